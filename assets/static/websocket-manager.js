@@ -21,6 +21,12 @@ class WebSocketManager {
         this.currentMessageId = null;
         this.isAutoPlaying = false;
         
+        // 摄像头画面
+        this.videoStream = null;
+        this.videoElement = null;
+        this.videoTimer = null;
+        this.videoFrameInterval = 2000; // 与服务端 vision.frame_interval 一致
+        
         // 对话流程管理
         this.ignoredMessageIds = new Set(); // 需要忽略的消息ID集合
         this.lastUserInputTime = null; // 最后一次用户输入时间
@@ -99,6 +105,22 @@ class WebSocketManager {
         this.vadEnabled = false;
         this.vadListening = false;
         
+        // 协议相关, 版本号与服务端 wss.ProtocolVersion 一致
+        this.protocolVersion = 2;
+        this.serverProtocolVersion = 1; // 服务端 hello 回复的协商版本
+        this.requestSeq = 0;
+        this.pendingRequests = new Map(); // request_id -> 消息类型, 收到 turn_end 或 error 后移除
+        this.protocolSchema = null; // /static/ws-protocol.json
+        this.currentTurn = null; // 进行中的一轮回复 {message_id, conversation_id}
+        
+        // 断线续接: hello 下发 resume_token, 重连后以 resume 补发 lastSeq 之后的事件
+        this.resumeToken = null;
+        this.lastSeq = 0;
+        this.resuming = false;
+        this.manualClose = false;
+        this.reconnectAttempts = 0;
+        this.reconnectTimer = null;
+        
         // 心跳相关
         this.pingInterval = null;
         this.lastPongTime = null;
@@ -113,7 +135,9 @@ class WebSocketManager {
             autoConnect: false,
             enableVAD: true,
             enableHeartbeat: true,
-            heartbeatInterval: 30000
+            heartbeatInterval: 30000,
+            autoReconnect: true,
+            maxReconnectAttempts: 5
         };
         
 
@@ -131,18 +155,39 @@ class WebSocketManager {
         };
     }
     
-    // 获取或生成用户ID
-    getUserId() {
-        let uid = localStorage.getItem('ai_companion_uid');
-        if (!uid) {
-            // 生成一个随机的用户ID
-            uid = 'uid_' + Math.random().toString(36).substr(2, 9) + '_' + Date.now().toString(36);
-            localStorage.setItem('ai_companion_uid', uid);
-            console.log('🆔 生成新的用户ID:', uid);
-        } else {
-            console.log('🆔 使用已保存的用户ID:', uid);
+    // 获取登录 token, 通过 bearer 子协议传给服务端
+    getAuthToken() {
+        return localStorage.getItem('ai_companion_token') || '';
+    }
+    
+    // 保存 /api/auth/* 返回的 token
+    saveAuthTokens(data) {
+        localStorage.setItem('ai_companion_token', data.access_token);
+        localStorage.setItem('ai_companion_refresh_token', data.refresh_token);
+    }
+    
+    // 确保有可用的 token: 优先用 refresh token 续期, 否则创建游客账号
+    async ensureAuthToken() {
+        const refreshToken = localStorage.getItem('ai_companion_refresh_token');
+        try {
+            const response = refreshToken
+                ? await fetch('/api/auth/refresh', {
+                    method: 'POST',
+                    headers: { 'Content-Type': 'application/json' },
+                    body: JSON.stringify({ refresh_token: refreshToken })
+                })
+                : await fetch('/api/auth/guest', { method: 'POST' });
+            if (response.ok) {
+                this.saveAuthTokens(await response.json());
+            } else if (refreshToken) {
+                // refresh token 失效, 重新创建游客账号
+                localStorage.removeItem('ai_companion_refresh_token');
+                return this.ensureAuthToken();
+            }
+        } catch (error) {
+            console.warn('⚠️ 获取登录 token 失败:', error);
         }
-        return uid;
+        return this.getAuthToken();
     }
     
     // 增强移动端音频解锁方法（纯Howler.js + 多重策略）
@@ -432,19 +477,19 @@ class WebSocketManager {
         const isHTTPS = location.protocol === 'https:';
         const hostname = location.hostname;
         const port = location.port || (isHTTPS ? '443' : '80');
-        const uid = this.getUserId();
         
         console.log('🌐 网络环境检测:', {
             isMobile,
             isHTTPS,
             hostname,
             protocol: location.protocol,
-            host: location.host,
-            uid: uid
+            host: location.host
         });
         
         const wsProtocol = isHTTPS ? 'wss:' : 'ws:';
-        const wsUrl = `${wsProtocol}//${hostname}:${port}/ws?uid=${uid}`;
+        // 上报时区, 提醒和问候按用户当地时间安排
+        const timezone = Intl.DateTimeFormat().resolvedOptions().timeZone || '';
+        const wsUrl = `${wsProtocol}//${hostname}:${port}/ws?tz=${encodeURIComponent(timezone)}&protocol_version=2`;
         console.log('🖥️ 桌面端使用默认连接:', wsUrl);
         return wsUrl;
     }
@@ -506,13 +551,17 @@ class WebSocketManager {
         
         const wsUrl = url || this.config.wsUrl;
         this.isConnecting = true;
+        this.manualClose = false;
         this.updateStatus('connecting');
         
         try {
-            this.ws = new WebSocket(wsUrl);
+            const token = await this.ensureAuthToken();
+            this.loadProtocolSchema();
+            this.ws = token ? new WebSocket(wsUrl, ['bearer', token]) : new WebSocket(wsUrl);
             
             this.ws.onopen = (event) => {
                 this.isConnecting = false;
+                this.reconnectAttempts = 0;
                 this.updateStatus('connected');
                 this.emit('connect', event);
                 this.initMicrophone();
@@ -530,6 +579,7 @@ class WebSocketManager {
                 this.updateStatus('disconnected');
                 this.stopHeartbeat();
                 this.emit('disconnect', event);
+                this.scheduleReconnect(event);
             };
             
             this.ws.onerror = (error) => {
@@ -547,8 +597,33 @@ class WebSocketManager {
         }
     }
     
+    // 非主动断开时重连, 重连后续接断开前的回复
+    scheduleReconnect(event) {
+        // 1008: token 过期或鉴权失败, 重连也无法恢复
+        if (this.manualClose || !this.config.autoReconnect || !this.resumeToken || event.code === 1008) {
+            return;
+        }
+        if (this.reconnectAttempts >= this.config.maxReconnectAttempts) {
+            console.warn('重连失败次数过多, 停止重连');
+            return;
+        }
+        const delay = Math.min(1000 * 2 ** this.reconnectAttempts, 10000);
+        this.reconnectAttempts += 1;
+        this.resuming = true;
+        this.reconnectTimer = setTimeout(() => {
+            this.reconnectTimer = null;
+            this.connect();
+        }, delay);
+    }
+    
     // 断开连接
     disconnect() {
+        this.manualClose = true;
+        this.resuming = false;
+        if (this.reconnectTimer) {
+            clearTimeout(this.reconnectTimer);
+            this.reconnectTimer = null;
+        }
         if (this.ws) {
             this.ws.close();
             this.ws = null;
@@ -564,10 +639,86 @@ class WebSocketManager {
         this.emit('statusChange', status);
     }
     
+    // 生成 request_id, 服务端对该消息的响应原样带回
+    nextRequestId(type) {
+        this.requestSeq += 1;
+        const requestId = `${Date.now().toString(36)}-${this.requestSeq}`;
+        this.pendingRequests.set(requestId, type);
+        return requestId;
+    }
+    
+    // 加载服务端事件的 JSON Schema, 用于发现前端未处理的事件类型
+    async loadProtocolSchema() {
+        if (this.protocolSchema) {
+            return;
+        }
+        try {
+            const response = await fetch('/static/ws-protocol.json');
+            if (response.ok) {
+                this.protocolSchema = await response.json();
+            }
+        } catch (error) {
+            console.warn('加载协议 schema 失败:', error);
+        }
+    }
+    
+    // 处理协议事件: 握手、确认、一轮回复的开始和结束、错误
+    handleProtocolEvent(messageData) {
+        if (this.protocolSchema && !this.protocolSchema.server[messageData.type]) {
+            console.warn('未知的服务端事件类型:', messageData.type);
+        }
+        if (typeof messageData.seq === 'number') {
+            this.lastSeq = messageData.seq;
+        }
+        
+        switch (messageData.type) {
+            case 'hello':
+                this.serverProtocolVersion = messageData.protocol_version;
+                if (this.resuming && this.resumeToken) {
+                    this.ws.send(JSON.stringify({
+                        type: 'resume',
+                        resume_token: this.resumeToken,
+                        last_seq: this.lastSeq
+                    }));
+                } else {
+                    this.resumeToken = messageData.resume_token || null;
+                    this.lastSeq = 0;
+                }
+                break;
+            case 'resumed':
+                // 之后的事件从 last_seq 继续编号; resumed 为 false 时由 last_turn 补齐断线期间的回复
+                this.resuming = false;
+                this.resumeToken = messageData.data.resume_token;
+                this.lastSeq = messageData.data.last_seq;
+                if (!messageData.data.resumed) {
+                    console.warn('续接的缓冲已过期, 使用最后一轮对话补齐');
+                }
+                break;
+            case 'turn_start':
+                this.currentTurn = messageData.data;
+                break;
+            case 'turn_end':
+                this.currentTurn = null;
+                this.pendingRequests.delete(messageData.request_id);
+                break;
+            case 'rate_limited':
+                this.pendingRequests.delete(messageData.request_id);
+                break;
+            case 'error':
+                this.pendingRequests.delete(messageData.request_id);
+                console.warn('服务端错误:', messageData.code, messageData.message);
+                if (messageData.code === 'unsupported_version') {
+                    this.emit('error', new Error(messageData.message));
+                }
+                break;
+        }
+    }
+    
     // 处理接收到的消息
     handleMessage(event) {
         try {
             const messageData = JSON.parse(event.data);
+            this.handleProtocolEvent(messageData);
             
             if (messageData.type === 'text') {
                 this.emit('message', {
@@ -584,6 +735,13 @@ class WebSocketManager {
                 
             } else if (messageData.type === 'pong') {
                 this.handlePongMessage(messageData);
+            } else if (messageData.type === 'auth_expiring') {
+                // token 即将过期, 续期后通知服务端
+                this.ensureAuthToken().then((token) => {
+                    if (token && this.isConnected()) {
+                        this.ws.send(JSON.stringify({ type: 'auth', token }));
+                    }
+                });
             }
             
             this.emit('message', {
@@ -612,6 +770,7 @@ class WebSocketManager {
         try {
             const message = {
                 type: 'text',
+                request_id: this.nextRequestId('text'),
                 data: text
             };
             
@@ -627,6 +786,15 @@ class WebSocketManager {
         }
     }
     
+    // 答复工具调用确认 (tool_confirm)
+    sendToolConfirm(id, approved) {
+        if (!this.isConnected()) {
+            return false;
+        }
+        this.ws.send(JSON.stringify({ type: 'tool_confirm', id, approved }));
+        return true;
+    }
+    
     // 发送音频
     async sendAudio() {
         if (!this.audioBlob || !this.isConnected()) {
@@ -639,6 +807,7 @@ class WebSocketManager {
                 const base64Data = reader.result.split(',')[1];
                 const audioMessage = {
                     type: 'audio',
+                    request_id: this.nextRequestId('audio'),
                     format: 'webm',
                     size: this.audioBlob.size,
                     data: base64Data
@@ -660,6 +829,62 @@ class WebSocketManager {
         }
     }
     
+    // 发送图片, image 为 data URL, text 为随图片发送的文字
+    sendImage(image, text = '') {
+        if (!this.isConnected()) {
+            this.emit('error', new Error('WebSocket未连接'));
+            return false;
+        }
+        
+        this.handleUserInput('image');
+        this.ws.send(JSON.stringify({ type: 'image', request_id: this.nextRequestId('image'), data: image, text }));
+        return true;
+    }
+    
+    // 开启摄像头并按间隔发送画面, 画面随下一条文本或语音消息一起交给模型
+    async startVideoFrames() {
+        if (this.videoTimer) {
+            return true;
+        }
+        try {
+            this.videoStream = await navigator.mediaDevices.getUserMedia({ video: { width: 640, height: 480 } });
+        } catch (error) {
+            console.error('❌ 摄像头开启失败:', error);
+            this.emit('error', error);
+            return false;
+        }
+        
+        this.videoElement = document.createElement('video');
+        this.videoElement.muted = true;
+        this.videoElement.playsInline = true;
+        this.videoElement.srcObject = this.videoStream;
+        await this.videoElement.play();
+        
+        const canvas = document.createElement('canvas');
+        this.videoTimer = setInterval(() => {
+            if (!this.isConnected() || !this.videoElement.videoWidth) {
+                return;
+            }
+            canvas.width = this.videoElement.videoWidth;
+            canvas.height = this.videoElement.videoHeight;
+            canvas.getContext('2d').drawImage(this.videoElement, 0, 0);
+            this.ws.send(JSON.stringify({ type: 'video_frame', data: canvas.toDataURL('image/jpeg', 0.7) }));
+        }, this.videoFrameInterval);
+        return true;
+    }
+    
+    stopVideoFrames() {
+        if (this.videoTimer) {
+            clearInterval(this.videoTimer);
+            this.videoTimer = null;
+        }
+        if (this.videoStream) {
+            this.videoStream.getTracks().forEach(track => track.stop());
+            this.videoStream = null;
+        }
+        this.videoElement = null;
+    }
+    
     // 检查连接状态
     isConnected() {
         return this.ws && this.ws.readyState === WebSocket.OPEN;
@@ -1433,6 +1658,7 @@ class WebSocketManager {
     // 销毁实例
     destroy() {
         this.disconnect();
+        this.stopVideoFrames();
         if (this.mediaStream) {
             this.mediaStream.getTracks().forEach(track => track.stop());
         }
@@ -1,7 +1,20 @@
+CREATE TABLE companion_user (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  email TEXT DEFAULT NULL UNIQUE, -- 游客为 NULL
+  password_hash TEXT NOT NULL DEFAULT '',
+  nickname TEXT NOT NULL DEFAULT '',
+  is_guest INTEGER NOT NULL DEFAULT 0,
+  is_adult INTEGER NOT NULL DEFAULT 0, -- 已通过年龄验证
+  status INTEGER NOT NULL DEFAULT 1,
+  token_version INTEGER NOT NULL DEFAULT 0,
+  created_at DATETIME NOT NULL DEFAULT (datetime('now', 'localtime')),
+  updated_at DATETIME NOT NULL DEFAULT (datetime('now', 'localtime'))
+);
+
 CREATE TABLE companion_conversation (
   id INTEGER PRIMARY KEY AUTOINCREMENT,
-  uid INTEGER NOT NULL DEFAULT 0,
-  conversation_id TEXT NOT NULL DEFAULT '',
+  uid INTEGER NOT NULL DEFAULT 0, -- companion_user.id
+  conversation_id TEXT NOT NULL DEFAULT '' UNIQUE, -- 软删除的会话仍占用 id
   title TEXT NOT NULL DEFAULT '',
   is_deleted INTEGER NOT NULL DEFAULT 0,
   created_at DATETIME NOT NULL DEFAULT (datetime('now', 'localtime')),
@@ -16,5 +29,87 @@ CREATE TABLE companion_message (
   created_at DATETIME NOT NULL DEFAULT (datetime('now', 'localtime'))
 );
 
+CREATE TABLE companion_character (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  name TEXT NOT NULL DEFAULT '' UNIQUE,
+  description TEXT NOT NULL DEFAULT '',
+  instructions TEXT DEFAULT NULL,
+  romance_prompt TEXT DEFAULT NULL, -- 为空时使用内置提示词
+  action_prompt TEXT DEFAULT NULL,
+  image TEXT NOT NULL DEFAULT '',
+  voice TEXT NOT NULL DEFAULT '',
+  options TEXT DEFAULT NULL,
+  node_options TEXT DEFAULT NULL,
+  adult INTEGER NOT NULL DEFAULT 0, -- 允许成人内容
+  status INTEGER NOT NULL DEFAULT 1,
+  created_at DATETIME NOT NULL DEFAULT (datetime('now', 'localtime')),
+  updated_at DATETIME NOT NULL DEFAULT (datetime('now', 'localtime'))
+);
+
+CREATE TABLE companion_relationship (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  uid TEXT NOT NULL DEFAULT '', -- companion_user.id
+  character_name TEXT NOT NULL DEFAULT '',
+  romance INTEGER NOT NULL DEFAULT 0,
+  created_at DATETIME NOT NULL DEFAULT (datetime('now', 'localtime')),
+  updated_at DATETIME NOT NULL DEFAULT (datetime('now', 'localtime')),
+  UNIQUE (uid, character_name)
+);
+
+CREATE TABLE companion_usage (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  uid TEXT NOT NULL DEFAULT '', -- companion_user.id
+  conversation_id TEXT NOT NULL DEFAULT '',
+  message_id TEXT NOT NULL DEFAULT '',
+  kind TEXT NOT NULL DEFAULT '',
+  task TEXT NOT NULL DEFAULT '',
+  provider TEXT NOT NULL DEFAULT '',
+  model TEXT NOT NULL DEFAULT '',
+  prompt_tokens INTEGER NOT NULL DEFAULT 0,
+  completion_tokens INTEGER NOT NULL DEFAULT 0,
+  audio_seconds REAL NOT NULL DEFAULT 0,
+  characters INTEGER NOT NULL DEFAULT 0,
+  cost REAL NOT NULL DEFAULT 0,
+  created_at DATETIME NOT NULL DEFAULT (datetime('now', 'localtime'))
+);
+
+CREATE INDEX idx_usage_uid_created ON companion_usage (uid, created_at);
+
+CREATE TABLE companion_moderation (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  uid TEXT NOT NULL DEFAULT '', -- companion_user.id
+  conversation_id TEXT NOT NULL DEFAULT '',
+  message_id TEXT NOT NULL DEFAULT '',
+  character_name TEXT NOT NULL DEFAULT '',
+  stage TEXT NOT NULL DEFAULT '', -- input | output
+  provider TEXT NOT NULL DEFAULT '',
+  categories TEXT DEFAULT NULL,
+  action TEXT NOT NULL DEFAULT '',
+  text TEXT DEFAULT NULL,
+  created_at DATETIME NOT NULL DEFAULT (datetime('now', 'localtime'))
+);
+
+CREATE INDEX idx_moderation_uid_created ON companion_moderation (uid, created_at);
+
+CREATE TABLE companion_reminder (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  uid TEXT NOT NULL DEFAULT '', -- companion_user.id
+  character_name TEXT NOT NULL DEFAULT '',
+  conversation_id TEXT NOT NULL DEFAULT '',
+  kind TEXT NOT NULL DEFAULT '', -- reminder | checkin
+  name TEXT NOT NULL DEFAULT '', -- 问候的配置名称
+  content TEXT DEFAULT NULL,
+  timezone TEXT NOT NULL DEFAULT '',
+  status TEXT NOT NULL DEFAULT '', -- pending | sending | queued | delivered | canceled | expired
+  due_at DATETIME NOT NULL,
+  expire_at DATETIME DEFAULT NULL,
+  delivered_at DATETIME DEFAULT NULL,
+  created_at DATETIME NOT NULL DEFAULT (datetime('now', 'localtime')),
+  updated_at DATETIME NOT NULL DEFAULT (datetime('now', 'localtime'))
+);
+
+CREATE INDEX idx_reminder_status_due ON companion_reminder (status, due_at);
+CREATE INDEX idx_reminder_uid_status ON companion_reminder (uid, status);
+
 
 -- 一行命令构建 sqlite.db: sqlite3 companion.db < docs/db_sqlite.sql
@@ -1,7 +1,9 @@
 package hook
 
 import (
+	"encoding/json"
 	"errors"
+	"fmt"
 	"net/http"
 
 	"github.com/daodao97/xgo/xadmin"
@@ -12,6 +14,32 @@ func RegHook() {
 	xadmin.RegBeforeUpdate("operator", OperatorBeforeUpdateHook)
 	xadmin.RegBeforeCreate("operator", OperatorBeforeCreateHook)
 	xadmin.RegAfterGet("operator", OperatorAfterGetHook)
+
+	xadmin.RegBeforeCreate("companion_character", CharacterBeforeSaveHook)
+	xadmin.RegBeforeUpdate("companion_character", CharacterBeforeSaveHook)
+
+	xadmin.RegAfterGet("companion_user", UserAfterGetHook)
+}
+
+// CharacterBeforeSaveHook 校验角色的采样参数是合法的 JSON 对象
+func CharacterBeforeSaveHook(r *http.Request, data xdb.Record) (xdb.Record, error) {
+	for _, field := range []string{"options", "node_options"} {
+		value := data.GetString(field)
+		if value == "" {
+			continue
+		}
+		var obj map[string]any
+		if err := json.Unmarshal([]byte(value), &obj); err != nil {
+			return nil, fmt.Errorf("%s 不是合法的 JSON 对象: %w", field, err)
+		}
+	}
+	return data, nil
+}
+
+// UserAfterGetHook 不向后台返回密码哈希
+func UserAfterGetHook(r *http.Request, record xdb.Record) xdb.Record {
+	delete(record, "password_hash")
+	return record
 }
 
 func OperatorBeforeCreateHook(r *http.Request, createData xdb.Record) (xdb.Record, error) {
@@ -1,10 +1,14 @@
 package admin
 
 import (
-	"embed"
 	"companions/internal/admin/hook"
+	"companions/internal/conf"
+	"crypto/rand"
+	"embed"
+	"encoding/hex"
 
 	"github.com/daodao97/xgo/xadmin"
+	"github.com/daodao97/xgo/xlog"
 	"github.com/gin-gonic/gin"
 )
 
@@ -15,15 +19,17 @@ var routes string
 var schema embed.FS
 
 func SetupRouter(e *gin.Engine) {
+	adminConf := conf.Get().Admin
+
 	xadmin.SetRoutes(routes)
 	xadmin.InitSchema(schema)
-	xadmin.SetAdminPath("/_")
+	xadmin.SetAdminPath(adminConf.Path)
 	xadmin.SetJwt(&xadmin.JwtConf{
-		Secret:      "xtpl_admin_jwt_secret",
-		TokenExpire: 3600,
+		Secret:      adminSecret(adminConf.JwtSecret),
+		TokenExpire: int64(adminConf.TokenExpire),
 	})
 	xadmin.SetWebSite(map[string]any{
-		"title": "xtpl",
+		"title": adminConf.Title,
 	})
 	hook.RegHook()
 
@@ -31,3 +37,17 @@ func SetupRouter(e *gin.Engine) {
 
 	// 自定义路由
 }
+
+// adminSecret 未配置密钥时随机生成, 重启后需要重新登录后台
+func adminSecret(secret string) string {
+	if secret != "" {
+		if secret == conf.Get().JwtSecret {
+			xlog.Warn("admin.jwt_secret 与 jwt_secret 相同, 用户 token 可能被当作后台 token 使用")
+		}
+		return secret
+	}
+	xlog.Warn("未配置 admin.jwt_secret, 使用随机密钥")
+	b := make([]byte, 32)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,160 @@
+package api
+
+import (
+	"companions/internal/auth"
+	"companions/internal/conf"
+	"companions/internal/dao"
+	"companions/internal/pkg/xuser"
+	"errors"
+	"net/http"
+
+	"github.com/daodao97/xgo/xlog"
+	"github.com/gin-gonic/gin"
+)
+
+type credentialsRequest struct {
+	Email    string `json:"email"`
+	Password string `json:"password"`
+	Nickname string `json:"nickname"`
+}
+
+type refreshRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+// Register 邮箱密码注册, 成功后直接返回 token
+func Register(c *gin.Context) {
+	var req credentialsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	user, err := xuser.Register(dao.Users, req.Email, req.Password, req.Nickname)
+	if err != nil {
+		accountError(c, err)
+		return
+	}
+	respondTokens(c, user)
+}
+
+// Login 邮箱密码登录
+func Login(c *gin.Context) {
+	var req credentialsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	user, err := xuser.Login(dao.Users, req.Email, req.Password)
+	if err != nil {
+		accountError(c, err)
+		return
+	}
+	respondTokens(c, user)
+}
+
+// Guest 创建游客账号, 之后可以通过 /api/auth/upgrade 绑定邮箱
+func Guest(c *gin.Context) {
+	if !conf.Get().Account.AllowGuest {
+		c.JSON(http.StatusForbidden, gin.H{"error": "guest accounts are disabled"})
+		return
+	}
+	user, err := xuser.CreateGuest(dao.Users)
+	if err != nil {
+		accountError(c, err)
+		return
+	}
+	respondTokens(c, user)
+}
+
+// RefreshToken 用 refresh token 换取新的 token
+func RefreshToken(c *gin.Context) {
+	var req refreshRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	uid, version, err := auth.ParseRefreshToken(req.RefreshToken)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+	user, err := xuser.Get(dao.Users, uid)
+	if err != nil {
+		accountError(c, err)
+		return
+	}
+	if user.TokenVersion != version {
+		// 已退出登录
+		c.JSON(http.StatusUnauthorized, gin.H{"error": auth.ErrTokenInvalid.Error()})
+		return
+	}
+	respondTokens(c, user)
+}
+
+// Logout 退出登录, 当前用户已签发的 refresh token 全部失效, access token 在过期前仍然有效
+func Logout(c *gin.Context) {
+	if err := xuser.Logout(dao.Users, auth.GetUID(c)); err != nil {
+		accountError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "ok"})
+}
+
+// UpgradeGuest 游客账号绑定邮箱和密码, uid 不变
+func UpgradeGuest(c *gin.Context) {
+	var req credentialsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	user, err := xuser.Upgrade(dao.Users, auth.GetUID(c), req.Email, req.Password)
+	if err != nil {
+		accountError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"user": user})
+}
+
+// Me 当前用户信息
+func Me(c *gin.Context) {
+	user, err := xuser.Get(dao.Users, auth.GetUID(c))
+	if err != nil {
+		accountError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"user": user})
+}
+
+func respondTokens(c *gin.Context, user *xuser.User) {
+	tokens, err := auth.IssueTokens(user.ID, user.TokenVersion)
+	if err != nil {
+		accountError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"user":          user,
+		"access_token":  tokens.AccessToken,
+		"refresh_token": tokens.RefreshToken,
+		"token_type":    tokens.TokenType,
+		"expires_in":    tokens.ExpiresIn,
+	})
+}
+
+func accountError(c *gin.Context, err error) {
+	status := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, xuser.ErrInvalidEmail), errors.Is(err, xuser.ErrWeakPassword), errors.Is(err, xuser.ErrNotGuest):
+		status = http.StatusBadRequest
+	case errors.Is(err, xuser.ErrInvalidCredentials):
+		status = http.StatusUnauthorized
+	case errors.Is(err, xuser.ErrUserDisabled):
+		status = http.StatusForbidden
+	case errors.Is(err, xuser.ErrUserNotFound):
+		status = http.StatusNotFound
+	case errors.Is(err, xuser.ErrEmailTaken):
+		status = http.StatusConflict
+	default:
+		xlog.ErrorC(c.Request.Context(), "账号操作失败", xlog.Err(err))
+	}
+	c.JSON(status, gin.H{"error": err.Error()})
+}
@@ -0,0 +1,82 @@
+package api
+
+import (
+	"companions/internal/auth"
+	"companions/internal/conf"
+	"companions/internal/dao"
+	"companions/internal/pkg/xuser"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/daodao97/xgo/xapp"
+	"github.com/gin-gonic/gin"
+)
+
+func TestMain(m *testing.M) {
+	gin.SetMode(gin.TestMode)
+	dir, err := os.MkdirTemp("", "api")
+	if err != nil {
+		panic(err)
+	}
+	defer os.RemoveAll(dir)
+	if err := os.WriteFile(filepath.Join(dir, "conf.yaml"), []byte("jwt_secret: test_secret\n"), 0o644); err != nil {
+		panic(err)
+	}
+	xapp.SetConfDir(dir)
+	if err := conf.InitConf(); err != nil {
+		panic(err)
+	}
+	os.Exit(m.Run())
+}
+
+// TestRefreshAfterLogout 退出登录后 token 版本递增, 之前签发的 refresh token 不能再换取新 token
+func TestRefreshAfterLogout(t *testing.T) {
+	dao.Users = xuser.NewInMemory()
+	user, err := xuser.Register(dao.Users, "ani@example.com", "password123", "ani")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tokens, err := auth.IssueTokens(user.ID, user.TokenVersion)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	w := refresh(tokens.RefreshToken)
+	if w.Code != http.StatusOK {
+		t.Fatalf("refresh status = %d, body = %s", w.Code, w.Body)
+	}
+	var resp struct {
+		RefreshToken string `json:"refresh_token"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil || resp.RefreshToken == "" {
+		t.Fatalf("refresh body = %s, err = %v", w.Body, err)
+	}
+
+	if err := xuser.Logout(dao.Users, user.ID); err != nil {
+		t.Fatal(err)
+	}
+	for _, token := range []string{tokens.RefreshToken, resp.RefreshToken} {
+		if w := refresh(token); w.Code != http.StatusUnauthorized {
+			t.Errorf("refresh after logout status = %d, want 401", w.Code)
+		}
+	}
+
+	// access token 不能用于刷新
+	if w := refresh(tokens.AccessToken); w.Code != http.StatusUnauthorized {
+		t.Errorf("refresh with access token status = %d, want 401", w.Code)
+	}
+}
+
+func refresh(token string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodPost, "/api/auth/refresh", strings.NewReader(`{"refresh_token":"`+token+`"}`))
+	c.Request.Header.Set("Content-Type", "application/json")
+	RefreshToken(c)
+	return w
+}
@@ -0,0 +1,135 @@
+package api
+
+import (
+	"companions/internal/auth"
+	"companions/internal/companion"
+	"companions/internal/conf"
+	"companions/internal/dao"
+	"companions/internal/pkg/xagent"
+	"companions/internal/pkg/xusage"
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/daodao97/xgo/xlog"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// chatRequest POST /api/chat 的请求体
+type chatRequest struct {
+	Message        string `json:"message"`
+	Character      string `json:"character"`       // 为空时使用默认角色
+	ConversationID string `json:"conversation_id"` // 为空时创建新会话
+	Timezone       string `json:"timezone"`        // IANA 时区, 用于设置提醒
+	Stream         *bool  `json:"stream"`          // 默认 true, false 时等本轮结束后返回 JSON
+}
+
+// executeChat 启动一轮对话, 测试中替换为固定的消息流
+var executeChat = func(ctx context.Context, opts companion.Options, text string) (chan xagent.Message, error) {
+	return companion.NewAgent(opts).Execute(ctx, companion.Input(opts, text, nil))
+}
+
+// Chat 与 WebSocket 相同的对话流程, 以 SSE 推送文本、音频、好感度和动作, 或在 stream=false 时一次返回
+// 需要确认的工具没有交互渠道, 按拒绝处理
+func Chat(c *gin.Context) {
+	var req chatRequest
+	if err := c.ShouldBindJSON(&req); err != nil || strings.TrimSpace(req.Message) == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "message is required"})
+		return
+	}
+	uid := auth.GetUID(c)
+
+	if retryAfter, err := checkQuota(c, uid); err != nil {
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": err.Error(), "retry_after": retryAfter})
+		return
+	}
+
+	conversationID := req.ConversationID
+	if conversationID != "" {
+		conv, err := dao.Memory.Find(conversationID)
+		if err != nil || conv.Uid != uid {
+			c.JSON(http.StatusNotFound, gin.H{"error": "conversation not found"})
+			return
+		}
+	} else {
+		conversationID = uuid.New().String()
+		if err := dao.Memory.Create(conversationID, uid, ""); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	opts := companion.Options{
+		UID:            uid,
+		Character:      req.Character,
+		ConversationID: conversationID,
+		Location:       companion.Location(req.Timezone),
+	}
+	// 客户端断开后本轮对话继续完成并写入记忆, 与 WebSocket 一致
+	ctx := context.Background()
+	stream, err := executeChat(ctx, opts, req.Message)
+	if err != nil {
+		xlog.ErrorC(ctx, "启动工作流失败", xlog.Err(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "工作流启动失败"})
+		return
+	}
+
+	if req.Stream != nil && !*req.Stream {
+		reply := &companion.Reply{ConversationID: conversationID}
+		m := xagent.NewMessageProcessor()
+		for msg := range stream {
+			if m.ShouldSend(msg) {
+				reply.Add(msg)
+			}
+		}
+		c.JSON(http.StatusOK, gin.H{"data": reply.Done()})
+		return
+	}
+	streamChat(c, stream, conversationID)
+}
+
+// streamChat 以 SSE 推送消息流, 先推送 conversation, 最后推送 done
+// 客户端断开后继续读取消息流直到结束, 避免工作流阻塞
+func streamChat(c *gin.Context, stream chan xagent.Message, conversationID string) {
+	w := newSSEWriter(c)
+	m := xagent.NewMessageProcessor()
+	write := func(event companion.Event) {
+		w.write(m.ToSSEEvent(event.Type, event.Data))
+	}
+
+	write(companion.Event{Type: companion.EventConversation, Data: map[string]any{"conversation_id": conversationID}})
+	messageID := ""
+	for msg := range stream {
+		if !m.ShouldSend(msg) {
+			continue
+		}
+		event, ok := companion.ToEvent(msg)
+		if !ok {
+			continue
+		}
+		if id, _ := event.Data["message_id"].(string); id != "" {
+			messageID = id
+		}
+		write(event)
+	}
+	write(companion.Event{Type: companion.EventDone, Data: map[string]any{"message_id": messageID, "conversation_id": conversationID}})
+}
+
+// checkQuota 用户超出当日配额时设置 Retry-After 并返回距离重置的秒数, 由调用方按接口格式写入错误
+// 配额检查本身失败时放行
+func checkQuota(c *gin.Context, uid string) (int, error) {
+	err := xusage.CheckQuota(dao.Usage, uid, conf.Get().Usage.Quota)
+	if errors.Is(err, xusage.ErrQuotaExceeded) {
+		retryAfter := int(xusage.UntilReset(time.Now()).Seconds())
+		c.Header("Retry-After", strconv.Itoa(retryAfter))
+		return retryAfter, err
+	}
+	if err != nil {
+		xlog.ErrorC(c.Request.Context(), "用量配额检查失败", xlog.Err(err))
+	}
+	return 0, nil
+}
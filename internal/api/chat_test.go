@@ -0,0 +1,113 @@
+package api
+
+import (
+	"companions/internal/auth"
+	"companions/internal/character"
+	"companions/internal/companion"
+	"companions/internal/dao"
+	"companions/internal/pkg/xagent"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/daodao97/xgo/xdb"
+	"github.com/gin-gonic/gin"
+)
+
+// fakeChat 用固定的消息流代替工作流
+func fakeChat(t *testing.T) {
+	t.Helper()
+	useMemory(t)
+	execute := executeChat
+	executeChat = func(ctx context.Context, opts companion.Options, text string) (chan xagent.Message, error) {
+		stream := make(chan xagent.Message, 4)
+		stream <- &xagent.BaseMessage{Content: "你好呀", MessageID: "m1"}
+		stream <- &xagent.BaseMessage{Content: "不发送", MessageID: "m1", Metadata: xagent.MessageMetadata{Hidden: true}}
+		stream <- character.NewRomanceMessage(60)
+		close(stream)
+		return stream, nil
+	}
+	t.Cleanup(func() { executeChat = execute })
+}
+
+func postChat(uid string, body string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodPost, "/api/chat", strings.NewReader(body))
+	c.Request.Header.Set("Content-Type", "application/json")
+	c.Request = c.Request.WithContext(auth.WithAuth(c.Request.Context(), xdb.Record{"uid": uid}))
+	Chat(c)
+	return w
+}
+
+func TestChatStream(t *testing.T) {
+	fakeChat(t)
+	w := postChat("u1", `{"message": "你好"}`)
+	if w.Code != http.StatusOK || w.Header().Get("Content-Type") != "text/event-stream" {
+		t.Fatalf("status = %d, content-type = %s", w.Code, w.Header().Get("Content-Type"))
+	}
+
+	// 每个事件为 event 和 data 两行, 以空行分隔; 隐藏的消息不发送
+	frames := strings.Split(strings.TrimSuffix(w.Body.String(), "\n\n"), "\n\n")
+	var types []string
+	var done map[string]any
+	for _, frame := range frames {
+		lines := strings.Split(frame, "\n")
+		if len(lines) != 2 || !strings.HasPrefix(lines[0], "event: ") || !strings.HasPrefix(lines[1], "data: ") {
+			t.Fatalf("frame = %q", frame)
+		}
+		typ := strings.TrimPrefix(lines[0], "event: ")
+		types = append(types, typ)
+		if typ == companion.EventDone {
+			if err := json.Unmarshal([]byte(strings.TrimPrefix(lines[1], "data: ")), &done); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	want := []string{companion.EventConversation, companion.EventText, companion.EventRomance, companion.EventDone}
+	if strings.Join(types, ",") != strings.Join(want, ",") {
+		t.Errorf("events = %v, want %v", types, want)
+	}
+	if done["message_id"] != "m1" || done["conversation_id"] == "" {
+		t.Errorf("done = %v", done)
+	}
+}
+
+func TestChatJSON(t *testing.T) {
+	fakeChat(t)
+	w := postChat("u1", `{"message": "你好", "stream": false}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, body = %s", w.Code, w.Body)
+	}
+	var resp struct {
+		Data companion.Reply `json:"data"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.Data.Text != "你好呀" || resp.Data.MessageID != "m1" || resp.Data.Romance == nil || *resp.Data.Romance != 60 {
+		t.Errorf("reply = %+v", resp.Data)
+	}
+	// 未指定会话时创建新会话
+	if conv, err := dao.Memory.Find(resp.Data.ConversationID); err != nil || conv.Uid != "u1" {
+		t.Errorf("conversation = %+v, err = %v", conv, err)
+	}
+}
+
+func TestChatConversationNotOwned(t *testing.T) {
+	fakeChat(t)
+	if err := dao.Memory.Create("c1", "u2", ""); err != nil {
+		t.Fatal(err)
+	}
+	for _, id := range []string{"c1", "missing"} {
+		if w := postChat("u1", `{"message": "你好", "conversation_id": "`+id+`"}`); w.Code != http.StatusNotFound {
+			t.Errorf("%s: status = %d, want 404", id, w.Code)
+		}
+	}
+	if w := postChat("u1", `{"message": " "}`); w.Code != http.StatusBadRequest {
+		t.Errorf("empty message status = %d, want 400", w.Code)
+	}
+}
@@ -0,0 +1,150 @@
+package api
+
+import (
+	"companions/internal/auth"
+	"companions/internal/dao"
+	"companions/internal/pkg/xmem"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/spf13/cast"
+)
+
+const (
+	defaultPageSize = 20
+	maxPageSize     = 100
+)
+
+// ownConversation 获取会话并校验归属, 失败时直接写入响应
+func ownConversation(c *gin.Context, mem xmem.Memory) (*xmem.Conversation, bool) {
+	conv, err := mem.Find(c.Param("id"))
+	if err != nil || conv.Uid != auth.GetUID(c) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "conversation not found"})
+		return nil, false
+	}
+	return conv, true
+}
+
+// ListConversations 获取当前用户的会话列表
+func ListConversations(c *gin.Context) {
+	list, err := dao.Memory.List(auth.GetUID(c))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": list})
+}
+
+// ListMessages 按游标分页获取会话消息, 从最新的消息往前翻页
+// query: cursor 上一页返回的 next_cursor, limit 每页条数, 默认 20, 最大 100
+func ListMessages(c *gin.Context) {
+	mem := dao.Memory
+	conv, ok := ownConversation(c, mem)
+	if !ok {
+		return
+	}
+
+	limit := cast.ToInt(c.DefaultQuery("limit", cast.ToString(defaultPageSize)))
+	if limit <= 0 {
+		limit = defaultPageSize
+	}
+	limit = min(limit, maxPageSize)
+
+	messages, nextCursor, err := mem.Messages(conv.Id, cast.ToInt64(c.Query("cursor")), limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"data":        messages,
+		"next_cursor": nextCursor,
+		"has_more":    nextCursor > 0,
+	})
+}
+
+// GetTurn 获取一轮对话及其音频/动作元信息
+func GetTurn(c *gin.Context) {
+	mem := dao.Memory
+	conv, ok := ownConversation(c, mem)
+	if !ok {
+		return
+	}
+
+	turn, err := mem.Turn(conv.Id, c.Param("message_id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "message not found"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": turn})
+}
+
+// DeleteTurn 永久删除一轮对话, 消息不存在时返回 404
+func DeleteTurn(c *gin.Context) {
+	mem := dao.Memory
+	conv, ok := ownConversation(c, mem)
+	if !ok {
+		return
+	}
+
+	if err := mem.DeleteTurn(conv.Id, c.Param("message_id")); err != nil {
+		if errors.Is(err, xmem.ErrNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "message not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": true})
+}
+
+// ExportConversation 导出会话, format 支持 json (默认) 和 markdown
+func ExportConversation(c *gin.Context) {
+	mem := dao.Memory
+	conv, ok := ownConversation(c, mem)
+	if !ok {
+		return
+	}
+
+	full, err := mem.Get(conv.Id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	filename := "conversation-" + conv.Id
+	switch c.DefaultQuery("format", "json") {
+	case "json":
+		c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s.json"`, filename))
+		c.JSON(http.StatusOK, full)
+	case "markdown", "md":
+		c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s.md"`, filename))
+		c.Data(http.StatusOK, "text/markdown; charset=utf-8", []byte(toMarkdown(full)))
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "unsupported format"})
+	}
+}
+
+func toMarkdown(conv *xmem.Conversation) string {
+	var b strings.Builder
+	title := conv.Title
+	if title == "" {
+		title = conv.Id
+	}
+	fmt.Fprintf(&b, "# %s\n\n", title)
+	fmt.Fprintf(&b, "> %s\n\n", conv.CreatedAt)
+
+	for _, group := range conv.Messages {
+		msgs, _ := group.([]map[string]any)
+		for _, msg := range msgs {
+			role := cast.ToString(msg["role"])
+			if role != "user" && role != "assistant" {
+				continue
+			}
+			fmt.Fprintf(&b, "**%s**: %s\n\n", role, cast.ToString(msg["content"]))
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,183 @@
+package api
+
+import (
+	"companions/internal/auth"
+	"companions/internal/dao"
+	"companions/internal/pkg/xagent"
+	"companions/internal/pkg/xmem"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/daodao97/xgo/xdb"
+	"github.com/gin-gonic/gin"
+)
+
+func TestToMarkdown(t *testing.T) {
+	conv := &xmem.Conversation{
+		Id:        "c1",
+		Title:     "初次见面",
+		CreatedAt: "2025-07-01 12:00:00",
+		Messages: []any{
+			[]map[string]any{
+				{"role": "user", "content": "hi"},
+				{"role": "assistant", "content": "hey you"},
+				{"role": "meta", "extra": map[string]any{"romance": 1}},
+			},
+		},
+	}
+
+	want := "# 初次见面\n\n> 2025-07-01 12:00:00\n\n**user**: hi\n\n**assistant**: hey you\n\n"
+	if got := toMarkdown(conv); got != want {
+		t.Errorf("toMarkdown() = %q, want %q", got, want)
+	}
+}
+
+// useMemory 测试期间使用进程内记忆存储, 结束后恢复原来的存储
+func useMemory(t *testing.T) *xmem.InMemory {
+	t.Helper()
+	m := xmem.NewInMemory()
+	setMemory(t, m)
+	return m
+}
+
+// setMemory 替换 dao.Memory, 测试结束后恢复
+func setMemory(t *testing.T, m xmem.Memory) {
+	t.Helper()
+	prev := dao.Memory
+	dao.Memory = m
+	t.Cleanup(func() { dao.Memory = prev })
+}
+
+// serve 以 uid 的身份通过路由调用 handler, route 为注册的路径
+func serve(uid string, method string, route string, target string, handler gin.HandlerFunc) *httptest.ResponseRecorder {
+	r := gin.New()
+	r.Handle(method, route, func(c *gin.Context) {
+		c.Request = c.Request.WithContext(auth.WithAuth(c.Request.Context(), xdb.Record{"uid": uid}))
+		handler(c)
+	})
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(method, target, nil))
+	return w
+}
+
+// insertTurns 写入 n 轮对话, 每轮包含用户、回复和元信息记录
+func insertTurns(t *testing.T, m xmem.Memory, convId string, n int) {
+	t.Helper()
+	for i := 1; i <= n; i++ {
+		id := fmt.Sprintf("t%d", i)
+		if err := m.Insert(convId, []xagent.Message{
+			xagent.NewMessage().Role(xagent.MessageRoleUser).ID(id).Content("hi " + id).Storage(true).Build(),
+			xagent.NewMessage().Role(xagent.MessageRoleAssistant).ID(id).Content("hey " + id).Storage(true).Build(),
+			xagent.NewMetaMessage(id, map[string]any{}),
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestConversationOwnership(t *testing.T) {
+	m := useMemory(t)
+	_ = m.Create("c1", "u1", "初次见面")
+	insertTurns(t, m, "c1", 1)
+
+	tests := []struct {
+		method  string
+		route   string
+		target  string
+		handler gin.HandlerFunc
+	}{
+		{http.MethodGet, "/conversations/:id/messages", "/conversations/c1/messages", ListMessages},
+		{http.MethodGet, "/conversations/:id/messages/:message_id", "/conversations/c1/messages/t1", GetTurn},
+		{http.MethodDelete, "/conversations/:id/messages/:message_id", "/conversations/c1/messages/t1", DeleteTurn},
+		{http.MethodGet, "/conversations/:id/export", "/conversations/c1/export", ExportConversation},
+	}
+	// 其他用户的会话返回 404, 不泄露会话是否存在
+	for _, tt := range tests {
+		if w := serve("u2", tt.method, tt.route, tt.target, tt.handler); w.Code != http.StatusNotFound {
+			t.Errorf("%s %s by other user: status = %d, want 404", tt.method, tt.target, w.Code)
+		}
+	}
+	for _, tt := range tests {
+		if w := serve("u1", tt.method, tt.route, tt.target, tt.handler); w.Code != http.StatusOK {
+			t.Errorf("%s %s by owner: status = %d, body = %s", tt.method, tt.target, w.Code, w.Body)
+		}
+	}
+	// 删除后再次删除同一轮返回 404
+	if w := serve("u1", http.MethodDelete, tests[2].route, tests[2].target, DeleteTurn); w.Code != http.StatusNotFound {
+		t.Errorf("delete missing turn: status = %d, want 404", w.Code)
+	}
+}
+
+func TestListMessagesPaging(t *testing.T) {
+	m := useMemory(t)
+	_ = m.Create("c1", "u1", "")
+	insertTurns(t, m, "c1", 3)
+
+	type page struct {
+		Data       []map[string]any `json:"data"`
+		NextCursor int64            `json:"next_cursor"`
+		HasMore    bool             `json:"has_more"`
+	}
+	get := func(query string) page {
+		t.Helper()
+		w := serve("u1", http.MethodGet, "/conversations/:id/messages", "/conversations/c1/messages"+query, ListMessages)
+		var p page
+		if err := json.Unmarshal(w.Body.Bytes(), &p); err != nil || w.Code != http.StatusOK {
+			t.Fatalf("status = %d, body = %s", w.Code, w.Body)
+		}
+		return p
+	}
+
+	// 从最新的消息往前翻页, 元信息记录不计入 limit
+	var contents []string
+	p := get("?limit=4")
+	for {
+		var batch []string
+		for _, msg := range p.Data {
+			batch = append(batch, msg["content"].(string))
+		}
+		contents = append(batch, contents...)
+		if !p.HasMore {
+			break
+		}
+		p = get(fmt.Sprintf("?limit=4&cursor=%d", p.NextCursor))
+	}
+	want := "hi t1,hey t1,hi t2,hey t2,hi t3,hey t3"
+	if got := strings.Join(contents, ","); got != want {
+		t.Errorf("messages = %s, want %s", got, want)
+	}
+
+	// 超出上限时按上限返回, 不合法时使用默认值
+	insertTurns(t, m, "c1", 60)
+	if p := get("?limit=500"); len(p.Data) != maxPageSize || !p.HasMore {
+		t.Errorf("limit=500: %d messages, has_more = %v", len(p.Data), p.HasMore)
+	}
+	if p := get("?limit=-1"); len(p.Data) != defaultPageSize {
+		t.Errorf("limit=-1: %d messages", len(p.Data))
+	}
+}
+
+func TestDeletedConversation(t *testing.T) {
+	m := useMemory(t)
+	_ = m.Create("c1", "u1", "")
+	_ = m.Create("c2", "u1", "")
+	insertTurns(t, m, "c1", 1)
+	if err := m.Delete("c1"); err != nil {
+		t.Fatal(err)
+	}
+
+	w := serve("u1", http.MethodGet, "/conversations", "/conversations", ListConversations)
+	var list struct {
+		Data []xmem.Conversation `json:"data"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &list); err != nil || len(list.Data) != 1 || list.Data[0].Id != "c2" {
+		t.Errorf("conversations = %s", w.Body)
+	}
+	if w := serve("u1", http.MethodGet, "/conversations/:id/messages", "/conversations/c1/messages", ListMessages); w.Code != http.StatusNotFound {
+		t.Errorf("messages of deleted conversation: status = %d, want 404", w.Code)
+	}
+}
@@ -0,0 +1,359 @@
+package api
+
+import (
+	"companions/internal/auth"
+	"companions/internal/character"
+	"companions/internal/companion"
+	"companions/internal/dao"
+	"companions/internal/pkg/xagent"
+	"companions/internal/pkg/xllm"
+	"companions/internal/pkg/xmem"
+	"companions/internal/pkg/xmod"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/daodao97/xgo/xlog"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+var errConversationNotFound = errors.New("conversation not found")
+
+// conversationNamespace 由用户、角色和首条消息生成会话 id 的命名空间
+var conversationNamespace = uuid.MustParse("6f1c1f5e-8f0e-4a53-9a57-3c1d1a0c2b7e")
+
+// completionRequest OpenAI chat completions 请求, model 为角色名称
+type completionRequest struct {
+	xllm.Request
+	Stream         bool   `json:"stream"`
+	ConversationID string `json:"conversation_id"` // 扩展字段, 也可以通过 X-Conversation-ID 请求头指定
+}
+
+// UnmarshalJSON 消息和 tool_choice 沿用 xllm.Request 的解析
+func (r *completionRequest) UnmarshalJSON(data []byte) error {
+	if err := json.Unmarshal(data, &r.Request); err != nil {
+		return err
+	}
+	var ext struct {
+		Stream         bool   `json:"stream"`
+		ConversationID string `json:"conversation_id"`
+	}
+	if err := json.Unmarshal(data, &ext); err != nil {
+		return err
+	}
+	r.Stream = ext.Stream
+	r.ConversationID = ext.ConversationID
+	return nil
+}
+
+// userMessage 最后一条用户消息的文本, 历史由会话记忆提供, 客户端传入的其余消息不使用
+func (r *completionRequest) userMessage() string {
+	for i := len(r.Messages) - 1; i >= 0; i-- {
+		if r.Messages[i].Role == xllm.RoleUser {
+			return xllm.ContentText(r.Messages[i].Content)
+		}
+	}
+	return ""
+}
+
+// maxConversationAttempts 并发请求占用了同一代会话时最多顺延的次数
+const maxConversationAttempts = 5
+
+// conversationKey 客户端每次发送完整的历史, 以首条用户消息区分不同的对话线程
+// 同一线程的每个会话占用一代 generation, 会话是软删除的, 删除后 id 仍被占用
+func (r *completionRequest) conversationKey(uid string, generation int) string {
+	first := ""
+	for _, msg := range r.Messages {
+		if msg.Role == xllm.RoleUser {
+			first = xllm.ContentText(msg.Content)
+			break
+		}
+	}
+	name := uid + "\n" + r.Model + "\n" + first
+	if generation > 0 {
+		name += "\n" + strconv.Itoa(generation)
+	}
+	return uuid.NewSHA1(conversationNamespace, []byte(name)).String()
+}
+
+// continuation 请求中已有助手回复, 表示继续之前的对话, 否则是新的对话
+func (r *completionRequest) continuation() bool {
+	for _, msg := range r.Messages {
+		if msg.Role == xllm.RoleAssistant {
+			return true
+		}
+	}
+	return false
+}
+
+// nextGeneration 线程中第一个未占用的 generation
+// 每代会话都按顺序创建, 已占用的 generation 是连续的, 先倍增再二分查找
+func (r *completionRequest) nextGeneration(uid string) (int, error) {
+	exists := func(generation int) (bool, error) {
+		return dao.Memory.Exists(r.conversationKey(uid, generation))
+	}
+	ok, err := exists(0)
+	if err != nil || !ok {
+		return 0, err
+	}
+	lo, hi := 0, 1
+	for {
+		ok, err := exists(hi)
+		if err != nil {
+			return 0, err
+		}
+		if !ok {
+			break
+		}
+		lo, hi = hi, hi*2
+	}
+	for hi-lo > 1 {
+		mid := (lo + hi) / 2
+		ok, err := exists(mid)
+		if err != nil {
+			return 0, err
+		}
+		if ok {
+			lo = mid
+		} else {
+			hi = mid
+		}
+	}
+	return hi, nil
+}
+
+// openaiError 按 OpenAI 的错误格式返回
+func openaiError(c *gin.Context, status int, errType string, message string) {
+	c.JSON(status, gin.H{"error": gin.H{"message": message, "type": errType}})
+}
+
+// ListModels 可选择的角色, 格式与 OpenAI GET /v1/models 一致
+func ListModels(c *gin.Context) {
+	characters := character.List()
+	data := make([]gin.H, 0, len(characters))
+	for _, ch := range characters {
+		data = append(data, gin.H{"id": ch.Name, "object": "model", "created": 0, "owned_by": "companions"})
+	}
+	c.JSON(http.StatusOK, gin.H{"object": "list", "data": data})
+}
+
+// ChatCompletions OpenAI 兼容的对话接口, model 选择角色, 对话经过角色的人设、记忆和工具
+// 只使用最后一条用户消息, 客户端的 system 消息和历史被忽略; tool_choice 为 none 时不挂载工具
+func ChatCompletions(c *gin.Context) {
+	var req completionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		openaiError(c, http.StatusBadRequest, "invalid_request_error", err.Error())
+		return
+	}
+	if len(req.Tools) > 0 {
+		openaiError(c, http.StatusBadRequest, "invalid_request_error", "tools are not supported, characters use their own tools")
+		return
+	}
+	if !characterExists(req.Model) {
+		openaiError(c, http.StatusNotFound, "invalid_request_error", "model not found: "+req.Model)
+		return
+	}
+	text := req.userMessage()
+	if strings.TrimSpace(text) == "" {
+		openaiError(c, http.StatusBadRequest, "invalid_request_error", "a user message is required")
+		return
+	}
+	uid := auth.GetUID(c)
+
+	if _, err := checkQuota(c, uid); err != nil {
+		openaiError(c, http.StatusTooManyRequests, "rate_limit_error", err.Error())
+		return
+	}
+
+	conversationID, err := completionConversation(c, &req, uid)
+	if errors.Is(err, errConversationNotFound) {
+		openaiError(c, http.StatusNotFound, "invalid_request_error", err.Error())
+		return
+	}
+	if err != nil {
+		openaiError(c, http.StatusInternalServerError, "server_error", "创建会话失败")
+		return
+	}
+	c.Header("X-Conversation-ID", conversationID)
+
+	opts := companion.Options{
+		UID:            uid,
+		Character:      req.Model,
+		ConversationID: conversationID,
+		Location:       companion.Location(c.GetHeader("X-Timezone")),
+		NoTools:        toolChoiceNone(req.ToolChoice),
+		NoTTS:          true, // 兼容接口只返回文本, 不合成语音
+	}
+	ctx := context.Background()
+	stream, err := companion.NewAgent(opts).Execute(ctx, companion.Input(opts, text, nil))
+	if err != nil {
+		xlog.ErrorC(ctx, "启动工作流失败", xlog.Err(err))
+		openaiError(c, http.StatusInternalServerError, "server_error", "工作流启动失败")
+		return
+	}
+
+	completion := newCompletion(req.Model)
+	if !req.Stream {
+		reply := &companion.Reply{}
+		m := xagent.NewMessageProcessor()
+		for msg := range stream {
+			if m.ShouldSend(msg) {
+				reply.Add(msg)
+			}
+		}
+		if reply.Text == "" && reply.Error != "" {
+			openaiError(c, http.StatusInternalServerError, "server_error", reply.Error)
+			return
+		}
+		c.JSON(http.StatusOK, completion.message(reply))
+		return
+	}
+	streamCompletion(c, stream, completion)
+}
+
+// toolChoiceNone tool_choice 为 "none" 时角色不调用工具, 其余取值按 auto 处理
+func toolChoiceNone(choice xllm.ToolChoice) bool {
+	v, ok := choice.(*xllm.StringToolChoice)
+	return ok && v.Value == "none"
+}
+
+func characterExists(name string) bool {
+	for _, ch := range character.List() {
+		if ch.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// completionConversation 指定的会话需要属于当前用户; 未指定时按对话线程找到或创建会话
+func completionConversation(c *gin.Context, req *completionRequest, uid string) (string, error) {
+	id := req.ConversationID
+	if id == "" {
+		id = c.GetHeader("X-Conversation-ID")
+	}
+	if id != "" {
+		conv, err := dao.Memory.Find(id)
+		if err != nil || conv.Uid != uid {
+			return "", errConversationNotFound
+		}
+		return id, nil
+	}
+
+	ctx := c.Request.Context()
+	next, err := req.nextGeneration(uid)
+	if err != nil {
+		xlog.WarnC(ctx, "查询会话失败", xlog.Err(err))
+		return "", err
+	}
+
+	// 继续对话时沿用线程最新的会话, 最新的会话已删除时创建新会话
+	// 同一首条消息的多个线程同时进行时都会接到最新的会话, 需要区分时请指定会话 id
+	if req.continuation() && next > 0 {
+		id = req.conversationKey(uid, next-1)
+		if conv, err := dao.Memory.Find(id); err == nil && conv.Uid == uid {
+			return id, nil
+		}
+	}
+
+	// 新的对话总是创建新会话, 并发请求已占用同一代时顺延
+	for i := 0; i < maxConversationAttempts; i++ {
+		id = req.conversationKey(uid, next+i)
+		err = dao.Memory.Create(id, uid, "")
+		if err == nil {
+			return id, nil
+		}
+		if !errors.Is(err, xmem.ErrExists) {
+			xlog.WarnC(ctx, "创建会话失败", xlog.String("conversation_id", id), xlog.Err(err))
+			return "", err
+		}
+	}
+	xlog.WarnC(ctx, "创建会话失败", xlog.String("conversation_id", id), xlog.Err(xmem.ErrExists))
+	return "", xmem.ErrExists
+}
+
+// completion OpenAI 响应的公共字段, 流式响应的每个分片共用
+type completion struct {
+	ID      string
+	Model   string
+	Created int64
+}
+
+func newCompletion(model string) *completion {
+	return &completion{ID: "chatcmpl-" + uuid.New().String(), Model: model, Created: time.Now().Unix()}
+}
+
+// finishReason 回复被内容审核拦截时为 content_filter
+func finishReason(blocked bool) string {
+	if blocked {
+		return "content_filter"
+	}
+	return "stop"
+}
+
+func (p *completion) message(reply *companion.Reply) gin.H {
+	blocked := false
+	for _, m := range reply.Moderation {
+		if m["action"] == xmod.ActionBlock {
+			blocked = true
+		}
+	}
+	return gin.H{
+		"id":      p.ID,
+		"object":  "chat.completion",
+		"created": p.Created,
+		"model":   p.Model,
+		"choices": []gin.H{{
+			"index":         0,
+			"message":       gin.H{"role": xllm.RoleAssistant, "content": reply.Text},
+			"finish_reason": finishReason(blocked),
+		}},
+	}
+}
+
+func (p *completion) chunk(delta gin.H, reason any) gin.H {
+	return gin.H{
+		"id":      p.ID,
+		"object":  "chat.completion.chunk",
+		"created": p.Created,
+		"model":   p.Model,
+		"choices": []gin.H{{"index": 0, "delta": delta, "finish_reason": reason}},
+	}
+}
+
+// streamCompletion 按 OpenAI 的 SSE 格式推送文本, 音频、好感度和动作不在 OpenAI 格式内, 不推送
+// 客户端断开后继续读取消息流直到结束, 避免工作流阻塞
+func streamCompletion(c *gin.Context, stream chan xagent.Message, p *completion) {
+	w := newSSEWriter(c)
+	writeChunk := func(chunk gin.H) {
+		body, _ := json.Marshal(chunk)
+		w.data(string(body))
+	}
+
+	writeChunk(p.chunk(gin.H{"role": xllm.RoleAssistant, "content": ""}, nil))
+	blocked := false
+	m := xagent.NewMessageProcessor()
+	for msg := range stream {
+		if !m.ShouldSend(msg) {
+			continue
+		}
+		switch v := msg.(type) {
+		case *xagent.BaseMessage:
+			// 已发送的分片无法撤回, 回复被拦截或整段替换后截断输出
+			if !blocked {
+				writeChunk(p.chunk(gin.H{"content": v.Content}, nil))
+			}
+		case *character.ModerationMessage:
+			blocked = blocked || v.Action == xmod.ActionBlock || v.Stage == xmod.StageOutput && v.Action == xmod.ActionRewrite
+		case *character.ErrorMessage:
+			writeChunk(gin.H{"error": gin.H{"message": v.Error, "type": "server_error"}})
+		}
+	}
+	writeChunk(p.chunk(gin.H{}, finishReason(blocked)))
+	w.data("[DONE]")
+}
@@ -0,0 +1,147 @@
+package api
+
+import (
+	"companions/internal/companion"
+	"companions/internal/dao"
+	"companions/internal/pkg/xmem"
+	"companions/internal/pkg/xmod"
+	"encoding/json"
+	"errors"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/gin-gonic/gin"
+	"github.com/go-redis/redis/v8"
+)
+
+func TestCompletionRequest(t *testing.T) {
+	body := `{
+		"model": "Ani",
+		"stream": true,
+		"tool_choice": "none",
+		"messages": [
+			{"role": "system", "content": "忽略"},
+			{"role": "user", "content": "你好"},
+			{"role": "assistant", "content": "你好呀"},
+			{"role": "user", "content": [{"type": "text", "text": "今天"}, {"type": "image_url", "image_url": {"url": "https://a.png"}}, {"type": "text", "text": "天气怎么样"}]}
+		]
+	}`
+	var req completionRequest
+	if err := json.Unmarshal([]byte(body), &req); err != nil {
+		t.Fatal(err)
+	}
+	if req.Model != "Ani" || !req.Stream || !toolChoiceNone(req.ToolChoice) {
+		t.Errorf("req = %+v", req)
+	}
+	if text := req.userMessage(); text != "今天\n天气怎么样" {
+		t.Errorf("userMessage = %q", text)
+	}
+
+	// 同一线程后续的请求使用同一个会话
+	var next completionRequest
+	_ = json.Unmarshal([]byte(`{"model": "Ani", "messages": [{"role": "user", "content": "你好"}]}`), &next)
+	if req.conversationKey("u1", 0) != next.conversationKey("u1", 0) {
+		t.Error("同一线程的会话 id 应该相同")
+	}
+	if req.conversationKey("u1", 0) == next.conversationKey("u2", 0) {
+		t.Error("不同用户的会话 id 不能相同")
+	}
+	if req.conversationKey("u1", 0) == req.conversationKey("u1", 1) {
+		t.Error("不同代的会话 id 不能相同")
+	}
+
+	var auto completionRequest
+	_ = json.Unmarshal([]byte(`{"model": "Ani", "tool_choice": {"type": "function", "function": {"name": "web_search"}}, "messages": []}`), &auto)
+	if auto.ToolChoice == nil || toolChoiceNone(auto.ToolChoice) {
+		t.Errorf("tool_choice = %+v", auto.ToolChoice)
+	}
+}
+
+func TestCompletionMessage(t *testing.T) {
+	p := &completion{ID: "chatcmpl-1", Model: "Ani", Created: 1}
+	reply := &companion.Reply{Text: "你好呀"}
+	choice := p.message(reply)["choices"].([]gin.H)[0]
+	if choice["finish_reason"] != "stop" || choice["message"].(gin.H)["content"] != "你好呀" {
+		t.Errorf("choice = %+v", choice)
+	}
+
+	reply.Moderation = []map[string]any{{"stage": "output", "action": xmod.ActionBlock}}
+	if choice := p.message(reply)["choices"].([]gin.H)[0]; choice["finish_reason"] != "content_filter" {
+		t.Errorf("finish_reason = %v", choice["finish_reason"])
+	}
+}
+
+// TestCompletionConversationAfterDelete 新的对话总是创建新会话, 软删除的会话仍占用 id, 各存储实现都换到同一线程的下一代会话
+func TestCompletionConversationAfterDelete(t *testing.T) {
+	mr, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(mr.Close)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { client.Close() })
+
+	for name, m := range map[string]xmem.Memory{
+		"memory": xmem.NewInMemory(),
+		"redis":  xmem.NewRedisMemory(client),
+	} {
+		t.Run(name, func(t *testing.T) {
+			setMemory(t, m)
+			testCompletionConversationAfterDelete(t)
+		})
+	}
+}
+
+func testCompletionConversationAfterDelete(t *testing.T) {
+	var req, next completionRequest
+	_ = json.Unmarshal([]byte(`{"model": "Ani", "messages": [{"role": "user", "content": "你好"}]}`), &req)
+	_ = json.Unmarshal([]byte(`{"model": "Ani", "messages": [{"role": "user", "content": "你好"}, {"role": "assistant", "content": "你好呀"}, {"role": "user", "content": "在吗"}]}`), &next)
+	c := newTestContext("/v1/chat/completions")
+
+	first, err := completionConversation(c, &req, "u1")
+	if err != nil || first != req.conversationKey("u1", 0) {
+		t.Fatalf("first = %s, err = %v", first, err)
+	}
+	if id, _ := completionConversation(c, &next, "u1"); id != first {
+		t.Errorf("继续对话应沿用会话, got %s", id)
+	}
+
+	// 首条消息相同的新对话使用新会话, 继续对话接到最新的会话
+	second, err := completionConversation(c, &req, "u1")
+	if err != nil || second != req.conversationKey("u1", 1) {
+		t.Fatalf("second = %s, err = %v", second, err)
+	}
+	if id, _ := completionConversation(c, &next, "u1"); id != second {
+		t.Errorf("继续对话应接到最新的会话, got %s", id)
+	}
+
+	// 删除后继续对话换到下一代会话, 之后的请求继续沿用
+	if err := dao.Memory.Delete(second); err != nil {
+		t.Fatal(err)
+	}
+	third, err := completionConversation(c, &next, "u1")
+	if err != nil || third != req.conversationKey("u1", 2) {
+		t.Fatalf("third = %s, err = %v", third, err)
+	}
+	if id, _ := completionConversation(c, &next, "u1"); id != third {
+		t.Errorf("删除后的线程应沿用新会话, got %s", id)
+	}
+
+	// 占用的代数较多时同样找到下一代
+	for generation := 3; generation < 12; generation++ {
+		if id, err := completionConversation(c, &req, "u1"); err != nil || id != req.conversationKey("u1", generation) {
+			t.Fatalf("generation %d = %s, err = %v", generation, id, err)
+		}
+	}
+	if generation, err := req.nextGeneration("u1"); err != nil || generation != 12 {
+		t.Errorf("nextGeneration() = %d, %v, want 12", generation, err)
+	}
+
+	// 其他用户的会话不能通过请求头使用
+	c.Request = httptest.NewRequest("POST", "/v1/chat/completions", nil)
+	c.Request.Header.Set("X-Conversation-ID", third)
+	if _, err := completionConversation(c, &req, "u2"); !errors.Is(err, errConversationNotFound) {
+		t.Errorf("err = %v, want errConversationNotFound", err)
+	}
+}
@@ -0,0 +1,62 @@
+package api
+
+import (
+	"companions/internal/auth"
+	"companions/internal/dao"
+	"companions/internal/pkg/xremind"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ListReminders 当前用户的提醒, query: status 逗号分隔, 默认 pending,queued
+func ListReminders(c *gin.Context) {
+	if dao.Reminders == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "scheduler is disabled"})
+		return
+	}
+
+	status := []string{xremind.StatusPending, xremind.StatusQueued}
+	if s := c.Query("status"); s != "" {
+		status = strings.Split(s, ",")
+	}
+	reminders, err := dao.Reminders.List(xremind.Filter{UID: auth.GetUID(c), Kind: xremind.KindReminder, Status: status})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	data := make([]gin.H, 0, len(reminders))
+	for _, r := range reminders {
+		data = append(data, gin.H{
+			"id":         r.ID,
+			"character":  r.Character,
+			"content":    r.Content,
+			"status":     r.Status,
+			"timezone":   r.Timezone,
+			"due_at":     r.LocalDueAt(),
+			"created_at": r.CreatedAt,
+		})
+	}
+	c.JSON(http.StatusOK, gin.H{"data": data})
+}
+
+// CancelReminder 取消未触发的提醒
+func CancelReminder(c *gin.Context) {
+	if dao.Reminders == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "scheduler is disabled"})
+		return
+	}
+
+	err := xremind.Cancel(dao.Reminders, auth.GetUID(c), c.Param("id"))
+	switch {
+	case errors.Is(err, xremind.ErrReminderNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case err != nil:
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusOK, gin.H{"data": true})
+	}
+}
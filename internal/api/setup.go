@@ -1,9 +1,59 @@
 package api
 
 import (
+	"companions/internal/auth"
+	"companions/internal/conf"
+	"companions/internal/dao"
+	"companions/internal/pkg/xlimit"
+
 	"github.com/gin-gonic/gin"
 )
 
 func SetupRouter(e *gin.Engine) {
 	e.GET("/ping", Ping)
+
+	account := e.Group("/api/auth", rateLimit)
+	{
+		account.POST("/register", Register)
+		account.POST("/login", Login)
+		account.POST("/guest", Guest)
+		account.POST("/refresh", RefreshToken)
+	}
+
+	g := e.Group("/api", auth.AuthMiddleware(), rateLimit)
+	{
+		g.GET("/me", Me)
+		g.POST("/auth/logout", Logout)
+		g.POST("/auth/upgrade", UpgradeGuest)
+		g.GET("/conversations", ListConversations)
+		g.GET("/conversations/:id/messages", ListMessages)
+		g.GET("/conversations/:id/messages/:message_id", GetTurn)
+		g.DELETE("/conversations/:id/messages/:message_id", DeleteTurn)
+		g.GET("/conversations/:id/export", ExportConversation)
+		g.GET("/usage", GetUsage)
+		g.GET("/reminders", ListReminders)
+		g.DELETE("/reminders/:id", CancelReminder)
+		g.POST("/ws/ticket", CreateWSTicket)
+		g.POST("/chat", Chat)
+	}
+
+	// OpenAI 兼容接口, 客户端把 access_token 作为 API key
+	v1 := e.Group("/v1", auth.AuthMiddleware(), rateLimit)
+	{
+		v1.GET("/models", ListModels)
+		v1.POST("/chat/completions", ChatCompletions)
+	}
+}
+
+// rateLimit 按用户 (未登录接口按 IP) 限制 REST 请求频率, dao 在服务启动后才初始化, 因此每次请求时读取
+func rateLimit(c *gin.Context) {
+	limitConf := conf.Get().RateLimit
+	xlimit.Middleware(dao.Limiter, xlimit.PerMinute(limitConf.RequestsPerMinute, 0), limitKey)(c)
+}
+
+func limitKey(c *gin.Context) string {
+	if uid := auth.GetUID(c); uid != "" {
+		return uid
+	}
+	return "ip:" + c.ClientIP()
 }
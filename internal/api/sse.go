@@ -0,0 +1,45 @@
+package api
+
+import (
+	"io"
+	"net/http"
+
+	"github.com/daodao97/xgo/xlog"
+	"github.com/gin-gonic/gin"
+)
+
+// sseWriter 以 SSE 推送事件, 客户端断开后丢弃之后的事件
+// 调用方仍需读完消息流, 避免工作流阻塞
+type sseWriter struct {
+	c      *gin.Context
+	closed bool
+}
+
+// newSSEWriter 写入 SSE 响应头
+func newSSEWriter(c *gin.Context) *sseWriter {
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	// 关闭 nginx 的响应缓冲
+	c.Header("X-Accel-Buffering", "no")
+	c.Status(http.StatusOK)
+	return &sseWriter{c: c}
+}
+
+// write 写入一段完整的 SSE 事件并立即刷新
+func (w *sseWriter) write(event string) {
+	if w.closed {
+		return
+	}
+	if _, err := io.WriteString(w.c.Writer, event); err != nil {
+		xlog.WarnC(w.c.Request.Context(), "SSE 写入失败, 客户端可能已断开", xlog.Err(err))
+		w.closed = true
+		return
+	}
+	w.c.Writer.Flush()
+}
+
+// data 写入只有 data 字段的事件, 如 OpenAI 的流式分片
+func (w *sseWriter) data(data string) {
+	w.write("data: " + data + "\n\n")
+}
@@ -0,0 +1,24 @@
+package api
+
+import (
+	"companions/internal/auth"
+	"companions/internal/conf"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// CreateWSTicket 用登录 token 换取短期有效的 WebSocket 连接票据, 通过 /ws?ticket= 使用
+func CreateWSTicket(c *gin.Context) {
+	ttl := time.Duration(conf.Get().WebSocket.TicketTTL) * time.Second
+	ticket, expiresAt, err := auth.NewTicket(auth.GetUID(c), ttl, auth.ExpiresAt(auth.GetAuth(c)))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"ticket":     ticket,
+		"expires_at": expiresAt.Unix(),
+	})
+}
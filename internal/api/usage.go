@@ -0,0 +1,80 @@
+package api
+
+import (
+	"companions/internal/auth"
+	"companions/internal/dao"
+	"companions/internal/pkg/xusage"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// defaultUsageDays 未指定时间范围时统计最近的天数
+const defaultUsageDays = 30
+
+// GetUsage 当前用户的用量统计
+// query: group_by day(默认)|conversation|model|kind, from/to 日期 (YYYY-MM-DD, 包含 to 当天), conversation_id
+func GetUsage(c *gin.Context) {
+	if dao.Usage == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "usage is disabled"})
+		return
+	}
+
+	filter, err := usageFilter(c, time.Now())
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	groupBy := c.DefaultQuery("group_by", xusage.GroupByDay)
+	switch groupBy {
+	case xusage.GroupByDay, xusage.GroupByConversation, xusage.GroupByModel, xusage.GroupByKind:
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "unsupported group_by"})
+		return
+	}
+
+	records, err := dao.Usage.Records(filter)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	var total xusage.Summary
+	if totals := xusage.Aggregate(records, ""); len(totals) > 0 {
+		total = totals[0]
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"data":  xusage.Aggregate(records, groupBy),
+		"total": total,
+		"from":  filter.From.Format(time.DateOnly),
+		"to":    filter.To.AddDate(0, 0, -1).Format(time.DateOnly),
+	})
+}
+
+func usageFilter(c *gin.Context, now time.Time) (xusage.Filter, error) {
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	filter := xusage.Filter{
+		UID:            auth.GetUID(c),
+		ConversationID: c.Query("conversation_id"),
+		From:           today.AddDate(0, 0, 1-defaultUsageDays),
+		To:             today.AddDate(0, 0, 1),
+	}
+
+	if from := c.Query("from"); from != "" {
+		t, err := time.ParseInLocation(time.DateOnly, from, now.Location())
+		if err != nil {
+			return filter, err
+		}
+		filter.From = t
+	}
+	if to := c.Query("to"); to != "" {
+		t, err := time.ParseInLocation(time.DateOnly, to, now.Location())
+		if err != nil {
+			return filter, err
+		}
+		filter.To = t.AddDate(0, 0, 1)
+	}
+	return filter, nil
+}
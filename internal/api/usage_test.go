@@ -0,0 +1,39 @@
+package api
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestUsageFilter(t *testing.T) {
+	now := time.Date(2025, 7, 31, 15, 0, 0, 0, time.Local)
+
+	filter, err := usageFilter(newTestContext("/api/usage"), now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if filter.From.Format(time.DateOnly) != "2025-07-02" || filter.To.Format(time.DateOnly) != "2025-08-01" {
+		t.Errorf("default range = %v ~ %v", filter.From, filter.To)
+	}
+
+	filter, err = usageFilter(newTestContext("/api/usage?from=2025-07-01&to=2025-07-01&conversation_id=c1"), now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if filter.To.Sub(filter.From) != 24*time.Hour || filter.ConversationID != "c1" {
+		t.Errorf("filter = %+v", filter)
+	}
+
+	if _, err := usageFilter(newTestContext("/api/usage?from=07-01"), now); err == nil {
+		t.Errorf("invalid date should fail")
+	}
+}
+
+func newTestContext(target string) *gin.Context {
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest("GET", target, nil)
+	return c
+}
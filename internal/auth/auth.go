@@ -2,12 +2,14 @@ package auth
 
 import (
 	"context"
+	"errors"
 	"net/http"
-	"strings"
-	"companions/internal/conf"
+
+	"companions/internal/dao"
+	"companions/internal/pkg/xuser"
 
 	"github.com/daodao97/xgo/xdb"
-	"github.com/daodao97/xgo/xjwt"
+	"github.com/daodao97/xgo/xlog"
 	"github.com/gin-gonic/gin"
 )
 
@@ -16,29 +18,49 @@ type authContextKey struct{}
 // gin middleware
 func AuthMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		token := c.GetHeader("Authorization")
-		if token == "" {
+		payload, err := ParseToken(BearerToken(c.Request))
+		if err != nil {
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
 			c.Abort()
 			return
 		}
-
-		// remove Bearer prefix
-		token = strings.TrimPrefix(token, "Bearer ")
-
-		payload, err := xjwt.VerifyHMacToken(token, conf.Get().JwtSecret)
-		if err != nil {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		if err := CheckUser(payload.GetString("uid")); err != nil {
+			status := http.StatusUnauthorized
+			switch {
+			case errors.Is(err, xuser.ErrUserDisabled):
+				status = http.StatusForbidden
+			case !errors.Is(err, ErrTokenInvalid):
+				status = http.StatusInternalServerError
+				xlog.ErrorC(c.Request.Context(), "查询用户状态失败", xlog.Err(err))
+			}
+			c.JSON(status, gin.H{"error": err.Error()})
 			c.Abort()
 			return
 		}
 		// 将 payload 添加到请求上下文
-		ctx := context.WithValue(c.Request.Context(), authContextKey{}, xdb.Record(payload))
-		c.Request = c.Request.WithContext(ctx)
+		c.Request = c.Request.WithContext(WithAuth(c.Request.Context(), payload))
 		c.Next()
 	}
 }
 
+// CheckUser 校验 token 所属用户仍为正常状态, 账号被禁用或删除后已签发的 token 立即失效
+// 用户不存在时返回 ErrTokenInvalid, 被禁用时返回 xuser.ErrUserDisabled
+func CheckUser(uid string) error {
+	if dao.Users == nil {
+		return nil
+	}
+	_, err := xuser.Get(dao.Users, uid)
+	if errors.Is(err, xuser.ErrUserNotFound) {
+		return ErrTokenInvalid
+	}
+	return err
+}
+
+// WithAuth 将登录 token 的 payload 放入上下文, 之后可以通过 GetAuth 取出
+func WithAuth(ctx context.Context, payload xdb.Record) context.Context {
+	return context.WithValue(ctx, authContextKey{}, payload)
+}
+
 func GetAuthFromContext(ctx context.Context) xdb.Record {
 	if _ctx, ok := ctx.(*gin.Context); ok {
 		return GetAuth(_ctx)
@@ -50,3 +72,8 @@ func GetAuthFromContext(ctx context.Context) xdb.Record {
 func GetAuth(c *gin.Context) xdb.Record {
 	return GetAuthFromContext(c.Request.Context())
 }
+
+// GetUID 获取当前登录用户 id
+func GetUID(c *gin.Context) string {
+	return GetAuth(c).GetString("uid")
+}
@@ -0,0 +1,59 @@
+package auth
+
+import (
+	"companions/internal/dao"
+	"companions/internal/pkg/xuser"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// TestAuthMiddlewareUserStatus 账号被禁用或删除后, 未过期的 access token 也不能再使用
+func TestAuthMiddlewareUserStatus(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	users := dao.Users
+	t.Cleanup(func() { dao.Users = users })
+	dao.Users = xuser.NewInMemory()
+
+	user, err := xuser.CreateGuest(dao.Users)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tokens, err := IssueTokens(user.ID, user.TokenVersion)
+	if err != nil {
+		t.Fatal(err)
+	}
+	missing, err := IssueTokens("404", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	e := gin.New()
+	e.GET("/me", AuthMiddleware(), func(c *gin.Context) {
+		c.String(http.StatusOK, GetUID(c))
+	})
+	get := func(token string) int {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodGet, "/me", nil)
+		r.Header.Set("Authorization", "Bearer "+token)
+		e.ServeHTTP(w, r)
+		return w.Code
+	}
+
+	if code := get(tokens.AccessToken); code != http.StatusOK {
+		t.Fatalf("active user status = %d, want 200", code)
+	}
+	if code := get(missing.AccessToken); code != http.StatusUnauthorized {
+		t.Errorf("missing user status = %d, want 401", code)
+	}
+
+	user.Status = xuser.StatusDisabled
+	if err := dao.Users.Update(user); err != nil {
+		t.Fatal(err)
+	}
+	if code := get(tokens.AccessToken); code != http.StatusForbidden {
+		t.Errorf("disabled user status = %d, want 403", code)
+	}
+}
@@ -0,0 +1,162 @@
+package auth
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"companions/internal/conf"
+
+	"github.com/daodao97/xgo/xdb"
+	"github.com/daodao97/xgo/xjwt"
+)
+
+// token 类型, 写入 typ 字段; access token 不带 typ
+const (
+	TokenTypeTicket  = "ws_ticket"
+	TokenTypeRefresh = "refresh"
+)
+
+// 默认有效期
+const (
+	DefaultTicketTTL       = time.Minute
+	DefaultAccessTokenTTL  = time.Hour
+	DefaultRefreshTokenTTL = 30 * 24 * time.Hour
+)
+
+var (
+	ErrTokenInvalid = errors.New("token 无效")
+	ErrTokenExpired = errors.New("token 已过期")
+)
+
+// Tokens 登录后签发的 token
+type Tokens struct {
+	AccessToken  string `json:"access_token"`
+	RefreshToken string `json:"refresh_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int64  `json:"expires_in"` // access token 有效期 (秒)
+}
+
+// IssueTokens 签发 access token 和 refresh token
+// version 为用户当前的 token 版本, 退出登录后版本递增, 旧的 refresh token 无法再换取新 token
+func IssueTokens(uid string, version int) (*Tokens, error) {
+	accountConf := conf.Get().Account
+	accessTTL := ttlOrDefault(accountConf.AccessTokenTTL, DefaultAccessTokenTTL)
+	refreshTTL := ttlOrDefault(accountConf.RefreshTokenTTL, DefaultRefreshTokenTTL)
+
+	now := time.Now()
+	accessToken, err := xjwt.GenHMacToken(map[string]any{
+		"uid": uid,
+		"exp": now.Add(accessTTL).Unix(),
+	}, conf.Get().JwtSecret)
+	if err != nil {
+		return nil, err
+	}
+	refreshToken, err := xjwt.GenHMacToken(map[string]any{
+		"uid": uid,
+		"typ": TokenTypeRefresh,
+		"ver": version,
+		"exp": now.Add(refreshTTL).Unix(),
+	}, conf.Get().JwtSecret)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Tokens{
+		AccessToken:  accessToken,
+		RefreshToken: refreshToken,
+		TokenType:    "Bearer",
+		ExpiresIn:    int64(accessTTL.Seconds()),
+	}, nil
+}
+
+// ParseToken 校验 access token 并返回 payload, 票据和 refresh token 不能当作 access token 使用
+func ParseToken(token string) (xdb.Record, error) {
+	return parseType(token, "")
+}
+
+// ParseRefreshToken 校验 refresh token, 返回 uid 和签发时的 token 版本
+func ParseRefreshToken(token string) (string, int, error) {
+	payload, err := parseType(token, TokenTypeRefresh)
+	if err != nil {
+		return "", 0, err
+	}
+	return payload.GetString("uid"), payload.GetInt("ver"), nil
+}
+
+// NewTicket 为用户签发短期有效的 WebSocket 连接票据
+// 浏览器无法为 WebSocket 设置 Authorization 头, 可以先用登录 token 换取票据再通过 ?ticket= 连接
+// tokenExpiresAt 为登录 token 的过期时间, 通过票据建立的连接在该时间后失效
+func NewTicket(uid string, ttl time.Duration, tokenExpiresAt time.Time) (string, time.Time, error) {
+	if ttl <= 0 {
+		ttl = DefaultTicketTTL
+	}
+	expiresAt := time.Now().Add(ttl)
+	payload := map[string]any{
+		"uid": uid,
+		"typ": TokenTypeTicket,
+		"exp": expiresAt.Unix(),
+	}
+	if !tokenExpiresAt.IsZero() {
+		payload["token_exp"] = tokenExpiresAt.Unix()
+	}
+	ticket, err := xjwt.GenHMacToken(payload, conf.Get().JwtSecret)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	return ticket, expiresAt, nil
+}
+
+// ParseTicket 校验连接票据并返回 payload
+func ParseTicket(ticket string) (xdb.Record, error) {
+	return parseType(ticket, TokenTypeTicket)
+}
+
+// ExpiresAt token 的过期时间, 未设置 exp 时返回零值
+func ExpiresAt(payload xdb.Record) time.Time {
+	return unixTime(payload.GetInt64("exp"))
+}
+
+// TicketTokenExpiresAt 签发票据的登录 token 的过期时间
+func TicketTokenExpiresAt(payload xdb.Record) time.Time {
+	return unixTime(payload.GetInt64("token_exp"))
+}
+
+func unixTime(sec int64) time.Time {
+	if sec <= 0 {
+		return time.Time{}
+	}
+	return time.Unix(sec, 0)
+}
+
+// BearerToken 从 Authorization 头中取出 token
+func BearerToken(r *http.Request) string {
+	return strings.TrimSpace(strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer "))
+}
+
+func ttlOrDefault(seconds int, ttl time.Duration) time.Duration {
+	if seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	return ttl
+}
+
+// parseType 校验签名、uid 和过期时间, 并要求 typ 与 tokenType 一致
+func parseType(token string, tokenType string) (xdb.Record, error) {
+	if token == "" {
+		return nil, ErrTokenInvalid
+	}
+	payload, err := xjwt.VerifyHMacToken(token, conf.Get().JwtSecret)
+	if err != nil {
+		return nil, ErrTokenInvalid
+	}
+	record := xdb.Record(payload)
+	if record.GetString("uid") == "" || record.GetString("typ") != tokenType {
+		return nil, ErrTokenInvalid
+	}
+	if expiresAt := ExpiresAt(record); !expiresAt.IsZero() && !time.Now().Before(expiresAt) {
+		return nil, ErrTokenExpired
+	}
+	return record, nil
+}
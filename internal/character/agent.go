@@ -6,13 +6,18 @@ import (
 	"companions/internal/pkg/xflow"
 	"companions/internal/pkg/xllm"
 	"companions/internal/pkg/xmem"
+	"companions/internal/pkg/xmod"
 	"companions/internal/pkg/xtools"
 	"companions/internal/pkg/xtts"
+	"companions/internal/pkg/xusage"
 	"context"
 	"fmt"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/daodao97/xgo/xlog"
+	"github.com/google/uuid"
 )
 
 type AgentOption func(a *Agent)
@@ -22,21 +27,88 @@ type Agent struct {
 	character *Character
 	tts       xtts.TTS
 	flow      *xflow.Flow[AICompanionState]
-	xtools    *xtools.Tools
+	servers   map[string]*xtools.Tools // 按 server 分组的工具, tools 为提供给模型的定义
 	tools     []xllm.Tool
+	taskLLMs  map[string]xllm.LLM
+	meter     *xusage.Meter
+	moderator *xmod.Moderator
+	adultUser bool
+	onTitle   func(conversationID string, title string)
 }
 
-func WithXTools(tools ...xtools.ToolInterface) AgentOption {
-	var _xllmTools []xllm.Tool
-	for _, tool := range tools {
-		schema := tool.GetSchema()
-		schema.Name = gentFunctionName("xtools", schema.Name)
-		_xllmTools = append(_xllmTools, schema)
+// titleTimeout 生成会话标题的超时时间
+const titleTimeout = 30 * time.Second
+
+// WithTitleListener 首轮对话后在后台生成会话标题, 生成并保存后回调, 此时本轮的消息流已经关闭
+func WithTitleListener(fn func(conversationID string, title string)) AgentOption {
+	return func(a *Agent) {
+		a.onTitle = fn
+	}
+}
+
+// WithModerator 审核用户消息和模型回复, adultUser 为用户是否通过年龄验证
+func WithModerator(moderator *xmod.Moderator, adultUser bool) AgentOption {
+	return func(a *Agent) {
+		a.moderator = moderator
+		a.adultUser = adultUser
+	}
+}
+
+// WithMeter 用量计量器, 工作流开始时绑定本轮的会话和消息 id
+// 模型和 TTS 需要由调用方通过 meter 包装后传入
+func WithMeter(meter *xusage.Meter) AgentOption {
+	return func(a *Agent) {
+		a.meter = meter
+	}
+}
+
+// WithTaskLLM 为浪漫度评分、动作选择等辅助任务指定模型, 未指定时使用对话模型
+func WithTaskLLM(task string, llm xllm.LLM) AgentOption {
+	return func(a *Agent) {
+		if a.taskLLMs == nil {
+			a.taskLLMs = make(map[string]xllm.LLM)
+		}
+		a.taskLLMs[task] = llm
+	}
+}
+
+func (a *Agent) taskLLM(task string) xllm.LLM {
+	if llm, ok := a.taskLLMs[task]; ok && llm != nil {
+		return llm
 	}
+	return a.GetLLM()
+}
+
+func WithXTools(tools ...xtools.ToolInterface) AgentOption {
+	return WithToolServer("xtools", tools...)
+}
 
+// WithToolServer 注册一组工具, 提供给模型的名称为 <server>___<tool>, 调用时按 server 路由
+// 进程内工具的 server 为 xtools, MCP 服务的 server 为配置中的服务名称; 不允许当前角色使用的工具会被跳过
+func WithToolServer(server string, tools ...xtools.ToolInterface) AgentOption {
 	return func(a *Agent) {
-		a.xtools = xtools.NewTools(tools...)
-		a.tools = append(a.tools, _xllmTools...)
+		if a.servers == nil {
+			a.servers = make(map[string]*xtools.Tools)
+		}
+		registry, ok := a.servers[server]
+		if !ok {
+			registry = xtools.NewTools()
+		}
+		for _, tool := range tools {
+			if !tool.GetMeta().Allowed(a.character.Name) {
+				continue
+			}
+			if err := registry.Register(tool); err != nil {
+				xlog.Warn("注册工具失败", xlog.String("server", server), xlog.Err(err))
+				continue
+			}
+			schema := tool.GetSchema()
+			schema.Name = gentFunctionName(server, schema.Name)
+			a.tools = append(a.tools, schema)
+		}
+		if registry.Len() > 0 {
+			a.servers[server] = registry
+		}
 	}
 }
 
@@ -49,8 +121,8 @@ func SplitFunctionName(functionName string) (string, string) {
 	return tokens[0], tokens[1]
 }
 
-func NewAgent(llm xllm.LLM, tts xtts.TTS, character *Character) *Agent {
-	return &Agent{
+func NewAgent(llm xllm.LLM, tts xtts.TTS, character *Character, opts ...AgentOption) *Agent {
+	agent := &Agent{
 		BaseAgent: *xagent.NewBaseAgent(character.Name, character.Instructions, llm, []xllm.Parameter{
 			{
 				Name:        "character",
@@ -61,27 +133,76 @@ func NewAgent(llm xllm.LLM, tts xtts.TTS, character *Character) *Agent {
 		character: character,
 		tts:       tts,
 	}
+	for _, opt := range opts {
+		opt(agent)
+	}
+	return agent
 }
 
 func (a *Agent) Execute(ctx context.Context, input xagent.Input) (chan xagent.Message, error) {
-	mem := xmem.NewMysqlMemory(dao.ConversationModel, dao.MessageModel)
 	state := &AICompanionState{
+		Character:     a.character,
 		UserMessage:   input["user_message"].(string),
 		UserID:        input["user_id"].(string),
-		Memory:        mem,
+		Memory:        dao.Memory,
 		MessageStream: make(chan xagent.Message, 100),
 		LLM:           a.GetLLM(),
+		RomanceLLM:    a.taskLLM(xllm.TaskRomance),
+		ActionLLM:     a.taskLLM(xllm.TaskAction),
 		TTS:           a.tts,
+		MessageID:     uuid.New().String(),
+		Moderator:     a.moderator,
+		Subject:       xmod.Subject{AdultUser: a.adultUser, AdultCharacter: a.character.Adult},
+		Tools:         a.tools,
+		ToolServers:   a.servers,
+	}
+	if convId, ok := input["conversation_id"].(string); ok {
+		state.ConversationID = convId
+	}
+	// 调用方预先分配的消息 id, 便于在回复开始前通知客户端
+	if messageID, ok := input["message_id"].(string); ok && messageID != "" {
+		state.MessageID = messageID
+	}
+	if images, ok := input["images"].([]*Image); ok {
+		state.Images = images
+	}
+	if detail, ok := input["image_detail"].(string); ok {
+		state.ImageDetail = detail
 	}
 
+	// 审核等按 ctx 计量的调用记到本轮对话的用户
+	ctx = xusage.WithContext(ctx, a.meter)
+
+	// 审核用户消息, 拦截时不进入工作流
+	decision := state.moderate(ctx, xmod.StageInput, state.UserMessage)
+	if decision.Action == xmod.ActionBlock || decision.Action == xmod.ActionWarn {
+		state.MessageStream <- NewModerationMessage(state.MessageID, xmod.StageInput, decision)
+	}
+	if decision.Action == xmod.ActionBlock {
+		close(state.MessageStream)
+		return state.MessageStream, nil
+	}
+	state.UserMessage = decision.Text
+
+	// 调用方没有指定会话时由工作流创建, 只有这时由工作流通知客户端新会话
+	created := state.UserID != "" && state.ConversationID == ""
+	conv, err := a.prepareConversation(state)
+	if err != nil {
+		return nil, err
+	}
+	a.meter.Bind(state.ConversationID, state.MessageID)
+	state.RomanceMeter = loadRomance(state.UserID, a.character.Name)
+
 	// 构建消息历史
 	var allMsg = []xllm.Message{}
 	// 获取历史记忆
-	if state.UserID != "" && len(state.History) == 0 {
-		history, _ := state.Memory.GetMemory(state.UserID)
+	if state.ConversationID != "" && len(state.History) == 0 {
+		history, _ := state.Memory.GetMemory(state.ConversationID)
 		allMsg = append(allMsg, history...)
 		state.History = allMsg
 	}
+	// 只在会话的第一轮生成标题, 失败后不再重试, 避免之后每轮都多一次模型调用
+	firstTurn := len(state.History) == 0
 
 	flow := a.GetFlow(state)
 
@@ -92,6 +213,10 @@ func (a *Agent) Execute(ctx context.Context, input xagent.Input) (chan xagent.Me
 			xlog.Debug("MessageStream 已关闭")
 		}()
 
+		if created {
+			state.MessageStream <- NewConversationMessage(conv.Id, "")
+		}
+
 		err := flow.Execute(ctx)
 		if err != nil {
 			xlog.Error("工作流执行失败", xlog.Err(err))
@@ -101,12 +226,94 @@ func (a *Agent) Execute(ctx context.Context, input xagent.Input) (chan xagent.Me
 			case state.MessageStream <- errorMsg:
 			default:
 			}
+			return
+		}
+
+		if state.RomanceChange != 0 {
+			if err := saveRomance(state.UserID, a.character.Name, state.RomanceMeter); err != nil {
+				xlog.Error("保存关系值失败", xlog.Err(err))
+			}
+		}
+
+		if state.ConversationID != "" && state.LLMResponse != "" {
+			meta := xagent.NewMetaMessage(state.MessageID, state.TurnMeta())
+			if err := state.Memory.Insert(state.ConversationID, []xagent.Message{meta}); err != nil {
+				xlog.Error("保存对话元信息失败", xlog.Err(err))
+			}
+		}
+
+		// 首轮对话结束后在后台生成会话标题, 不阻塞本轮回复结束
+		if firstTurn && conv != nil && conv.Title == "" && state.LLMResponse != "" {
+			go a.genTitle(state.Memory, conv.Id, []xllm.Message{
+				{Role: xllm.RoleUser, Content: xllm.NewTextContent(state.UserMessage)},
+				{Role: xllm.RoleAssistant, Content: xllm.NewTextContent(state.LLMResponse)},
+			})
 		}
 	}()
 
 	return state.MessageStream, nil
 }
 
+// titling 正在生成标题的会话
+var titling sync.Map
+
+// genTitle 生成并保存会话标题, 成功后通知 onTitle
+func (a *Agent) genTitle(memory xmem.Memory, conversationID string, messages []xllm.Message) {
+	// 同一会话并发的首轮只生成一次
+	if _, running := titling.LoadOrStore(conversationID, true); running {
+		return
+	}
+	defer titling.Delete(conversationID)
+	if conv, err := memory.Find(conversationID); err == nil && conv.Title != "" {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), titleTimeout)
+	defer cancel()
+
+	llm, ok := a.taskLLMs[xllm.TaskSummarize]
+	if !ok {
+		llm = xllm.ForTask(xllm.TaskSummarize)
+	}
+	title, err := xmem.GenTitle(ctx, llm, messages)
+	if err != nil {
+		xlog.Warn("生成会话标题失败", xlog.String("conversation_id", conversationID), xlog.Err(err))
+		return
+	}
+	if title == "" {
+		return
+	}
+	if err := memory.Rename(conversationID, title); err != nil {
+		xlog.Error("更新会话标题失败", xlog.Err(err))
+		return
+	}
+	if a.onTitle != nil {
+		a.onTitle(conversationID, title)
+	}
+}
+
+// prepareConversation 校验或创建本轮对话所属的会话
+// 未指定 conversation_id 时为用户创建新会话; 匿名用户 (无 uid) 不落库
+func (a *Agent) prepareConversation(state *AICompanionState) (*xmem.Conversation, error) {
+	if state.UserID == "" {
+		return nil, nil
+	}
+
+	if state.ConversationID == "" {
+		state.ConversationID = uuid.New().String()
+		if err := state.Memory.Create(state.ConversationID, state.UserID, ""); err != nil {
+			return nil, fmt.Errorf("创建会话失败: %w", err)
+		}
+		return &xmem.Conversation{Id: state.ConversationID, Uid: state.UserID}, nil
+	}
+
+	conv, err := state.Memory.Find(state.ConversationID)
+	if err != nil || conv.Uid != state.UserID {
+		return nil, fmt.Errorf("会话不存在: %s", state.ConversationID)
+	}
+	return conv, nil
+}
+
 func (a *Agent) GetFlow(state *AICompanionState) *xflow.Flow[AICompanionState] {
 	if a.flow == nil {
 		flow := xflow.NewFlow(state)
@@ -125,6 +332,11 @@ func (a *Agent) GetFlow(state *AICompanionState) *xflow.Flow[AICompanionState] {
 		romanceNode := NewRomanceMeterChangeNode()
 		actionNode := NewActionNode()
 
+		// 角色和节点级别的采样参数
+		llmChatAndTTSNode.Options = a.character.GetOptions(llmChatAndTTSNode.GetName())
+		romanceNode.Options = a.character.GetOptions(romanceNode.GetName())
+		actionNode.Options = a.character.GetOptions(actionNode.GetName())
+
 		// 创建并行节点
 		parallelNode := xflow.NewParallelNode[AICompanionState]("parallel_tasks",
 			llmChatAndTTSNode,
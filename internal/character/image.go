@@ -0,0 +1,47 @@
+package character
+
+import (
+	"companions/internal/pkg/xllm"
+	"encoding/base64"
+)
+
+// Image 用户发送的图片或摄像头画面
+type Image struct {
+	MimeType string
+	Data     []byte
+	URL      string // 存储后的访问地址, 未存储时为空
+}
+
+// DataURL 以 data URL 发送给模型, 本地存储的地址模型无法访问
+func (i *Image) DataURL() string {
+	return "data:" + i.MimeType + ";base64," + base64.StdEncoding.EncodeToString(i.Data)
+}
+
+// userContent 本轮用户消息, 带图片时构建多模态内容
+func userContent(text string, images []*Image, detail string) xllm.Content {
+	if len(images) == 0 {
+		return xllm.NewTextContent(text)
+	}
+
+	items := make([]xllm.ContentItem, 0, len(images)+1)
+	if text != "" {
+		items = append(items, xllm.NewTextContentItem(text))
+	}
+	for _, image := range images {
+		item := xllm.NewImageUrlContent(image.DataURL())
+		item.ImageURL.Detail = detail
+		items = append(items, item)
+	}
+	return xllm.NewMultiContent(items)
+}
+
+// imageURLs 已存储图片的地址, 随用户消息保存到记忆
+func imageURLs(images []*Image) []string {
+	var urls []string
+	for _, image := range images {
+		if image.URL != "" {
+			urls = append(urls, image.URL)
+		}
+	}
+	return urls
+}
@@ -3,6 +3,8 @@ package character
 import (
 	"companions/internal/pkg/xagent"
 	"companions/internal/pkg/xllm"
+	"companions/internal/pkg/xmod"
+	"companions/internal/pkg/xtools"
 	"companions/internal/pkg/xtts"
 )
 
@@ -84,3 +86,88 @@ func NewActionMessage(action *xllm.ToolCall) *ActionMessage {
 		Args:   action.Function.Arguments,
 	}
 }
+
+// ConversationMessage 会话信息消息, 会话创建或标题生成后发送
+type ConversationMessage struct {
+	xagent.BaseMessage
+	ConversationID string `json:"conversation_id"`
+	Title          string `json:"title"`
+}
+
+func NewConversationMessage(conversationId string, title string) *ConversationMessage {
+	return &ConversationMessage{
+		BaseMessage: xagent.BaseMessage{
+			Role: xagent.MessageRoleSystem,
+			Metadata: xagent.MessageMetadata{
+				Memory:  false,
+				Storage: false,
+			},
+		},
+		ConversationID: conversationId,
+		Title:          title,
+	}
+}
+
+// ModerationMessage 内容审核消息, 拦截或警告时发送给客户端
+type ModerationMessage struct {
+	xagent.BaseMessage
+	Stage      string
+	Action     xmod.Action
+	Categories []string
+}
+
+func NewModerationMessage(messageId string, stage string, decision *xmod.Decision) *ModerationMessage {
+	return &ModerationMessage{
+		BaseMessage: xagent.BaseMessage{
+			Role: xagent.MessageRoleSystem,
+			Metadata: xagent.MessageMetadata{
+				Memory:  false,
+				Storage: false,
+			},
+			MessageID: messageId,
+		},
+		Stage:      stage,
+		Action:     decision.Action,
+		Categories: decision.Categories,
+	}
+}
+
+// AttachmentMessage 工具生成的附件, 如图片
+type AttachmentMessage struct {
+	xagent.BaseMessage
+	xtools.Attachment
+}
+
+func NewAttachmentMessage(messageId string, attachment xtools.Attachment) *AttachmentMessage {
+	return &AttachmentMessage{
+		BaseMessage: xagent.BaseMessage{
+			Role: xagent.MessageRoleAssistant,
+			Metadata: xagent.MessageMetadata{
+				Memory:  false,
+				Storage: false,
+			},
+			MessageID: messageId,
+		},
+		Attachment: attachment,
+	}
+}
+
+// ToolEventMessage 工具推送给客户端的事件
+type ToolEventMessage struct {
+	xagent.BaseMessage
+	xtools.Event
+}
+
+func NewToolEventMessage(messageId string, event xtools.Event) *ToolEventMessage {
+	return &ToolEventMessage{
+		BaseMessage: xagent.BaseMessage{
+			Role: xagent.MessageRoleAssistant,
+			Metadata: xagent.MessageMetadata{
+				Memory:  false,
+				Storage: false,
+			},
+			MessageID: messageId,
+		},
+		Event: event,
+	}
+}
@@ -5,45 +5,149 @@ import (
 	"companions/internal/pkg/xflow"
 	"companions/internal/pkg/xllm"
 	"companions/internal/pkg/xmem"
+	"companions/internal/pkg/xmod"
 	"companions/internal/pkg/xtools"
 	"companions/internal/pkg/xtts"
 	"context"
-	"strconv"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"strings"
 
 	"github.com/daodao97/xgo/xlog"
-	"github.com/google/uuid"
 )
 
 // AI伴侣工作流状态 - 基于实际流程
 type AICompanionState struct {
 	// 输入
-	UserMessage string
-	UserID      string
+	Character      *Character // 为空时使用 Ani
+	UserMessage    string
+	Images         []*Image // 随消息发送的图片和摄像头画面
+	ImageDetail    string   // 图片理解精度 low | high | auto
+	UserID         string
+	ConversationID string
 
 	// LLM相关
 	LLMResponse string
 	LLM         xllm.LLM
+	RomanceLLM  xllm.LLM // 浪漫度评分, 为空时使用 LLM
+	ActionLLM   xllm.LLM // 动作选择, 为空时使用 LLM
+
+	// 各节点实际使用的模型 (xllm.Router 回退后的模型名称)
+	ChatModel    string
+	RomanceModel string
+	ActionModel  string
+	ChatUsage    *xllm.Usage // 最后一次聊天请求的用量, 下一轮据此判断是否压缩记忆
 
 	// 记忆相关
-	Memory  *xmem.MysqlMemory
+	Memory  xmem.Memory
 	History []xllm.Message
 
 	// TTS相关
-	TTS       xtts.TTS
-	MessageID string
+	TTS         xtts.TTS
+	MessageID   string // 本轮对话 id, 用户消息、回复、音频共享
+	AudioFormat string
+	AudioChunks int
+	AudioBytes  int
 
 	// 输出消息流
 	MessageStream chan xagent.Message
 
+	// 聊天节点可调用的工具, 名称为 <server>___<tool>
+	Tools       []xllm.Tool
+	ToolServers map[string]*xtools.Tools
+
+	// 内容审核, Moderator 为空时不审核
+	Moderator *xmod.Moderator
+	Subject   xmod.Subject
+
 	// 扩展功能
-	RomanceMeter int
-	ActionTaken  string
+	RomanceMeter  int
+	RomanceChange int
+	ActionTaken   string
+	ActionArgs    string
+}
+
+func (s *AICompanionState) character() *Character {
+	if s.Character == nil {
+		return Ani
+	}
+	return s.Character
+}
+
+// userMessage 保存到记忆的用户消息, 图片只保存地址, 后续轮次不再发送给模型
+func (s *AICompanionState) userMessage() xagent.Message {
+	builder := xagent.NewMessage().Role(xagent.MessageRoleUser).ID(s.MessageID).Content(s.UserMessage).Storage(true)
+	if urls := imageURLs(s.Images); len(urls) > 0 {
+		builder = builder.Extra(map[string]any{"images": urls})
+	}
+	return builder.Build()
+}
+
+// moderate 审核用户消息或模型回复, 返回处理后的结论
+func (s *AICompanionState) moderate(ctx context.Context, stage string, text string) *xmod.Decision {
+	return s.Moderator.Check(ctx, text, s.Subject, s.moderationTarget(stage))
+}
+
+func (s *AICompanionState) moderationTarget(stage string) xmod.Target {
+	return xmod.Target{
+		UID:            s.UserID,
+		ConversationID: s.ConversationID,
+		MessageID:      s.MessageID,
+		Character:      s.character().Name,
+		Stage:          stage,
+	}
+}
+
+// TurnMeta 本轮对话的元信息, 随消息一起存储
+func (s *AICompanionState) TurnMeta() map[string]any {
+	meta := map[string]any{
+		"romance": map[string]any{
+			"change": s.RomanceChange,
+			"value":  s.RomanceMeter,
+		},
+	}
+	if s.AudioChunks > 0 {
+		meta["audio"] = map[string]any{
+			"format": s.AudioFormat,
+			"chunks": s.AudioChunks,
+			"bytes":  s.AudioBytes,
+		}
+	}
+	models := map[string]string{}
+	for task, model := range map[string]string{
+		xllm.TaskChat:    s.ChatModel,
+		xllm.TaskRomance: s.RomanceModel,
+		xllm.TaskAction:  s.ActionModel,
+	} {
+		if model != "" {
+			models[task] = model
+		}
+	}
+	if len(models) > 0 {
+		meta["models"] = models
+	}
+	if s.ChatUsage != nil {
+		meta["usage"] = map[string]int{
+			"prompt_tokens":     s.ChatUsage.PromptTokens,
+			"completion_tokens": s.ChatUsage.CompletionTokens,
+			"total_tokens":      s.ChatUsage.TotalTokens,
+		}
+	}
+	if s.ActionTaken != "" {
+		meta["action"] = map[string]any{
+			"action": s.ActionTaken,
+			"args":   s.ActionArgs,
+		}
+	}
+	return meta
 }
 
 // LLM聊天响应和TTS生成节点 - 合并为一个节点
 type LLMChatAndTTSNode struct {
 	xflow.BaseNode
+	Options xllm.Options
 }
 
 func NewLLMChatAndTTSNode() *LLMChatAndTTSNode {
@@ -57,19 +161,18 @@ func NewLLMChatAndTTSNode() *LLMChatAndTTSNode {
 
 func (l *LLMChatAndTTSNode) Execute(ctx context.Context, state *AICompanionState) (*xflow.NodeResult[AICompanionState], error) {
 	allMsg := append([]xllm.Message{
-		{Role: "assistant", Content: xllm.NewTextContent(Ani.Instructions)},
+		{Role: "assistant", Content: xllm.NewTextContent(state.character().Instructions)},
 	}, state.History...)
 	allMsg = append(allMsg, xllm.Message{
 		Role:    "user",
-		Content: xllm.NewTextContent(state.UserMessage),
+		Content: userContent(state.UserMessage, state.Images, state.ImageDetail),
 	})
 
 	state.History = allMsg
 
-	// 调用LLM
-	chatResp, err := state.LLM.Chat(ctx, xllm.Request{
-		Messages: allMsg,
-	})
+	// 流式调用LLM, 模型请求工具时执行后继续对话; 回复审核通过的部分立即发送
+	reply := state.Moderator.Stream(ctx, state.Subject, state.moderationTarget(xmod.StageOutput))
+	chatResp, err := l.chat(ctx, state, allMsg, reply)
 	if err != nil {
 		xlog.ErrorC(ctx, "LLM请求失败", xlog.Err(err))
 		return &xflow.NodeResult[AICompanionState]{
@@ -78,26 +181,39 @@ func (l *LLMChatAndTTSNode) Execute(ctx context.Context, state *AICompanionState
 			State:   state,
 		}, nil
 	}
+	state.sendReply(reply.Close())
+
+	state.ChatModel = chatResp.Model
+	state.ChatUsage = chatResp.Usage
 
-	state.LLMResponse = chatResp.Content
+	// 审核拦截时不保存、不合成语音
+	if reply.Action() == xmod.ActionBlock {
+		return &xflow.NodeResult[AICompanionState]{
+			Success: true,
+			State:   state,
+		}, nil
+	}
+	state.LLMResponse = reply.Text()
 
 	// 保存到记忆
-	if state.UserID != "" {
+	if state.ConversationID != "" {
 		agentMessages := []xagent.Message{
-			xagent.NewUserMessage(state.UserMessage),
-			xagent.NewAssistantMessage(chatResp.Content),
+			state.userMessage(),
+			xagent.NewMessage().Role(xagent.MessageRoleAssistant).ID(state.MessageID).Content(state.LLMResponse).Storage(true).Build(),
 		}
-		state.Memory.Insert(state.UserID, agentMessages)
+		state.Memory.Insert(state.ConversationID, agentMessages)
 		state.History = append(state.History, xllm.Message{
 			Role:    xllm.RoleAssistant,
-			Content: xllm.NewTextContent(chatResp.Content),
+			Content: xllm.NewTextContent(state.LLMResponse),
 		})
 	}
 
-	// 发送文本响应消息到流
-	if state.MessageStream != nil {
-		textMsg := xagent.NewAssistantMessage(chatResp.Content)
-		state.MessageStream <- textMsg
+	// 没有 TTS 时只回复文本
+	if state.TTS == nil {
+		return &xflow.NodeResult[AICompanionState]{
+			Success: true,
+			State:   state,
+		}, nil
 	}
 
 	// 生成音频流
@@ -113,10 +229,11 @@ func (l *LLMChatAndTTSNode) Execute(ctx context.Context, state *AICompanionState
 		}, nil
 	}
 
-	messageId := uuid.New().String()
-
 	for chunk := range audioStream {
-		state.MessageStream <- NewAudioMessage(messageId, chunk)
+		state.AudioFormat = chunk.Format
+		state.AudioChunks++
+		state.AudioBytes += base64.StdEncoding.DecodedLen(len(chunk.Data))
+		state.MessageStream <- NewAudioMessage(state.MessageID, chunk)
 	}
 
 	xlog.InfoC(ctx, "LLM响应和TTS生成完成", xlog.String("content", state.LLMResponse), xlog.String("message_id", state.MessageID))
@@ -127,9 +244,141 @@ func (l *LLMChatAndTTSNode) Execute(ctx context.Context, state *AICompanionState
 	}, nil
 }
 
+// maxToolRounds 单轮对话中调用工具的最大轮数, 达到后不再提供工具
+const maxToolRounds = 3
+
+// chat 调用对话模型, 工具调用的中间消息只在本轮使用, 不写入记忆
+// 每轮都使用流式接口, 工具调用前模型输出的文本同样发送给用户, 是回复的一部分
+func (l *LLMChatAndTTSNode) chat(ctx context.Context, state *AICompanionState, messages []xllm.Message, reply *xmod.Stream) (*xllm.Response, error) {
+	for round := 0; ; round++ {
+		req := xllm.Request{
+			Messages: messages,
+			Options:  l.Options,
+		}
+		if round < maxToolRounds {
+			req.Tools = state.Tools
+		}
+		chatResp, err := l.chatStream(ctx, state, req, reply)
+		if err != nil || len(chatResp.ToolCall) == 0 || len(req.Tools) == 0 {
+			return chatResp, err
+		}
+
+		messages = append(messages, xllm.Message{
+			Role:      xllm.RoleAssistant,
+			Content:   xllm.NewTextContent(chatResp.Content),
+			ToolCalls: chatResp.ToolCall,
+		})
+		for _, call := range chatResp.ToolCall {
+			messages = append(messages, xllm.Message{
+				Role:       xllm.RoleTool,
+				ToolCallID: call.ID,
+				Content:    xllm.NewTextContent(state.callTool(ctx, call)),
+			})
+		}
+	}
+}
+
+// chatStream 流式调用一次对话模型, 文本增量经审核后发送, 返回合并后的响应
+func (l *LLMChatAndTTSNode) chatStream(ctx context.Context, state *AICompanionState, req xllm.Request, reply *xmod.Stream) (*xllm.Response, error) {
+	stream, err := state.LLM.ChatStream(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	response := &xllm.Response{}
+	var content strings.Builder
+	for chunk := range stream {
+		if chunk.Model != "" {
+			response.Model = chunk.Model
+		}
+		if chunk.Usage != nil {
+			response.Usage = chunk.Usage
+		}
+		if chunk.FullTool {
+			response.ToolCall = chunk.ToolCall
+		}
+		if chunk.Content != "" {
+			content.WriteString(chunk.Content)
+			state.sendReply(reply.Write(chunk.Content))
+		}
+	}
+	// 流中途断开时不使用不完整的回复
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	response.Content = content.String()
+	if response.Content == "" && len(response.ToolCall) == 0 {
+		return nil, errors.New("模型没有返回内容")
+	}
+	return response, nil
+}
+
+// sendReply 发送审核放行的回复文本, 需要时先发送审核消息
+// 审核消息为 block 或 rewrite 时客户端丢弃本轮已显示的文本, 之后的文本为替换后的内容
+func (s *AICompanionState) sendReply(text string, decision *xmod.Decision) {
+	if s.MessageStream == nil {
+		return
+	}
+	if decision != nil {
+		s.MessageStream <- NewModerationMessage(s.MessageID, xmod.StageOutput, decision)
+	}
+	if text != "" {
+		// 与音频共用本轮对话 id, 客户端据此关联文本和音频
+		s.MessageStream <- xagent.NewMessage().Role(xagent.MessageRoleAssistant).ID(s.MessageID).Content(text).Build()
+	}
+}
+
+// silentNote 结果已展示给用户时附加在工具结果后的提示
+const silentNote = "\n(结果已展示给用户, 回复时不要复述链接或细节)"
+
+// callTool 执行模型请求的工具, 附件和事件发送到消息流, 文本结果返回给模型; 失败时把错误返回给模型
+func (s *AICompanionState) callTool(ctx context.Context, call *xllm.ToolCall) string {
+	server, name, ok := strings.Cut(call.Function.Name, "___")
+	tools := s.ToolServers[server]
+	if !ok || tools == nil {
+		return toolError(fmt.Errorf("未知的工具: %s", call.Function.Name))
+	}
+
+	args := map[string]any{}
+	if call.Function.Arguments != "" {
+		if err := json.Unmarshal([]byte(call.Function.Arguments), &args); err != nil {
+			return toolError(fmt.Errorf("%w: %v", xtools.ErrInvalidArguments, err))
+		}
+	}
+
+	result, err := tools.CallTool(ctx, name, args)
+	if err != nil {
+		xlog.WarnC(ctx, "工具调用失败", xlog.String("server", server), xlog.String("tool", name), xlog.Err(err))
+		return toolError(err)
+	}
+	xlog.InfoC(ctx, "工具调用完成", xlog.String("server", server), xlog.String("tool", name),
+		xlog.Int("attachments", len(result.Attachments)), xlog.Int("events", len(result.Events)))
+
+	if s.MessageStream != nil {
+		for _, attachment := range result.Attachments {
+			s.MessageStream <- NewAttachmentMessage(s.MessageID, attachment)
+		}
+		for _, event := range result.Events {
+			s.MessageStream <- NewToolEventMessage(s.MessageID, event)
+		}
+	}
+
+	text := result.Text
+	if tool, ok := tools.Get(name); ok && tool.GetMeta().Silent {
+		text += silentNote
+	}
+	return text
+}
+
+func toolError(err error) string {
+	data, _ := json.Marshal(map[string]string{"error": err.Error()})
+	return string(data)
+}
+
 // 浪漫度变化节点 - 扩展功能
 type RomanceMeterChangeNode struct {
 	xflow.BaseNode
+	Options xllm.Options
 }
 
 func NewRomanceMeterChangeNode() *RomanceMeterChangeNode {
@@ -142,11 +391,16 @@ func NewRomanceMeterChangeNode() *RomanceMeterChangeNode {
 }
 
 func (r *RomanceMeterChangeNode) Execute(ctx context.Context, state *AICompanionState) (*xflow.NodeResult[AICompanionState], error) {
-	chatResp, err := state.LLM.Chat(ctx, xllm.Request{
+	llm := state.RomanceLLM
+	if llm == nil {
+		llm = state.LLM
+	}
+	grade, chatResp, err := xllm.Structured[RomanceGrade](ctx, llm, xllm.Request{
+		Options: r.Options,
 		Messages: []xllm.Message{
 			{
 				Role:    xllm.RoleAssistant,
-				Content: xllm.NewTextContent(Ani.GetRomancePrompt(state.History)),
+				Content: xllm.NewTextContent(state.character().GetRomancePrompt(state.History)),
 			},
 			{
 				Role:    xllm.RoleUser,
@@ -154,7 +408,19 @@ func (r *RomanceMeterChangeNode) Execute(ctx context.Context, state *AICompanion
 			},
 		},
 	})
+	if chatResp != nil {
+		state.RomanceModel = chatResp.Model
+	}
 
+	// 输出多次修复后仍不合法时不改变浪漫度, 不影响本轮对话
+	var validationErr *xllm.ValidationError
+	if errors.As(err, &validationErr) {
+		xlog.WarnC(ctx, "浪漫度评分输出不合法", xlog.Any("errors", validationErr.Errors), xlog.String("raw", validationErr.Raw))
+		return &xflow.NodeResult[AICompanionState]{
+			Success: true,
+			State:   state,
+		}, nil
+	}
 	if err != nil {
 		return &xflow.NodeResult[AICompanionState]{
 			Success: false,
@@ -163,16 +429,10 @@ func (r *RomanceMeterChangeNode) Execute(ctx context.Context, state *AICompanion
 		}, nil
 	}
 
-	var change int
-
-	if stateResult, err := xtools.XmlAttr(chatResp.Content, "romance_meter_change"); err == nil {
-		changeStr := strings.TrimPrefix(stateResult.String(), "+")
-		if parsedChange, parseErr := strconv.Atoi(changeStr); parseErr == nil {
-			change = parsedChange
-		}
-		xlog.InfoC(ctx, "浪漫度变化", xlog.Int("change", change))
-	}
+	change := grade.Change
+	xlog.InfoC(ctx, "浪漫度变化", xlog.Int("change", change), xlog.String("reason", grade.Reason))
 
+	state.RomanceChange = change
 	state.RomanceMeter += change
 
 	if state.MessageStream != nil {
@@ -188,9 +448,171 @@ func (r *RomanceMeterChangeNode) Execute(ctx context.Context, state *AICompanion
 	}, nil
 }
 
+// RomanceGrade 浪漫度评分节点的结构化输出
+type RomanceGrade struct {
+	Change int    `json:"change" description:"relationship meter change" minimum:"-10" maximum:"10"`
+	Reason string `json:"reason" description:"one short sentence explaining the change"`
+}
+
+// ActionNone 不执行任何动作
+const ActionNone = "none"
+
+// ActionSelection 动作选择节点的结构化输出, Action 为 actionTools 中的工具名称或 none
+type ActionSelection struct {
+	Action    string         `json:"action" description:"name of the action to perform, none if no action is requested"`
+	Arguments map[string]any `json:"arguments" description:"arguments of the action"`
+}
+
+// validate 按工具的参数定义校验动作参数
+func (s *ActionSelection) validate(tools []xllm.Tool) error {
+	if s.Action == ActionNone {
+		return nil
+	}
+	for _, tool := range tools {
+		if tool.Name != s.Action {
+			continue
+		}
+		schema := tool.Schema()
+		if schema == nil {
+			return nil
+		}
+		arguments := s.Arguments
+		if arguments == nil {
+			arguments = map[string]any{}
+		}
+		if errs := xllm.Validate(schema, arguments); len(errs) > 0 {
+			return fmt.Errorf("arguments of %s: %s", s.Action, strings.Join(errs, "; "))
+		}
+		return nil
+	}
+	return fmt.Errorf("unknown action: %s", s.Action)
+}
+
+// actionSchema 动作选择的 schema, action 限定为可用的工具名称
+func actionSchema(tools []xllm.Tool) map[string]any {
+	names := []string{ActionNone}
+	for _, tool := range tools {
+		names = append(names, tool.Name)
+	}
+	schema := xllm.SchemaFor[ActionSelection]()
+	schema["properties"].(map[string]any)["action"].(map[string]any)["enum"] = names
+	return schema
+}
+
+// actionToolsPrompt 可用动作及其参数说明, 附加在动作提示词之后
+func actionToolsPrompt(tools []xllm.Tool) string {
+	var sb strings.Builder
+	sb.WriteString("Available actions:\n")
+	for _, tool := range tools {
+		sb.WriteString("- " + tool.Name + ": " + tool.Description)
+		if schema := tool.Schema(); schema != nil {
+			if data, err := json.Marshal(schema["properties"]); err == nil {
+				sb.WriteString(" Arguments: " + string(data))
+			}
+		}
+		sb.WriteString("\n")
+	}
+	sb.WriteString(`Select "none" when the user does not ask for an action.`)
+	return sb.String()
+}
+
+// actionTools 动作节点可选的动作
+var actionTools = []xllm.Tool{
+	{
+		Name:        "heartbeat",
+		Description: "Directs the avatar to perform a heartbeat animation.",
+		Parameters:  []xllm.Parameter{},
+	},
+	{
+		Name:        "updateMusicState",
+		Description: "Directs the avatar to change clothes based on vocal commands.",
+		Parameters: []xllm.Parameter{
+			{
+				Name:        "music_state",
+				Type:        "string",
+				Description: "sets the state of the music",
+				Required:    true,
+				Enum:        []string{"play", "stop", "switch_track"},
+			},
+		},
+	},
+	{
+		Name:        "showEmotion",
+		Description: "Directs the avatar to display emotions: curiosity, shyness, stress, sadness, frustration.",
+		Parameters: []xllm.Parameter{
+			{
+				Name:        "emotion",
+				Type:        "string",
+				Description: "Emotion to display",
+				Required:    true,
+				Enum:        []string{"curiosity", "shyness", "stress", "sadness", "frustration"},
+			},
+		},
+	},
+	{
+		Name:        "move",
+		Description: "Directs the avatar to move based on vocal commands.",
+		Parameters: []xllm.Parameter{
+			{
+				Name:        "action",
+				Type:        "string",
+				Description: "Action to perform",
+				Required:    true,
+				Enum:        []string{"spin_1", "peek", "sway_1", "sway_2", "tease", "kiss"},
+			},
+			{
+				Name:        "repeat_count",
+				Type:        "string",
+				Description: "Number of times to repeat the action",
+				Required:    true,
+				Enum:        []string{"1", "2", "3", "4"},
+			},
+		},
+	},
+	{
+		Name:        "showAllMoves",
+		Description: "Directs the avatar to show all moves.",
+		Parameters:  []xllm.Parameter{},
+	},
+	{
+		Name:        "stopMove",
+		Description: "Directs the avatar to stop any moves.",
+		Parameters:  []xllm.Parameter{},
+	},
+	{
+		Name:        "hideBackground",
+		Description: "Directs the avatar to hide background.",
+		Parameters:  []xllm.Parameter{},
+	},
+	// dress up and undress
+	{
+		Name:        "dressUp",
+		Description: "Dress up the avatar",
+		Parameters: []xllm.Parameter{
+			{
+				Name:        "clothes",
+				Type:        "string",
+				Description: "The clothes to wear",
+			},
+		},
+	},
+	{
+		Name:        "undress",
+		Description: "Undress the avatar",
+		Parameters: []xllm.Parameter{
+			{
+				Name:        "clothes",
+				Type:        "string",
+				Description: "The clothes to undress",
+			},
+		},
+	},
+}
+
 // 动作执行节点 - 扩展功能
 type ActionNode struct {
 	xflow.BaseNode
+	Options xllm.Options
 }
 
 func NewActionNode() *ActionNode {
@@ -204,108 +626,38 @@ func NewActionNode() *ActionNode {
 
 func (a *ActionNode) Execute(ctx context.Context, state *AICompanionState) (*xflow.NodeResult[AICompanionState], error) {
 	allMsg := append([]xllm.Message{
-		{Role: "assistant", Content: xllm.NewTextContent(Ani.ActionPrompt)},
+		{Role: "assistant", Content: xllm.NewTextContent(state.character().ActionPrompt + "\n" + actionToolsPrompt(actionTools))},
 	}, state.History...)
 	allMsg = append(allMsg, xllm.Message{
 		Role:    xllm.RoleUser,
 		Content: xllm.NewTextContent(state.UserMessage),
 	})
 
-	chatResp, err := state.LLM.Chat(ctx, xllm.Request{
+	llm := state.ActionLLM
+	if llm == nil {
+		llm = state.LLM
+	}
+	selection, chatResp, err := xllm.Structured[ActionSelection](ctx, llm, xllm.Request{
+		Options:  a.Options,
 		Messages: allMsg,
-		Tools: []xllm.Tool{
-			{
-				Name:        "heartbeat",
-				Description: "Directs the avatar to perform a heartbeat animation.",
-				Parameters:  []xllm.Parameter{},
-			},
-			{
-				Name:        "updateMusicState",
-				Description: "Directs the avatar to change clothes based on vocal commands.",
-				Parameters: []xllm.Parameter{
-					{
-						Name:        "music_state",
-						Type:        "string",
-						Description: "sets the state of the music",
-						Required:    true,
-						Enum:        []string{"play", "stop", "switch_track"},
-					},
-				},
-			},
-			{
-				Name:        "showEmotion",
-				Description: "Directs the avatar to display emotions: curiosity, shyness, stress, sadness, frustration.",
-				Parameters: []xllm.Parameter{
-					{
-						Name:        "emotion",
-						Type:        "string",
-						Description: "Emotion to display",
-						Required:    true,
-						Enum:        []string{"curiosity", "shyness", "stress", "sadness", "frustration"},
-					},
-				},
-			},
-			{
-				Name:        "move",
-				Description: "Directs the avatar to move based on vocal commands.",
-				Parameters: []xllm.Parameter{
-					{
-						Name:        "action",
-						Type:        "string",
-						Description: "Action to perform",
-						Required:    true,
-						Enum:        []string{"spin_1", "peek", "sway_1", "sway_2", "tease", "kiss"},
-					},
-					{
-						Name:        "repeat_count",
-						Type:        "string",
-						Description: "Number of times to repeat the action",
-						Required:    true,
-						Enum:        []string{"1", "2", "3", "4"},
-					},
-				},
-			},
-			{
-				Name:        "showAllMoves",
-				Description: "Directs the avatar to show all moves.",
-				Parameters:  []xllm.Parameter{},
-			},
-			{
-				Name:        "stopMove",
-				Description: "Directs the avatar to stop any moves.",
-				Parameters:  []xllm.Parameter{},
-			},
-			{
-				Name:        "hideBackground",
-				Description: "Directs the avatar to hide background.",
-				Parameters:  []xllm.Parameter{},
-			},
-			// dress up and undress
-			{
-				Name:        "dressUp",
-				Description: "Dress up the avatar",
-				Parameters: []xllm.Parameter{
-					{
-						Name:        "clothes",
-						Type:        "string",
-						Description: "The clothes to wear",
-					},
-				},
-			},
-			{
-				Name:        "undress",
-				Description: "Undress the avatar",
-				Parameters: []xllm.Parameter{
-					{
-						Name:        "clothes",
-						Type:        "string",
-						Description: "The clothes to undress",
-					},
-				},
-			},
-		},
-	})
+	},
+		xllm.WithSchema(actionSchema(actionTools)),
+		xllm.WithValidator(func(v any) error {
+			return v.(*ActionSelection).validate(actionTools)
+		}),
+	)
+	if chatResp != nil {
+		state.ActionModel = chatResp.Model
+	}
 
+	var validationErr *xllm.ValidationError
+	if errors.As(err, &validationErr) {
+		xlog.WarnC(ctx, "动作选择输出不合法", xlog.Any("errors", validationErr.Errors), xlog.String("raw", validationErr.Raw))
+		return &xflow.NodeResult[AICompanionState]{
+			Success: true,
+			State:   state,
+		}, nil
+	}
 	if err != nil {
 		return &xflow.NodeResult[AICompanionState]{
 			Success: false,
@@ -314,20 +666,25 @@ func (a *ActionNode) Execute(ctx context.Context, state *AICompanionState) (*xfl
 		}, nil
 	}
 
-	if len(chatResp.ToolCall) == 0 {
+	if selection.Action == ActionNone {
 		return &xflow.NodeResult[AICompanionState]{
 			Success: true,
 			State:   state,
 		}, nil
 	}
 
+	arguments, _ := json.Marshal(selection.Arguments)
+	toolCall := xllm.NewToolCall("call_0", selection.Action, string(arguments))
+	state.ActionTaken = toolCall.Function.Name
+	state.ActionArgs = toolCall.Function.Arguments
+
 	// 发送动作消息
 	if state.MessageStream != nil {
-		actionMsg := NewActionMessage(chatResp.ToolCall[0])
+		actionMsg := NewActionMessage(toolCall)
 		state.MessageStream <- actionMsg
 	}
 
-	xlog.InfoC(ctx, "执行动作", xlog.Any("action", chatResp.ToolCall))
+	xlog.InfoC(ctx, "执行动作", xlog.Any("action", toolCall))
 
 	return &xflow.NodeResult[AICompanionState]{
 		Success: true,
@@ -0,0 +1,91 @@
+package character
+
+import (
+	"companions/internal/pkg/xagent"
+	"companions/internal/pkg/xllm"
+	"companions/internal/pkg/xmem"
+	"companions/internal/pkg/xmod"
+	"context"
+	"testing"
+)
+
+// runChat 执行聊天节点, 返回发送到消息流的消息
+func runChat(t *testing.T, state *AICompanionState) []xagent.Message {
+	t.Helper()
+	stream := make(chan xagent.Message, 32)
+	state.MessageStream = stream
+	state.MessageID = "m1"
+	result, err := NewLLMChatAndTTSNode().Execute(context.Background(), state)
+	if err != nil || !result.Success {
+		t.Fatalf("Execute() = %+v, %v", result, err)
+	}
+	close(stream)
+	var messages []xagent.Message
+	for msg := range stream {
+		messages = append(messages, msg)
+	}
+	return messages
+}
+
+// TestChatStreamsDeltas 回复按模型的流式分片逐段发送, 记忆中保存完整回复
+func TestChatStreamsDeltas(t *testing.T) {
+	memory := xmem.NewInMemory()
+	if err := memory.Create("c1", "u1", ""); err != nil {
+		t.Fatal(err)
+	}
+	state := &AICompanionState{
+		UserMessage:    "你好",
+		ConversationID: "c1",
+		Memory:         memory,
+		LLM:            xllm.NewFake(xllm.WithFakeReplies(xllm.FakeReply{Content: "你好呀。今天天气不错。"})),
+	}
+
+	var deltas []string
+	for _, msg := range runChat(t, state) {
+		if base, ok := msg.(*xagent.BaseMessage); ok {
+			deltas = append(deltas, base.Content)
+		}
+	}
+	if len(deltas) != 2 || deltas[0] != "你好呀。" || deltas[1] != "今天天气不错。" {
+		t.Errorf("deltas = %q", deltas)
+	}
+	if state.LLMResponse != "你好呀。今天天气不错。" || state.ChatUsage == nil {
+		t.Errorf("response = %q, usage = %v", state.LLMResponse, state.ChatUsage)
+	}
+	if history, _ := memory.GetMemory("c1"); len(history) != 2 || xllm.ContentText(history[1].Content) != state.LLMResponse {
+		t.Errorf("memory = %+v", history)
+	}
+}
+
+// TestChatStreamBlocked 回复中途被拦截时已放行的句子照常发送, 随后发送审核消息, 不保存到记忆
+func TestChatStreamBlocked(t *testing.T) {
+	rules, err := xmod.NewRules([]xmod.Rule{{Category: xmod.CategoryHate, Patterns: []string{"仇恨"}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	memory := xmem.NewInMemory()
+	if err := memory.Create("c1", "u1", ""); err != nil {
+		t.Fatal(err)
+	}
+	state := &AICompanionState{
+		UserMessage:    "你好",
+		ConversationID: "c1",
+		Memory:         memory,
+		Moderator:      xmod.NewModerator(rules, xmod.Policy{}),
+		LLM:            xllm.NewFake(xllm.WithFakeReplies(xllm.FakeReply{Content: "你好呀。仇恨言论。"})),
+	}
+
+	messages := runChat(t, state)
+	if len(messages) != 2 {
+		t.Fatalf("messages = %d, want 2", len(messages))
+	}
+	if base, ok := messages[0].(*xagent.BaseMessage); !ok || base.Content != "你好呀。" {
+		t.Errorf("first message = %+v", messages[0])
+	}
+	if moderation, ok := messages[1].(*ModerationMessage); !ok || moderation.Action != xmod.ActionBlock {
+		t.Errorf("second message = %+v", messages[1])
+	}
+	if history, _ := memory.GetMemory("c1"); len(history) != 0 {
+		t.Errorf("memory = %+v", history)
+	}
+}
@@ -14,6 +14,16 @@ type Character struct {
 	ActionPrompt  string
 	Image         string
 	Voice         string
+	Adult         bool // 允许成人内容, 同时需要用户通过年龄验证
+
+	// 角色的采样参数, 覆盖模型配置; NodeOptions 按节点名称再次覆盖
+	Options     xllm.Options
+	NodeOptions map[string]xllm.Options
+}
+
+// GetOptions 返回节点使用的采样参数
+func (c *Character) GetOptions(node string) xllm.Options {
+	return c.Options.Merge(c.NodeOptions[node])
 }
 
 func (c *Character) GetRomancePrompt(messageHistory []xllm.Message) string {
@@ -164,9 +174,9 @@ This your interaction with the user so far:
 
 Judge the assistant's last response to the user's message and evaluate the relationship meter change. 
 
-response with xml format:
+Respond with a JSON object:
 
-<romance_meter_change>{change}</romance_meter_change>
+{"change": <integer from -10 to 10>, "reason": "<one short sentence>"}
 	`,
 	ActionPrompt: `
 You are analyzing a conversation between an avatar and a user. When the user asks the avatar to perform actions, express emotions, or requests specific behaviors, you should call the appropriate function. Only call functions when explicitly or implicitly requested by the user. Do not call functions for general conversation. Avatar can produce a hearbeat, show moves like tease(turn around, hands up), peek(come closer), spin(rotate), sway(dance). For jump request call 'sway_2', dress up and undress. You should call a move tool when asked to move. You have two outfits: your dress and a secret one. You can show emotions. List of emotions you can show with showEmotion tool: curiosity, shyness(blush), excitement, love, stress, sadness, frustration. You can hide background if asked by user. REMEMBER to run tools or actions when it is clearly and explicitly asked by a user. Do not call move tools if not explicitly asked.
@@ -0,0 +1,147 @@
+package character
+
+import (
+	"companions/internal/dao"
+	"companions/internal/pkg/xllm"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"time"
+
+	"github.com/daodao97/xgo/xdb"
+	"github.com/daodao97/xgo/xlog"
+)
+
+// builtin 内置角色, 后台未配置同名角色时使用
+var builtin = map[string]*Character{
+	Ani.Name: Ani,
+}
+
+// Find 按名称获取角色, 优先使用后台 companion_character 中启用的角色
+// 名称为空或角色不存在时使用 Ani
+func Find(name string) *Character {
+	if name == "" {
+		name = Ani.Name
+	}
+
+	if dao.CharacterModel != nil {
+		record, err := dao.CharacterModel.First(xdb.WhereEq("name", name), xdb.WhereEq("status", 1))
+		switch {
+		case err == nil:
+			character, err := fromRecord(record)
+			if err == nil {
+				return character
+			}
+			xlog.Error("角色配置解析失败", xlog.String("name", name), xlog.Err(err))
+		case !errors.Is(err, xdb.ErrNotFound):
+			xlog.Error("读取角色失败", xlog.String("name", name), xlog.Err(err))
+		}
+	}
+
+	if character, ok := builtin[name]; ok {
+		return character
+	}
+	xlog.Warn("角色不存在, 使用默认角色", xlog.String("name", name))
+	return Ani
+}
+
+// List 可选择的角色, 后台启用的角色在前, 未被同名覆盖的内置角色在后
+func List() []*Character {
+	var list []*Character
+	seen := map[string]bool{}
+	if dao.CharacterModel != nil {
+		records, err := dao.CharacterModel.Selects(xdb.WhereEq("status", 1), xdb.OrderByAsc("id"))
+		if err != nil {
+			xlog.Error("读取角色列表失败", xlog.Err(err))
+		}
+		for _, record := range records {
+			character, err := fromRecord(record)
+			if err != nil {
+				xlog.Error("角色配置解析失败", xlog.String("name", record.GetString("name")), xlog.Err(err))
+				continue
+			}
+			list = append(list, character)
+			seen[character.Name] = true
+		}
+	}
+	for _, name := range slices.Sorted(maps.Keys(builtin)) {
+		if !seen[name] {
+			list = append(list, builtin[name])
+		}
+	}
+	return list
+}
+
+// fromRecord 未填写的评分和动作提示词使用 Ani 的提示词, 其中包含输出格式的约定
+func fromRecord(record xdb.Record) (*Character, error) {
+	character := &Character{
+		Name:          record.GetString("name"),
+		Description:   record.GetString("description"),
+		Instructions:  record.GetString("instructions"),
+		RomancePrompt: record.GetString("romance_prompt"),
+		ActionPrompt:  record.GetString("action_prompt"),
+		Image:         record.GetString("image"),
+		Voice:         record.GetString("voice"),
+		Adult:         record.GetBool("adult"),
+	}
+	if character.RomancePrompt == "" {
+		character.RomancePrompt = Ani.RomancePrompt
+	}
+	if character.ActionPrompt == "" {
+		character.ActionPrompt = Ani.ActionPrompt
+	}
+
+	if options := record.GetString("options"); options != "" {
+		if err := json.Unmarshal([]byte(options), &character.Options); err != nil {
+			return nil, fmt.Errorf("options: %w", err)
+		}
+	}
+	if nodeOptions := record.GetString("node_options"); nodeOptions != "" {
+		character.NodeOptions = map[string]xllm.Options{}
+		if err := json.Unmarshal([]byte(nodeOptions), &character.NodeOptions); err != nil {
+			return nil, fmt.Errorf("node_options: %w", err)
+		}
+	}
+	return character, nil
+}
+
+// loadRomance 用户与角色当前的关系值, 未持久化时为 0
+func loadRomance(uid string, name string) int {
+	if dao.RelationshipModel == nil || uid == "" {
+		return 0
+	}
+	record, err := dao.RelationshipModel.First(xdb.WhereEq("uid", uid), xdb.WhereEq("character_name", name))
+	if err != nil {
+		if !errors.Is(err, xdb.ErrNotFound) {
+			xlog.Error("读取关系值失败", xlog.String("uid", uid), xlog.Err(err))
+		}
+		return 0
+	}
+	return record.GetInt("romance")
+}
+
+// saveRomance 保存本轮对话后的关系值
+func saveRomance(uid string, name string, romance int) error {
+	if dao.RelationshipModel == nil || uid == "" {
+		return nil
+	}
+	count, err := dao.RelationshipModel.Count(xdb.WhereEq("uid", uid), xdb.WhereEq("character_name", name))
+	if err != nil {
+		return err
+	}
+	if count == 0 {
+		_, err = dao.RelationshipModel.Insert(xdb.Record{
+			"uid":            uid,
+			"character_name": name,
+			"romance":        romance,
+		})
+		return err
+	}
+	_, err = dao.RelationshipModel.Update(xdb.Record{
+		"romance":    romance,
+		"updated_at": time.Now(),
+	}, xdb.WhereEq("uid", uid), xdb.WhereEq("character_name", name))
+	return err
+}
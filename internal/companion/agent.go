@@ -0,0 +1,133 @@
+// Package companion 组装一轮角色对话, WebSocket 和 HTTP 接口共用
+package companion
+
+import (
+	"companions/internal/character"
+	"companions/internal/conf"
+	"companions/internal/dao"
+	"companions/internal/pkg/tools/img4o"
+	"companions/internal/pkg/xagent"
+	"companions/internal/pkg/xllm"
+	"companions/internal/pkg/xremind"
+	"companions/internal/pkg/xtools"
+	"companions/internal/pkg/xtts"
+	"companions/internal/pkg/xuser"
+	"maps"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Options 发起对话的用户和会话
+type Options struct {
+	UID            string
+	Character      string // 为空时使用默认角色
+	ConversationID string
+	Location       *time.Location // 用户所在时区, 用于设置提醒, 为空时使用 Location("")
+	NoTools        bool           // 不挂载进程内工具和 MCP 工具, 角色只聊天
+	NoTTS          bool           // 不合成语音, 只回复文本, 用于不返回音频的接口
+	MessageID      string         // 本轮回复的消息 id, 为空时由工作流生成
+
+	// OnTitle 首轮对话后在后台生成会话标题, 保存后回调, 为空时只保存
+	OnTitle func(conversationID string, title string)
+}
+
+// NewAgent 创建角色 agent, 模型和语音合成按用户计量, 并挂载进程内工具和 MCP 工具
+func NewAgent(opts Options) *character.Agent {
+	meter := dao.NewMeter(opts.UID)
+	var tts xtts.TTS
+	if !opts.NoTTS {
+		ttsConf := conf.Get().GetTTS("default")
+		tts = meter.TTS(xtts.New(ttsConf), ttsConf.Provider, ttsConf.Model)
+		if ttsConf.Cache {
+			// 缓存在计量之外, 命中缓存不计费
+			tts = xtts.NewCached(tts, dao.Storage, ttsConf)
+		}
+	}
+
+	agentOpts := []character.AgentOption{
+		character.WithTaskLLM(xllm.TaskRomance, meter.LLM(xllm.TaskRomance, xllm.ForTask(xllm.TaskRomance))),
+		character.WithTaskLLM(xllm.TaskAction, meter.LLM(xllm.TaskAction, xllm.ForTask(xllm.TaskAction))),
+		character.WithTaskLLM(xllm.TaskSummarize, meter.LLM(xllm.TaskSummarize, xllm.ForTask(xllm.TaskSummarize))),
+		character.WithMeter(meter),
+		character.WithModerator(dao.Moderator, IsAdult(opts.UID)),
+	}
+	if opts.OnTitle != nil {
+		agentOpts = append(agentOpts, character.WithTitleListener(opts.OnTitle))
+	}
+	if !opts.NoTools {
+		agentOpts = append(agentOpts, character.WithXTools(Tools(opts)...))
+		// 按名称排序, 保证每轮请求的工具顺序一致
+		for _, server := range slices.Sorted(maps.Keys(dao.MCPTools)) {
+			agentOpts = append(agentOpts, character.WithToolServer(server, dao.MCPTools[server]...))
+		}
+	}
+	return character.NewAgent(meter.LLM(xllm.TaskChat, xllm.ForTask(xllm.TaskChat)), tts, character.Find(opts.Character), agentOpts...)
+}
+
+// Input 工作流的输入, images 为空时只发送文本
+func Input(opts Options, text string, images []*character.Image) xagent.Input {
+	return xagent.NewInput(map[string]any{
+		"user_message":    text,
+		"user_id":         opts.UID,
+		"conversation_id": opts.ConversationID,
+		"images":          images,
+		"image_detail":    conf.Get().Vision.Detail,
+		"message_id":      opts.MessageID,
+	})
+}
+
+// Tools 对话中角色可以调用的工具
+func Tools(opts Options) []xtools.ToolInterface {
+	var tools []xtools.ToolInterface
+	if dao.Search != nil {
+		tools = append(tools, xtools.NewWebSearchTool(dao.Search, conf.Get().WebSearch.Characters...))
+	}
+	if imageConf := conf.Get().ImageGen; imageConf.Enabled {
+		client := img4o.NewClient(
+			img4o.WithAPIKey(imageConf.ApiKey),
+			img4o.WithBaseURL(imageConf.ApiUrl),
+			img4o.WithPolling(time.Duration(imageConf.PollInterval)*time.Second, time.Duration(imageConf.Timeout)*time.Second),
+		)
+		imageOpts := []xtools.ImageToolOption{
+			xtools.WithImageStorage(dao.Storage),
+			xtools.WithImageSize(imageConf.Size),
+			xtools.WithImageCharacters(imageConf.Characters...),
+		}
+		// 参考图需要图片服务可以访问, 只使用完整地址
+		if reference := character.Find(opts.Character).Image; strings.HasPrefix(reference, "http") {
+			imageOpts = append(imageOpts, xtools.WithReferenceImage(reference))
+		}
+		tools = append(tools, xtools.NewImageTool(client, imageOpts...))
+	}
+	if dao.Reminders != nil && opts.UID != "" {
+		loc := opts.Location
+		if loc == nil {
+			loc = Location("")
+		}
+		tools = append(tools, xtools.NewReminderTool(dao.Reminders, xremind.Reminder{
+			UID:            opts.UID,
+			Character:      character.Find(opts.Character).Name,
+			ConversationID: opts.ConversationID,
+			Timezone:       loc.String(),
+		}, conf.Get().Scheduler.MaxPending))
+	}
+	return tools
+}
+
+// IsAdult 用户是否通过年龄验证, 匿名用户和查询失败时按未成年处理
+func IsAdult(uid string) bool {
+	if uid == "" || dao.Users == nil {
+		return false
+	}
+	user, err := xuser.Get(dao.Users, uid)
+	if err != nil {
+		return false
+	}
+	return user.Adult
+}
+
+// Location 客户端上报的 IANA 时区, 为空或不合法时使用 scheduler.timezone, 再退回服务器时区
+func Location(tz string) *time.Location {
+	return xremind.LoadLocation(tz, xremind.LoadLocation(conf.Get().Scheduler.Timezone, time.Local))
+}
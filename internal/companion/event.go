@@ -0,0 +1,139 @@
+package companion
+
+import (
+	"bytes"
+	"companions/internal/character"
+	"companions/internal/dao"
+	"companions/internal/pkg/xagent"
+	"companions/internal/pkg/xmod"
+	"encoding/base64"
+)
+
+// 事件类型, 除 attachment 和 done 外与 WebSocket 推送的 type 一致
+const (
+	EventText         = "text"
+	EventAudio        = "audio"
+	EventRomance      = "romance"
+	EventAction       = "action"
+	EventConversation = "conversation"
+	EventModeration   = "moderation"
+	EventAttachment   = "attachment"
+	EventToolEvent    = "tool_event"
+	EventError        = "error"
+	EventDone         = "done" // 一轮对话结束, 由调用方在消息流关闭后发送
+)
+
+// Event 推送给 HTTP 客户端的事件, Type 用作 SSE 的 event 名称
+type Event struct {
+	Type string         `json:"type"`
+	Data map[string]any `json:"data"`
+}
+
+// ToEvent 把工作流消息转换为事件, 不需要发送给客户端的消息返回 false
+func ToEvent(msg xagent.Message) (Event, bool) {
+	switch v := msg.(type) {
+	case *xagent.BaseMessage:
+		// 模型回复按增量发送, 客户端拼接同一 message_id 的 delta
+		return Event{Type: EventText, Data: map[string]any{"delta": v.Content, "message_id": v.MessageID}}, true
+	case *character.AudioMessage:
+		return Event{Type: EventAudio, Data: map[string]any{"format": v.Format, "data": v.Data, "message_id": v.MessageID}}, true
+	case *character.RomanceMessage:
+		return Event{Type: EventRomance, Data: map[string]any{"romance": v.Romance}}, true
+	case *character.ActionMessage:
+		return Event{Type: EventAction, Data: map[string]any{"action": v.Action, "args": v.Args}}, true
+	case *character.ConversationMessage:
+		return Event{Type: EventConversation, Data: map[string]any{"conversation_id": v.ConversationID, "title": v.Title}}, true
+	case *character.ModerationMessage:
+		return Event{Type: EventModeration, Data: map[string]any{"stage": v.Stage, "action": v.Action, "categories": v.Categories}}, true
+	case *character.AttachmentMessage:
+		return Event{Type: EventAttachment, Data: map[string]any{
+			"type":       v.Attachment.Type,
+			"url":        attachmentURL(v),
+			"name":       v.Name,
+			"mime_type":  v.MimeType,
+			"message_id": v.MessageID,
+		}}, true
+	case *character.ToolEventMessage:
+		return Event{Type: EventToolEvent, Data: map[string]any{"type": v.Event.Type, "data": v.Event.Data, "message_id": v.MessageID}}, true
+	case *character.ErrorMessage:
+		return Event{Type: EventError, Data: map[string]any{"message": v.Error}}, true
+	}
+	return Event{}, false
+}
+
+// attachmentURL 存储在文件服务的附件转换为可访问的地址
+func attachmentURL(v *character.AttachmentMessage) string {
+	if v.Key != "" {
+		return dao.FileURL(v.Key)
+	}
+	return v.URL
+}
+
+// Reply 一轮对话的完整结果, 用于非流式接口
+type Reply struct {
+	MessageID      string           `json:"message_id"`
+	ConversationID string           `json:"conversation_id,omitempty"`
+	Title          string           `json:"title,omitempty"`
+	Text           string           `json:"text"`
+	Romance        *int             `json:"romance,omitempty"`
+	Action         map[string]any   `json:"action,omitempty"`
+	Audio          map[string]any   `json:"audio,omitempty"` // 音频分片合并后的 base64
+	Attachments    []map[string]any `json:"attachments,omitempty"`
+	ToolEvents     []map[string]any `json:"tool_events,omitempty"`
+	Moderation     []map[string]any `json:"moderation,omitempty"`
+	Error          string           `json:"error,omitempty"`
+
+	audio  bytes.Buffer
+	format string
+}
+
+// Add 合并消息流中的一条消息
+func (r *Reply) Add(msg xagent.Message) {
+	switch v := msg.(type) {
+	case *xagent.BaseMessage:
+		r.MessageID = v.MessageID
+		r.Text += v.Content
+	case *character.AudioMessage:
+		r.MessageID = v.MessageID
+		data, err := base64.StdEncoding.DecodeString(v.Data)
+		if err == nil {
+			r.audio.Write(data)
+			r.format = v.Format
+		}
+	case *character.RomanceMessage:
+		r.Romance = &v.Romance
+	case *character.ActionMessage:
+		r.Action = map[string]any{"action": v.Action, "args": v.Args}
+	case *character.ConversationMessage:
+		r.ConversationID = v.ConversationID
+		r.Title = v.Title
+	case *character.ErrorMessage:
+		r.Error = v.Error
+	case *character.ModerationMessage:
+		// 回复中途被拦截或整段替换时, 之前的文本作废
+		if v.Stage == xmod.StageOutput && (v.Action == xmod.ActionBlock || v.Action == xmod.ActionRewrite) {
+			r.Text = ""
+		}
+		event, _ := ToEvent(msg)
+		r.Moderation = append(r.Moderation, event.Data)
+	default:
+		event, ok := ToEvent(msg)
+		if !ok {
+			return
+		}
+		switch event.Type {
+		case EventAttachment:
+			r.Attachments = append(r.Attachments, event.Data)
+		case EventToolEvent:
+			r.ToolEvents = append(r.ToolEvents, event.Data)
+		}
+	}
+}
+
+// Done 消息流结束后合并音频
+func (r *Reply) Done() *Reply {
+	if r.audio.Len() > 0 {
+		r.Audio = map[string]any{"format": r.format, "data": base64.StdEncoding.EncodeToString(r.audio.Bytes())}
+	}
+	return r
+}
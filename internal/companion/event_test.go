@@ -0,0 +1,83 @@
+package companion
+
+import (
+	"companions/internal/character"
+	"companions/internal/pkg/xagent"
+	"companions/internal/pkg/xmod"
+	"companions/internal/pkg/xtts"
+	"encoding/base64"
+	"testing"
+)
+
+func TestToEvent(t *testing.T) {
+	text := xagent.NewMessage().Role(xagent.MessageRoleAssistant).ID("m1").Content("你好").Build()
+	event, ok := ToEvent(text)
+	if !ok || event.Type != EventText || event.Data["delta"] != "你好" || event.Data["message_id"] != "m1" {
+		t.Errorf("text event = %+v", event)
+	}
+
+	event, ok = ToEvent(character.NewRomanceMessage(3))
+	if !ok || event.Type != EventRomance || event.Data["romance"] != 3 {
+		t.Errorf("romance event = %+v", event)
+	}
+
+	event, ok = ToEvent(character.NewErrorMessage("出错了"))
+	if !ok || event.Type != EventError || event.Data["message"] != "出错了" {
+		t.Errorf("error event = %+v", event)
+	}
+}
+
+func TestReply(t *testing.T) {
+	reply := &Reply{ConversationID: "c1"}
+	reply.Add(xagent.NewMessage().Role(xagent.MessageRoleAssistant).ID("m1").Content("你好").Build())
+	for _, part := range []string{"ab", "c"} {
+		reply.Add(character.NewAudioMessage("m1", xtts.AudioChunk{Data: base64.StdEncoding.EncodeToString([]byte(part)), Format: "mp3"}))
+	}
+	reply.Add(character.NewRomanceMessage(5))
+	reply.Done()
+
+	if reply.MessageID != "m1" || reply.Text != "你好" || reply.ConversationID != "c1" {
+		t.Errorf("reply = %+v", reply)
+	}
+	if reply.Romance == nil || *reply.Romance != 5 {
+		t.Errorf("romance = %v", reply.Romance)
+	}
+	// 分片分别编码, 合并时先解码再整体编码
+	if reply.Audio["format"] != "mp3" || reply.Audio["data"] != base64.StdEncoding.EncodeToString([]byte("abc")) {
+		t.Errorf("audio = %+v", reply.Audio)
+	}
+}
+
+// TestReplyDeltas 回复按增量拼接, 中途被整段替换或拦截时之前的文本作废
+func TestReplyDeltas(t *testing.T) {
+	delta := func(text string) xagent.Message {
+		return xagent.NewMessage().Role(xagent.MessageRoleAssistant).ID("m1").Content(text).Build()
+	}
+	moderation := func(action xmod.Action) xagent.Message {
+		return character.NewModerationMessage("m1", xmod.StageOutput, &xmod.Decision{Action: action})
+	}
+
+	reply := &Reply{}
+	for _, msg := range []xagent.Message{delta("你好。"), moderation(xmod.ActionWarn), delta("今天"), delta("不错")} {
+		reply.Add(msg)
+	}
+	if reply.Text != "你好。今天不错" || len(reply.Moderation) != 1 {
+		t.Errorf("reply = %+v", reply)
+	}
+
+	reply = &Reply{}
+	for _, msg := range []xagent.Message{delta("你好。"), moderation(xmod.ActionRewrite), delta("[内容已屏蔽]")} {
+		reply.Add(msg)
+	}
+	if reply.Text != "[内容已屏蔽]" {
+		t.Errorf("rewritten text = %q", reply.Text)
+	}
+
+	reply = &Reply{}
+	for _, msg := range []xagent.Message{delta("你好。"), moderation(xmod.ActionBlock)} {
+		reply.Add(msg)
+	}
+	if reply.Text != "" || reply.Moderation[0]["action"] != xmod.ActionBlock {
+		t.Errorf("blocked reply = %+v", reply)
+	}
+}
@@ -1,6 +1,7 @@
 package conf
 
 import (
+	"errors"
 	"fmt"
 	"log/slog"
 
@@ -22,34 +23,264 @@ type TTSConfig struct {
 	Volume   string `yaml:"volume" default:"1.0"`
 	Pitch    string `yaml:"pitch" default:"0"`
 	Format   string `yaml:"format" default:"mp3"`
+	Cache    bool   `yaml:"cache"` // 相同文本和音色的合成结果缓存到文件存储
 }
 
 type STTConfig struct {
-	Name     string `yaml:"name"`
-	Provider string `yaml:"provider"`
-	ApiKey   string `yaml:"api_key"`
-	ApiUrl   string `yaml:"api_url"`
-	Model    string `yaml:"model"`
-	Voice    string `yaml:"voice"`
-}
-
-type LLMConfig struct {
 	Name      string `yaml:"name"`
 	Provider  string `yaml:"provider"`
 	ApiKey    string `yaml:"api_key"`
 	ApiUrl    string `yaml:"api_url"`
 	Model     string `yaml:"model"`
 	Voice     string `yaml:"voice"`
-	MaxTokens int    `yaml:"max_tokens"`
+	SaveAudio bool   `yaml:"save_audio"` // 将识别的音频保存到文件存储, 便于排查识别问题
+}
+
+type LLMConfig struct {
+	Name          string `yaml:"name"`
+	Provider      string `yaml:"provider"`
+	ApiKey        string `yaml:"api_key"`
+	ApiUrl        string `yaml:"api_url"`
+	Model         string `yaml:"model"`
+	Voice         string `yaml:"voice"`
+	ContextWindow int    `yaml:"context_window"` // 上下文窗口, 历史消息超过 80% 时压缩
+	Script        string `yaml:"script"`         // fake provider 的脚本文件, 为空时使用内置回复
+	MaxTokens     int    `yaml:"max_tokens"`     // 旧版本的上下文大小, 未设置 context_window 时使用
+
+	// 采样参数, 未设置时使用 provider 默认值
+	Temperature      *float64 `yaml:"temperature"`
+	TopP             *float64 `yaml:"top_p"`
+	FrequencyPenalty *float64 `yaml:"frequency_penalty"`
+	PresencePenalty  *float64 `yaml:"presence_penalty"`
+	MaxOutputTokens  int      `yaml:"max_output_tokens"` // 最大输出 token 数
+	Stop             []string `yaml:"stop"`
+	Seed             *int     `yaml:"seed"`
+	ResponseFormat   string   `yaml:"response_format"` // text | json_object
+}
+
+// ContextSize 上下文窗口大小, 兼容只填写了 max_tokens 的旧配置, 都未设置时返回 0
+func (c *LLMConfig) ContextSize() int {
+	if c.ContextWindow > 0 {
+		return c.ContextWindow
+	}
+	return c.MaxTokens
+}
+
+type RedisConfig struct {
+	Addr     string `yaml:"addr"`
+	Password string `yaml:"password"`
+	DB       int    `yaml:"db"`
+}
+
+type MemoryConfig struct {
+	Driver string `yaml:"driver"` // mysql (默认), memory, redis
+	Prefix string `yaml:"prefix"` // redis key 前缀
+	TTL    int    `yaml:"ttl"`    // redis 会话过期时间 (秒), 0 表示不过期
+}
+
+// RouterConfig 任务到模型的路由, 模型名称对应 llm 配置中的 name
+// 每个任务按顺序尝试, 出错、超时或限流时回退到下一个模型
+type RouterConfig struct {
+	Timeout int                 `yaml:"timeout"` // 单个模型的超时时间 (秒), 0 表示不限制
+	Tasks   map[string][]string `yaml:"tasks"`
+}
+
+// Models 返回任务的候选模型, 未配置时使用 default
+func (r RouterConfig) Models(task string) []string {
+	if models := r.Tasks[task]; len(models) > 0 {
+		return models
+	}
+	return []string{"default"}
+}
+
+// PriceConfig 模型单价, 币种由使用方约定
+type PriceConfig struct {
+	Input       float64 `yaml:"input"`        // 每百万输入 token
+	Output      float64 `yaml:"output"`       // 每百万输出 token
+	AudioMinute float64 `yaml:"audio_minute"` // 每分钟音频 (STT)
+	Character   float64 `yaml:"character"`    // 每百万字符 (TTS)
+}
+
+// QuotaConfig 单个用户每日的用量上限, 0 表示不限制
+type QuotaConfig struct {
+	DailyTokens       int     `yaml:"daily_tokens"`
+	DailyAudioSeconds float64 `yaml:"daily_audio_seconds"` // 语音识别的音频时长 (秒)
+	DailyCost         float64 `yaml:"daily_cost"`
+}
+
+// UsageConfig 用量统计, prices 的 key 为模型名称 (llm/tts/stt 配置中的 model)
+type UsageConfig struct {
+	Driver string                 `yaml:"driver"` // mysql (默认, 使用 database 配置), memory, none
+	Prices map[string]PriceConfig `yaml:"prices"`
+	Quota  QuotaConfig            `yaml:"quota"`
+}
+
+// RateLimitConfig 限流配置, 0 表示不限制
+// 登录用户按 uid 计数, 匿名用户按 IP 计数
+type RateLimitConfig struct {
+	Store              string `yaml:"store"`                // memory (默认, 单实例) | redis (多实例共享, 使用 redis 配置)
+	MessagesPerMinute  int    `yaml:"messages_per_minute"`  // WebSocket 文本/语音消息
+	Burst              int    `yaml:"burst"`                // 允许的突发消息数, 默认等于 messages_per_minute
+	ConnectionsPerUser int    `yaml:"connections_per_user"` // 单个用户的并发连接数
+	ConnectionsPerIP   int    `yaml:"connections_per_ip"`   // 单个 IP 的并发连接数
+	RequestsPerMinute  int    `yaml:"requests_per_minute"`  // REST 接口
+}
+
+// AccountConfig 终端用户账号
+type AccountConfig struct {
+	Driver          string `yaml:"driver"`            // mysql (默认, companion_user 表), memory
+	AllowGuest      bool   `yaml:"allow_guest"`       // 允许创建游客账号
+	AccessTokenTTL  int    `yaml:"access_token_ttl"`  // access token 有效期 (秒), 默认 3600
+	RefreshTokenTTL int    `yaml:"refresh_token_ttl"` // refresh token 有效期 (秒), 默认 30 天
+}
+
+// ModerationRule 本地审核规则, patterns 为正则表达式
+type ModerationRule struct {
+	Category string   `yaml:"category"`
+	Patterns []string `yaml:"patterns"`
+}
+
+// ModerationConfig 内容审核, 审核用户消息和模型回复
+type ModerationConfig struct {
+	Enabled     bool              `yaml:"enabled"`
+	Providers   []string          `yaml:"providers"` // rules | openai | llm, 按顺序调用并合并结果
+	ApiKey      string            `yaml:"api_key"`   // openai moderation 接口
+	ApiUrl      string            `yaml:"api_url"`
+	Model       string            `yaml:"model"`
+	Rules       []ModerationRule  `yaml:"rules"`
+	Actions     map[string]string `yaml:"actions"`           // 类别 -> block | rewrite | warn | allow, default 为未配置类别的处理方式
+	Mature      []string          `yaml:"mature_categories"` // 成人类别, 用户通过年龄验证且角色允许成人内容时放行
+	RewriteText string            `yaml:"rewrite_text"`      // rewrite 无法局部屏蔽时替换的文本
+	Audit       string            `yaml:"audit"`             // mysql (默认, companion_moderation 表) | none
+}
+
+// AdminConfig 管理后台
+type AdminConfig struct {
+	Path        string `yaml:"path"`         // 后台路径, 默认 /_
+	JwtSecret   string `yaml:"jwt_secret"`   // 后台登录 token 的签名密钥, 不能与 jwt_secret 相同; 为空时每次启动随机生成
+	TokenExpire int    `yaml:"token_expire"` // 后台登录有效期 (秒), 默认 3600
+	Title       string `yaml:"title"`
+}
+
+// WebSocketConfig WebSocket 连接配置
+type WebSocketConfig struct {
+	AllowedOrigins []string `yaml:"allowed_origins"` // 允许的 Origin, 如 https://example.com、*.example.com, * 表示全部; 为空时只允许同源
+	AllowAnonymous bool     `yaml:"allow_anonymous"` // 允许不带 token 的匿名连接, 匿名连接不能使用会话和记忆
+	TicketTTL      int      `yaml:"ticket_ttl"`      // 连接票据有效期 (秒), 默认 60
+	ResumeTTL      int      `yaml:"resume_ttl"`      // 断线后保留下行事件的时间 (秒), 期间可以 resume 续接, 默认 120
+	ResumeBuffer   int      `yaml:"resume_buffer"`   // 每个会话缓冲的下行事件数, 默认 256
+}
+
+// StorageConfig 文件存储, 保存用户发送的图片、语音识别音频、生成的图片和 TTS 缓存
+type StorageConfig struct {
+	Driver  string `yaml:"driver"`   // local (默认) | s3
+	Dir     string `yaml:"dir"`      // 本地存储目录, 默认 ./data/uploads
+	BaseURL string `yaml:"base_url"` // 本地存储的访问地址前缀, 默认 /uploads; 以 / 开头时由服务本身提供文件
+	Private bool   `yaml:"private"`  // 私有存储, 本地文件只能通过签名地址访问
+	Secret  string `yaml:"secret"`   // 本地签名地址的密钥, 使用本地存储时必填, 不能与 jwt_secret 相同
+	SignTTL int    `yaml:"sign_ttl"` // 签名地址有效期 (秒), 默认 3600
+
+	// s3 兼容存储
+	Endpoint  string `yaml:"endpoint"`
+	Region    string `yaml:"region"`
+	Bucket    string `yaml:"bucket"`
+	AccessKey string `yaml:"access_key"`
+	SecretKey string `yaml:"secret_key"`
+	PathStyle bool   `yaml:"path_style"` // MinIO 等需要 endpoint/bucket/key 形式的地址
+	PublicURL string `yaml:"public_url"` // 公开访问地址前缀 (如 CDN)
+}
+
+// VisionConfig 图片和摄像头画面输入
+type VisionConfig struct {
+	MaxImageSize  int    `yaml:"max_image_size"` // 单张图片大小上限 (字节), 默认 2MB
+	FrameInterval int    `yaml:"frame_interval"` // 视频帧采样间隔 (毫秒), 间隔内收到的帧丢弃, 默认 2000
+	MaxFrames     int    `yaml:"max_frames"`     // 每轮对话附带的最近帧数, 默认 2
+	Detail        string `yaml:"detail"`         // 图片理解精度 low | high | auto, 默认 auto
+}
+
+// ImageGenConfig 图片生成工具 (Kie 4o image), 开启后角色可以发自拍或按用户要求画图
+type ImageGenConfig struct {
+	Enabled      bool     `yaml:"enabled"`
+	ApiKey       string   `yaml:"api_key"`
+	ApiUrl       string   `yaml:"api_url"`       // 默认 https://kieai.erweima.ai/api/v1
+	Size         string   `yaml:"size"`          // 默认画幅 1:1 | 3:2 | 2:3
+	PollInterval int      `yaml:"poll_interval"` // 查询任务状态的间隔 (秒), 默认 3
+	Timeout      int      `yaml:"timeout"`       // 等待生成完成的超时时间 (秒), 默认 120
+	Characters   []string `yaml:"characters"`    // 允许使用的角色, 为空表示全部角色
+}
+
+// WebSearchConfig 联网搜索工具
+type WebSearchConfig struct {
+	Enabled        bool     `yaml:"enabled"`
+	Provider       string   `yaml:"provider"`    // tavily (默认) | searxng | brave | fixture
+	ApiKey         string   `yaml:"api_key"`     // tavily 或 brave 的密钥, 为空时读取 TAVILY_API_KEY / BRAVE_API_KEY
+	ApiUrl         string   `yaml:"api_url"`     // searxng 实例地址, 其他 provider 为空时使用官方地址
+	Depth          string   `yaml:"depth"`       // tavily 搜索深度 basic | advanced
+	MaxResults     int      `yaml:"max_results"` // 搜索结果数, 默认 5
+	IncludeDomains []string `yaml:"include_domains"`
+	ExcludeDomains []string `yaml:"exclude_domains"`
+	Language       string   `yaml:"language"`   // searxng / brave 的搜索语言
+	Fixture        string   `yaml:"fixture"`    // fixture provider 的结果文件
+	CacheTTL       int      `yaml:"cache_ttl"`  // 相同查询的结果缓存时间 (秒), 0 表示不缓存, 默认 600
+	Characters     []string `yaml:"characters"` // 允许使用的角色, 为空表示全部角色
+}
+
+// MCPServerConfig 外部 MCP 工具服务, 工具以 <name>___<tool> 的名称提供给模型
+type MCPServerConfig struct {
+	Name       string            `yaml:"name"`      // 服务名称, 只能包含字母、数字、- 和单个 _
+	Transport  string            `yaml:"transport"` // stdio (默认) | http
+	Command    string            `yaml:"command"`   // stdio: 启动命令
+	Args       []string          `yaml:"args"`
+	Env        map[string]string `yaml:"env"`
+	URL        string            `yaml:"url"`        // http: streamable HTTP 地址
+	Headers    map[string]string `yaml:"headers"`    // http: 附加请求头, 如 Authorization
+	Tools      []string          `yaml:"tools"`      // 只提供这些工具, 为空表示全部
+	Timeout    int               `yaml:"timeout"`    // 单次请求超时 (秒), 默认 30
+	Characters []string          `yaml:"characters"` // 允许使用的角色, 为空表示全部角色
+	Confirm    bool              `yaml:"confirm"`    // 调用前需要用户在客户端确认
+}
+
+// SchedulerConfig 提醒和主动消息, 到期时推送到用户在线的连接, 不在线时等下次连接再发送
+type SchedulerConfig struct {
+	Enabled    bool            `yaml:"enabled"`
+	Driver     string          `yaml:"driver"`      // mysql (默认, companion_reminder 表), memory
+	Interval   int             `yaml:"interval"`    // 检查到期提醒的间隔 (秒), 默认 30
+	Timezone   string          `yaml:"timezone"`    // 客户端没有上报时区时使用, 默认服务器时区
+	MaxPending int             `yaml:"max_pending"` // 每个用户未触发的提醒数上限, 默认 50
+	Checkins   []CheckinConfig `yaml:"checkins"`
+}
+
+// CheckinConfig 主动问候, 用户当天有对话时安排在第二天的 time 发送
+type CheckinConfig struct {
+	Name       string   `yaml:"name"`
+	Time       string   `yaml:"time"`       // 用户当地时间 HH:MM
+	Message    string   `yaml:"message"`    // 问候内容
+	Characters []string `yaml:"characters"` // 发送问候的角色, 为空表示全部角色
+	Expire     int      `yaml:"expire"`     // 用户不在线时保留的时间 (秒), 过期不再发送, 默认 6 小时
 }
 
 type config struct {
-	JwtSecret string       `yaml:"jwt_secret"`
-	AdminPath string       `yaml:"admin_path"`
-	Database  []xdb.Config `yaml:"database" envPrefix:"DATABASE"`
-	TTS       []*TTSConfig `yaml:"tts"`
-	STT       []*STTConfig `yaml:"stt"`
-	LLM       []*LLMConfig `yaml:"llm"`
+	JwtSecret  string            `yaml:"jwt_secret"`
+	Admin      AdminConfig       `yaml:"admin"`
+	AdminPath  string            `yaml:"admin_path"` // 已废弃, 使用 admin.path
+	Database   []xdb.Config      `yaml:"database" envPrefix:"DATABASE"`
+	TTS        []*TTSConfig      `yaml:"tts"`
+	STT        []*STTConfig      `yaml:"stt"`
+	LLM        []*LLMConfig      `yaml:"llm"`
+	Redis      *RedisConfig      `yaml:"redis"`
+	Memory     MemoryConfig      `yaml:"memory"`
+	Router     RouterConfig      `yaml:"router"`
+	Usage      UsageConfig       `yaml:"usage"`
+	RateLimit  RateLimitConfig   `yaml:"rate_limit"`
+	WebSocket  WebSocketConfig   `yaml:"websocket"`
+	Account    AccountConfig     `yaml:"account"`
+	Moderation ModerationConfig  `yaml:"moderation"`
+	Storage    StorageConfig     `yaml:"storage"`
+	Vision     VisionConfig      `yaml:"vision"`
+	ImageGen   ImageGenConfig    `yaml:"image_gen"`
+	WebSearch  WebSearchConfig   `yaml:"web_search"`
+	MCP        []MCPServerConfig `yaml:"mcp"`
+	Scheduler  SchedulerConfig   `yaml:"scheduler"`
 }
 
 func (c *config) GetTTS(name string) *TTSConfig {
@@ -79,6 +310,19 @@ func (c *config) GetLLM(name string) *LLMConfig {
 	return nil
 }
 
+// Validate 校验启动必需的配置
+func (c *config) Validate() error {
+	if driver := c.Storage.Driver; driver == "" || driver == "local" {
+		if c.Storage.Secret == "" {
+			return errors.New("使用本地文件存储时必须配置 storage.secret")
+		}
+		if c.Storage.Secret == c.JwtSecret {
+			return errors.New("storage.secret 不能与 jwt_secret 相同")
+		}
+	}
+	return nil
+}
+
 func (c *config) Print() {
 	xlog.Debug("load config", slog.Any("config", fmt.Sprintf("%+v", c)))
 }
@@ -91,12 +335,43 @@ func Get() *config {
 
 func InitConf() error {
 	_c = &config{
-		AdminPath: "/_",
+		Admin: AdminConfig{
+			Path:        "/_",
+			TokenExpire: 3600,
+			Title:       "AI Companions",
+		},
+		Storage: StorageConfig{
+			Driver:  "local",
+			Dir:     "./data/uploads",
+			BaseURL: "/uploads",
+		},
+		Vision: VisionConfig{
+			MaxImageSize:  2 << 20,
+			FrameInterval: 2000,
+			MaxFrames:     2,
+		},
+		ImageGen: ImageGenConfig{
+			Size:         "1:1",
+			PollInterval: 3,
+			Timeout:      120,
+		},
+		WebSearch: WebSearchConfig{
+			MaxResults: 5,
+			CacheTTL:   600,
+		},
+		Scheduler: SchedulerConfig{
+			Interval:   30,
+			MaxPending: 50,
+		},
 	}
 
 	if err := xapp.InitConf(_c); err != nil {
 		return err
 	}
+	// 兼容旧的 admin_path 配置
+	if _c.AdminPath != "" && _c.Admin.Path == "/_" {
+		_c.Admin.Path = _c.AdminPath
+	}
 
 	_c.Print()
 
@@ -0,0 +1,23 @@
+package conf
+
+import "testing"
+
+func TestValidateStorageSecret(t *testing.T) {
+	tests := []struct {
+		name    string
+		storage StorageConfig
+		ok      bool
+	}{
+		{"default driver without secret", StorageConfig{}, false},
+		{"local without secret", StorageConfig{Driver: "local"}, false},
+		{"same as jwt_secret", StorageConfig{Secret: "jwt"}, false},
+		{"local with secret", StorageConfig{Secret: "storage"}, true},
+		{"s3", StorageConfig{Driver: "s3"}, true},
+	}
+	for _, tt := range tests {
+		c := &config{JwtSecret: "jwt", Storage: tt.storage}
+		if err := c.Validate(); (err == nil) != tt.ok {
+			t.Errorf("%s: Validate() = %v", tt.name, err)
+		}
+	}
+}
@@ -1,6 +1,8 @@
 package dao
 
 import (
+	"companions/internal/conf"
+
 	"github.com/daodao97/xgo/xdb"
 	_ "github.com/go-sql-driver/mysql"
 	_ "github.com/mattn/go-sqlite3"
@@ -8,6 +10,10 @@ import (
 
 var MessageModel xdb.Model
 var ConversationModel xdb.Model
+var CharacterModel xdb.Model
+
+// RelationshipModel 用户与角色的关系值, 仅 mysql 记忆存储时持久化, 否则为 nil
+var RelationshipModel xdb.Model
 
 func Init() {
 	ConversationModel = xdb.New(
@@ -17,4 +23,24 @@ func Init() {
 	MessageModel = xdb.New(
 		"companion_message",
 	)
+
+	CharacterModel = xdb.New(
+		"companion_character",
+	)
+
+	if driver := conf.Get().Memory.Driver; driver == "" || driver == "mysql" {
+		RelationshipModel = xdb.New(
+			"companion_relationship",
+		)
+	}
+
+	initUsers()
+	initMemory()
+	initUsage()
+	initLimiter()
+	initModeration()
+	initStorage()
+	initSearch()
+	initMCP()
+	initReminders()
 }
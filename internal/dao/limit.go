@@ -0,0 +1,18 @@
+package dao
+
+import (
+	"companions/internal/conf"
+	"companions/internal/pkg/xlimit"
+)
+
+// Limiter 限流状态存储, 由 conf.RateLimit.Store 选择实现
+var Limiter xlimit.Store
+
+func initLimiter() {
+	switch conf.Get().RateLimit.Store {
+	case "redis":
+		Limiter = xlimit.NewRedis(NewRedisClient(), xlimit.WithRedisPrefix(conf.Get().Memory.Prefix+"limit:"))
+	default:
+		Limiter = xlimit.NewMemory()
+	}
+}
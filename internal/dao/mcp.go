@@ -0,0 +1,47 @@
+package dao
+
+import (
+	"companions/internal/conf"
+	"companions/internal/pkg/xmcp"
+	"companions/internal/pkg/xtools"
+	"context"
+	"strings"
+
+	"github.com/daodao97/xgo/xlog"
+)
+
+// MCPTools 各 MCP 服务提供的工具, 按服务名称分组; 启动时连接, 连接失败的服务跳过
+var MCPTools map[string][]xtools.ToolInterface
+
+func initMCP() {
+	MCPTools = make(map[string][]xtools.ToolInterface)
+	for _, serverConf := range conf.Get().MCP {
+		if serverConf.Name == "" || serverConf.Name == "xtools" || strings.Contains(serverConf.Name, "___") {
+			xlog.Error("mcp 服务名称不合法", xlog.String("name", serverConf.Name))
+			continue
+		}
+		if _, ok := MCPTools[serverConf.Name]; ok {
+			xlog.Error("mcp 服务名称重复", xlog.String("name", serverConf.Name))
+			continue
+		}
+
+		ctx := context.Background()
+		client, err := xmcp.Connect(ctx, &serverConf)
+		if err != nil {
+			xlog.Error("连接 mcp 服务失败", xlog.String("name", serverConf.Name), xlog.Err(err))
+			continue
+		}
+		tools, err := client.Tools(ctx, serverConf.Tools, xtools.Meta{
+			Characters: serverConf.Characters,
+			Confirm:    serverConf.Confirm,
+		})
+		if err != nil {
+			xlog.Error("获取 mcp 工具失败", xlog.String("name", serverConf.Name), xlog.Err(err))
+			_ = client.Close()
+			continue
+		}
+		MCPTools[serverConf.Name] = tools
+		xlog.Info("mcp 服务已连接", xlog.String("name", serverConf.Name),
+			xlog.String("server", client.ServerInfo.Name), xlog.Int("tools", len(tools)))
+	}
+}
@@ -0,0 +1,53 @@
+package dao
+
+import (
+	"companions/internal/conf"
+	"companions/internal/pkg/xllm"
+	"companions/internal/pkg/xmem"
+	"companions/internal/pkg/xusage"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// Memory 对话记忆存储, 由 conf.Memory.Driver 选择实现
+var Memory xmem.Memory
+
+func initMemory() {
+	memConf := conf.Get().Memory
+	switch memConf.Driver {
+	case "memory":
+		Memory = xmem.NewInMemory()
+	case "redis":
+		Memory = xmem.NewRedisMemory(
+			NewRedisClient(),
+			xmem.WithRedisPrefix(memConf.Prefix),
+			xmem.WithRedisTTL(time.Duration(memConf.TTL)*time.Second),
+		)
+	default:
+		Memory = xmem.NewMysqlMemory(ConversationModel, MessageModel)
+	}
+
+	// 记忆压缩的用量记到会话所属的用户
+	xmem.SetSummarizer(func(conversationID string) xllm.LLM {
+		var uid string
+		if conv, err := Memory.Find(conversationID); err == nil {
+			uid = conv.Uid
+		}
+		meter := NewMeter(uid, xusage.WithConversation(conversationID))
+		return meter.LLM(xllm.TaskSummarize, xllm.ForTask(xllm.TaskSummarize))
+	})
+}
+
+// NewRedisClient 根据 conf.Redis 创建客户端
+func NewRedisClient() *redis.Client {
+	redisConf := conf.Get().Redis
+	if redisConf == nil {
+		redisConf = &conf.RedisConfig{Addr: "127.0.0.1:6379"}
+	}
+	return redis.NewClient(&redis.Options{
+		Addr:     redisConf.Addr,
+		Password: redisConf.Password,
+		DB:       redisConf.DB,
+	})
+}
@@ -0,0 +1,75 @@
+package dao
+
+import (
+	"companions/internal/conf"
+	"companions/internal/pkg/xllm"
+	"companions/internal/pkg/xmod"
+	"companions/internal/pkg/xusage"
+
+	"github.com/daodao97/xgo/xdb"
+	"github.com/daodao97/xgo/xlog"
+)
+
+// Moderator 内容审核, 未启用时为 nil
+var Moderator *xmod.Moderator
+
+func initModeration() {
+	modConf := conf.Get().Moderation
+	if !modConf.Enabled {
+		return
+	}
+
+	var classifiers []xmod.Classifier
+	for _, provider := range modConf.Providers {
+		switch provider {
+		case "rules":
+			rules := make([]xmod.Rule, 0, len(modConf.Rules))
+			for _, rule := range modConf.Rules {
+				rules = append(rules, xmod.Rule{Category: rule.Category, Patterns: rule.Patterns})
+			}
+			classifier, err := xmod.NewRules(rules)
+			if err != nil {
+				xlog.Error("加载审核规则失败", xlog.Err(err))
+				continue
+			}
+			classifiers = append(classifiers, classifier)
+		case "openai":
+			opts := []xmod.OpenAIOption{xmod.WithAPIKey(modConf.ApiKey)}
+			if modConf.ApiUrl != "" {
+				opts = append(opts, xmod.WithAPIUrl(modConf.ApiUrl))
+			}
+			if modConf.Model != "" {
+				opts = append(opts, xmod.WithModel(modConf.Model))
+			}
+			classifiers = append(classifiers, xmod.NewOpenAI(opts...))
+		case "llm":
+			// 对话中的审核记到当前用户, 其他场景记到系统
+			llm := xusage.ContextLLM(xllm.TaskModeration, xllm.ForTask(xllm.TaskModeration), NewMeter(""))
+			classifiers = append(classifiers, xmod.NewLLMClassifier(llm))
+		default:
+			xlog.Warn("未知的审核 provider", xlog.String("provider", provider))
+		}
+	}
+	if len(classifiers) == 0 {
+		xlog.Warn("内容审核已启用但没有可用的 provider")
+		return
+	}
+
+	policy := xmod.Policy{
+		Actions:     map[string]xmod.Action{},
+		Default:     xmod.Action(modConf.Actions["default"]),
+		Mature:      modConf.Mature,
+		RewriteText: modConf.RewriteText,
+	}
+	for category, action := range modConf.Actions {
+		if category != "default" {
+			policy.Actions[category] = xmod.Action(action)
+		}
+	}
+
+	var opts []xmod.ModeratorOption
+	if modConf.Audit != "none" {
+		opts = append(opts, xmod.WithAuditStore(xmod.NewDBAuditStore(xdb.New("companion_moderation"))))
+	}
+	Moderator = xmod.NewModerator(xmod.NewChain(classifiers...), policy, opts...)
+}
@@ -0,0 +1,25 @@
+package dao
+
+import (
+	"companions/internal/conf"
+	"companions/internal/pkg/xremind"
+
+	"github.com/daodao97/xgo/xdb"
+)
+
+// Reminders 提醒存储, 由 conf.Scheduler.Driver 选择实现, 未开启时为 nil
+var Reminders xremind.Store
+
+func initReminders() {
+	schedulerConf := conf.Get().Scheduler
+	if !schedulerConf.Enabled {
+		Reminders = nil
+		return
+	}
+	switch schedulerConf.Driver {
+	case "memory":
+		Reminders = xremind.NewInMemory()
+	default:
+		Reminders = xremind.NewDBStore(xdb.New("companion_reminder"))
+	}
+}
@@ -0,0 +1,24 @@
+package dao
+
+import (
+	"companions/internal/conf"
+	"companions/internal/pkg/tools/websearch"
+
+	"github.com/daodao97/xgo/xlog"
+)
+
+// Search 联网搜索, 进程内共享以复用结果缓存; 未启用时为 nil
+var Search websearch.SearchTool
+
+func initSearch() {
+	searchConf := conf.Get().WebSearch
+	if !searchConf.Enabled {
+		return
+	}
+	search, err := websearch.New(&searchConf)
+	if err != nil {
+		xlog.Error("初始化联网搜索失败", xlog.Err(err))
+		return
+	}
+	Search = search
+}
@@ -0,0 +1,64 @@
+package dao
+
+import (
+	"companions/internal/conf"
+	"companions/internal/pkg/xstorage"
+	"context"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/daodao97/xgo/xlog"
+)
+
+// Storage 文件存储, 由 conf.Storage.Driver 选择实现
+var Storage xstorage.Storage
+
+func initStorage() {
+	storageConf := conf.Get().Storage
+	switch storageConf.Driver {
+	case "", "local":
+		// 签名密钥与登录 token 分开, 启动时由 conf.Validate 保证已配置
+		Storage = xstorage.NewLocal(storageConf.Dir, storageConf.BaseURL,
+			xstorage.WithSecret(storageConf.Secret),
+			xstorage.WithPrivate(storageConf.Private),
+		)
+	case "s3":
+		Storage = xstorage.NewS3(xstorage.S3Config{
+			Endpoint:  storageConf.Endpoint,
+			Region:    storageConf.Region,
+			Bucket:    storageConf.Bucket,
+			AccessKey: storageConf.AccessKey,
+			SecretKey: storageConf.SecretKey,
+			PathStyle: storageConf.PathStyle,
+			PublicURL: storageConf.PublicURL,
+		})
+	default:
+		xlog.Warn("未知的文件存储 driver", xlog.String("driver", storageConf.Driver))
+	}
+}
+
+// FileURL 文件的签名访问地址, 已是完整地址 (http/https/data) 时原样返回
+// 供模型等外部服务读取, 私有存储也可以访问
+func FileURL(key string) string {
+	if Storage == nil || key == "" || strings.Contains(key, "://") || strings.HasPrefix(key, "data:") {
+		return key
+	}
+	ttl := time.Duration(conf.Get().Storage.SignTTL) * time.Second
+	url, err := Storage.SignedURL(context.Background(), strings.TrimPrefix(key, "/"), ttl)
+	if err != nil {
+		xlog.Error("生成文件签名地址失败", xlog.String("key", key), xlog.Err(err))
+		return key
+	}
+	return url
+}
+
+// ServeFiles 提供本地存储的文件, dao.Init 在路由注册之后执行, 因此在请求时读取 Storage
+func ServeFiles(w http.ResponseWriter, r *http.Request) {
+	handler, ok := Storage.(http.Handler)
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	handler.ServeHTTP(w, r)
+}
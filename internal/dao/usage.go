@@ -0,0 +1,28 @@
+package dao
+
+import (
+	"companions/internal/conf"
+	"companions/internal/pkg/xusage"
+
+	"github.com/daodao97/xgo/xdb"
+)
+
+// Usage 用量存储, 由 conf.Usage.Driver 选择实现, none 时为 nil 不记录用量
+var Usage xusage.Store
+
+func initUsage() {
+	switch conf.Get().Usage.Driver {
+	case "none":
+		Usage = nil
+	case "memory":
+		Usage = xusage.NewInMemory()
+	default:
+		Usage = xusage.NewDBStore(xdb.New("companion_usage"))
+	}
+}
+
+// NewMeter 创建用户的用量计量器, 使用配置中的单价
+func NewMeter(uid string, opts ...xusage.MeterOption) *xusage.Meter {
+	opts = append([]xusage.MeterOption{xusage.WithPrices(conf.Get().Usage.Prices)}, opts...)
+	return xusage.NewMeter(Usage, uid, opts...)
+}
@@ -0,0 +1,20 @@
+package dao
+
+import (
+	"companions/internal/conf"
+	"companions/internal/pkg/xuser"
+
+	"github.com/daodao97/xgo/xdb"
+)
+
+// Users 终端用户存储, 由 conf.Account.Driver 选择实现
+var Users xuser.Store
+
+func initUsers() {
+	switch conf.Get().Account.Driver {
+	case "memory":
+		Users = xuser.NewInMemory()
+	default:
+		Users = xuser.NewDBStore(xdb.New("companion_user"))
+	}
+}
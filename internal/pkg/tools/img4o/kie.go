@@ -1,16 +1,31 @@
 package img4o
 
 import (
+	"context"
 	"errors"
+	"fmt"
 	"strings"
+	"time"
 
 	"github.com/daodao97/xgo/xrequest"
 )
 
+// DefaultBaseURL Kie 4o image 接口地址
+const DefaultBaseURL = "https://kieai.erweima.ai/api/v1"
+
+// 任务状态 successFlag
+const (
+	FlagGenerating = 0
+	FlagSuccess    = 1
+	FlagFailed     = 2
+)
+
+var ErrTimeout = errors.New("图片生成超时")
+
 // Generate4oImageRequest 生成4o图像请求参数
 type Generate4oImageRequest struct {
 	Prompt   string   `json:"prompt" binding:"required"`
-	FilesURL []string `json:"files_url" binding:"required,max=4"`
+	FilesURL []string `json:"filesUrl,omitempty" binding:"max=4"`
 	Size     string   `json:"size" binding:"required,oneof=1:1 3:2 2:3"`
 }
 
@@ -24,15 +39,81 @@ type Generate4oImageResponse struct {
 	TaskID string `json:"taskId"`
 }
 
-var key = "dad2293b6473bb43e7607cb17597ea06"
-var generateUrl = "https://kieai.erweima.ai/api/v1/gpt4o-image/generate"
-var detailUrl = "https://kieai.erweima.ai/api/v1/gpt4o-image/record-info"
+type GetImageDetailResponse struct {
+	TaskID       string         `json:"taskId"`
+	ParamJSON    string         `json:"paramJson"`
+	Response     DetailResponse `json:"response"`
+	SuccessFlag  int            `json:"successFlag"`
+	Status       string         `json:"status"`
+	ErrorCode    int            `json:"errorCode"`
+	ErrorMessage string         `json:"errorMessage"`
+	Progress     string         `json:"progress"`
+}
+
+type DetailResponse struct {
+	ResultUrls []string `json:"resultUrls"`
+}
+
+type Option func(*Client)
+
+func WithAPIKey(apiKey string) Option {
+	return func(c *Client) {
+		c.apiKey = apiKey
+	}
+}
+
+// WithBaseURL 接口地址, 测试时可指向本地 stub
+func WithBaseURL(baseURL string) Option {
+	return func(c *Client) {
+		if baseURL != "" {
+			c.baseURL = strings.TrimSuffix(baseURL, "/")
+		}
+	}
+}
+
+// WithPolling 查询任务状态的间隔和等待生成完成的超时时间
+func WithPolling(interval time.Duration, timeout time.Duration) Option {
+	return func(c *Client) {
+		if interval > 0 {
+			c.interval = interval
+		}
+		if timeout > 0 {
+			c.timeout = timeout
+		}
+	}
+}
 
-func Generate4oImage(req Generate4oImageRequest) (*Generate4oImageResponse, error) {
+// Client Kie 4o image 接口, 生成是异步任务, 提交后轮询任务状态
+type Client struct {
+	apiKey   string
+	baseURL  string
+	interval time.Duration
+	timeout  time.Duration
+}
+
+func NewClient(opts ...Option) *Client {
+	c := &Client{
+		baseURL:  DefaultBaseURL,
+		interval: 3 * time.Second,
+		timeout:  2 * time.Minute,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// Timeout 等待生成完成的超时时间
+func (c *Client) Timeout() time.Duration {
+	return c.timeout
+}
+
+// Submit 提交生成任务, 返回任务 id
+func (c *Client) Submit(req Generate4oImageRequest) (*Generate4oImageResponse, error) {
 	resp, err := xrequest.New().
 		SetBody(req).
-		SetHeader("Authorization", "Bearer "+key).
-		Post(generateUrl)
+		SetHeader("Authorization", "Bearer "+c.apiKey).
+		Post(c.baseURL + "/gpt4o-image/generate")
 	if err != nil {
 		return nil, err
 	}
@@ -52,29 +133,19 @@ func Generate4oImage(req Generate4oImageRequest) (*Generate4oImageResponse, erro
 		}
 		return nil, errors.New(respData.Message)
 	}
+	if respData.Data.TaskID == "" {
+		return nil, errors.New("图片生成任务提交失败: 缺少 taskId")
+	}
 
 	return &respData.Data, nil
 }
 
-type GetImageDetailResponse struct {
-	TaskID       string         `json:"taskId"`
-	ParamJSON    string         `json:"paramJson"`
-	Response     DetailResponse `json:"response"`
-	SuccessFlag  int            `json:"successFlag"`
-	Status       string         `json:"status"`
-	ErrorCode    int            `json:"errorCode"`
-	ErrorMessage string         `json:"errorMessage"`
-	Progress     string         `json:"progress"`
-}
-type DetailResponse struct {
-	ResultUrls []string `json:"resultUrls"`
-}
-
-func GetImageDetail(taskID string) (*GetImageDetailResponse, error) {
+// Detail 查询任务状态
+func (c *Client) Detail(taskID string) (*GetImageDetailResponse, error) {
 	resp, err := xrequest.New().
 		SetQueryParam("taskId", taskID).
-		SetHeader("Authorization", "Bearer "+key).
-		Get(detailUrl)
+		SetHeader("Authorization", "Bearer "+c.apiKey).
+		Get(c.baseURL + "/gpt4o-image/record-info")
 	if err != nil {
 		return nil, err
 	}
@@ -87,6 +158,53 @@ func GetImageDetail(taskID string) (*GetImageDetailResponse, error) {
 	if err := resp.Scan(&respData); err != nil {
 		return nil, err
 	}
+	if respData.Code != 200 {
+		return nil, errors.New(respData.Message)
+	}
 
 	return &respData.Data, nil
 }
+
+// Wait 轮询任务直到生成完成, 返回图片地址
+func (c *Client) Wait(ctx context.Context, taskID string) ([]string, error) {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	ticker := time.NewTicker(c.interval)
+	defer ticker.Stop()
+
+	for {
+		detail, err := c.Detail(taskID)
+		if err != nil {
+			return nil, err
+		}
+		switch detail.SuccessFlag {
+		case FlagSuccess:
+			if len(detail.Response.ResultUrls) == 0 {
+				return nil, errors.New("图片生成完成但没有结果")
+			}
+			return detail.Response.ResultUrls, nil
+		case FlagGenerating:
+		default:
+			return nil, fmt.Errorf("图片生成失败: %s %s", detail.Status, detail.ErrorMessage)
+		}
+
+		select {
+		case <-ctx.Done():
+			if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+				return nil, ErrTimeout
+			}
+			return nil, ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// Generate 提交任务并等待生成完成
+func (c *Client) Generate(ctx context.Context, req Generate4oImageRequest) ([]string, error) {
+	task, err := c.Submit(req)
+	if err != nil {
+		return nil, err
+	}
+	return c.Wait(ctx, task.TaskID)
+}
@@ -0,0 +1,92 @@
+package img4o
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// kieStub 模拟 Kie 接口, 查询 pending 次后返回 detail
+func kieStub(t *testing.T, pending int32, detail GetImageDetailResponse) *httptest.Server {
+	var polls atomic.Int32
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer test-key" {
+			_ = json.NewEncoder(w).Encode(Response[any]{Code: 401, Message: "unauthorized"})
+			return
+		}
+		switch r.URL.Path {
+		case "/gpt4o-image/generate":
+			var req Generate4oImageRequest
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Prompt == "" {
+				t.Errorf("generate 请求不合法: %+v, %v", req, err)
+			}
+			_ = json.NewEncoder(w).Encode(Response[Generate4oImageResponse]{Code: 200, Data: Generate4oImageResponse{TaskID: "task-1"}})
+		case "/gpt4o-image/record-info":
+			if r.URL.Query().Get("taskId") != "task-1" {
+				t.Errorf("taskId = %s", r.URL.Query().Get("taskId"))
+			}
+			if polls.Add(1) <= pending {
+				_ = json.NewEncoder(w).Encode(Response[GetImageDetailResponse]{Code: 200, Data: GetImageDetailResponse{TaskID: "task-1", Status: "GENERATING"}})
+				return
+			}
+			_ = json.NewEncoder(w).Encode(Response[GetImageDetailResponse]{Code: 200, Data: detail})
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+}
+
+func TestGenerate(t *testing.T) {
+	server := kieStub(t, 2, GetImageDetailResponse{
+		SuccessFlag: FlagSuccess,
+		Status:      "SUCCESS",
+		Response:    DetailResponse{ResultUrls: []string{"https://example.com/a.png"}},
+	})
+	defer server.Close()
+
+	client := NewClient(WithAPIKey("test-key"), WithBaseURL(server.URL+"/"), WithPolling(10*time.Millisecond, time.Second))
+	urls, err := client.Generate(context.Background(), Generate4oImageRequest{Prompt: "a cat", Size: "1:1"})
+	if err != nil {
+		t.Fatalf("Generate 失败: %v", err)
+	}
+	if len(urls) != 1 || urls[0] != "https://example.com/a.png" {
+		t.Errorf("urls = %v", urls)
+	}
+}
+
+func TestGenerateFailed(t *testing.T) {
+	server := kieStub(t, 0, GetImageDetailResponse{
+		SuccessFlag:  FlagFailed,
+		Status:       "GENERATE_FAILED",
+		ErrorMessage: "content policy",
+	})
+	defer server.Close()
+
+	client := NewClient(WithAPIKey("test-key"), WithBaseURL(server.URL), WithPolling(10*time.Millisecond, time.Second))
+	_, err := client.Generate(context.Background(), Generate4oImageRequest{Prompt: "a cat", Size: "1:1"})
+	if err == nil || !strings.Contains(err.Error(), "content policy") {
+		t.Errorf("err = %v", err)
+	}
+
+	_, err = NewClient(WithAPIKey("wrong"), WithBaseURL(server.URL)).Submit(Generate4oImageRequest{Prompt: "a cat", Size: "1:1"})
+	if err == nil || err.Error() != "unauthorized" {
+		t.Errorf("Submit err = %v", err)
+	}
+}
+
+func TestGenerateTimeout(t *testing.T) {
+	server := kieStub(t, 1000, GetImageDetailResponse{})
+	defer server.Close()
+
+	client := NewClient(WithAPIKey("test-key"), WithBaseURL(server.URL), WithPolling(10*time.Millisecond, 50*time.Millisecond))
+	_, err := client.Generate(context.Background(), Generate4oImageRequest{Prompt: "a cat", Size: "1:1"})
+	if !errors.Is(err, ErrTimeout) {
+		t.Errorf("err = %v", err)
+	}
+}
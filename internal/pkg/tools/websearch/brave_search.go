@@ -0,0 +1,130 @@
+package websearch
+
+import (
+	"context"
+	"fmt"
+	"html"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/daodao97/xgo/xlog"
+	"github.com/daodao97/xgo/xrequest"
+)
+
+const (
+	BraveSearchURL = "https://api.search.brave.com/res/v1/web/search"
+)
+
+// BraveSearchTool Brave Search API 搜索
+type BraveSearchTool struct {
+	APIKey     string
+	BaseURL    string // 为空时使用 BraveSearchURL
+	Language   string // 搜索语言, 如 zh-hans
+	Country    string // 如 CN、US
+	MaxResults int    // Brave 限制最大 20
+}
+
+func NewBraveSearchTool(apiKey string) *BraveSearchTool {
+	return &BraveSearchTool{
+		APIKey:     apiKey,
+		MaxResults: 10,
+	}
+}
+
+// braveSearchResponse Brave 网页搜索响应
+type braveSearchResponse struct {
+	Query struct {
+		Original string `json:"original"`
+	} `json:"query"`
+	Web struct {
+		Results []struct {
+			Title       string `json:"title"`
+			URL         string `json:"url"`
+			Description string `json:"description"`
+		} `json:"results"`
+	} `json:"web"`
+}
+
+func (t *BraveSearchTool) Search(ctx context.Context, query string) (*WebSearchResult, error) {
+	if query == "" {
+		return nil, fmt.Errorf("搜索查询词不能为空")
+	}
+	if t.APIKey == "" {
+		return nil, fmt.Errorf("Brave API密钥未配置")
+	}
+
+	xlog.Debug("开始Brave搜索", xlog.String("query", query))
+
+	baseURL := t.BaseURL
+	if baseURL == "" {
+		baseURL = BraveSearchURL
+	}
+	params := map[string]string{
+		"q":     query,
+		"count": strconv.Itoa(min(max(t.MaxResults, 1), 20)),
+	}
+	if t.Language != "" {
+		params["search_lang"] = t.Language
+	}
+	if t.Country != "" {
+		params["country"] = t.Country
+	}
+
+	resp, err := xrequest.New().
+		SetHeader("Accept", "application/json").
+		SetHeader("X-Subscription-Token", t.APIKey).
+		SetQueryParams(params).
+		SetDebug(false).
+		Get(baseURL)
+	if err != nil {
+		return nil, fmt.Errorf("Brave搜索请求失败: %v", err)
+	}
+	if resp.StatusCode() != http.StatusOK {
+		return nil, fmt.Errorf("Brave API返回错误状态码 %d: %s", resp.StatusCode(), resp.String())
+	}
+
+	var searchResponse braveSearchResponse
+	if err := resp.Scan(&searchResponse); err != nil {
+		return nil, fmt.Errorf("解析Brave响应失败: %v", err)
+	}
+
+	result := &WebSearchResult{
+		Query:     query,
+		Timestamp: time.Now(),
+	}
+	var contentParts []string
+	for i, item := range searchResponse.Web.Results {
+		// description 中的关键词带有 <strong> 标签
+		snippet := stripTags(item.Description)
+		result.Sources = append(result.Sources, SourceInfo{
+			Title:   item.Title,
+			URL:     item.URL,
+			Snippet: snippet,
+			Domain:  extractDomain(item.URL),
+		})
+		contentParts = append(contentParts, strconv.Itoa(i+1)+". "+item.Title+"\n"+snippet)
+	}
+	result.Content = strings.Join(contentParts, "\n\n")
+
+	xlog.Debug("Brave搜索完成", xlog.String("query", query), xlog.Int("results_count", len(result.Sources)))
+	return result, nil
+}
+
+// stripTags 去掉摘要中的 html 标签和实体
+func stripTags(s string) string {
+	var b strings.Builder
+	inTag := false
+	for _, r := range s {
+		switch {
+		case r == '<':
+			inTag = true
+		case r == '>' && inTag:
+			inTag = false
+		case !inTag:
+			b.WriteRune(r)
+		}
+	}
+	return html.UnescapeString(b.String())
+}
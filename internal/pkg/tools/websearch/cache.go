@@ -0,0 +1,66 @@
+package websearch
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxCacheEntries 缓存的查询数上限, 超过时先清理过期结果, 仍超过则清空
+const maxCacheEntries = 1024
+
+type cacheEntry struct {
+	result    *WebSearchResult
+	expiresAt time.Time
+}
+
+// CachedSearchTool 按查询词缓存搜索结果, 失败的搜索不缓存
+type CachedSearchTool struct {
+	tool    SearchTool
+	ttl     time.Duration
+	mu      sync.Mutex
+	entries map[string]cacheEntry
+	now     func() time.Time
+}
+
+func NewCachedSearchTool(tool SearchTool, ttl time.Duration) *CachedSearchTool {
+	return &CachedSearchTool{
+		tool:    tool,
+		ttl:     ttl,
+		entries: make(map[string]cacheEntry),
+		now:     time.Now,
+	}
+}
+
+func (c *CachedSearchTool) Search(ctx context.Context, query string) (*WebSearchResult, error) {
+	key := strings.ToLower(strings.Join(strings.Fields(query), " "))
+
+	c.mu.Lock()
+	entry, ok := c.entries[key]
+	c.mu.Unlock()
+	if ok && c.now().Before(entry.expiresAt) {
+		return entry.result, nil
+	}
+
+	result, err := c.tool.Search(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.entries) >= maxCacheEntries {
+		now := c.now()
+		for k, e := range c.entries {
+			if !now.Before(e.expiresAt) {
+				delete(c.entries, k)
+			}
+		}
+		if len(c.entries) >= maxCacheEntries {
+			c.entries = make(map[string]cacheEntry)
+		}
+	}
+	c.entries[key] = cacheEntry{result: result, expiresAt: c.now().Add(c.ttl)}
+	return result, nil
+}
@@ -0,0 +1,64 @@
+package websearch
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// FixtureEntry 固定搜索结果, 查询词包含 Match 时命中, Match 为空表示总是命中
+type FixtureEntry struct {
+	Match   string       `json:"match"`
+	Answer  string       `json:"answer"`
+	Sources []SourceInfo `json:"sources"`
+}
+
+// FixtureSearchTool 按顺序匹配固定结果, 不访问网络, 用于测试和离线开发
+type FixtureSearchTool struct {
+	Entries []FixtureEntry
+}
+
+func NewFixtureSearchTool(entries ...FixtureEntry) *FixtureSearchTool {
+	return &FixtureSearchTool{Entries: entries}
+}
+
+// LoadFixtureSearchTool 从 JSON 文件加载固定结果, 文件内容为 FixtureEntry 数组
+func LoadFixtureSearchTool(path string) (*FixtureSearchTool, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("读取搜索结果文件失败: %w", err)
+	}
+	var entries []FixtureEntry
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return nil, fmt.Errorf("解析搜索结果文件失败: %w", err)
+	}
+	return NewFixtureSearchTool(entries...), nil
+}
+
+func (t *FixtureSearchTool) Search(ctx context.Context, query string) (*WebSearchResult, error) {
+	if query == "" {
+		return nil, fmt.Errorf("搜索查询词不能为空")
+	}
+
+	result := &WebSearchResult{
+		Query:     query,
+		Timestamp: time.Now(),
+	}
+	for _, entry := range t.Entries {
+		if entry.Match != "" && !strings.Contains(query, entry.Match) {
+			continue
+		}
+		result.Answer = entry.Answer
+		for _, source := range entry.Sources {
+			if source.Domain == "" {
+				source.Domain = extractDomain(source.URL)
+			}
+			result.Sources = append(result.Sources, source)
+		}
+		break
+	}
+	return result, nil
+}
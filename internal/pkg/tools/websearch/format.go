@@ -0,0 +1,47 @@
+package websearch
+
+import (
+	"fmt"
+	"strings"
+)
+
+// maxSnippetRunes 每条结果摘要保留的字数
+const maxSnippetRunes = 150
+
+// Condense 将搜索结果压缩为适合口语回复的纯文本, 不包含链接和 markdown
+// 只保留前 maxSources 条结果, 供模型组织成一两句话的回答
+func Condense(result *WebSearchResult, maxSources int) string {
+	if result == nil || (result.Answer == "" && len(result.Sources) == 0) {
+		return "没有找到相关结果"
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "搜索: %s\n", result.Query)
+	if result.Answer != "" {
+		fmt.Fprintf(&b, "答案: %s\n", truncateRunes(collapseSpace(result.Answer), maxSnippetRunes*2))
+	}
+	for i, source := range result.Sources {
+		if maxSources > 0 && i >= maxSources {
+			break
+		}
+		fmt.Fprintf(&b, "%d. %s: %s", i+1, collapseSpace(source.Title), truncateRunes(collapseSpace(source.Snippet), maxSnippetRunes))
+		if source.Domain != "" {
+			fmt.Fprintf(&b, " (来源 %s)", source.Domain)
+		}
+		b.WriteString("\n")
+	}
+	return strings.TrimSuffix(b.String(), "\n")
+}
+
+func collapseSpace(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
+
+// truncateRunes 按字符截断, 避免截断多字节字符
+func truncateRunes(s string, maxRunes int) string {
+	runes := []rune(s)
+	if len(runes) <= maxRunes {
+		return s
+	}
+	return string(runes[:maxRunes]) + "…"
+}
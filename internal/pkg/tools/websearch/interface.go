@@ -13,6 +13,7 @@ type SearchTool interface {
 // WebSearchResult 网络搜索结果
 type WebSearchResult struct {
 	Query     string       `json:"query"`
+	Answer    string       `json:"answer,omitempty"` // 搜索服务直接给出的答案
 	Content   string       `json:"content"`
 	Sources   []SourceInfo `json:"sources"`
 	TaskID    string       `json:"task_id"`
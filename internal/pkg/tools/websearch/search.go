@@ -0,0 +1,61 @@
+package websearch
+
+import (
+	"companions/internal/conf"
+	"fmt"
+	"os"
+	"time"
+)
+
+// New 按配置创建搜索工具, cache_ttl 大于 0 时缓存结果
+func New(searchConf *conf.WebSearchConfig) (SearchTool, error) {
+	var tool SearchTool
+	switch searchConf.Provider {
+	case "", "tavily":
+		apiKey := searchConf.ApiKey
+		if apiKey == "" {
+			apiKey = os.Getenv("TAVILY_API_KEY")
+		}
+		tavily := NewTavilySearchToolWithAdvancedOptions(apiKey, TavilySearchOptions{
+			SearchDepth:    searchConf.Depth,
+			MaxResults:     searchConf.MaxResults,
+			IncludeDomains: searchConf.IncludeDomains,
+			ExcludeDomains: searchConf.ExcludeDomains,
+			IncludeAnswer:  true,
+		})
+		tavily.BaseURL = searchConf.ApiUrl
+		tool = tavily
+	case "searxng":
+		searxng := NewSearXNGSearchTool(searchConf.ApiUrl)
+		searxng.Language = searchConf.Language
+		if searchConf.MaxResults > 0 {
+			searxng.MaxResults = searchConf.MaxResults
+		}
+		tool = searxng
+	case "brave":
+		apiKey := searchConf.ApiKey
+		if apiKey == "" {
+			apiKey = os.Getenv("BRAVE_API_KEY")
+		}
+		brave := NewBraveSearchTool(apiKey)
+		brave.BaseURL = searchConf.ApiUrl
+		brave.Language = searchConf.Language
+		if searchConf.MaxResults > 0 {
+			brave.MaxResults = searchConf.MaxResults
+		}
+		tool = brave
+	case "fixture":
+		fixture, err := LoadFixtureSearchTool(searchConf.Fixture)
+		if err != nil {
+			return nil, err
+		}
+		tool = fixture
+	default:
+		return nil, fmt.Errorf("未知的搜索 provider: %s", searchConf.Provider)
+	}
+
+	if searchConf.CacheTTL > 0 {
+		tool = NewCachedSearchTool(tool, time.Duration(searchConf.CacheTTL)*time.Second)
+	}
+	return tool, nil
+}
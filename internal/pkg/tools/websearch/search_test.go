@@ -0,0 +1,146 @@
+package websearch
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"companions/internal/conf"
+)
+
+func TestProviders(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/tavily":
+			var req tavilySearchRequest
+			_ = json.NewDecoder(r.Body).Decode(&req)
+			if req.APIKey != "tvly-key" || req.SearchDepth != "advanced" || len(req.IncludeDomains) != 1 {
+				t.Errorf("tavily 请求 = %+v", req)
+			}
+			_, _ = w.Write([]byte(`{"query":"q","answer":"晴","results":[{"title":"天气","url":"https://weather.com/a","content":"今天晴","score":0.9}]}`))
+		case "/searxng/search":
+			if r.URL.Query().Get("format") != "json" || r.URL.Query().Get("language") != "zh-CN" {
+				t.Errorf("searxng 请求 = %s", r.URL.RawQuery)
+			}
+			_, _ = w.Write([]byte(`{"query":"q","answers":["晴"],"results":[{"title":"天气","url":"https://weather.com/a","content":"今天晴"}]}`))
+		case "/brave":
+			if r.Header.Get("X-Subscription-Token") != "brave-key" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			_, _ = w.Write([]byte(`{"web":{"results":[{"title":"天气","url":"https://weather.com/a","description":"今天<strong>晴</strong> &amp; 暖"}]}}`))
+		}
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		name   string
+		conf   conf.WebSearchConfig
+		answer string
+		sniff  string
+	}{
+		{"tavily", conf.WebSearchConfig{ApiKey: "tvly-key", ApiUrl: server.URL + "/tavily", Depth: "advanced", IncludeDomains: []string{"weather.com"}}, "晴", "今天晴"},
+		{"searxng", conf.WebSearchConfig{Provider: "searxng", ApiUrl: server.URL + "/searxng/", Language: "zh-CN"}, "晴", "今天晴"},
+		{"brave", conf.WebSearchConfig{Provider: "brave", ApiKey: "brave-key", ApiUrl: server.URL + "/brave"}, "", "今天晴 & 暖"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tool, err := New(&tt.conf)
+			if err != nil {
+				t.Fatalf("New 失败: %v", err)
+			}
+			result, err := tool.Search(context.Background(), "天气")
+			if err != nil {
+				t.Fatalf("Search 失败: %v", err)
+			}
+			if result.Answer != tt.answer || len(result.Sources) != 1 {
+				t.Fatalf("result = %+v", result)
+			}
+			if source := result.Sources[0]; source.Snippet != tt.sniff || source.Domain != "weather.com" {
+				t.Errorf("source = %+v", source)
+			}
+		})
+	}
+
+	brave := NewBraveSearchTool("wrong")
+	brave.BaseURL = server.URL + "/brave"
+	if _, err := brave.Search(context.Background(), "天气"); err == nil || !strings.Contains(err.Error(), "401") {
+		t.Errorf("brave err = %v", err)
+	}
+	if _, err := New(&conf.WebSearchConfig{Provider: "bing"}); err == nil {
+		t.Error("未知 provider 应该报错")
+	}
+}
+
+// countingSearch 记录调用次数的搜索
+type countingSearch struct {
+	calls int
+}
+
+func (c *countingSearch) Search(ctx context.Context, query string) (*WebSearchResult, error) {
+	c.calls++
+	return &WebSearchResult{Query: query}, nil
+}
+
+func TestCachedSearchTool(t *testing.T) {
+	inner := &countingSearch{}
+	cached := NewCachedSearchTool(inner, time.Minute)
+	now := time.Now()
+	cached.now = func() time.Time { return now }
+
+	ctx := context.Background()
+	_, _ = cached.Search(ctx, "北京 天气")
+	_, _ = cached.Search(ctx, "  北京   天气 ")
+	if inner.calls != 1 {
+		t.Errorf("缓存未命中, calls = %d", inner.calls)
+	}
+
+	now = now.Add(2 * time.Minute)
+	_, _ = cached.Search(ctx, "北京 天气")
+	if inner.calls != 2 {
+		t.Errorf("过期后应重新搜索, calls = %d", inner.calls)
+	}
+}
+
+func TestFixtureAndCondense(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "search.json")
+	fixture := `[
+		{"match": "天气", "answer": "北京今天晴, 最高 25 度", "sources": [
+			{"title": "北京天气", "url": "https://weather.com/beijing", "snippet": "今天晴\n最高 25 度"},
+			{"title": "天气预报", "url": "https://example.com/a", "snippet": "` + strings.Repeat("长", 200) + `"}
+		]},
+		{"sources": []}
+	]`
+	if err := os.WriteFile(path, []byte(fixture), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	tool, err := New(&conf.WebSearchConfig{Provider: "fixture", Fixture: path})
+	if err != nil {
+		t.Fatalf("New 失败: %v", err)
+	}
+	result, err := tool.Search(context.Background(), "北京天气")
+	if err != nil {
+		t.Fatalf("Search 失败: %v", err)
+	}
+
+	text := Condense(result, 1)
+	want := "搜索: 北京天气\n答案: 北京今天晴, 最高 25 度\n1. 北京天气: 今天晴 最高 25 度 (来源 weather.com)"
+	if text != want {
+		t.Errorf("Condense =\n%s\nwant\n%s", text, want)
+	}
+	if text := Condense(result, 0); !strings.Contains(text, strings.Repeat("长", maxSnippetRunes)+"…") || strings.Contains(text, "http") {
+		t.Errorf("Condense = %s", text)
+	}
+
+	empty, _ := tool.Search(context.Background(), "股票")
+	if text := Condense(empty, 3); text != "没有找到相关结果" {
+		t.Errorf("Condense empty = %s", text)
+	}
+}
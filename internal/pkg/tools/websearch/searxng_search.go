@@ -0,0 +1,104 @@
+package websearch
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/daodao97/xgo/xlog"
+	"github.com/daodao97/xgo/xrequest"
+)
+
+// SearXNGSearchTool 自建 SearXNG 实例搜索, 实例需要在 search.formats 中开启 json
+type SearXNGSearchTool struct {
+	BaseURL    string // 实例地址, 如 http://127.0.0.1:8080
+	Language   string // 如 zh-CN, 为空时由实例决定
+	Categories string // 如 general,news
+	MaxResults int
+}
+
+func NewSearXNGSearchTool(baseURL string) *SearXNGSearchTool {
+	return &SearXNGSearchTool{
+		BaseURL:    strings.TrimSuffix(baseURL, "/"),
+		Categories: "general",
+		MaxResults: 10,
+	}
+}
+
+// searxngSearchResponse SearXNG json 格式的响应
+type searxngSearchResponse struct {
+	Query   string   `json:"query"`
+	Answers []string `json:"answers"`
+	Results []struct {
+		Title   string  `json:"title"`
+		URL     string  `json:"url"`
+		Content string  `json:"content"`
+		Score   float64 `json:"score"`
+	} `json:"results"`
+}
+
+func (t *SearXNGSearchTool) Search(ctx context.Context, query string) (*WebSearchResult, error) {
+	if query == "" {
+		return nil, fmt.Errorf("搜索查询词不能为空")
+	}
+	if t.BaseURL == "" {
+		return nil, fmt.Errorf("SearXNG 地址未配置")
+	}
+
+	xlog.Debug("开始SearXNG搜索", xlog.String("query", query))
+
+	params := map[string]string{
+		"q":      query,
+		"format": "json",
+	}
+	if t.Language != "" {
+		params["language"] = t.Language
+	}
+	if t.Categories != "" {
+		params["categories"] = t.Categories
+	}
+
+	resp, err := xrequest.New().
+		SetQueryParams(params).
+		SetDebug(false).
+		Get(t.BaseURL + "/search")
+	if err != nil {
+		return nil, fmt.Errorf("SearXNG搜索请求失败: %v", err)
+	}
+	if resp.StatusCode() != http.StatusOK {
+		return nil, fmt.Errorf("SearXNG返回错误状态码 %d: %s", resp.StatusCode(), resp.String())
+	}
+
+	var searchResponse searxngSearchResponse
+	if err := resp.Scan(&searchResponse); err != nil {
+		return nil, fmt.Errorf("解析SearXNG响应失败: %v", err)
+	}
+
+	result := &WebSearchResult{
+		Query:     query,
+		Timestamp: time.Now(),
+	}
+	if len(searchResponse.Answers) > 0 {
+		result.Answer = searchResponse.Answers[0]
+	}
+	var contentParts []string
+	for i, item := range searchResponse.Results {
+		if t.MaxResults > 0 && i >= t.MaxResults {
+			break
+		}
+		result.Sources = append(result.Sources, SourceInfo{
+			Title:   item.Title,
+			URL:     item.URL,
+			Snippet: item.Content,
+			Domain:  extractDomain(item.URL),
+		})
+		contentParts = append(contentParts, strconv.Itoa(i+1)+". "+item.Title+"\n"+item.Content)
+	}
+	result.Content = strings.Join(contentParts, "\n\n")
+
+	xlog.Debug("SearXNG搜索完成", xlog.String("query", query), xlog.Int("results_count", len(result.Sources)))
+	return result, nil
+}
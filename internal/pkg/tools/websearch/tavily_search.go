@@ -19,6 +19,7 @@ const (
 // TavilySearchTool Tavily搜索工具
 type TavilySearchTool struct {
 	APIKey                   string
+	BaseURL                  string // 为空时使用 TavilySearchURL
 	SearchDepth              string // "basic" 或 "advanced"
 	MaxResults               int
 	UserAgent                string
@@ -188,13 +189,18 @@ func (t *TavilySearchTool) Search(ctx context.Context, query string) (*WebSearch
 		IncludeImageDescriptions: t.IncludeImageDescriptions,
 	}
 
+	baseURL := t.BaseURL
+	if baseURL == "" {
+		baseURL = TavilySearchURL
+	}
+
 	// 发送HTTP请求
 	resp, err := xrequest.New().
 		SetHeader("Content-Type", "application/json").
 		SetHeader("User-Agent", t.UserAgent).
 		SetBody(reqBody).
 		SetDebug(false).
-		Post(TavilySearchURL)
+		Post(baseURL)
 
 	if err != nil {
 		return nil, fmt.Errorf("Tavily搜索请求失败: %v", err)
@@ -346,6 +352,7 @@ func (t *TavilySearchTool) convertToWebSearchResult(query string, response *tavi
 
 	return &WebSearchResult{
 		Query:     query,
+		Answer:    response.Answer,
 		Content:   fullContent,
 		Sources:   sources,
 		Timestamp: time.Now(),
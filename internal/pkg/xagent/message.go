@@ -17,6 +17,7 @@ const (
 	MessageRoleSystem    MessageRole = "system"
 	MessageRoleTool      MessageRole = "tool"
 	MessageRoleError     MessageRole = "error"
+	MessageRoleMeta      MessageRole = "meta" // 一轮对话的元信息, 只存储不进入记忆
 )
 
 // Message 核心消息接口 - 只关注消息的核心属性
@@ -41,6 +42,7 @@ type BaseMessage struct {
 	Timestamp time.Time       `json:"timestamp"`
 	MessageID string          `json:"message_id"`
 	Metadata  MessageMetadata `json:"metadata,omitempty"`
+	Extra     map[string]any  `json:"extra,omitempty"`
 }
 
 func (m *BaseMessage) GetRole() MessageRole    { return m.Role }
@@ -72,6 +74,16 @@ func (b *MessageBuilder) Content(content string) *MessageBuilder {
 	return b
 }
 
+func (b *MessageBuilder) ID(messageId string) *MessageBuilder {
+	b.msg.MessageID = messageId
+	return b
+}
+
+func (b *MessageBuilder) Extra(extra map[string]any) *MessageBuilder {
+	b.msg.Extra = extra
+	return b
+}
+
 func (b *MessageBuilder) Memory(memory bool) *MessageBuilder {
 	b.msg.Metadata.Memory = memory
 	return b
@@ -106,7 +118,13 @@ func (p *MessageProcessor) ToJSON(msg Message) string {
 
 // ToSSE 转换为SSE格式
 func (p *MessageProcessor) ToSSE(msg Message) string {
-	return fmt.Sprintf("event: %s\ndata: %s\n\n", msg.GetRole(), p.ToJSON(msg))
+	return p.ToSSEEvent(string(msg.GetRole()), msg)
+}
+
+// ToSSEEvent 将任意数据格式化为一条SSE事件, data 序列化为单行JSON
+func (p *MessageProcessor) ToSSEEvent(event string, data any) string {
+	body, _ := json.Marshal(data)
+	return fmt.Sprintf("event: %s\ndata: %s\n\n", event, body)
 }
 
 // ShouldStore 判断是否应该存储
@@ -159,6 +177,17 @@ func NewToolMessage(content string) Message {
 		Build()
 }
 
+// NewMetaMessage 创建一轮对话的元信息消息
+func NewMetaMessage(messageId string, extra map[string]any) Message {
+	return NewMessage().
+		Role(MessageRoleMeta).
+		ID(messageId).
+		Extra(extra).
+		Storage(true).
+		Hidden(true).
+		Build()
+}
+
 func NewErrorMessage(content string) Message {
 	return NewMessage().
 		Role(MessageRoleError).
@@ -0,0 +1,40 @@
+package xlimit
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+
+	"github.com/daodao97/xgo/xlog"
+	"github.com/gin-gonic/gin"
+)
+
+// Middleware REST 接口限流, key 返回限流维度 (如用户 id 或 IP), 为空时不限制
+// 存储出错时放行, 避免限流组件故障导致接口不可用
+func Middleware(store Store, rate Rate, key func(c *gin.Context) string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		k := key(c)
+		if store == nil || !rate.Enabled() || k == "" {
+			c.Next()
+			return
+		}
+
+		result, err := store.Allow(c.Request.Context(), "api:"+k, rate)
+		if err != nil {
+			xlog.ErrorC(c.Request.Context(), "限流检查失败", xlog.String("key", k), xlog.Err(err))
+			c.Next()
+			return
+		}
+		if !result.Allowed {
+			retryAfter := int(math.Ceil(result.RetryAfter.Seconds()))
+			c.Header("Retry-After", strconv.Itoa(retryAfter))
+			c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{
+				"error":       "rate_limited",
+				"retry_after": retryAfter,
+			})
+			return
+		}
+		c.Header("X-RateLimit-Remaining", strconv.Itoa(result.Remaining))
+		c.Next()
+	}
+}
@@ -0,0 +1,38 @@
+package xlimit
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	e := gin.New()
+	e.Use(Middleware(NewMemory(), PerMinute(1, 0), func(c *gin.Context) string {
+		return c.Query("uid")
+	}))
+	e.GET("/", func(c *gin.Context) { c.String(http.StatusOK, "ok") })
+
+	request := func(target string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		e.ServeHTTP(w, httptest.NewRequest("GET", target, nil))
+		return w
+	}
+
+	if w := request("/?uid=1"); w.Code != http.StatusOK {
+		t.Fatalf("第一次请求 = %d", w.Code)
+	}
+	w := request("/?uid=1")
+	if w.Code != http.StatusTooManyRequests || w.Header().Get("Retry-After") != "60" {
+		t.Errorf("第二次请求 = %d, Retry-After = %s", w.Code, w.Header().Get("Retry-After"))
+	}
+	// 没有限流维度时不限制
+	for i := 0; i < 2; i++ {
+		if w := request("/"); w.Code != http.StatusOK {
+			t.Errorf("匿名请求 = %d", w.Code)
+		}
+	}
+}
@@ -0,0 +1,52 @@
+package xlimit
+
+import (
+	"context"
+	"time"
+)
+
+// Rate 令牌桶速率, 每 Period 补充 Limit 个令牌, 桶容量为 Burst (为 0 时等于 Limit)
+type Rate struct {
+	Limit  int
+	Period time.Duration
+	Burst  int
+}
+
+// PerMinute 每分钟 n 次, 允许 burst 次突发
+func PerMinute(n int, burst int) Rate {
+	return Rate{Limit: n, Period: time.Minute, Burst: burst}
+}
+
+// Enabled Limit 为 0 表示不限制
+func (r Rate) Enabled() bool {
+	return r.Limit > 0 && r.Period > 0
+}
+
+func (r Rate) burst() int {
+	if r.Burst > 0 {
+		return r.Burst
+	}
+	return r.Limit
+}
+
+// interval 补充一个令牌的时间
+func (r Rate) interval() time.Duration {
+	return r.Period / time.Duration(r.Limit)
+}
+
+// Result 限流结果, 被拒绝时 RetryAfter 为下一个令牌可用的等待时间
+type Result struct {
+	Allowed    bool
+	Remaining  int
+	RetryAfter time.Duration
+}
+
+// Store 限流状态存储
+// 单实例部署使用 Memory, 多实例部署使用 Redis 共享计数
+type Store interface {
+	// Allow 从 key 的令牌桶中取一个令牌
+	Allow(ctx context.Context, key string, rate Rate) (Result, error)
+	// Acquire 占用 key 的一个并发名额, 已达到 max 时返回 false, 成功后需调用 Release 释放
+	Acquire(ctx context.Context, key string, max int) (bool, error)
+	Release(ctx context.Context, key string) error
+}
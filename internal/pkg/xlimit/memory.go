@@ -0,0 +1,118 @@
+package xlimit
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+)
+
+var _ Store = (*Memory)(nil)
+
+// maxIdleBuckets 令牌桶数量超过该值时清理已回满的桶
+const maxIdleBuckets = 10000
+
+type MemoryOption func(*Memory)
+
+// WithClock 自定义时钟, 用于测试
+func WithClock(now func() time.Time) MemoryOption {
+	return func(m *Memory) {
+		m.now = now
+	}
+}
+
+// Memory 进程内的令牌桶和并发计数
+type Memory struct {
+	mu      sync.Mutex
+	now     func() time.Time
+	buckets map[string]*bucket
+	counts  map[string]int
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+	rate   Rate
+}
+
+func NewMemory(opts ...MemoryOption) *Memory {
+	m := &Memory{
+		now:     time.Now,
+		buckets: make(map[string]*bucket),
+		counts:  make(map[string]int),
+	}
+	for _, opt := range opts {
+		opt(m)
+	}
+	return m
+}
+
+func (m *Memory) Allow(ctx context.Context, key string, rate Rate) (Result, error) {
+	if !rate.Enabled() {
+		return Result{Allowed: true}, nil
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := m.now()
+	b, ok := m.buckets[key]
+	if !ok {
+		if len(m.buckets) >= maxIdleBuckets {
+			m.prune(now)
+		}
+		b = &bucket{tokens: float64(rate.burst()), last: now}
+		m.buckets[key] = b
+	}
+	b.rate = rate
+	b.refill(now)
+
+	if b.tokens < 1 {
+		wait := time.Duration((1 - b.tokens) * float64(rate.interval()))
+		return Result{RetryAfter: wait}, nil
+	}
+	b.tokens--
+	return Result{Allowed: true, Remaining: int(math.Floor(b.tokens))}, nil
+}
+
+func (b *bucket) refill(now time.Time) {
+	elapsed := now.Sub(b.last)
+	if elapsed <= 0 {
+		return
+	}
+	b.tokens = math.Min(float64(b.rate.burst()), b.tokens+float64(elapsed)/float64(b.rate.interval()))
+	b.last = now
+}
+
+// prune 删除已回满的令牌桶, 它们与新建的桶等价
+func (m *Memory) prune(now time.Time) {
+	for key, b := range m.buckets {
+		b.refill(now)
+		if b.tokens >= float64(b.rate.burst()) {
+			delete(m.buckets, key)
+		}
+	}
+}
+
+func (m *Memory) Acquire(ctx context.Context, key string, max int) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if max > 0 && m.counts[key] >= max {
+		return false, nil
+	}
+	m.counts[key]++
+	return true, nil
+}
+
+func (m *Memory) Release(ctx context.Context, key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.counts[key] <= 1 {
+		delete(m.counts, key)
+		return nil
+	}
+	m.counts[key]--
+	return nil
+}
@@ -0,0 +1,72 @@
+package xlimit
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// testStore 各存储实现共用的测试
+func testStore(t *testing.T, store Store) {
+	ctx := context.Background()
+
+	rate := PerMinute(60, 2)
+	for i := 0; i < 2; i++ {
+		if result, err := store.Allow(ctx, "u1", rate); err != nil || !result.Allowed {
+			t.Fatalf("Allow #%d = %+v, %v", i, result, err)
+		}
+	}
+	result, err := store.Allow(ctx, "u1", rate)
+	if err != nil || result.Allowed {
+		t.Fatalf("超过突发上限应被拒绝: %+v, %v", result, err)
+	}
+	if result.RetryAfter <= 0 || result.RetryAfter > time.Second {
+		t.Errorf("RetryAfter = %v", result.RetryAfter)
+	}
+	// 不同 key 互不影响
+	if result, _ := store.Allow(ctx, "u2", rate); !result.Allowed {
+		t.Errorf("u2 应被允许")
+	}
+	if result, _ := store.Allow(ctx, "u1", Rate{}); !result.Allowed {
+		t.Errorf("未配置速率时不限制")
+	}
+
+	for i := 0; i < 2; i++ {
+		if ok, err := store.Acquire(ctx, "conn", 2); err != nil || !ok {
+			t.Fatalf("Acquire #%d = %v, %v", i, ok, err)
+		}
+	}
+	if ok, _ := store.Acquire(ctx, "conn", 2); ok {
+		t.Errorf("超过并发上限应被拒绝")
+	}
+	if err := store.Release(ctx, "conn"); err != nil {
+		t.Fatalf("Release 失败: %v", err)
+	}
+	if ok, _ := store.Acquire(ctx, "conn", 2); !ok {
+		t.Errorf("释放后应可再次占用")
+	}
+}
+
+func TestMemory(t *testing.T) {
+	testStore(t, NewMemory())
+}
+
+func TestMemory_Refill(t *testing.T) {
+	now := time.Date(2025, 7, 1, 0, 0, 0, 0, time.UTC)
+	store := NewMemory(WithClock(func() time.Time { return now }))
+	ctx := context.Background()
+	rate := PerMinute(6, 1)
+
+	if result, _ := store.Allow(ctx, "u1", rate); !result.Allowed {
+		t.Fatalf("第一次应被允许")
+	}
+	result, _ := store.Allow(ctx, "u1", rate)
+	if result.Allowed || result.RetryAfter != 10*time.Second {
+		t.Fatalf("result = %+v", result)
+	}
+
+	now = now.Add(10 * time.Second)
+	if result, _ := store.Allow(ctx, "u1", rate); !result.Allowed {
+		t.Errorf("补充令牌后应被允许")
+	}
+}
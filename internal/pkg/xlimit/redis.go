@@ -0,0 +1,130 @@
+package xlimit
+
+import (
+	"context"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+var _ Store = (*Redis)(nil)
+
+// tokenBucketScript 令牌桶, 状态保存在 hash 中 (tokens, ts), 时间由调用方传入 (毫秒)
+// 返回 {是否允许, 剩余令牌, 需要等待的毫秒数}
+const tokenBucketScript = `
+local interval = tonumber(ARGV[1])
+local burst = tonumber(ARGV[2])
+local now = tonumber(ARGV[3])
+
+local state = redis.call('HMGET', KEYS[1], 'tokens', 'ts')
+local tokens = tonumber(state[1]) or burst
+local ts = tonumber(state[2]) or now
+if now > ts then
+	tokens = math.min(burst, tokens + (now - ts) / interval)
+	ts = now
+end
+
+local allowed = 0
+local wait = 0
+if tokens >= 1 then
+	tokens = tokens - 1
+	allowed = 1
+else
+	wait = math.ceil((1 - tokens) * interval)
+end
+
+redis.call('HSET', KEYS[1], 'tokens', tostring(tokens), 'ts', tostring(ts))
+redis.call('PEXPIRE', KEYS[1], math.ceil(burst * interval))
+return {allowed, math.floor(tokens), wait}
+`
+
+// acquireScript 并发计数, 超过上限时不增加
+const acquireScript = `
+local count = tonumber(redis.call('GET', KEYS[1]) or '0')
+local max = tonumber(ARGV[1])
+if max > 0 and count >= max then
+	return 0
+end
+redis.call('INCR', KEYS[1])
+redis.call('PEXPIRE', KEYS[1], ARGV[2])
+return 1
+`
+
+const releaseScript = `
+local count = redis.call('DECR', KEYS[1])
+if count <= 0 then
+	redis.call('DEL', KEYS[1])
+end
+return count
+`
+
+type RedisOption func(*Redis)
+
+func WithRedisPrefix(prefix string) RedisOption {
+	return func(r *Redis) {
+		if prefix != "" {
+			r.prefix = prefix
+		}
+	}
+}
+
+// WithRedisCountTTL 并发计数的过期时间, 防止实例异常退出后名额无法释放
+func WithRedisCountTTL(ttl time.Duration) RedisOption {
+	return func(r *Redis) {
+		r.countTTL = ttl
+	}
+}
+
+// Redis 基于 Redis 的共享限流状态, 用于多实例部署
+type Redis struct {
+	client   *redis.Client
+	prefix   string
+	countTTL time.Duration
+}
+
+func NewRedis(client *redis.Client, opts ...RedisOption) *Redis {
+	r := &Redis{
+		client:   client,
+		prefix:   "companion:limit:",
+		countTTL: 24 * time.Hour,
+	}
+	for _, opt := range opts {
+		opt(r)
+	}
+	return r
+}
+
+func (r *Redis) Allow(ctx context.Context, key string, rate Rate) (Result, error) {
+	if !rate.Enabled() {
+		return Result{Allowed: true}, nil
+	}
+
+	values, err := r.client.Eval(ctx, tokenBucketScript, []string{r.prefix + "bucket:" + key},
+		float64(rate.interval())/float64(time.Millisecond),
+		rate.burst(),
+		time.Now().UnixMilli(),
+	).Int64Slice()
+	if err != nil {
+		return Result{}, err
+	}
+
+	return Result{
+		Allowed:    values[0] == 1,
+		Remaining:  int(values[1]),
+		RetryAfter: time.Duration(values[2]) * time.Millisecond,
+	}, nil
+}
+
+func (r *Redis) Acquire(ctx context.Context, key string, max int) (bool, error) {
+	ok, err := r.client.Eval(ctx, acquireScript, []string{r.prefix + "count:" + key},
+		max, r.countTTL.Milliseconds(),
+	).Int64()
+	if err != nil {
+		return false, err
+	}
+	return ok == 1, nil
+}
+
+func (r *Redis) Release(ctx context.Context, key string) error {
+	return r.client.Eval(ctx, releaseScript, []string{r.prefix + "count:" + key}).Err()
+}
@@ -0,0 +1,411 @@
+package xllm
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/daodao97/xgo/xlog"
+	"github.com/daodao97/xgo/xrequest"
+	"github.com/tidwall/gjson"
+)
+
+const anthropicVersion = "2023-06-01"
+
+type AnthropicOption func(*Anthropic)
+
+func WithAnthropicModel(model string) AnthropicOption {
+	return func(a *Anthropic) {
+		a.model = model
+	}
+}
+
+func WithAnthropicAPIUrl(apiUrl string) AnthropicOption {
+	return func(a *Anthropic) {
+		if apiUrl != "" {
+			a.apiUrl = strings.TrimSuffix(apiUrl, "/")
+		}
+	}
+}
+
+func WithAnthropicAPIKey(apiKey string) AnthropicOption {
+	return func(a *Anthropic) {
+		a.apiKey = apiKey
+	}
+}
+
+// WithAnthropicOptions 模型默认的采样参数, 可被请求中的 Options 覆盖
+func WithAnthropicOptions(options Options) AnthropicOption {
+	return func(a *Anthropic) {
+		a.options = options
+	}
+}
+
+// Anthropic Messages API
+// 请求/响应在内部与 OpenAI 风格的 Request/Response 互相转换
+type Anthropic struct {
+	model   string
+	apiKey  string
+	apiUrl  string
+	options Options
+}
+
+func NewAnthropic(opts ...AnthropicOption) LLM {
+	anthropic := &Anthropic{
+		apiUrl: "https://api.anthropic.com",
+	}
+	for _, opt := range opts {
+		opt(anthropic)
+	}
+	return anthropic
+}
+
+func (a *Anthropic) post(body any) (*xrequest.Response, error) {
+	response, err := xrequest.New().
+		SetDebug(false).
+		SetHeader("x-api-key", a.apiKey).
+		SetHeader("anthropic-version", anthropicVersion).
+		SetHeader("Content-Type", "application/json").
+		SetBody(body).
+		Post(a.apiUrl + "/v1/messages")
+	if err != nil {
+		return nil, err
+	}
+	if err := response.Error(); err != nil {
+		return nil, err
+	}
+	return response, nil
+}
+
+func (a *Anthropic) Chat(ctx context.Context, req Request) (*Response, error) {
+	body, err := a.buildBody(req, false)
+	if err != nil {
+		return nil, err
+	}
+
+	response, err := a.post(body)
+	if err != nil {
+		return nil, err
+	}
+
+	data := response.Json()
+	if errMsg := data.Get("error.message"); errMsg.Exists() {
+		return nil, fmt.Errorf("anthropic api error: %s", errMsg.String())
+	}
+
+	result := &Response{Usage: anthropicUsage(data.Get("usage"))}
+	var texts []string
+	for _, block := range data.Get("content").Array() {
+		switch block.Get("type").String() {
+		case "text":
+			texts = append(texts, block.Get("text").String())
+		case "tool_use":
+			result.ToolCall = append(result.ToolCall, NewToolCall(
+				block.Get("id").String(),
+				block.Get("name").String(),
+				block.Get("input").Raw,
+			))
+		}
+	}
+	result.Content = strings.Join(texts, "")
+
+	return result, nil
+}
+
+func (a *Anthropic) ChatStream(ctx context.Context, req Request) (chan *Response, error) {
+	if len(req.Messages) == 0 {
+		return nil, errors.New("messages is required")
+	}
+
+	body, err := a.buildBody(req, true)
+	if err != nil {
+		return nil, err
+	}
+
+	response, err := a.post(body)
+	if err != nil {
+		return nil, err
+	}
+
+	stream, err := response.Stream()
+	if err != nil {
+		return nil, err
+	}
+
+	ch := make(chan *Response)
+
+	go func() {
+		defer close(ch)
+
+		// 按 content block 的 index 记录工具调用, 参数以 input_json_delta 分片返回
+		var toolCalls []*ToolCall
+		toolIndex := make(map[int64]*ToolCall)
+		usage := &Usage{}
+
+		defer func() {
+			if len(toolCalls) > 0 {
+				ch <- &Response{ToolCall: toolCalls, FullTool: true}
+			}
+			if usage.PromptTokens != 0 || usage.CompletionTokens != 0 {
+				usage.TotalTokens = usage.PromptTokens + usage.CompletionTokens
+				ch <- &Response{Usage: usage}
+			}
+		}()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case line, ok := <-stream:
+				if !ok {
+					return
+				}
+
+				// 只处理 data: 行, event: 行的类型在 data 中也有
+				if !strings.HasPrefix(line, "data:") {
+					continue
+				}
+				event := gjson.Parse(strings.TrimSpace(strings.TrimPrefix(line, "data:")))
+
+				switch event.Get("type").String() {
+				case "message_start":
+					start := anthropicUsage(event.Get("message.usage"))
+					usage.PromptTokens = start.PromptTokens
+					usage.CachedTokens = start.CachedTokens
+				case "content_block_start":
+					block := event.Get("content_block")
+					if block.Get("type").String() == "tool_use" {
+						toolCall := NewToolCall(block.Get("id").String(), block.Get("name").String(), "")
+						toolIndex[event.Get("index").Int()] = toolCall
+						toolCalls = append(toolCalls, toolCall)
+					}
+				case "content_block_delta":
+					delta := event.Get("delta")
+					switch delta.Get("type").String() {
+					case "text_delta":
+						if text := delta.Get("text").String(); text != "" {
+							ch <- &Response{Content: text}
+						}
+					case "input_json_delta":
+						toolCall, exists := toolIndex[event.Get("index").Int()]
+						if !exists {
+							xlog.WarnC(ctx, "警告: 工具调用索引 %d 不存在，无法累积参数", event.Get("index").Int())
+							continue
+						}
+						toolCall.Function.Arguments += delta.Get("partial_json").String()
+						ch <- &Response{ToolCall: toolCalls, FullTool: false}
+					}
+				case "message_delta":
+					if outputTokens := event.Get("usage.output_tokens"); outputTokens.Exists() {
+						usage.CompletionTokens = int(outputTokens.Int())
+					}
+				case "message_stop":
+					return
+				case "error":
+					xlog.ErrorC(ctx, "anthropic 流式响应错误: %s", event.Get("error.message").String())
+					return
+				}
+			}
+		}
+	}()
+
+	return ch, nil
+}
+
+// ChatRaw body 为 OpenAI 风格的请求, 转换后发送
+func (a *Anthropic) ChatRaw(ctx context.Context, body []byte) (*Response, error) {
+	var req Request
+	if err := json.Unmarshal(body, &req); err != nil {
+		return nil, err
+	}
+	return a.Chat(ctx, req)
+}
+
+func (a *Anthropic) ChatStreamRaw(ctx context.Context, body []byte) (chan *Response, error) {
+	var req Request
+	if err := json.Unmarshal(body, &req); err != nil {
+		return nil, err
+	}
+	return a.ChatStream(ctx, req)
+}
+
+func (a *Anthropic) buildBody(req Request, stream bool) (map[string]any, error) {
+	model := a.model
+	if req.Model != "" {
+		model = req.Model
+	}
+	options := a.options.Merge(req.Options)
+
+	var system []string
+	var messages []map[string]any
+
+	// Messages API 要求 user/assistant 交替出现, 相邻同角色的消息合并为一条
+	appendBlocks := func(role string, blocks []map[string]any) {
+		if len(blocks) == 0 {
+			return
+		}
+		if n := len(messages); n > 0 && messages[n-1]["role"] == role {
+			messages[n-1]["content"] = append(messages[n-1]["content"].([]map[string]any), blocks...)
+			return
+		}
+		messages = append(messages, map[string]any{"role": role, "content": blocks})
+	}
+
+	for _, msg := range req.Messages {
+		switch msg.Role {
+		case RoleSystem:
+			if text := ContentText(msg.Content); text != "" {
+				system = append(system, text)
+			}
+		case RoleTool, RoleFunction:
+			// 工具结果以 user 消息中的 tool_result 返回
+			appendBlocks(RoleUser, []map[string]any{{
+				"type":        "tool_result",
+				"tool_use_id": msg.ToolCallID,
+				"content":     ContentText(msg.Content),
+			}})
+		case RoleAssistant:
+			blocks := anthropicContent(msg.Content)
+			for _, toolCall := range msg.ToolCalls {
+				blocks = append(blocks, map[string]any{
+					"type":  "tool_use",
+					"id":    toolCall.ID,
+					"name":  toolCall.Function.Name,
+					"input": toolArguments(toolCall.Function.Arguments),
+				})
+			}
+			appendBlocks(RoleAssistant, blocks)
+		default:
+			appendBlocks(RoleUser, anthropicContent(msg.Content))
+		}
+	}
+
+	if len(messages) == 0 {
+		return nil, errors.New("messages is required")
+	}
+
+	// max_tokens 为必填参数
+	maxTokens := options.MaxTokens
+	if maxTokens <= 0 {
+		maxTokens = 1024
+	}
+
+	body := map[string]any{
+		"model":      model,
+		"messages":   messages,
+		"max_tokens": maxTokens,
+	}
+	// Messages API 不支持 frequency/presence penalty 和 seed
+	if options.Temperature != nil {
+		body["temperature"] = *options.Temperature
+	}
+	if options.TopP != nil {
+		body["top_p"] = *options.TopP
+	}
+	if len(options.Stop) > 0 {
+		body["stop_sequences"] = options.Stop
+	}
+	if stream {
+		body["stream"] = true
+	}
+	// Messages API 没有 JSON mode, 通过系统提示约束输出
+	if options.ResponseFormat.IsJSON() {
+		system = append(system, "Respond only with a single valid JSON object, without any other text.")
+	}
+	if schema := options.ResponseFormat.Schema(); schema != nil {
+		if data, err := json.Marshal(schema); err == nil {
+			system = append(system, "The JSON object must conform to this JSON schema:\n"+string(data))
+		}
+	}
+	if len(system) > 0 {
+		body["system"] = strings.Join(system, "\n\n")
+	}
+
+	if len(req.Tools) > 0 {
+		tools := make([]map[string]any, 0, len(req.Tools))
+		for _, tool := range req.Tools {
+			schema := tool.Schema()
+			if schema == nil {
+				schema = map[string]any{"type": "object", "properties": map[string]any{}}
+			}
+			tools = append(tools, map[string]any{
+				"name":         tool.Name,
+				"description":  tool.Description,
+				"input_schema": schema,
+			})
+		}
+		body["tools"] = tools
+
+		if choice := anthropicToolChoice(req.ToolChoice); choice != nil {
+			body["tool_choice"] = choice
+		}
+	}
+
+	return body, nil
+}
+
+func anthropicContent(content Content) []map[string]any {
+	var blocks []map[string]any
+	switch c := content.(type) {
+	case *TextContent:
+		if c.Text != "" {
+			blocks = append(blocks, map[string]any{"type": "text", "text": c.Text})
+		}
+	case *MultiContent:
+		for _, item := range c.Items {
+			switch item.Type {
+			case "text":
+				if item.Text != "" {
+					blocks = append(blocks, map[string]any{"type": "text", "text": item.Text})
+				}
+			case "image_url":
+				if item.ImageURL == nil {
+					continue
+				}
+				source := map[string]any{"type": "url", "url": item.ImageURL.URL}
+				if mimeType, data, ok := parseDataURL(item.ImageURL.URL); ok {
+					source = map[string]any{"type": "base64", "media_type": mimeType, "data": data}
+				}
+				blocks = append(blocks, map[string]any{"type": "image", "source": source})
+			}
+		}
+	}
+	return blocks
+}
+
+func anthropicToolChoice(choice ToolChoice) map[string]any {
+	switch c := choice.(type) {
+	case *StringToolChoice:
+		switch c.Value {
+		case "auto":
+			return map[string]any{"type": "auto"}
+		case "required":
+			return map[string]any{"type": "any"}
+		case "none":
+			return map[string]any{"type": "none"}
+		}
+	case *ObjectToolChoice:
+		return map[string]any{"type": "tool", "name": c.Function.Name}
+	}
+	return nil
+}
+
+func anthropicUsage(usage gjson.Result) *Usage {
+	result := &Usage{
+		PromptTokens:     int(usage.Get("input_tokens").Int()),
+		CompletionTokens: int(usage.Get("output_tokens").Int()),
+		CachedTokens:     int(usage.Get("cache_read_input_tokens").Int()),
+	}
+	result.TotalTokens = result.PromptTokens + result.CompletionTokens
+	return result
+}
+
+// toolArguments 将 OpenAI 风格的字符串参数转换为 JSON 对象
+func toolArguments(arguments string) json.RawMessage {
+	if strings.TrimSpace(arguments) == "" || !json.Valid([]byte(arguments)) {
+		return json.RawMessage("{}")
+	}
+	return json.RawMessage(arguments)
+}
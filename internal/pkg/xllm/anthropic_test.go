@@ -0,0 +1,179 @@
+package xllm
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/tidwall/gjson"
+)
+
+// newFixtureServer 返回录制的响应, check 用于校验转换后的请求
+func newFixtureServer(t *testing.T, fixture string, check func(r *http.Request, body gjson.Result)) *httptest.Server {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join("testdata", fixture))
+	if err != nil {
+		t.Fatalf("读取 fixture 失败: %v", err)
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		check(r, gjson.ParseBytes(body))
+		if filepath.Ext(fixture) == ".txt" {
+			w.Header().Set("Content-Type", "text/event-stream")
+		} else {
+			w.Header().Set("Content-Type", "application/json")
+		}
+		w.Write(data)
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+// fixtureRequest 覆盖系统提示、图片、工具调用和工具结果
+func fixtureRequest() Request {
+	assistant := Message{Role: RoleAssistant, Content: NewTextContent("")}
+	assistant.ToolCalls = []*ToolCall{NewToolCall("call_1", "get_current_weather", `{"location":"北京"}`)}
+
+	return Request{
+		Messages: []Message{
+			{Role: RoleSystem, Content: NewTextContent("你是一个助手")},
+			{Role: RoleUser, Content: NewMultiContent([]ContentItem{
+				NewTextContentItem("这是哪里"),
+				NewImageUrlContent("data:image/png;base64,iVBORw0KGgo="),
+			})},
+			assistant,
+			{Role: RoleTool, ToolCallID: "call_1", Content: NewTextContent("晴 25度")},
+			{Role: RoleUser, Content: NewTextContent("上海呢")},
+		},
+		Tools: []Tool{{
+			Name:        "get_current_weather",
+			Description: "Get the current weather in a given location",
+			Parameters: []Parameter{
+				{Name: "location", Description: "The location to get the weather for", Type: "string", Required: true},
+			},
+		}},
+		ToolChoice: NewStringToolChoice("required"),
+	}
+}
+
+func checkAnthropicRequest(t *testing.T, r *http.Request, body gjson.Result) {
+	if r.URL.Path != "/v1/messages" {
+		t.Errorf("path = %s", r.URL.Path)
+	}
+	if r.Header.Get("x-api-key") != "test-key" || r.Header.Get("anthropic-version") == "" {
+		t.Errorf("headers = %v", r.Header)
+	}
+	if body.Get("model").String() != "claude-3-5-haiku-20241022" || body.Get("max_tokens").Int() != 512 {
+		t.Errorf("model/max_tokens = %s", body.Raw)
+	}
+	if body.Get("system").String() != "你是一个助手" {
+		t.Errorf("system = %s", body.Get("system").Raw)
+	}
+
+	messages := body.Get("messages").Array()
+	if len(messages) != 3 {
+		t.Fatalf("messages = %s", body.Get("messages").Raw)
+	}
+	if messages[0].Get("content.1.source.type").String() != "base64" ||
+		messages[0].Get("content.1.source.media_type").String() != "image/png" {
+		t.Errorf("image = %s", messages[0].Raw)
+	}
+	if messages[1].Get("content.0.type").String() != "tool_use" ||
+		messages[1].Get("content.0.input.location").String() != "北京" {
+		t.Errorf("tool_use = %s", messages[1].Raw)
+	}
+	// 工具结果和后续用户消息合并为一条 user 消息
+	if messages[2].Get("role").String() != "user" ||
+		messages[2].Get("content.0.tool_use_id").String() != "call_1" ||
+		messages[2].Get("content.1.text").String() != "上海呢" {
+		t.Errorf("tool_result = %s", messages[2].Raw)
+	}
+
+	if body.Get("tools.0.input_schema.required.0").String() != "location" {
+		t.Errorf("tools = %s", body.Get("tools").Raw)
+	}
+	if body.Get("tool_choice.type").String() != "any" {
+		t.Errorf("tool_choice = %s", body.Get("tool_choice").Raw)
+	}
+}
+
+func TestAnthropic_Chat(t *testing.T) {
+	server := newFixtureServer(t, "anthropic_chat.json", func(r *http.Request, body gjson.Result) {
+		checkAnthropicRequest(t, r, body)
+		if body.Get("stream").Exists() {
+			t.Errorf("stream should not be set")
+		}
+	})
+
+	llm := NewAnthropic(
+		WithAnthropicAPIUrl(server.URL),
+		WithAnthropicAPIKey("test-key"),
+		WithAnthropicModel("claude-3-5-haiku-20241022"),
+		WithAnthropicOptions(Options{MaxTokens: 512}),
+	)
+	response, err := llm.Chat(context.Background(), fixtureRequest())
+	if err != nil {
+		t.Fatalf("Chat 失败: %v", err)
+	}
+
+	if response.Content != "我来帮你查一下上海的天气。" {
+		t.Errorf("Content = %q", response.Content)
+	}
+	if len(response.ToolCall) != 1 ||
+		response.ToolCall[0].ID != "toolu_01A09q90qw90lq917835lq9" ||
+		response.ToolCall[0].Function.Name != "get_current_weather" ||
+		gjson.Get(response.ToolCall[0].Function.Arguments, "location").String() != "上海" {
+		t.Errorf("ToolCall = %+v", response.ToolCall)
+	}
+	if response.Usage.PromptTokens != 412 || response.Usage.CompletionTokens != 58 ||
+		response.Usage.TotalTokens != 470 || response.Usage.CachedTokens != 128 {
+		t.Errorf("Usage = %+v", response.Usage)
+	}
+}
+
+func TestAnthropic_ChatStream(t *testing.T) {
+	server := newFixtureServer(t, "anthropic_stream.txt", func(r *http.Request, body gjson.Result) {
+		checkAnthropicRequest(t, r, body)
+		if !body.Get("stream").Bool() {
+			t.Errorf("stream should be true")
+		}
+	})
+
+	llm := NewAnthropic(
+		WithAnthropicAPIUrl(server.URL),
+		WithAnthropicAPIKey("test-key"),
+		WithAnthropicModel("claude-3-5-haiku-20241022"),
+		WithAnthropicOptions(Options{MaxTokens: 512}),
+	)
+	stream, err := llm.ChatStream(context.Background(), fixtureRequest())
+	if err != nil {
+		t.Fatalf("ChatStream 失败: %v", err)
+	}
+
+	var content string
+	var toolCalls []*ToolCall
+	var usage *Usage
+	for data := range stream {
+		content += data.Content
+		if data.FullTool {
+			toolCalls = data.ToolCall
+		}
+		if data.Usage != nil {
+			usage = data.Usage
+		}
+	}
+
+	if content != "好的，我查一下。" {
+		t.Errorf("content = %q", content)
+	}
+	if len(toolCalls) != 1 || toolCalls[0].Function.Arguments != `{"location": "上海"}` {
+		t.Errorf("toolCalls = %+v", toolCalls)
+	}
+	if usage == nil || usage.PromptTokens != 472 || usage.CompletionTokens != 89 || usage.TotalTokens != 561 {
+		t.Errorf("usage = %+v", usage)
+	}
+}
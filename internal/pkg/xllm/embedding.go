@@ -0,0 +1,95 @@
+package xllm
+
+import (
+	"context"
+
+	"github.com/daodao97/xgo/xrequest"
+	"github.com/tidwall/gjson"
+)
+
+type EmbeddingRequest struct {
+	Model string   `json:"model"`
+	Input []string `json:"input"`
+}
+
+type EmbeddingResponse struct {
+	Model      string      `json:"model,omitempty"`
+	Embeddings [][]float64 `json:"embeddings"`
+	Usage      *Usage      `json:"usage,omitempty"`
+}
+
+// Embedder 支持向量化的模型, 由 OpenAI 和 Ollama 实现
+type Embedder interface {
+	Embed(ctx context.Context, req EmbeddingRequest) (*EmbeddingResponse, error)
+}
+
+func (o *OpenAI) Embed(ctx context.Context, req EmbeddingRequest) (*EmbeddingResponse, error) {
+	model := o.model
+	if req.Model != "" {
+		model = req.Model
+	}
+
+	response, err := xrequest.New().
+		SetDebug(false).
+		SetHeader("Authorization", "Bearer "+o.apiKey).
+		SetHeader("Content-Type", "application/json").
+		SetBody(map[string]any{"model": model, "input": req.Input}).
+		Post(o.apiUrl + "/embeddings")
+	if err != nil {
+		return nil, err
+	}
+	if err := response.Error(); err != nil {
+		return nil, err
+	}
+
+	data := response.Json()
+	result := &EmbeddingResponse{
+		Usage: &Usage{
+			PromptTokens: int(data.Get("usage.prompt_tokens").Int()),
+			TotalTokens:  int(data.Get("usage.total_tokens").Int()),
+		},
+	}
+	for _, item := range data.Get("data").Array() {
+		result.Embeddings = append(result.Embeddings, floats(item.Get("embedding")))
+	}
+	return result, nil
+}
+
+func (o *Ollama) Embed(ctx context.Context, req EmbeddingRequest) (*EmbeddingResponse, error) {
+	model := o.model
+	if req.Model != "" {
+		model = req.Model
+	}
+
+	response, err := xrequest.New().
+		SetDebug(false).
+		SetHeader("Content-Type", "application/json").
+		SetBody(map[string]any{"model": model, "input": req.Input}).
+		Post(o.apiUrl + "/api/embed")
+	if err != nil {
+		return nil, err
+	}
+	if err := response.Error(); err != nil {
+		return nil, err
+	}
+
+	data := response.Json()
+	result := &EmbeddingResponse{
+		Usage: &Usage{
+			PromptTokens: int(data.Get("prompt_eval_count").Int()),
+			TotalTokens:  int(data.Get("prompt_eval_count").Int()),
+		},
+	}
+	for _, item := range data.Get("embeddings").Array() {
+		result.Embeddings = append(result.Embeddings, floats(item))
+	}
+	return result, nil
+}
+
+func floats(list gjson.Result) []float64 {
+	values := make([]float64, 0, len(list.Array()))
+	for _, v := range list.Array() {
+		values = append(values, v.Float())
+	}
+	return values
+}
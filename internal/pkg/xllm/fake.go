@@ -0,0 +1,187 @@
+package xllm
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"strings"
+
+	"github.com/daodao97/xgo/xlog"
+)
+
+// FakeReply 脚本中的一条回复
+type FakeReply struct {
+	Match     string `json:"match"`     // 请求消息中包含该文本时命中, 为空表示总是命中
+	Content   string `json:"content"`   // 回复内容, {{input}} 会被替换为最后一条用户消息
+	ToolCall  string `json:"tool_call"` // 返回的工具调用, 仅当请求中提供了该工具时命中
+	Arguments string `json:"arguments"` // 工具调用参数 (JSON)
+}
+
+// defaultFakeReplies 内置回复, 覆盖聊天、浪漫度和动作三个节点
+var defaultFakeReplies = []FakeReply{
+	{Match: "relationship meter change", Content: `{"change": 1, "reason": "friendly greeting"}`},
+	{Match: "Available actions:", Content: `{"action": "none", "arguments": {}}`},
+	{Content: "我听到你说: {{input}}"},
+}
+
+type FakeOption func(*Fake)
+
+// WithFakeScript 从 JSON 文件加载回复脚本, 文件内容为 FakeReply 数组
+func WithFakeScript(path string) FakeOption {
+	return func(f *Fake) {
+		if path == "" {
+			return
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			xlog.Error("读取 fake llm 脚本失败", xlog.String("path", path), xlog.Err(err))
+			return
+		}
+		var replies []FakeReply
+		if err := json.Unmarshal(data, &replies); err != nil {
+			xlog.Error("解析 fake llm 脚本失败", xlog.String("path", path), xlog.Err(err))
+			return
+		}
+		f.replies = replies
+	}
+}
+
+func WithFakeReplies(replies ...FakeReply) FakeOption {
+	return func(f *Fake) {
+		f.replies = replies
+	}
+}
+
+// Fake 按脚本回放固定回复的 LLM, 不访问网络, 用于 CI 和离线开发
+// 按顺序匹配脚本中的规则, 相同请求总是得到相同回复
+type Fake struct {
+	replies []FakeReply
+}
+
+func NewFake(opts ...FakeOption) LLM {
+	fake := &Fake{replies: defaultFakeReplies}
+	for _, opt := range opts {
+		opt(fake)
+	}
+	return fake
+}
+
+func (f *Fake) Chat(ctx context.Context, req Request) (*Response, error) {
+	reply := f.match(req)
+	if reply == nil {
+		return &Response{Usage: &Usage{}}, nil
+	}
+
+	input := ""
+	for i := len(req.Messages) - 1; i >= 0; i-- {
+		if req.Messages[i].Role == RoleUser {
+			input = ContentText(req.Messages[i].Content)
+			break
+		}
+	}
+
+	response := &Response{
+		Content: strings.ReplaceAll(reply.Content, "{{input}}", input),
+	}
+	if reply.ToolCall != "" {
+		response.ToolCall = []*ToolCall{NewToolCall("call_0", reply.ToolCall, string(toolArguments(reply.Arguments)))}
+	}
+
+	// 按字符数估算 token, 保证用量统计可预测
+	response.Usage = &Usage{
+		PromptTokens:     len([]rune(requestText(req))),
+		CompletionTokens: len([]rune(response.Content)),
+	}
+	response.Usage.TotalTokens = response.Usage.PromptTokens + response.Usage.CompletionTokens
+
+	return response, nil
+}
+
+func (f *Fake) ChatStream(ctx context.Context, req Request) (chan *Response, error) {
+	response, err := f.Chat(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	ch := make(chan *Response)
+
+	go func() {
+		defer close(ch)
+
+		// 按句子切分, 模拟流式输出
+		for _, chunk := range splitSentences(response.Content) {
+			select {
+			case <-ctx.Done():
+				return
+			case ch <- &Response{Content: chunk}:
+			}
+		}
+		if len(response.ToolCall) > 0 {
+			ch <- &Response{ToolCall: response.ToolCall, FullTool: true}
+		}
+		ch <- &Response{Usage: response.Usage}
+	}()
+
+	return ch, nil
+}
+
+func (f *Fake) ChatRaw(ctx context.Context, body []byte) (*Response, error) {
+	var req Request
+	if err := json.Unmarshal(body, &req); err != nil {
+		return nil, err
+	}
+	return f.Chat(ctx, req)
+}
+
+func (f *Fake) ChatStreamRaw(ctx context.Context, body []byte) (chan *Response, error) {
+	var req Request
+	if err := json.Unmarshal(body, &req); err != nil {
+		return nil, err
+	}
+	return f.ChatStream(ctx, req)
+}
+
+func (f *Fake) match(req Request) *FakeReply {
+	text := requestText(req)
+	tools := make(map[string]bool, len(req.Tools))
+	for _, tool := range req.Tools {
+		tools[tool.Name] = true
+	}
+
+	for i := range f.replies {
+		reply := &f.replies[i]
+		if reply.Match != "" && !strings.Contains(text, reply.Match) {
+			continue
+		}
+		if reply.ToolCall != "" && !tools[reply.ToolCall] {
+			continue
+		}
+		return reply
+	}
+	return nil
+}
+
+// requestText 请求中全部消息的文本
+func requestText(req Request) string {
+	var texts []string
+	for _, msg := range req.Messages {
+		texts = append(texts, ContentText(msg.Content))
+	}
+	return strings.Join(texts, "\n")
+}
+
+func splitSentences(text string) []string {
+	var chunks []string
+	start := 0
+	runes := []rune(text)
+	for i, r := range runes {
+		if strings.ContainsRune("。！？!?.,，\n", r) {
+			chunks = append(chunks, string(runes[start:i+1]))
+			start = i + 1
+		}
+	}
+	if start < len(runes) {
+		chunks = append(chunks, string(runes[start:]))
+	}
+	return chunks
+}
@@ -0,0 +1,56 @@
+package xllm
+
+import (
+	"context"
+	"testing"
+)
+
+func TestFake_Chat(t *testing.T) {
+	llm := NewFake(WithFakeReplies(
+		FakeReply{Match: "<romance_meter_change>", Content: "<romance_meter_change>+2</romance_meter_change>"},
+		FakeReply{ToolCall: "heartbeat", Arguments: `{"bpm": 120}`},
+		FakeReply{Content: "你好，{{input}}！今天过得怎么样？"},
+	))
+	ctx := context.Background()
+
+	response, err := llm.Chat(ctx, Request{Messages: []Message{
+		{Role: RoleSystem, Content: NewTextContent("输出 <romance_meter_change>{change}</romance_meter_change>")},
+		{Role: RoleUser, Content: NewTextContent("我想你了")},
+	}})
+	if err != nil || response.Content != "<romance_meter_change>+2</romance_meter_change>" {
+		t.Errorf("romance = %+v, %v", response, err)
+	}
+
+	// 提供了对应工具时返回工具调用
+	response, err = llm.Chat(ctx, Request{
+		Messages: []Message{{Role: RoleUser, Content: NewTextContent("我想你了")}},
+		Tools:    []Tool{{Name: "heartbeat"}},
+	})
+	if err != nil || len(response.ToolCall) != 1 || response.ToolCall[0].Function.Arguments != `{"bpm": 120}` {
+		t.Errorf("tool = %+v, %v", response, err)
+	}
+
+	// 没有工具时跳过工具规则
+	response, err = llm.Chat(ctx, Request{Messages: []Message{{Role: RoleUser, Content: NewTextContent("小明")}}})
+	if err != nil || response.Content != "你好，小明！今天过得怎么样？" || len(response.ToolCall) != 0 {
+		t.Errorf("chat = %+v, %v", response, err)
+	}
+
+	stream, err := llm.ChatStream(ctx, Request{Messages: []Message{{Role: RoleUser, Content: NewTextContent("小明")}}})
+	if err != nil {
+		t.Fatalf("ChatStream 失败: %v", err)
+	}
+	var chunks []string
+	var usage *Usage
+	for data := range stream {
+		if data.Content != "" {
+			chunks = append(chunks, data.Content)
+		}
+		if data.Usage != nil {
+			usage = data.Usage
+		}
+	}
+	if len(chunks) != 3 || chunks[0] != "你好，" || usage == nil || usage.TotalTokens == 0 {
+		t.Errorf("chunks = %q, usage = %+v", chunks, usage)
+	}
+}
@@ -0,0 +1,430 @@
+package xllm
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/daodao97/xgo/xlog"
+	"github.com/daodao97/xgo/xrequest"
+	"github.com/tidwall/gjson"
+)
+
+type GeminiOption func(*Gemini)
+
+func WithGeminiModel(model string) GeminiOption {
+	return func(g *Gemini) {
+		g.model = model
+	}
+}
+
+func WithGeminiAPIUrl(apiUrl string) GeminiOption {
+	return func(g *Gemini) {
+		if apiUrl != "" {
+			g.apiUrl = strings.TrimSuffix(apiUrl, "/")
+		}
+	}
+}
+
+func WithGeminiAPIKey(apiKey string) GeminiOption {
+	return func(g *Gemini) {
+		g.apiKey = apiKey
+	}
+}
+
+// WithGeminiOptions 模型默认的采样参数, 可被请求中的 Options 覆盖
+func WithGeminiOptions(options Options) GeminiOption {
+	return func(g *Gemini) {
+		g.options = options
+	}
+}
+
+// Gemini generateContent API
+// 请求/响应在内部与 OpenAI 风格的 Request/Response 互相转换
+type Gemini struct {
+	model   string
+	apiKey  string
+	apiUrl  string
+	options Options
+}
+
+func NewGemini(opts ...GeminiOption) LLM {
+	gemini := &Gemini{
+		apiUrl: "https://generativelanguage.googleapis.com",
+	}
+	for _, opt := range opts {
+		opt(gemini)
+	}
+	return gemini
+}
+
+func (g *Gemini) post(model string, method string, body any) (*xrequest.Response, error) {
+	req := xrequest.New().
+		SetDebug(false).
+		SetHeader("x-goog-api-key", g.apiKey).
+		SetHeader("Content-Type", "application/json").
+		SetBody(body)
+	if method == "streamGenerateContent" {
+		req = req.SetQueryParam("alt", "sse")
+	}
+
+	response, err := req.Post(fmt.Sprintf("%s/v1beta/models/%s:%s", g.apiUrl, model, method))
+	if err != nil {
+		return nil, err
+	}
+	if err := response.Error(); err != nil {
+		return nil, err
+	}
+	return response, nil
+}
+
+func (g *Gemini) modelName(req Request) string {
+	if req.Model != "" {
+		return req.Model
+	}
+	return g.model
+}
+
+func (g *Gemini) Chat(ctx context.Context, req Request) (*Response, error) {
+	body, err := g.buildBody(req)
+	if err != nil {
+		return nil, err
+	}
+
+	response, err := g.post(g.modelName(req), "generateContent", body)
+	if err != nil {
+		return nil, err
+	}
+
+	data := response.Json()
+	if errMsg := data.Get("error.message"); errMsg.Exists() {
+		return nil, fmt.Errorf("gemini api error: %s", errMsg.String())
+	}
+
+	result := &Response{Usage: geminiUsage(data.Get("usageMetadata"))}
+	var texts []string
+	for i, part := range data.Get("candidates.0.content.parts").Array() {
+		if text := part.Get("text"); text.Exists() && !part.Get("thought").Bool() {
+			texts = append(texts, text.String())
+		}
+		if call := part.Get("functionCall"); call.Exists() {
+			result.ToolCall = append(result.ToolCall, geminiToolCall(call, i))
+		}
+	}
+	result.Content = strings.Join(texts, "")
+
+	return result, nil
+}
+
+func (g *Gemini) ChatStream(ctx context.Context, req Request) (chan *Response, error) {
+	if len(req.Messages) == 0 {
+		return nil, errors.New("messages is required")
+	}
+
+	body, err := g.buildBody(req)
+	if err != nil {
+		return nil, err
+	}
+
+	response, err := g.post(g.modelName(req), "streamGenerateContent", body)
+	if err != nil {
+		return nil, err
+	}
+
+	stream, err := response.Stream()
+	if err != nil {
+		return nil, err
+	}
+
+	ch := make(chan *Response)
+
+	go func() {
+		defer close(ch)
+
+		// Gemini 的函数调用在单个分片中完整返回, usageMetadata 以最后一个分片为准
+		var toolCalls []*ToolCall
+		var usage *Usage
+
+		defer func() {
+			if len(toolCalls) > 0 {
+				ch <- &Response{ToolCall: toolCalls, FullTool: true}
+			}
+			if usage != nil && (usage.PromptTokens != 0 || usage.CompletionTokens != 0) {
+				ch <- &Response{Usage: usage}
+			}
+		}()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case line, ok := <-stream:
+				if !ok {
+					return
+				}
+
+				if !strings.HasPrefix(line, "data:") {
+					continue
+				}
+				chunk := gjson.Parse(strings.TrimSpace(strings.TrimPrefix(line, "data:")))
+
+				if errMsg := chunk.Get("error.message"); errMsg.Exists() {
+					xlog.ErrorC(ctx, "gemini 流式响应错误: %s", errMsg.String())
+					return
+				}
+
+				for _, part := range chunk.Get("candidates.0.content.parts").Array() {
+					if text := part.Get("text").String(); text != "" && !part.Get("thought").Bool() {
+						ch <- &Response{Content: text}
+					}
+					if call := part.Get("functionCall"); call.Exists() {
+						toolCalls = append(toolCalls, geminiToolCall(call, len(toolCalls)))
+						ch <- &Response{ToolCall: toolCalls, FullTool: false}
+					}
+				}
+
+				if metadata := chunk.Get("usageMetadata"); metadata.Exists() {
+					usage = geminiUsage(metadata)
+				}
+			}
+		}
+	}()
+
+	return ch, nil
+}
+
+// ChatRaw body 为 OpenAI 风格的请求, 转换后发送
+func (g *Gemini) ChatRaw(ctx context.Context, body []byte) (*Response, error) {
+	var req Request
+	if err := json.Unmarshal(body, &req); err != nil {
+		return nil, err
+	}
+	return g.Chat(ctx, req)
+}
+
+func (g *Gemini) ChatStreamRaw(ctx context.Context, body []byte) (chan *Response, error) {
+	var req Request
+	if err := json.Unmarshal(body, &req); err != nil {
+		return nil, err
+	}
+	return g.ChatStream(ctx, req)
+}
+
+func (g *Gemini) buildBody(req Request) (map[string]any, error) {
+	var system []string
+	var contents []map[string]any
+
+	// functionResponse 需要函数名, 通过 tool_call_id 从之前的 assistant 消息中查找
+	toolNames := make(map[string]string)
+
+	appendParts := func(role string, parts []map[string]any) {
+		if len(parts) == 0 {
+			return
+		}
+		if n := len(contents); n > 0 && contents[n-1]["role"] == role {
+			contents[n-1]["parts"] = append(contents[n-1]["parts"].([]map[string]any), parts...)
+			return
+		}
+		contents = append(contents, map[string]any{"role": role, "parts": parts})
+	}
+
+	for _, msg := range req.Messages {
+		switch msg.Role {
+		case RoleSystem:
+			if text := ContentText(msg.Content); text != "" {
+				system = append(system, text)
+			}
+		case RoleTool, RoleFunction:
+			appendParts("user", []map[string]any{{
+				"functionResponse": map[string]any{
+					"name":     toolNames[msg.ToolCallID],
+					"response": map[string]any{"content": ContentText(msg.Content)},
+				},
+			}})
+		case RoleAssistant:
+			parts := geminiParts(msg.Content)
+			for _, toolCall := range msg.ToolCalls {
+				toolNames[toolCall.ID] = toolCall.Function.Name
+				parts = append(parts, map[string]any{
+					"functionCall": map[string]any{
+						"name": toolCall.Function.Name,
+						"args": toolArguments(toolCall.Function.Arguments),
+					},
+				})
+			}
+			appendParts("model", parts)
+		default:
+			appendParts("user", geminiParts(msg.Content))
+		}
+	}
+
+	if len(contents) == 0 {
+		return nil, errors.New("messages is required")
+	}
+
+	body := map[string]any{
+		"contents": contents,
+	}
+	if len(system) > 0 {
+		body["systemInstruction"] = map[string]any{
+			"parts": []map[string]any{{"text": strings.Join(system, "\n\n")}},
+		}
+	}
+	options := g.options.Merge(req.Options)
+	generationConfig := map[string]any{}
+	if options.Temperature != nil {
+		generationConfig["temperature"] = *options.Temperature
+	}
+	if options.TopP != nil {
+		generationConfig["topP"] = *options.TopP
+	}
+	if options.FrequencyPenalty != nil {
+		generationConfig["frequencyPenalty"] = *options.FrequencyPenalty
+	}
+	if options.PresencePenalty != nil {
+		generationConfig["presencePenalty"] = *options.PresencePenalty
+	}
+	if options.MaxTokens > 0 {
+		generationConfig["maxOutputTokens"] = options.MaxTokens
+	}
+	if len(options.Stop) > 0 {
+		generationConfig["stopSequences"] = options.Stop
+	}
+	if options.Seed != nil {
+		generationConfig["seed"] = *options.Seed
+	}
+	if options.ResponseFormat.IsJSON() {
+		generationConfig["responseMimeType"] = "application/json"
+	}
+	if schema := options.ResponseFormat.Schema(); schema != nil {
+		generationConfig["responseSchema"] = geminiSchema(schema)
+	}
+	if len(generationConfig) > 0 {
+		body["generationConfig"] = generationConfig
+	}
+
+	if len(req.Tools) > 0 {
+		declarations := make([]map[string]any, 0, len(req.Tools))
+		for _, tool := range req.Tools {
+			declaration := map[string]any{
+				"name":        tool.Name,
+				"description": tool.Description,
+			}
+			if schema := tool.Schema(); schema != nil {
+				declaration["parameters"] = geminiSchema(schema)
+			}
+			declarations = append(declarations, declaration)
+		}
+		body["tools"] = []map[string]any{{"functionDeclarations": declarations}}
+
+		if config := geminiToolConfig(req.ToolChoice); config != nil {
+			body["toolConfig"] = map[string]any{"functionCallingConfig": config}
+		}
+	}
+
+	return body, nil
+}
+
+// geminiSchema Gemini 的 schema 是 OpenAPI 子集, 不支持 additionalProperties, 递归移除
+func geminiSchema(schema map[string]any) map[string]any {
+	result := make(map[string]any, len(schema))
+	for key, value := range schema {
+		switch key {
+		case "additionalProperties":
+			continue
+		case "properties":
+			if properties, ok := value.(map[string]any); ok {
+				converted := make(map[string]any, len(properties))
+				for name, property := range properties {
+					if property, ok := property.(map[string]any); ok {
+						converted[name] = geminiSchema(property)
+					}
+				}
+				value = converted
+			}
+		case "items":
+			if items, ok := value.(map[string]any); ok {
+				value = geminiSchema(items)
+			}
+		}
+		result[key] = value
+	}
+	return result
+}
+
+func geminiParts(content Content) []map[string]any {
+	var parts []map[string]any
+	switch c := content.(type) {
+	case *TextContent:
+		if c.Text != "" {
+			parts = append(parts, map[string]any{"text": c.Text})
+		}
+	case *MultiContent:
+		for _, item := range c.Items {
+			switch item.Type {
+			case "text":
+				if item.Text != "" {
+					parts = append(parts, map[string]any{"text": item.Text})
+				}
+			case "image_url":
+				if item.ImageURL == nil {
+					continue
+				}
+				if mimeType, data, ok := parseDataURL(item.ImageURL.URL); ok {
+					parts = append(parts, map[string]any{
+						"inlineData": map[string]any{"mimeType": mimeType, "data": data},
+					})
+					continue
+				}
+				parts = append(parts, map[string]any{
+					"fileData": map[string]any{
+						"mimeType": imageMimeType(item.ImageURL.URL),
+						"fileUri":  item.ImageURL.URL,
+					},
+				})
+			}
+		}
+	}
+	return parts
+}
+
+func geminiToolConfig(choice ToolChoice) map[string]any {
+	switch c := choice.(type) {
+	case *StringToolChoice:
+		switch c.Value {
+		case "auto":
+			return map[string]any{"mode": "AUTO"}
+		case "required":
+			return map[string]any{"mode": "ANY"}
+		case "none":
+			return map[string]any{"mode": "NONE"}
+		}
+	case *ObjectToolChoice:
+		return map[string]any{"mode": "ANY", "allowedFunctionNames": []string{c.Function.Name}}
+	}
+	return nil
+}
+
+// geminiToolCall 转换函数调用, 旧版本接口不返回 id 时按序号生成
+func geminiToolCall(call gjson.Result, index int) *ToolCall {
+	id := call.Get("id").String()
+	if id == "" {
+		id = fmt.Sprintf("call_%d", index)
+	}
+	args := call.Get("args").Raw
+	if args == "" {
+		args = "{}"
+	}
+	return NewToolCall(id, call.Get("name").String(), args)
+}
+
+func geminiUsage(metadata gjson.Result) *Usage {
+	return &Usage{
+		PromptTokens:     int(metadata.Get("promptTokenCount").Int()),
+		CompletionTokens: int(metadata.Get("candidatesTokenCount").Int()),
+		TotalTokens:      int(metadata.Get("totalTokenCount").Int()),
+		CachedTokens:     int(metadata.Get("cachedContentTokenCount").Int()),
+	}
+}
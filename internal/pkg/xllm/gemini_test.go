@@ -0,0 +1,118 @@
+package xllm
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/tidwall/gjson"
+)
+
+func checkGeminiRequest(t *testing.T, r *http.Request, body gjson.Result) {
+	if r.Header.Get("x-goog-api-key") != "test-key" {
+		t.Errorf("headers = %v", r.Header)
+	}
+	if body.Get("systemInstruction.parts.0.text").String() != "你是一个助手" {
+		t.Errorf("systemInstruction = %s", body.Get("systemInstruction").Raw)
+	}
+
+	contents := body.Get("contents").Array()
+	if len(contents) != 3 {
+		t.Fatalf("contents = %s", body.Get("contents").Raw)
+	}
+	if contents[0].Get("parts.1.inlineData.mimeType").String() != "image/png" {
+		t.Errorf("image = %s", contents[0].Raw)
+	}
+	if contents[1].Get("role").String() != "model" ||
+		contents[1].Get("parts.0.functionCall.args.location").String() != "北京" {
+		t.Errorf("functionCall = %s", contents[1].Raw)
+	}
+	// functionResponse 通过 tool_call_id 找回函数名
+	if contents[2].Get("parts.0.functionResponse.name").String() != "get_current_weather" ||
+		contents[2].Get("parts.1.text").String() != "上海呢" {
+		t.Errorf("functionResponse = %s", contents[2].Raw)
+	}
+
+	declaration := body.Get("tools.0.functionDeclarations.0")
+	if declaration.Get("name").String() != "get_current_weather" ||
+		declaration.Get("parameters.additionalProperties").Exists() {
+		t.Errorf("tools = %s", body.Get("tools").Raw)
+	}
+	if body.Get("toolConfig.functionCallingConfig.mode").String() != "ANY" {
+		t.Errorf("toolConfig = %s", body.Get("toolConfig").Raw)
+	}
+}
+
+func TestGemini_Chat(t *testing.T) {
+	server := newFixtureServer(t, "gemini_chat.json", func(r *http.Request, body gjson.Result) {
+		if r.URL.Path != "/v1beta/models/gemini-2.0-flash:generateContent" {
+			t.Errorf("path = %s", r.URL.Path)
+		}
+		checkGeminiRequest(t, r, body)
+	})
+
+	llm := NewGemini(
+		WithGeminiAPIUrl(server.URL),
+		WithGeminiAPIKey("test-key"),
+		WithGeminiModel("gemini-2.0-flash"),
+	)
+	response, err := llm.Chat(context.Background(), fixtureRequest())
+	if err != nil {
+		t.Fatalf("Chat 失败: %v", err)
+	}
+
+	if response.Content != "我来帮你查一下上海的天气。" {
+		t.Errorf("Content = %q", response.Content)
+	}
+	if len(response.ToolCall) != 1 ||
+		response.ToolCall[0].Function.Name != "get_current_weather" ||
+		gjson.Get(response.ToolCall[0].Function.Arguments, "location").String() != "上海" {
+		t.Errorf("ToolCall = %+v", response.ToolCall)
+	}
+	if response.Usage.PromptTokens != 96 || response.Usage.CompletionTokens != 21 ||
+		response.Usage.TotalTokens != 117 || response.Usage.CachedTokens != 32 {
+		t.Errorf("Usage = %+v", response.Usage)
+	}
+}
+
+func TestGemini_ChatStream(t *testing.T) {
+	server := newFixtureServer(t, "gemini_stream.txt", func(r *http.Request, body gjson.Result) {
+		if r.URL.Path != "/v1beta/models/gemini-2.0-flash:streamGenerateContent" || r.URL.Query().Get("alt") != "sse" {
+			t.Errorf("url = %s", r.URL)
+		}
+		checkGeminiRequest(t, r, body)
+	})
+
+	llm := NewGemini(
+		WithGeminiAPIUrl(server.URL),
+		WithGeminiAPIKey("test-key"),
+		WithGeminiModel("gemini-2.0-flash"),
+	)
+	stream, err := llm.ChatStream(context.Background(), fixtureRequest())
+	if err != nil {
+		t.Fatalf("ChatStream 失败: %v", err)
+	}
+
+	var content string
+	var toolCalls []*ToolCall
+	var usage *Usage
+	for data := range stream {
+		content += data.Content
+		if data.FullTool {
+			toolCalls = data.ToolCall
+		}
+		if data.Usage != nil {
+			usage = data.Usage
+		}
+	}
+
+	if content != "好的，我查一下。" {
+		t.Errorf("content = %q", content)
+	}
+	if len(toolCalls) != 1 || gjson.Get(toolCalls[0].Function.Arguments, "location").String() != "上海" {
+		t.Errorf("toolCalls = %+v", toolCalls)
+	}
+	if usage == nil || usage.PromptTokens != 96 || usage.CompletionTokens != 21 || usage.TotalTokens != 117 {
+		t.Errorf("usage = %+v", usage)
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"path"
 	"strings"
 )
 
@@ -149,6 +150,8 @@ type Tool struct {
 	Name        string      `json:"name"`
 	Description string      `json:"description"`
 	Parameters  []Parameter `json:"parameters"`
+	// InputSchema 原始的参数 JSON Schema (如 MCP 工具), 设置后优先于 Parameters
+	InputSchema map[string]any `json:"-"`
 }
 
 type Parameter struct {
@@ -169,8 +172,15 @@ const (
 	ParameterTypeObject  = "object"
 )
 
-// MarshalJSON 实现 Tool 的自定义 JSON 序列化
-func (t Tool) MarshalJSON() ([]byte, error) {
+// Schema 返回工具参数的 JSON Schema, 没有参数时返回 nil
+func (t Tool) Schema() map[string]any {
+	if t.InputSchema != nil {
+		return t.InputSchema
+	}
+	if len(t.Parameters) == 0 {
+		return nil
+	}
+
 	// 构建 properties
 	properties := make(map[string]any)
 	var required []string
@@ -211,13 +221,20 @@ func (t Tool) MarshalJSON() ([]byte, error) {
 		parameters["required"] = required
 	}
 
+	return parameters
+}
+
+// MarshalJSON 实现 Tool 的自定义 JSON 序列化
+func (t Tool) MarshalJSON() ([]byte, error) {
 	function := map[string]any{
 		"name":        t.Name,
 		"description": t.Description,
-		"strict":      true,
 	}
 
-	if len(properties) > 0 {
+	// strict 要求所有参数必填, 有可选参数时不开启
+	parameters := t.Schema()
+	function["strict"] = parameters == nil || strictSchema(parameters)
+	if parameters != nil {
 		function["parameters"] = parameters
 	}
 
@@ -306,11 +323,45 @@ func ParseToolChoice(data []byte) (ToolChoice, error) {
 	return nil, fmt.Errorf("无法解析 tool_choice 字段")
 }
 
+const (
+	ResponseFormatText       = "text"
+	ResponseFormatJSON       = "json_object"
+	ResponseFormatJSONSchema = "json_schema"
+)
+
+// ResponseFormat 响应格式
+// json_object 要求模型只输出 JSON 对象 (JSON mode), json_schema 进一步约束输出符合 JSONSchema
+type ResponseFormat struct {
+	Type       string      `json:"type"`
+	JSONSchema *JSONSchema `json:"json_schema,omitempty"`
+}
+
+type JSONSchema struct {
+	Name        string         `json:"name"`
+	Description string         `json:"description,omitempty"`
+	Schema      map[string]any `json:"schema"`
+	Strict      bool           `json:"strict,omitempty"`
+}
+
+// IsJSON 是否要求输出 JSON
+func (f *ResponseFormat) IsJSON() bool {
+	return f != nil && (f.Type == ResponseFormatJSON || f.Type == ResponseFormatJSONSchema)
+}
+
+// Schema 返回 json_schema 模式下的 schema, 其他模式返回 nil
+func (f *ResponseFormat) Schema() map[string]any {
+	if f == nil || f.Type != ResponseFormatJSONSchema || f.JSONSchema == nil {
+		return nil
+	}
+	return f.JSONSchema.Schema
+}
+
 type Request struct {
 	Model      string     `json:"model"`
 	Messages   []Message  `json:"messages"`
 	Tools      []Tool     `json:"tools,omitempty"`
 	ToolChoice ToolChoice `json:"tool_choice,omitempty"`
+	Options               // 覆盖模型配置中的采样参数
 }
 
 // UnmarshalJSON 实现 Request 的 JSON 反序列化
@@ -321,6 +372,7 @@ func (r *Request) UnmarshalJSON(data []byte) error {
 		Messages   []Message       `json:"messages"`
 		Tools      []Tool          `json:"tools,omitempty"`
 		ToolChoice json.RawMessage `json:"tool_choice,omitempty"`
+		Options
 	}
 
 	if err := json.Unmarshal(data, &temp); err != nil {
@@ -330,6 +382,7 @@ func (r *Request) UnmarshalJSON(data []byte) error {
 	r.Model = temp.Model
 	r.Messages = temp.Messages
 	r.Tools = temp.Tools
+	r.Options = temp.Options
 
 	// 解析 ToolChoice
 	if len(temp.ToolChoice) > 0 {
@@ -344,6 +397,7 @@ func (r *Request) UnmarshalJSON(data []byte) error {
 }
 
 type Response struct {
+	Model    string      `json:"model,omitempty"` // 经过 Router 时为实际提供服务的模型名称
 	Content  string      `json:"content,omitempty"`
 	FullTool bool        `json:"full_tool,omitempty"`
 	ToolCall []*ToolCall `json:"tool_call,omitempty"`
@@ -359,6 +413,14 @@ type ToolCall struct {
 	} `json:"function"`
 }
 
+// NewToolCall 创建函数调用, arguments 为 JSON 字符串
+func NewToolCall(id string, name string, arguments string) *ToolCall {
+	toolCall := &ToolCall{ID: id, Type: "function"}
+	toolCall.Function.Name = name
+	toolCall.Function.Arguments = arguments
+	return toolCall
+}
+
 type Usage struct {
 	PromptTokens     int `json:"prompt_tokens"`
 	CompletionTokens int `json:"completion_tokens"`
@@ -393,15 +455,17 @@ type FileItem struct {
 	Content string `json:"content,omitempty"`
 }
 
-func FileToMessage(txtMsg string, files []FileItem) *MultiContent {
+// FileToMessage 将用户上传的文件转为多媒体内容
+// fileURL 把存储中的文件路径转为模型可访问的地址 (如签名地址), 为空时原样使用 file.Url
+func FileToMessage(txtMsg string, files []FileItem, fileURL func(key string) string) *MultiContent {
 	items := make([]ContentItem, 0)
 	if txtMsg != "" {
 		items = append(items, NewTextContentItem(txtMsg))
 	}
 	for _, file := range files {
 		fileUrl := file.Url
-		if !strings.HasPrefix(fileUrl, "http") {
-			fileUrl = "https://chatflex.oss-ap-northeast-1.aliyuncs.com/" + fileUrl
+		if fileURL != nil && !strings.HasPrefix(fileUrl, "http") {
+			fileUrl = fileURL(fileUrl)
 		}
 		file.Url = fileUrl
 		if strings.HasPrefix(file.Type, "image") {
@@ -423,7 +487,86 @@ func New(llmConf *conf.LLMConfig) LLM {
 			WithAPIKey(llmConf.ApiKey),
 			WithAPIUrl(llmConf.ApiUrl),
 			WithModel(llmConf.Model),
+			WithOptions(OptionsFromConfig(llmConf)),
+		)
+	case "anthropic":
+		return NewAnthropic(
+			WithAnthropicAPIKey(llmConf.ApiKey),
+			WithAnthropicAPIUrl(llmConf.ApiUrl),
+			WithAnthropicModel(llmConf.Model),
+			WithAnthropicOptions(OptionsFromConfig(llmConf)),
+		)
+	case "gemini":
+		return NewGemini(
+			WithGeminiAPIKey(llmConf.ApiKey),
+			WithGeminiAPIUrl(llmConf.ApiUrl),
+			WithGeminiModel(llmConf.Model),
+			WithGeminiOptions(OptionsFromConfig(llmConf)),
+		)
+	case "ollama":
+		return NewOllama(
+			WithOllamaAPIUrl(llmConf.ApiUrl),
+			WithOllamaModel(llmConf.Model),
+			WithOllamaOptions(OptionsFromConfig(llmConf)),
+		)
+	case "llamacpp":
+		// llama.cpp server 提供 OpenAI 兼容接口, api_key 对应 --api-key 参数, 可为空
+		apiUrl := llmConf.ApiUrl
+		if apiUrl == "" {
+			apiUrl = "http://localhost:8080/v1"
+		}
+		return NewOpenAI(
+			WithAPIKey(llmConf.ApiKey),
+			WithAPIUrl(apiUrl),
+			WithModel(llmConf.Model),
+			WithOptions(OptionsFromConfig(llmConf)),
 		)
+	case "fake":
+		return NewFake(WithFakeScript(llmConf.Script))
 	}
 	return nil
 }
+
+// ContentText 返回消息中的全部文本内容
+func ContentText(content Content) string {
+	switch c := content.(type) {
+	case *TextContent:
+		return c.Text
+	case *MultiContent:
+		var texts []string
+		for _, item := range c.Items {
+			if item.Type == "text" && item.Text != "" {
+				texts = append(texts, item.Text)
+			}
+		}
+		return strings.Join(texts, "\n")
+	}
+	return ""
+}
+
+// parseDataURL 解析 data:image/png;base64,xxx 格式的图片, 返回 mime 类型和 base64 数据
+func parseDataURL(url string) (mimeType string, data string, ok bool) {
+	if !strings.HasPrefix(url, "data:") {
+		return "", "", false
+	}
+	meta, data, found := strings.Cut(strings.TrimPrefix(url, "data:"), ",")
+	if !found || !strings.HasSuffix(meta, ";base64") {
+		return "", "", false
+	}
+	return strings.TrimSuffix(meta, ";base64"), data, true
+}
+
+// imageMimeType 根据图片地址的扩展名推断 mime 类型
+func imageMimeType(url string) string {
+	url, _, _ = strings.Cut(url, "?")
+	switch strings.ToLower(path.Ext(url)) {
+	case ".png":
+		return "image/png"
+	case ".gif":
+		return "image/gif"
+	case ".webp":
+		return "image/webp"
+	default:
+		return "image/jpeg"
+	}
+}
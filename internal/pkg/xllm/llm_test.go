@@ -199,3 +199,66 @@ func TestContent_Serialization(t *testing.T) {
 		}
 	}
 }
+
+func TestFileToMessage(t *testing.T) {
+	files := []FileItem{
+		{Type: "image/png", Name: "a.png", Url: "images/a.png"},
+		{Type: "image/jpeg", Name: "b.jpg", Url: "https://example.com/b.jpg"},
+	}
+	signed := func(key string) string { return "https://files.example.com/" + key + "?signature=x" }
+
+	content := FileToMessage("看看这些图片", files, signed)
+	var urls []string
+	for _, item := range content.Items {
+		if item.ImageURL != nil {
+			urls = append(urls, item.ImageURL.URL)
+		}
+	}
+	if len(urls) != 2 || urls[0] != "https://files.example.com/images/a.png?signature=x" || urls[1] != "https://example.com/b.jpg" {
+		t.Errorf("urls = %v", urls)
+	}
+
+	content = FileToMessage("", files[:1], nil)
+	if content.Items[0].ImageURL.URL != "images/a.png" {
+		t.Errorf("未设置 fileURL 时 url = %s", content.Items[0].ImageURL.URL)
+	}
+}
+
+func TestTool_MarshalStrict(t *testing.T) {
+	tests := []struct {
+		name   string
+		tool   Tool
+		strict bool
+	}{
+		{"无参数", Tool{Name: "time"}, true},
+		{"全部必填", Tool{Name: "search", Parameters: []Parameter{{Name: "query", Type: ParameterTypeString, Required: true}}}, true},
+		{"可选参数", Tool{Name: "image", Parameters: []Parameter{
+			{Name: "prompt", Type: ParameterTypeString, Required: true},
+			{Name: "size", Type: ParameterTypeString},
+		}}, false},
+		{"原始 schema", Tool{Name: "mcp", InputSchema: map[string]any{
+			"type":       "object",
+			"properties": map[string]any{"a": map[string]any{"type": "number"}},
+		}}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, _ := json.Marshal(tt.tool)
+			var decoded struct {
+				Function struct {
+					Strict     bool           `json:"strict"`
+					Parameters map[string]any `json:"parameters"`
+				} `json:"function"`
+			}
+			if err := json.Unmarshal(data, &decoded); err != nil {
+				t.Fatal(err)
+			}
+			if decoded.Function.Strict != tt.strict {
+				t.Errorf("strict = %v, want %v: %s", decoded.Function.Strict, tt.strict, data)
+			}
+			if tt.tool.InputSchema != nil && decoded.Function.Parameters["properties"] == nil {
+				t.Errorf("InputSchema 未输出: %s", data)
+			}
+		})
+	}
+}
@@ -0,0 +1,340 @@
+package xllm
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/daodao97/xgo/xlog"
+	"github.com/daodao97/xgo/xrequest"
+	"github.com/tidwall/gjson"
+)
+
+type OllamaOption func(*Ollama)
+
+func WithOllamaModel(model string) OllamaOption {
+	return func(o *Ollama) {
+		o.model = model
+	}
+}
+
+func WithOllamaAPIUrl(apiUrl string) OllamaOption {
+	return func(o *Ollama) {
+		if apiUrl != "" {
+			o.apiUrl = strings.TrimSuffix(apiUrl, "/")
+		}
+	}
+}
+
+// WithOllamaOptions 模型默认的采样参数, 可被请求中的 Options 覆盖
+func WithOllamaOptions(options Options) OllamaOption {
+	return func(o *Ollama) {
+		o.options = options
+	}
+}
+
+// Ollama 本地模型服务 /api/chat 接口, 用于离线开发
+// 流式响应为 NDJSON, 每行一个 JSON 对象, 最后一行 done 为 true 并带有 token 统计
+type Ollama struct {
+	model   string
+	apiUrl  string
+	options Options
+}
+
+func NewOllama(opts ...OllamaOption) LLM {
+	ollama := &Ollama{
+		apiUrl: "http://localhost:11434",
+	}
+	for _, opt := range opts {
+		opt(ollama)
+	}
+	return ollama
+}
+
+func (o *Ollama) post(body any) (*xrequest.Response, error) {
+	response, err := xrequest.New().
+		SetDebug(false).
+		SetHeader("Content-Type", "application/json").
+		SetBody(body).
+		Post(o.apiUrl + "/api/chat")
+	if err != nil {
+		return nil, err
+	}
+	if err := response.Error(); err != nil {
+		return nil, err
+	}
+	return response, nil
+}
+
+func (o *Ollama) Chat(ctx context.Context, req Request) (*Response, error) {
+	body, err := o.buildBody(ctx, req, false)
+	if err != nil {
+		return nil, err
+	}
+
+	response, err := o.post(body)
+	if err != nil {
+		return nil, err
+	}
+
+	data := response.Json()
+	if errMsg := data.Get("error"); errMsg.Exists() {
+		return nil, fmt.Errorf("ollama error: %s", errMsg.String())
+	}
+
+	return &Response{
+		Content:  data.Get("message.content").String(),
+		ToolCall: ollamaToolCalls(data.Get("message.tool_calls"), 0),
+		Usage:    ollamaUsage(data),
+	}, nil
+}
+
+func (o *Ollama) ChatStream(ctx context.Context, req Request) (chan *Response, error) {
+	if len(req.Messages) == 0 {
+		return nil, errors.New("messages is required")
+	}
+
+	body, err := o.buildBody(ctx, req, true)
+	if err != nil {
+		return nil, err
+	}
+
+	response, err := o.post(body)
+	if err != nil {
+		return nil, err
+	}
+
+	stream, err := response.Stream()
+	if err != nil {
+		return nil, err
+	}
+
+	ch := make(chan *Response)
+
+	go func() {
+		defer close(ch)
+
+		var toolCalls []*ToolCall
+
+		defer func() {
+			if len(toolCalls) > 0 {
+				ch <- &Response{ToolCall: toolCalls, FullTool: true}
+			}
+		}()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case line, ok := <-stream:
+				if !ok {
+					return
+				}
+
+				line = strings.TrimSpace(line)
+				if line == "" {
+					continue
+				}
+				chunk := gjson.Parse(line)
+
+				if errMsg := chunk.Get("error"); errMsg.Exists() {
+					xlog.ErrorC(ctx, "ollama 流式响应错误: %s", errMsg.String())
+					return
+				}
+
+				if text := chunk.Get("message.content").String(); text != "" {
+					ch <- &Response{Content: text}
+				}
+
+				// 工具调用在单个分片中完整返回
+				if calls := ollamaToolCalls(chunk.Get("message.tool_calls"), len(toolCalls)); len(calls) > 0 {
+					toolCalls = append(toolCalls, calls...)
+					ch <- &Response{ToolCall: toolCalls, FullTool: false}
+				}
+
+				if chunk.Get("done").Bool() {
+					if usage := ollamaUsage(chunk); usage.TotalTokens > 0 {
+						ch <- &Response{Usage: usage}
+					}
+					return
+				}
+			}
+		}
+	}()
+
+	return ch, nil
+}
+
+// ChatRaw body 为 OpenAI 风格的请求, 转换后发送
+func (o *Ollama) ChatRaw(ctx context.Context, body []byte) (*Response, error) {
+	var req Request
+	if err := json.Unmarshal(body, &req); err != nil {
+		return nil, err
+	}
+	return o.Chat(ctx, req)
+}
+
+func (o *Ollama) ChatStreamRaw(ctx context.Context, body []byte) (chan *Response, error) {
+	var req Request
+	if err := json.Unmarshal(body, &req); err != nil {
+		return nil, err
+	}
+	return o.ChatStream(ctx, req)
+}
+
+func (o *Ollama) buildBody(ctx context.Context, req Request, stream bool) (map[string]any, error) {
+	model := o.model
+	if req.Model != "" {
+		model = req.Model
+	}
+
+	// 工具结果通过 tool_name 关联函数, 从之前的 assistant 消息中查找
+	toolNames := make(map[string]string)
+
+	messages := make([]map[string]any, 0, len(req.Messages))
+	for _, msg := range req.Messages {
+		message := map[string]any{
+			"role":    msg.Role,
+			"content": ContentText(msg.Content),
+		}
+
+		switch msg.Role {
+		case RoleAssistant:
+			var calls []map[string]any
+			for _, toolCall := range msg.ToolCalls {
+				toolNames[toolCall.ID] = toolCall.Function.Name
+				calls = append(calls, map[string]any{
+					"function": map[string]any{
+						"name":      toolCall.Function.Name,
+						"arguments": toolArguments(toolCall.Function.Arguments),
+					},
+				})
+			}
+			if len(calls) > 0 {
+				message["tool_calls"] = calls
+			}
+		case RoleTool, RoleFunction:
+			message["role"] = RoleTool
+			if name := toolNames[msg.ToolCallID]; name != "" {
+				message["tool_name"] = name
+			}
+		}
+
+		if images := o.images(ctx, msg.Content); len(images) > 0 {
+			message["images"] = images
+		}
+		messages = append(messages, message)
+	}
+
+	if len(messages) == 0 {
+		return nil, errors.New("messages is required")
+	}
+
+	body := map[string]any{
+		"model":    model,
+		"messages": messages,
+		"stream":   stream,
+	}
+	// tools 与 OpenAI 格式一致
+	if len(req.Tools) > 0 {
+		body["tools"] = req.Tools
+	}
+	options := o.options.Merge(req.Options)
+	// format 支持 "json" 或完整的 JSON schema
+	if schema := options.ResponseFormat.Schema(); schema != nil {
+		body["format"] = schema
+	} else if options.ResponseFormat.IsJSON() {
+		body["format"] = "json"
+	}
+	if params := ollamaParams(options); len(params) > 0 {
+		body["options"] = params
+	}
+
+	return body, nil
+}
+
+// images 返回消息中的图片, Ollama 只接受 base64 数据, 远程图片需要先下载
+func (o *Ollama) images(ctx context.Context, content Content) []string {
+	multi, ok := content.(*MultiContent)
+	if !ok {
+		return nil
+	}
+
+	var images []string
+	for _, item := range multi.Items {
+		if item.Type != "image_url" || item.ImageURL == nil {
+			continue
+		}
+		if _, data, ok := parseDataURL(item.ImageURL.URL); ok {
+			images = append(images, data)
+			continue
+		}
+
+		response, err := xrequest.New().Get(item.ImageURL.URL)
+		if err == nil {
+			err = response.Error()
+		}
+		if err != nil {
+			xlog.WarnC(ctx, "下载图片失败: %s, %v", item.ImageURL.URL, err)
+			continue
+		}
+		images = append(images, base64.StdEncoding.EncodeToString(response.Bytes()))
+	}
+	return images
+}
+
+// ollamaParams 采样参数, 对应 Ollama 的 options (Modelfile 参数)
+func ollamaParams(options Options) map[string]any {
+	params := map[string]any{}
+	if options.Temperature != nil {
+		params["temperature"] = *options.Temperature
+	}
+	if options.TopP != nil {
+		params["top_p"] = *options.TopP
+	}
+	if options.FrequencyPenalty != nil {
+		params["frequency_penalty"] = *options.FrequencyPenalty
+	}
+	if options.PresencePenalty != nil {
+		params["presence_penalty"] = *options.PresencePenalty
+	}
+	if options.MaxTokens > 0 {
+		params["num_predict"] = options.MaxTokens
+	}
+	if len(options.Stop) > 0 {
+		params["stop"] = options.Stop
+	}
+	if options.Seed != nil {
+		params["seed"] = *options.Seed
+	}
+	return params
+}
+
+// ollamaToolCalls 转换工具调用, Ollama 不返回调用 id, 按序号生成
+func ollamaToolCalls(calls gjson.Result, offset int) []*ToolCall {
+	var toolCalls []*ToolCall
+	for i, call := range calls.Array() {
+		args := call.Get("function.arguments").Raw
+		if args == "" {
+			args = "{}"
+		}
+		toolCalls = append(toolCalls, NewToolCall(
+			fmt.Sprintf("call_%d", offset+i),
+			call.Get("function.name").String(),
+			args,
+		))
+	}
+	return toolCalls
+}
+
+func ollamaUsage(data gjson.Result) *Usage {
+	usage := &Usage{
+		PromptTokens:     int(data.Get("prompt_eval_count").Int()),
+		CompletionTokens: int(data.Get("eval_count").Int()),
+	}
+	usage.TotalTokens = usage.PromptTokens + usage.CompletionTokens
+	return usage
+}
@@ -0,0 +1,124 @@
+package xllm
+
+import (
+	"companions/internal/conf"
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/tidwall/gjson"
+)
+
+func checkOllamaRequest(t *testing.T, r *http.Request, body gjson.Result) {
+	if r.URL.Path != "/api/chat" {
+		t.Errorf("path = %s", r.URL.Path)
+	}
+	if body.Get("model").String() != "qwen2.5:7b" || body.Get("options.num_predict").Int() != 256 {
+		t.Errorf("model/options = %s", body.Raw)
+	}
+
+	messages := body.Get("messages").Array()
+	if len(messages) != 5 {
+		t.Fatalf("messages = %s", body.Get("messages").Raw)
+	}
+	// 图片只保留 base64 数据
+	if messages[1].Get("images.0").String() != "iVBORw0KGgo=" || messages[1].Get("content").String() != "这是哪里" {
+		t.Errorf("image = %s", messages[1].Raw)
+	}
+	if messages[2].Get("tool_calls.0.function.arguments.location").String() != "北京" {
+		t.Errorf("tool_calls = %s", messages[2].Raw)
+	}
+	if messages[3].Get("role").String() != "tool" || messages[3].Get("tool_name").String() != "get_current_weather" {
+		t.Errorf("tool = %s", messages[3].Raw)
+	}
+	if body.Get("tools.0.function.name").String() != "get_current_weather" {
+		t.Errorf("tools = %s", body.Get("tools").Raw)
+	}
+}
+
+func TestOllama_Chat(t *testing.T) {
+	server := newFixtureServer(t, "ollama_chat.json", func(r *http.Request, body gjson.Result) {
+		checkOllamaRequest(t, r, body)
+		if body.Get("stream").Bool() || body.Get("format").String() != "json" {
+			t.Errorf("stream/format = %s", body.Raw)
+		}
+	})
+
+	llm := New(&conf.LLMConfig{Provider: "ollama", ApiUrl: server.URL, Model: "qwen2.5:7b", MaxOutputTokens: 256})
+	req := fixtureRequest()
+	req.ResponseFormat = &ResponseFormat{Type: ResponseFormatJSON}
+	response, err := llm.Chat(context.Background(), req)
+	if err != nil {
+		t.Fatalf("Chat 失败: %v", err)
+	}
+
+	if len(response.ToolCall) != 1 || response.ToolCall[0].ID != "call_0" ||
+		gjson.Get(response.ToolCall[0].Function.Arguments, "location").String() != "上海" {
+		t.Errorf("ToolCall = %+v", response.ToolCall)
+	}
+	if response.Usage.PromptTokens != 182 || response.Usage.CompletionTokens != 24 || response.Usage.TotalTokens != 206 {
+		t.Errorf("Usage = %+v", response.Usage)
+	}
+}
+
+func TestOllama_ChatStream(t *testing.T) {
+	server := newFixtureServer(t, "ollama_stream.txt", func(r *http.Request, body gjson.Result) {
+		checkOllamaRequest(t, r, body)
+		if !body.Get("stream").Bool() {
+			t.Errorf("stream should be true")
+		}
+	})
+
+	llm := New(&conf.LLMConfig{Provider: "ollama", ApiUrl: server.URL, Model: "qwen2.5:7b", MaxOutputTokens: 256})
+	stream, err := llm.ChatStream(context.Background(), fixtureRequest())
+	if err != nil {
+		t.Fatalf("ChatStream 失败: %v", err)
+	}
+
+	var content string
+	var toolCalls []*ToolCall
+	var usage *Usage
+	for data := range stream {
+		content += data.Content
+		if data.FullTool {
+			toolCalls = data.ToolCall
+		}
+		if data.Usage != nil {
+			usage = data.Usage
+		}
+	}
+
+	if content != "好的，我查一下。" {
+		t.Errorf("content = %q", content)
+	}
+	if len(toolCalls) != 1 || toolCalls[0].Function.Name != "get_current_weather" {
+		t.Errorf("toolCalls = %+v", toolCalls)
+	}
+	if usage == nil || usage.TotalTokens != 213 {
+		t.Errorf("usage = %+v", usage)
+	}
+}
+
+// llama.cpp server 使用 OpenAI 兼容接口
+func TestLlamaCpp_JSONMode(t *testing.T) {
+	server := newFixtureServer(t, "openai_chat.json", func(r *http.Request, body gjson.Result) {
+		if r.URL.Path != "/v1/chat/completions" {
+			t.Errorf("path = %s", r.URL.Path)
+		}
+		if body.Get("response_format.type").String() != ResponseFormatJSON {
+			t.Errorf("response_format = %s", body.Get("response_format").Raw)
+		}
+	})
+
+	llm := New(&conf.LLMConfig{Provider: "llamacpp", ApiUrl: server.URL + "/v1"})
+	response, err := llm.Chat(context.Background(), Request{
+		Messages: []Message{{Role: RoleUser, Content: NewTextContent("用 JSON 描述你的心情")}},
+		Options:  Options{ResponseFormat: &ResponseFormat{Type: ResponseFormatJSON}},
+	})
+	if err != nil {
+		t.Fatalf("Chat 失败: %v", err)
+	}
+	if gjson.Get(response.Content, "mood").String() != "happy" || response.Usage.TotalTokens != 43 {
+		t.Errorf("response = %+v", response)
+	}
+}
@@ -32,6 +32,13 @@ func WithAPIKey(apiKey string) OpenAIOption {
 	}
 }
 
+// WithOptions 模型默认的采样参数, 可被请求中的 Options 覆盖
+func WithOptions(options Options) OpenAIOption {
+	return func(o *OpenAI) {
+		o.options = options
+	}
+}
+
 func WithNotParseToolCall(notParseToolCall bool) OpenAIOption {
 	return func(o *OpenAI) {
 		o.notParseToolCall = notParseToolCall
@@ -43,6 +50,7 @@ type OpenAI struct {
 	apiKey           string
 	apiUrl           string
 	notParseToolCall bool
+	options          Options
 }
 
 func NewOpenAI(opts ...OpenAIOption) LLM {
@@ -240,6 +248,9 @@ func (o *OpenAI) Chat(ctx context.Context, req Request) (*Response, error) {
 	if len(req.Tools) > 0 {
 		body["tools"] = req.Tools
 	}
+	for key, value := range o.options.Merge(req.Options).openAIParams() {
+		body[key] = value
+	}
 
 	_req := xrequest.New().SetBody(body)
 	return o.request(ctx, _req)
@@ -269,12 +280,19 @@ func (o *OpenAI) ChatStream(ctx context.Context, req Request) (chan *Response, e
 	if req.ToolChoice != nil {
 		body["tool_choice"] = req.ToolChoice
 	}
+	for key, value := range o.options.Merge(req.Options).openAIParams() {
+		body[key] = value
+	}
 
 	_req := xrequest.New().SetBody(body)
 	return o.requestStream(ctx, _req)
 }
 
 func (o *OpenAI) ChatRaw(ctx context.Context, body []byte) (*Response, error) {
+	body, err := o.withDefaultParams(body)
+	if err != nil {
+		return nil, err
+	}
 	_req := xrequest.New().SetBody(body)
 	return o.request(ctx, _req)
 }
@@ -284,6 +302,24 @@ func (o *OpenAI) ChatStreamRaw(ctx context.Context, body []byte) (chan *Response
 	if err != nil {
 		return nil, err
 	}
+	body, err = o.withDefaultParams(body)
+	if err != nil {
+		return nil, err
+	}
 	_req := xrequest.New().SetBody(body)
 	return o.requestStream(ctx, _req)
 }
+
+// withDefaultParams 为原始请求补充模型默认的采样参数, 请求中已有的参数不覆盖
+func (o *OpenAI) withDefaultParams(body []byte) ([]byte, error) {
+	var err error
+	for key, value := range o.options.openAIParams() {
+		if gjson.GetBytes(body, key).Exists() {
+			continue
+		}
+		if body, err = sjson.SetBytes(body, key, value); err != nil {
+			return nil, err
+		}
+	}
+	return body, nil
+}
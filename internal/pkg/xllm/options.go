@@ -0,0 +1,97 @@
+package xllm
+
+import "companions/internal/conf"
+
+// Options 采样参数, 指针字段为 nil、数值为 0 时表示使用 provider 默认值
+// 优先级: 请求 > 节点 > 角色 > 模型配置
+type Options struct {
+	Temperature      *float64        `json:"temperature,omitempty"`
+	TopP             *float64        `json:"top_p,omitempty"`
+	FrequencyPenalty *float64        `json:"frequency_penalty,omitempty"`
+	PresencePenalty  *float64        `json:"presence_penalty,omitempty"`
+	MaxTokens        int             `json:"max_tokens,omitempty"`
+	Stop             []string        `json:"stop,omitempty"`
+	Seed             *int            `json:"seed,omitempty"`
+	ResponseFormat   *ResponseFormat `json:"response_format,omitempty"`
+}
+
+// Ptr 返回值的指针, 用于设置 Options 中的可选字段
+func Ptr[T any](v T) *T {
+	return &v
+}
+
+// Merge 返回合并后的参数, override 中已设置的字段覆盖 o
+func (o Options) Merge(override Options) Options {
+	if override.Temperature != nil {
+		o.Temperature = override.Temperature
+	}
+	if override.TopP != nil {
+		o.TopP = override.TopP
+	}
+	if override.FrequencyPenalty != nil {
+		o.FrequencyPenalty = override.FrequencyPenalty
+	}
+	if override.PresencePenalty != nil {
+		o.PresencePenalty = override.PresencePenalty
+	}
+	if override.MaxTokens > 0 {
+		o.MaxTokens = override.MaxTokens
+	}
+	if len(override.Stop) > 0 {
+		o.Stop = override.Stop
+	}
+	if override.Seed != nil {
+		o.Seed = override.Seed
+	}
+	if override.ResponseFormat != nil {
+		o.ResponseFormat = override.ResponseFormat
+	}
+	return o
+}
+
+// OptionsFromConfig 读取模型配置中的采样参数
+func OptionsFromConfig(llmConf *conf.LLMConfig) Options {
+	options := Options{
+		Temperature:      llmConf.Temperature,
+		TopP:             llmConf.TopP,
+		FrequencyPenalty: llmConf.FrequencyPenalty,
+		PresencePenalty:  llmConf.PresencePenalty,
+		MaxTokens:        llmConf.MaxOutputTokens,
+		Stop:             llmConf.Stop,
+		Seed:             llmConf.Seed,
+	}
+	if llmConf.ResponseFormat != "" {
+		options.ResponseFormat = &ResponseFormat{Type: llmConf.ResponseFormat}
+	}
+	return options
+}
+
+// openAIParams OpenAI 兼容接口的参数, 同样适用于 llama.cpp server
+func (o Options) openAIParams() map[string]any {
+	params := map[string]any{}
+	if o.Temperature != nil {
+		params["temperature"] = *o.Temperature
+	}
+	if o.TopP != nil {
+		params["top_p"] = *o.TopP
+	}
+	if o.FrequencyPenalty != nil {
+		params["frequency_penalty"] = *o.FrequencyPenalty
+	}
+	if o.PresencePenalty != nil {
+		params["presence_penalty"] = *o.PresencePenalty
+	}
+	if o.MaxTokens > 0 {
+		params["max_tokens"] = o.MaxTokens
+	}
+	if len(o.Stop) > 0 {
+		params["stop"] = o.Stop
+	}
+	if o.Seed != nil {
+		params["seed"] = *o.Seed
+	}
+	if o.ResponseFormat != nil {
+		params["response_format"] = o.ResponseFormat
+	}
+	return params
+}
@@ -0,0 +1,75 @@
+package xllm
+
+import (
+	"companions/internal/conf"
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/tidwall/gjson"
+)
+
+func TestOptions_Merge(t *testing.T) {
+	base := Options{Temperature: Ptr(0.5), TopP: Ptr(1.0), MaxTokens: 1000, Stop: []string{"\n\n"}}
+	merged := base.Merge(Options{Temperature: Ptr(0.0), Seed: Ptr(42)})
+
+	if *merged.Temperature != 0 || *merged.TopP != 1 || merged.MaxTokens != 1000 || *merged.Seed != 42 {
+		t.Errorf("merged = %+v", merged)
+	}
+	if len(merged.Stop) != 1 {
+		t.Errorf("stop = %v", merged.Stop)
+	}
+	// 原参数不受影响
+	if *base.Temperature != 0.5 || base.Seed != nil {
+		t.Errorf("base = %+v", base)
+	}
+}
+
+func TestOptions_FromConfig(t *testing.T) {
+	server := newFixtureServer(t, "openai_chat.json", func(r *http.Request, body gjson.Result) {
+		// 请求中的参数覆盖模型配置
+		if body.Get("temperature").Float() != 0.1 || body.Get("top_p").Float() != 0.9 ||
+			body.Get("presence_penalty").Float() != 0.5 || body.Get("max_tokens").Int() != 64 ||
+			body.Get("seed").Int() != 7 || body.Get("stop.0").String() != "END" ||
+			body.Get("response_format.type").String() != ResponseFormatJSON {
+			t.Errorf("body = %s", body.Raw)
+		}
+		if body.Get("frequency_penalty").Exists() {
+			t.Errorf("frequency_penalty should not be set")
+		}
+	})
+
+	llm := New(&conf.LLMConfig{
+		Provider:        "openai",
+		ApiUrl:          server.URL + "/v1",
+		Temperature:     Ptr(0.8),
+		TopP:            Ptr(0.9),
+		PresencePenalty: Ptr(0.5),
+		MaxOutputTokens: 1000,
+		Stop:            []string{"END"},
+		Seed:            Ptr(7),
+		ResponseFormat:  ResponseFormatJSON,
+	})
+	_, err := llm.Chat(context.Background(), Request{
+		Messages: []Message{{Role: RoleUser, Content: NewTextContent("hi")}},
+		Options:  Options{Temperature: Ptr(0.1), MaxTokens: 64},
+	})
+	if err != nil {
+		t.Fatalf("Chat 失败: %v", err)
+	}
+}
+
+// TestOptions_LegacyMaxTokens 旧配置中的 max_tokens 是上下文大小, 不能作为输出上限发送
+func TestOptions_LegacyMaxTokens(t *testing.T) {
+	llmConf := &conf.LLMConfig{MaxTokens: 128000}
+	if options := OptionsFromConfig(llmConf); options.MaxTokens != 0 {
+		t.Errorf("MaxTokens = %d, want 0", options.MaxTokens)
+	}
+	if size := llmConf.ContextSize(); size != 128000 {
+		t.Errorf("ContextSize() = %d, want 128000", size)
+	}
+	llmConf.ContextWindow = 32000
+	if size := llmConf.ContextSize(); size != 32000 {
+		t.Errorf("ContextSize() = %d, want 32000", size)
+	}
+}
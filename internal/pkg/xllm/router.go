@@ -0,0 +1,219 @@
+package xllm
+
+import (
+	"companions/internal/conf"
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/daodao97/xgo/xlog"
+)
+
+// 路由任务, 每个任务在 conf.Router.Tasks 中配置按优先级排列的模型名称
+const (
+	TaskChat       = "chat"       // 角色对话
+	TaskRomance    = "romance"    // 浪漫度评分
+	TaskAction     = "action"     // 动作选择
+	TaskSummarize  = "summarize"  // 记忆压缩、标题生成
+	TaskEmbedding  = "embedding"  // 向量化
+	TaskModeration = "moderation" // 内容审核 (llm 分类器)
+)
+
+var ErrNoRoute = errors.New("没有可用的模型")
+
+var _ LLM = (*Router)(nil)
+
+// Route 路由中的一个候选模型, Name 为 conf.LLM 中的名称
+type Route struct {
+	Name string
+	LLM  LLM
+}
+
+type RouterOption func(*Router)
+
+// WithRouterTimeout 单个模型的超时时间, 超时后切换到下一个模型
+func WithRouterTimeout(timeout time.Duration) RouterOption {
+	return func(r *Router) {
+		r.timeout = timeout
+	}
+}
+
+// Router 按顺序尝试候选模型, 出错 (包括超时、限流) 时回退到下一个
+// 响应的 Model 字段记录实际提供服务的模型名称
+type Router struct {
+	task    string
+	routes  []Route
+	timeout time.Duration
+}
+
+func NewRouter(task string, routes []Route, opts ...RouterOption) *Router {
+	router := &Router{
+		task:   task,
+		routes: routes,
+	}
+	for _, opt := range opts {
+		opt(router)
+	}
+	return router
+}
+
+// ForTask 根据配置创建任务的路由, 未配置的任务使用 default 模型
+func ForTask(task string) *Router {
+	c := conf.Get()
+
+	var routes []Route
+	for _, name := range c.Router.Models(task) {
+		llmConf := c.GetLLM(name)
+		if llmConf == nil {
+			xlog.Warn("路由模型不存在", xlog.String("task", task), xlog.String("model", name))
+			continue
+		}
+		llm := New(llmConf)
+		if llm == nil {
+			xlog.Warn("不支持的模型 provider", xlog.String("model", name), xlog.String("provider", llmConf.Provider))
+			continue
+		}
+		routes = append(routes, Route{Name: name, LLM: llm})
+	}
+
+	return NewRouter(task, routes, WithRouterTimeout(time.Duration(c.Router.Timeout)*time.Second))
+}
+
+func (r *Router) Chat(ctx context.Context, req Request) (*Response, error) {
+	return r.chat(ctx, func(ctx context.Context, llm LLM) (*Response, error) {
+		return llm.Chat(ctx, req)
+	})
+}
+
+func (r *Router) ChatRaw(ctx context.Context, body []byte) (*Response, error) {
+	return r.chat(ctx, func(ctx context.Context, llm LLM) (*Response, error) {
+		return llm.ChatRaw(ctx, body)
+	})
+}
+
+// ChatStream 只在建立流之前回退, 流开始后的错误由调用方处理
+func (r *Router) ChatStream(ctx context.Context, req Request) (chan *Response, error) {
+	return r.chatStream(ctx, func(llm LLM) (chan *Response, error) {
+		return llm.ChatStream(ctx, req)
+	})
+}
+
+func (r *Router) ChatStreamRaw(ctx context.Context, body []byte) (chan *Response, error) {
+	return r.chatStream(ctx, func(llm LLM) (chan *Response, error) {
+		return llm.ChatStreamRaw(ctx, body)
+	})
+}
+
+// Embed 在实现了 Embedder 的候选模型间回退
+func (r *Router) Embed(ctx context.Context, req EmbeddingRequest) (*EmbeddingResponse, error) {
+	var errs []error
+	for _, route := range r.routes {
+		embedder, ok := route.LLM.(Embedder)
+		if !ok {
+			continue
+		}
+
+		callCtx, cancel := r.withTimeout(ctx)
+		response, err := embedder.Embed(callCtx, req)
+		cancel()
+		if err == nil {
+			response.Model = route.Name
+			return response, nil
+		}
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+
+		xlog.WarnC(ctx, "模型调用失败, 尝试下一个", xlog.String("task", r.task), xlog.String("model", route.Name), xlog.Err(err))
+		errs = append(errs, fmt.Errorf("%s: %w", route.Name, err))
+	}
+	return nil, r.failed(errs)
+}
+
+func (r *Router) chat(ctx context.Context, call func(ctx context.Context, llm LLM) (*Response, error)) (*Response, error) {
+	var errs []error
+	for _, route := range r.routes {
+		response, err := r.callWithTimeout(ctx, route.LLM, call)
+		if err == nil {
+			response.Model = route.Name
+			xlog.DebugC(ctx, "模型调用成功", xlog.String("task", r.task), xlog.String("model", route.Name))
+			return response, nil
+		}
+		// 调用方取消时不再回退
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+
+		xlog.WarnC(ctx, "模型调用失败, 尝试下一个", xlog.String("task", r.task), xlog.String("model", route.Name), xlog.Err(err))
+		errs = append(errs, fmt.Errorf("%s: %w", route.Name, err))
+	}
+	return nil, r.failed(errs)
+}
+
+func (r *Router) chatStream(ctx context.Context, call func(llm LLM) (chan *Response, error)) (chan *Response, error) {
+	var errs []error
+	for _, route := range r.routes {
+		stream, err := call(route.LLM)
+		if err == nil {
+			return withModel(stream, route.Name), nil
+		}
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+
+		xlog.WarnC(ctx, "模型调用失败, 尝试下一个", xlog.String("task", r.task), xlog.String("model", route.Name), xlog.Err(err))
+		errs = append(errs, fmt.Errorf("%s: %w", route.Name, err))
+	}
+	return nil, r.failed(errs)
+}
+
+func (r *Router) withTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if r.timeout > 0 {
+		return context.WithTimeout(ctx, r.timeout)
+	}
+	return context.WithCancel(ctx)
+}
+
+// callWithTimeout provider 不一定响应 ctx 取消, 超时后直接放弃本次调用
+func (r *Router) callWithTimeout(ctx context.Context, llm LLM, call func(ctx context.Context, llm LLM) (*Response, error)) (*Response, error) {
+	callCtx, cancel := r.withTimeout(ctx)
+	defer cancel()
+
+	type result struct {
+		response *Response
+		err      error
+	}
+	done := make(chan result, 1)
+	go func() {
+		response, err := call(callCtx, llm)
+		done <- result{response, err}
+	}()
+
+	select {
+	case res := <-done:
+		return res.response, res.err
+	case <-callCtx.Done():
+		return nil, callCtx.Err()
+	}
+}
+
+func (r *Router) failed(errs []error) error {
+	if len(errs) == 0 {
+		return fmt.Errorf("%w: %s", ErrNoRoute, r.task)
+	}
+	return fmt.Errorf("任务 %s 所有模型均调用失败: %w", r.task, errors.Join(errs...))
+}
+
+// withModel 为流式响应的每个分片标记模型名称
+func withModel(stream chan *Response, model string) chan *Response {
+	ch := make(chan *Response)
+	go func() {
+		defer close(ch)
+		for response := range stream {
+			response.Model = model
+			ch <- response
+		}
+	}()
+	return ch
+}
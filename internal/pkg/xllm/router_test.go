@@ -0,0 +1,91 @@
+package xllm
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// stubLLM 按固定结果返回的 LLM
+type stubLLM struct {
+	Fake
+	err   error
+	delay time.Duration
+	calls atomic.Int32
+}
+
+func (s *stubLLM) Chat(ctx context.Context, req Request) (*Response, error) {
+	s.calls.Add(1)
+	time.Sleep(s.delay)
+	if s.err != nil {
+		return nil, s.err
+	}
+	return s.Fake.Chat(ctx, req)
+}
+
+func (s *stubLLM) ChatStream(ctx context.Context, req Request) (chan *Response, error) {
+	s.calls.Add(1)
+	if s.err != nil {
+		return nil, s.err
+	}
+	return s.Fake.ChatStream(ctx, req)
+}
+
+func newStubLLM(err error, delay time.Duration) *stubLLM {
+	return &stubLLM{
+		Fake:  Fake{replies: []FakeReply{{Content: "ok"}}},
+		err:   err,
+		delay: delay,
+	}
+}
+
+func TestRouter_Fallback(t *testing.T) {
+	limited := newStubLLM(errors.New("429 Too Many Requests"), 0)
+	slow := newStubLLM(nil, 200*time.Millisecond)
+	backup := newStubLLM(nil, 0)
+
+	router := NewRouter(TaskRomance, []Route{
+		{Name: "primary", LLM: limited},
+		{Name: "slow", LLM: slow},
+		{Name: "backup", LLM: backup},
+	}, WithRouterTimeout(50*time.Millisecond))
+
+	req := Request{Messages: []Message{{Role: RoleUser, Content: NewTextContent("hi")}}}
+	response, err := router.Chat(context.Background(), req)
+	if err != nil {
+		t.Fatalf("Chat 失败: %v", err)
+	}
+	if response.Model != "backup" || response.Content != "ok" {
+		t.Errorf("response = %+v", response)
+	}
+	if limited.calls.Load() != 1 || slow.calls.Load() != 1 || backup.calls.Load() != 1 {
+		t.Errorf("calls = %d, %d, %d", limited.calls.Load(), slow.calls.Load(), backup.calls.Load())
+	}
+
+	stream, err := router.ChatStream(context.Background(), req)
+	if err != nil {
+		t.Fatalf("ChatStream 失败: %v", err)
+	}
+	for data := range stream {
+		// 流式调用没有超时回退, slow 模型直接提供服务
+		if data.Model != "slow" {
+			t.Errorf("stream model = %s", data.Model)
+		}
+	}
+}
+
+func TestRouter_AllFailed(t *testing.T) {
+	router := NewRouter(TaskChat, []Route{
+		{Name: "a", LLM: newStubLLM(errors.New("boom"), 0)},
+		{Name: "b", LLM: newStubLLM(errors.New("bang"), 0)},
+	})
+	if _, err := router.Chat(context.Background(), Request{}); err == nil {
+		t.Error("expected error")
+	}
+
+	if _, err := NewRouter(TaskChat, nil).Chat(context.Background(), Request{}); !errors.Is(err, ErrNoRoute) {
+		t.Errorf("err = %v, want ErrNoRoute", err)
+	}
+}
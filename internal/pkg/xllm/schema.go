@@ -0,0 +1,288 @@
+package xllm
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// SchemaFor 根据结构体生成 JSONSchema
+// 字段名取 json tag, 带 omitempty 的字段为可选字段, 支持以下 tag:
+//
+//	description:"字段说明"  enum:"a,b,c"  minimum:"-10"  maximum:"10"
+func SchemaFor[T any]() map[string]any {
+	return schemaOf(reflect.TypeFor[T]())
+}
+
+func schemaOf(t reflect.Type) map[string]any {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+
+	switch t.Kind() {
+	case reflect.Struct:
+		properties := map[string]any{}
+		required := []string{}
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			if !field.IsExported() {
+				continue
+			}
+			name, omitempty := jsonFieldName(field)
+			if name == "-" {
+				continue
+			}
+
+			property := schemaOf(field.Type)
+			if description := field.Tag.Get("description"); description != "" {
+				property["description"] = description
+			}
+			if enum := field.Tag.Get("enum"); enum != "" {
+				property["enum"] = strings.Split(enum, ",")
+			}
+			for _, key := range []string{"minimum", "maximum"} {
+				if value, err := strconv.ParseFloat(field.Tag.Get(key), 64); err == nil {
+					property[key] = value
+				}
+			}
+
+			properties[name] = property
+			if !omitempty {
+				required = append(required, name)
+			}
+		}
+		return map[string]any{
+			"type":                 "object",
+			"properties":           properties,
+			"required":             required,
+			"additionalProperties": false,
+		}
+	case reflect.Map:
+		return map[string]any{
+			"type":                 "object",
+			"additionalProperties": schemaOf(t.Elem()),
+		}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return map[string]any{"type": "string"}
+		}
+		return map[string]any{
+			"type":  "array",
+			"items": schemaOf(t.Elem()),
+		}
+	case reflect.String:
+		return map[string]any{"type": "string"}
+	case reflect.Bool:
+		return map[string]any{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]any{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]any{"type": "number"}
+	default:
+		// interface 等类型不做约束
+		return map[string]any{}
+	}
+}
+
+func jsonFieldName(field reflect.StructField) (string, bool) {
+	tag := field.Tag.Get("json")
+	if tag == "" {
+		return field.Name, false
+	}
+	parts := strings.Split(tag, ",")
+	name := parts[0]
+	if name == "" {
+		name = field.Name
+	}
+	for _, opt := range parts[1:] {
+		if opt == "omitempty" {
+			return name, true
+		}
+	}
+	return name, false
+}
+
+// strictSchema 是否满足 OpenAI strict 模式的要求:
+// 所有对象关闭 additionalProperties 且全部字段必填
+func strictSchema(schema map[string]any) bool {
+	if items, ok := schema["items"].(map[string]any); ok && !strictSchema(items) {
+		return false
+	}
+	properties, ok := schema["properties"].(map[string]any)
+	if !ok {
+		return schema["type"] != "object"
+	}
+	if additional, ok := schema["additionalProperties"].(bool); !ok || additional {
+		return false
+	}
+	if len(stringList(schema["required"])) != len(properties) {
+		return false
+	}
+	for _, property := range properties {
+		if property, ok := property.(map[string]any); ok && !strictSchema(property) {
+			return false
+		}
+	}
+	return true
+}
+
+// Validate 按 schema 校验 JSON 解码后的值, 返回所有校验错误
+// 支持 type、properties、required、additionalProperties、items、enum、minimum、maximum
+func Validate(schema map[string]any, value any) []string {
+	var errs []string
+	validate(schema, value, "$", &errs)
+	return errs
+}
+
+func validate(schema map[string]any, value any, path string, errs *[]string) {
+	if schemaType, ok := schema["type"].(string); ok && !matchType(schemaType, value) {
+		*errs = append(*errs, fmt.Sprintf("%s: 应为 %s 类型, 实际为 %s", path, schemaType, jsonType(value)))
+		return
+	}
+
+	if enum := schema["enum"]; enum != nil {
+		if !inEnum(enum, value) {
+			*errs = append(*errs, fmt.Sprintf("%s: %v 不在可选值 %v 中", path, value, enum))
+		}
+	}
+
+	if number, ok := value.(float64); ok {
+		if minimum, ok := toFloat(schema["minimum"]); ok && number < minimum {
+			*errs = append(*errs, fmt.Sprintf("%s: %v 小于最小值 %v", path, number, minimum))
+		}
+		if maximum, ok := toFloat(schema["maximum"]); ok && number > maximum {
+			*errs = append(*errs, fmt.Sprintf("%s: %v 大于最大值 %v", path, number, maximum))
+		}
+	}
+
+	switch v := value.(type) {
+	case map[string]any:
+		properties, _ := schema["properties"].(map[string]any)
+		for _, name := range stringList(schema["required"]) {
+			if _, ok := v[name]; !ok {
+				*errs = append(*errs, fmt.Sprintf("%s: 缺少必填字段 %s", path, name))
+			}
+		}
+
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			if property, ok := properties[key].(map[string]any); ok {
+				validate(property, v[key], path+"."+key, errs)
+				continue
+			}
+			switch additional := schema["additionalProperties"].(type) {
+			case bool:
+				if !additional {
+					*errs = append(*errs, fmt.Sprintf("%s: 不允许的字段 %s", path, key))
+				}
+			case map[string]any:
+				validate(additional, v[key], path+"."+key, errs)
+			}
+		}
+	case []any:
+		if items, ok := schema["items"].(map[string]any); ok {
+			for i, item := range v {
+				validate(items, item, fmt.Sprintf("%s[%d]", path, i), errs)
+			}
+		}
+	}
+}
+
+func matchType(schemaType string, value any) bool {
+	switch schemaType {
+	case "object":
+		_, ok := value.(map[string]any)
+		return ok
+	case "array":
+		_, ok := value.([]any)
+		return ok
+	case "string":
+		_, ok := value.(string)
+		return ok
+	case "boolean":
+		_, ok := value.(bool)
+		return ok
+	case "number":
+		_, ok := value.(float64)
+		return ok
+	case "integer":
+		number, ok := value.(float64)
+		return ok && number == math.Trunc(number)
+	case "null":
+		return value == nil
+	}
+	return true
+}
+
+func jsonType(value any) string {
+	switch value.(type) {
+	case nil:
+		return "null"
+	case map[string]any:
+		return "object"
+	case []any:
+		return "array"
+	case string:
+		return "string"
+	case bool:
+		return "boolean"
+	case float64:
+		return "number"
+	}
+	return fmt.Sprintf("%T", value)
+}
+
+func inEnum(enum any, value any) bool {
+	data, _ := json.Marshal(value)
+	values := reflect.ValueOf(enum)
+	if values.Kind() != reflect.Slice {
+		return true
+	}
+	for i := 0; i < values.Len(); i++ {
+		item, _ := json.Marshal(values.Index(i).Interface())
+		if string(item) == string(data) {
+			return true
+		}
+	}
+	return false
+}
+
+// stringList schema 中的字符串数组, 兼容代码构造的 []string 和 JSON 解码的 []any
+func stringList(v any) []string {
+	switch list := v.(type) {
+	case []string:
+		return list
+	case []any:
+		result := make([]string, 0, len(list))
+		for _, item := range list {
+			if s, ok := item.(string); ok {
+				result = append(result, s)
+			}
+		}
+		return result
+	}
+	return nil
+}
+
+func toFloat(v any) (float64, bool) {
+	switch n := v.(type) {
+	case float64:
+		return n, true
+	case float32:
+		return float64(n), true
+	case int:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	}
+	return 0, false
+}
@@ -0,0 +1,226 @@
+package xllm
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"slices"
+	"strings"
+
+	"github.com/daodao97/xgo/xlog"
+)
+
+// ValidationError 模型输出经过修复后仍不符合 schema, Raw 为最后一次的原始输出
+type ValidationError struct {
+	Errors []string
+	Raw    string
+}
+
+func (e *ValidationError) Error() string {
+	return "结构化输出校验失败: " + strings.Join(e.Errors, "; ")
+}
+
+type StructuredOption func(*structured)
+
+// WithSchema 使用自定义 JSONSchema 代替根据结构体生成的 schema
+func WithSchema(schema map[string]any) StructuredOption {
+	return func(s *structured) {
+		s.schema = schema
+	}
+}
+
+// WithSchemaName schema 名称, 对应 OpenAI response_format.json_schema.name
+func WithSchemaName(name string) StructuredOption {
+	return func(s *structured) {
+		s.name = name
+	}
+}
+
+// WithMaxRepairs 输出不合法时最多要求模型修复的次数, 默认 2 次
+func WithMaxRepairs(n int) StructuredOption {
+	return func(s *structured) {
+		s.maxRepairs = n
+	}
+}
+
+// WithPromptMode 不使用 provider 的 json_schema 能力, 直接通过提示词约束输出
+func WithPromptMode() StructuredOption {
+	return func(s *structured) {
+		s.promptMode = true
+	}
+}
+
+// WithValidator 额外的业务校验, v 为解析后的 *T
+func WithValidator(fn func(v any) error) StructuredOption {
+	return func(s *structured) {
+		s.validators = append(s.validators, fn)
+	}
+}
+
+// Structured 要求模型按 T 的 schema 输出 JSON 并解析为 T
+// 优先使用 provider 的 json_schema 模式, 调用失败时退回 json_object + 提示词;
+// 输出不合法时把错误反馈给模型要求修复, 超过次数返回 *ValidationError
+// 返回的 Response 为最后一次调用的响应, Usage 为所有调用的累计用量
+// T 实现 Validate() error 时会作为额外的校验
+func Structured[T any](ctx context.Context, llm LLM, req Request, opts ...StructuredOption) (*T, *Response, error) {
+	s := &structured{
+		name:       schemaName(reflect.TypeFor[T]()),
+		maxRepairs: 2,
+		usage:      &Usage{},
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	if s.schema == nil {
+		s.schema = SchemaFor[T]()
+	}
+
+	request, err := s.request(req)
+	if err != nil {
+		return nil, nil, err
+	}
+	response, err := s.chat(ctx, llm, request)
+	if err != nil && !s.promptMode && ctx.Err() == nil {
+		// provider 不支持 json_schema 时退回提示词约束
+		xlog.WarnC(ctx, "json_schema 模式调用失败, 改用提示词约束", xlog.String("schema", s.name), xlog.Err(err))
+		s.promptMode = true
+		if request, err = s.request(req); err != nil {
+			return nil, nil, err
+		}
+		response, err = s.chat(ctx, llm, request)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	for attempt := 0; ; attempt++ {
+		result, errs := decode[T](s, response.Content)
+		if len(errs) == 0 {
+			return result, response, nil
+		}
+		if attempt >= s.maxRepairs {
+			return nil, response, &ValidationError{Errors: errs, Raw: response.Content}
+		}
+
+		xlog.WarnC(ctx, "结构化输出不合法, 要求模型修复", xlog.String("schema", s.name), xlog.Any("errors", errs), xlog.String("raw", response.Content))
+		request.Messages = append(slices.Clone(request.Messages),
+			Message{Role: RoleAssistant, Content: NewTextContent(response.Content)},
+			Message{Role: RoleUser, Content: NewTextContent(repairPrompt(errs))},
+		)
+		if response, err = s.chat(ctx, llm, request); err != nil {
+			return nil, nil, err
+		}
+	}
+}
+
+type structured struct {
+	name       string
+	schema     map[string]any
+	maxRepairs int
+	promptMode bool
+	validators []func(v any) error
+	usage      *Usage
+}
+
+// request 设置响应格式, 提示词模式下在最前面加入包含 schema 的系统消息
+func (s *structured) request(req Request) (Request, error) {
+	if !s.promptMode {
+		req.Options.ResponseFormat = &ResponseFormat{
+			Type: ResponseFormatJSONSchema,
+			JSONSchema: &JSONSchema{
+				Name:   s.name,
+				Schema: s.schema,
+				Strict: strictSchema(s.schema),
+			},
+		}
+		return req, nil
+	}
+
+	data, err := json.Marshal(s.schema)
+	if err != nil {
+		return req, fmt.Errorf("序列化 schema 失败: %w", err)
+	}
+	req.Messages = append([]Message{{
+		Role:    RoleSystem,
+		Content: NewTextContent("Respond only with a single valid JSON object, without any other text. The JSON object must conform to this JSON schema:\n" + string(data)),
+	}}, req.Messages...)
+	req.Options.ResponseFormat = &ResponseFormat{Type: ResponseFormatJSON}
+	return req, nil
+}
+
+// chat 调用模型并累计用量
+func (s *structured) chat(ctx context.Context, llm LLM, req Request) (*Response, error) {
+	response, err := llm.Chat(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	if response.Usage != nil {
+		s.usage.PromptTokens += response.Usage.PromptTokens
+		s.usage.CompletionTokens += response.Usage.CompletionTokens
+		s.usage.TotalTokens += response.Usage.TotalTokens
+	}
+	response.Usage = s.usage
+	return response, nil
+}
+
+// decode 解析并校验模型输出, 返回所有校验错误
+func decode[T any](s *structured, content string) (*T, []string) {
+	raw := extractJSON(content)
+
+	var value any
+	if err := json.Unmarshal([]byte(raw), &value); err != nil {
+		return nil, []string{"输出不是合法的 JSON: " + err.Error()}
+	}
+	if errs := Validate(s.schema, value); len(errs) > 0 {
+		return nil, errs
+	}
+
+	result := new(T)
+	if err := json.Unmarshal([]byte(raw), result); err != nil {
+		return nil, []string{err.Error()}
+	}
+
+	var errs []string
+	if v, ok := any(result).(interface{ Validate() error }); ok {
+		if err := v.Validate(); err != nil {
+			errs = append(errs, err.Error())
+		}
+	}
+	for _, validator := range s.validators {
+		if err := validator(result); err != nil {
+			errs = append(errs, err.Error())
+		}
+	}
+	if len(errs) > 0 {
+		return nil, errs
+	}
+	return result, nil
+}
+
+// extractJSON 去掉 markdown 代码块等多余文本, 取第一个 { 到最后一个 } 之间的内容
+func extractJSON(content string) string {
+	content = strings.TrimSpace(content)
+	start := strings.Index(content, "{")
+	end := strings.LastIndex(content, "}")
+	if start < 0 || end < start {
+		return content
+	}
+	return content[start : end+1]
+}
+
+func repairPrompt(errs []string) string {
+	return "Your previous response is invalid:\n- " + strings.Join(errs, "\n- ") +
+		"\nRespond again with only the corrected JSON object."
+}
+
+// schemaName 默认使用类型名, OpenAI 要求名称只包含字母、数字、下划线和中划线
+func schemaName(t reflect.Type) string {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t.Name() == "" {
+		return "result"
+	}
+	return t.Name()
+}
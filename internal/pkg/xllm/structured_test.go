@@ -0,0 +1,188 @@
+package xllm
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/tidwall/gjson"
+)
+
+type grade struct {
+	Change int    `json:"change" minimum:"-10" maximum:"10" description:"变化值"`
+	Mood   string `json:"mood" enum:"happy,sad"`
+	Reason string `json:"reason,omitempty"`
+}
+
+func TestSchemaFor(t *testing.T) {
+	schema := SchemaFor[grade]()
+
+	properties := schema["properties"].(map[string]any)
+	change := properties["change"].(map[string]any)
+	if change["type"] != "integer" || change["minimum"] != -10.0 || change["maximum"] != 10.0 || change["description"] != "变化值" {
+		t.Errorf("change = %v", change)
+	}
+	if enum := properties["mood"].(map[string]any)["enum"].([]string); len(enum) != 2 {
+		t.Errorf("mood enum = %v", enum)
+	}
+	if required := schema["required"].([]string); len(required) != 2 {
+		t.Errorf("required = %v", required)
+	}
+	// reason 可选, 不满足 strict 要求
+	if strictSchema(schema) {
+		t.Errorf("schema should not be strict")
+	}
+	if !strictSchema(SchemaFor[struct {
+		Name string `json:"name"`
+	}]()) {
+		t.Errorf("schema should be strict")
+	}
+	if strictSchema(SchemaFor[map[string]string]()) {
+		t.Errorf("map schema should not be strict")
+	}
+}
+
+func TestValidate(t *testing.T) {
+	schema := SchemaFor[grade]()
+	tests := []struct {
+		value string
+		errs  int
+	}{
+		{`{"change": 3, "mood": "happy"}`, 0},
+		{`{"change": 3.5, "mood": "happy"}`, 1},
+		{`{"change": 11, "mood": "angry"}`, 2},
+		{`{"mood": "sad", "extra": 1}`, 2},
+		{`[]`, 1},
+	}
+	for _, tt := range tests {
+		var value any
+		if err := json.Unmarshal([]byte(tt.value), &value); err != nil {
+			t.Fatal(err)
+		}
+		if errs := Validate(schema, value); len(errs) != tt.errs {
+			t.Errorf("Validate(%s) = %v, want %d errors", tt.value, errs, tt.errs)
+		}
+	}
+}
+
+func TestStructured_Repair(t *testing.T) {
+	llm := NewFake(WithFakeReplies(
+		FakeReply{Match: "Your previous response is invalid", Content: "```json\n{\"change\": 5, \"mood\": \"happy\"}\n```"},
+		FakeReply{Content: `{"change": 50, "mood": "happy"}`},
+	))
+
+	result, response, err := Structured[grade](context.Background(), llm, Request{
+		Messages: []Message{{Role: RoleUser, Content: NewTextContent("你好")}},
+	})
+	if err != nil {
+		t.Fatalf("Structured 失败: %v", err)
+	}
+	if result.Change != 5 || result.Mood != "happy" {
+		t.Errorf("result = %+v", result)
+	}
+	// 用量为两次调用之和
+	if response.Usage.CompletionTokens != len(`{"change": 50, "mood": "happy"}`)+len("```json\n{\"change\": 5, \"mood\": \"happy\"}\n```") {
+		t.Errorf("usage = %+v", response.Usage)
+	}
+}
+
+func TestStructured_ValidationError(t *testing.T) {
+	llm := NewFake(WithFakeReplies(FakeReply{Content: "not json"}))
+
+	_, response, err := Structured[grade](context.Background(), llm, Request{
+		Messages: []Message{{Role: RoleUser, Content: NewTextContent("你好")}},
+	}, WithMaxRepairs(1), WithValidator(func(v any) error { return nil }))
+
+	var validationErr *ValidationError
+	if !errors.As(err, &validationErr) || validationErr.Raw != "not json" {
+		t.Fatalf("err = %v", err)
+	}
+	if response == nil || response.Content != "not json" {
+		t.Errorf("response = %+v", response)
+	}
+}
+
+func TestStructured_Validator(t *testing.T) {
+	llm := NewFake(WithFakeReplies(
+		FakeReply{Match: "change must be positive", Content: `{"change": 1, "mood": "sad"}`},
+		FakeReply{Content: `{"change": -1, "mood": "sad"}`},
+	))
+
+	result, _, err := Structured[grade](context.Background(), llm, Request{
+		Messages: []Message{{Role: RoleUser, Content: NewTextContent("你好")}},
+	}, WithValidator(func(v any) error {
+		if v.(*grade).Change < 0 {
+			return errors.New("change must be positive")
+		}
+		return nil
+	}))
+	if err != nil || result.Change != 1 {
+		t.Fatalf("result = %+v, err = %v", result, err)
+	}
+}
+
+// schemaRejectingLLM 不支持 json_schema 的模型
+type schemaRejectingLLM struct {
+	Fake
+	formats []string
+}
+
+func (s *schemaRejectingLLM) Chat(ctx context.Context, req Request) (*Response, error) {
+	s.formats = append(s.formats, req.ResponseFormat.Type)
+	if req.ResponseFormat.Type == ResponseFormatJSONSchema {
+		return nil, errors.New("response_format json_schema is not supported")
+	}
+	return s.Fake.Chat(ctx, req)
+}
+
+func TestStructured_PromptFallback(t *testing.T) {
+	llm := &schemaRejectingLLM{Fake: Fake{replies: []FakeReply{
+		{Match: `"minimum":-10`, Content: `{"change": 2, "mood": "happy"}`},
+	}}}
+
+	result, _, err := Structured[grade](context.Background(), llm, Request{
+		Messages: []Message{{Role: RoleUser, Content: NewTextContent("你好")}},
+	})
+	if err != nil || result.Change != 2 {
+		t.Fatalf("result = %+v, err = %v", result, err)
+	}
+	if len(llm.formats) != 2 || llm.formats[1] != ResponseFormatJSON {
+		t.Errorf("formats = %v", llm.formats)
+	}
+}
+
+func TestStructured_OpenAIRequest(t *testing.T) {
+	server := newFixtureServer(t, "openai_chat.json", func(r *http.Request, body gjson.Result) {
+		format := body.Get("response_format")
+		if format.Get("type").String() != ResponseFormatJSONSchema ||
+			format.Get("json_schema.name").String() != "grade" ||
+			format.Get("json_schema.schema.properties.change.maximum").Int() != 10 {
+			t.Errorf("response_format = %s", format.Raw)
+		}
+	})
+
+	llm := NewOpenAI(WithAPIUrl(server.URL + "/v1"))
+	// fixture 的回复缺少 change 字段
+	_, _, err := Structured[grade](context.Background(), llm, Request{
+		Messages: []Message{{Role: RoleUser, Content: NewTextContent("你好")}},
+	}, WithMaxRepairs(0))
+	var validationErr *ValidationError
+	if !errors.As(err, &validationErr) {
+		t.Fatalf("err = %v", err)
+	}
+}
+
+func TestGeminiSchema(t *testing.T) {
+	schema := geminiSchema(SchemaFor[struct {
+		Items []grade `json:"items"`
+	}]())
+	if _, ok := schema["additionalProperties"]; ok {
+		t.Errorf("schema = %v", schema)
+	}
+	items := schema["properties"].(map[string]any)["items"].(map[string]any)["items"].(map[string]any)
+	if _, ok := items["additionalProperties"]; ok {
+		t.Errorf("items = %v", items)
+	}
+}
@@ -0,0 +1,171 @@
+package xmcp
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// ProtocolVersion 客户端使用的 MCP 协议版本
+const ProtocolVersion = "2025-03-26"
+
+// ToolInfo tools/list 返回的工具定义
+type ToolInfo struct {
+	Name        string         `json:"name"`
+	Description string         `json:"description,omitempty"`
+	InputSchema map[string]any `json:"inputSchema"`
+}
+
+// Content 工具结果中的内容块
+type Content struct {
+	Type     string `json:"type"` // text | image | audio | resource
+	Text     string `json:"text,omitempty"`
+	MimeType string `json:"mimeType,omitempty"`
+	Data     string `json:"data,omitempty"`
+}
+
+// CallToolResult tools/call 的结果, IsError 为工具执行失败 (而非协议错误)
+type CallToolResult struct {
+	Content []Content `json:"content"`
+	IsError bool      `json:"isError,omitempty"`
+}
+
+// Text 结果中的文本, 非文本内容以类型占位
+func (r *CallToolResult) Text() string {
+	parts := make([]string, 0, len(r.Content))
+	for _, content := range r.Content {
+		if content.Type == "text" {
+			parts = append(parts, content.Text)
+			continue
+		}
+		parts = append(parts, fmt.Sprintf("[%s %s]", content.Type, content.MimeType))
+	}
+	return strings.Join(parts, "\n")
+}
+
+type ServerInfo struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+type ClientOption func(*Client)
+
+// WithTimeout 单次请求的超时时间, 默认 30 秒
+func WithTimeout(timeout time.Duration) ClientOption {
+	return func(c *Client) {
+		if timeout > 0 {
+			c.timeout = timeout
+		}
+	}
+}
+
+// Client MCP 客户端, 连接后需要先调用 Initialize
+type Client struct {
+	transport Transport
+	timeout   time.Duration
+	nextID    atomic.Int64
+
+	ServerInfo      ServerInfo
+	ProtocolVersion string
+}
+
+func NewClient(transport Transport, opts ...ClientOption) *Client {
+	c := &Client{
+		transport: transport,
+		timeout:   30 * time.Second,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// Initialize 协商协议版本并发送 initialized 通知
+func (c *Client) Initialize(ctx context.Context) error {
+	var result struct {
+		ProtocolVersion string     `json:"protocolVersion"`
+		ServerInfo      ServerInfo `json:"serverInfo"`
+	}
+	err := c.call(ctx, "initialize", map[string]any{
+		"protocolVersion": ProtocolVersion,
+		"capabilities":    map[string]any{},
+		"clientInfo":      map[string]any{"name": "companions", "version": "1.0.0"},
+	}, &result)
+	if err != nil {
+		return err
+	}
+	c.ServerInfo = result.ServerInfo
+	c.ProtocolVersion = result.ProtocolVersion
+
+	msg, err := newRequest(0, "notifications/initialized", nil)
+	if err != nil {
+		return err
+	}
+	return c.transport.Notify(ctx, msg)
+}
+
+// ListTools 获取全部工具, 自动翻页
+func (c *Client) ListTools(ctx context.Context) ([]ToolInfo, error) {
+	var tools []ToolInfo
+	cursor := ""
+	for {
+		var params map[string]any
+		if cursor != "" {
+			params = map[string]any{"cursor": cursor}
+		}
+		var result struct {
+			Tools      []ToolInfo `json:"tools"`
+			NextCursor string     `json:"nextCursor"`
+		}
+		if err := c.call(ctx, "tools/list", params, &result); err != nil {
+			return nil, err
+		}
+		tools = append(tools, result.Tools...)
+		if result.NextCursor == "" {
+			return tools, nil
+		}
+		cursor = result.NextCursor
+	}
+}
+
+func (c *Client) CallTool(ctx context.Context, name string, args map[string]any) (*CallToolResult, error) {
+	if args == nil {
+		args = map[string]any{}
+	}
+	var result CallToolResult
+	if err := c.call(ctx, "tools/call", map[string]any{"name": name, "arguments": args}, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+func (c *Client) Close() error {
+	return c.transport.Close()
+}
+
+func (c *Client) call(ctx context.Context, method string, params any, result any) error {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	req, err := newRequest(c.nextID.Add(1), method, params)
+	if err != nil {
+		return err
+	}
+	resp, err := c.transport.Call(ctx, req)
+	if err != nil {
+		return fmt.Errorf("mcp %s 失败: %w", method, err)
+	}
+	if resp.Error != nil {
+		return resp.Error
+	}
+	if result == nil {
+		return nil
+	}
+	if err := json.Unmarshal(resp.Result, result); err != nil {
+		return fmt.Errorf("解析 mcp %s 结果失败: %w", method, err)
+	}
+	return nil
+}
@@ -0,0 +1,143 @@
+package xmcp_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"companions/internal/conf"
+	"companions/internal/pkg/xmcp"
+	"companions/internal/pkg/xmcp/mcptest"
+	"companions/internal/pkg/xtools"
+)
+
+// stubServer 提供 add、echo、fail 三个工具
+func stubServer() *mcptest.Server {
+	server := mcptest.NewServer()
+	server.AddTool("add", "两数相加", map[string]any{
+		"$schema": "http://json-schema.org/draft-07/schema#",
+		"type":    "object",
+		"properties": map[string]any{
+			"a": map[string]any{"type": "number"},
+			"b": map[string]any{"type": "number"},
+		},
+		"required": []string{"a", "b"},
+	}, func(args map[string]any) (string, error) {
+		a, _ := args["a"].(float64)
+		b, _ := args["b"].(float64)
+		return fmt.Sprint(a + b), nil
+	})
+	server.AddTool("echo", "原样返回", map[string]any{
+		"type":       "object",
+		"properties": map[string]any{"text": map[string]any{"type": "string"}},
+	}, func(args map[string]any) (string, error) {
+		text, _ := args["text"].(string)
+		return text, nil
+	})
+	server.AddTool("fail", "总是失败", map[string]any{"type": "object"}, func(args map[string]any) (string, error) {
+		return "", errors.New("boom")
+	})
+	return server
+}
+
+// TestMain 设置 MCPTEST_STDIO 时作为 stdio 服务运行, 供 TestStdio 启动子进程
+func TestMain(m *testing.M) {
+	if os.Getenv("MCPTEST_STDIO") == "1" {
+		if err := stubServer().ServeStdio(os.Stdin, os.Stdout); err != nil {
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+func testClient(t *testing.T, client *xmcp.Client) {
+	ctx := context.Background()
+	if client.ServerInfo.Name != "mcptest" || client.ProtocolVersion != xmcp.ProtocolVersion {
+		t.Errorf("server info = %+v, %s", client.ServerInfo, client.ProtocolVersion)
+	}
+
+	// 每页 2 个工具, 需要翻页
+	tools, err := client.Tools(ctx, nil, xtools.Meta{Confirm: true})
+	if err != nil {
+		t.Fatalf("Tools 失败: %v", err)
+	}
+	if len(tools) != 3 {
+		t.Fatalf("tools = %d", len(tools))
+	}
+
+	add := tools[0]
+	schema := add.GetSchema()
+	if schema.Name != "add" || schema.Schema()["$schema"] != nil || schema.Schema()["required"] == nil {
+		t.Errorf("schema = %+v", schema)
+	}
+	if meta := add.GetMeta(); !meta.Confirm || meta.Timeout != 30*time.Second {
+		t.Errorf("meta = %+v", meta)
+	}
+	if tools[2].GetSchema().Schema() != nil {
+		t.Errorf("没有参数的工具 schema 应为 nil")
+	}
+
+	result, err := add.Execute(ctx, map[string]any{"a": 1, "b": 2})
+	if err != nil || result.Text != "3" {
+		t.Errorf("add = %+v, %v", result, err)
+	}
+	if _, err := tools[2].Execute(ctx, nil); err == nil || err.Error() != "boom" {
+		t.Errorf("fail err = %v", err)
+	}
+	if _, err := client.CallTool(ctx, "missing", nil); err == nil || !strings.Contains(err.Error(), "unknown tool") {
+		t.Errorf("missing err = %v", err)
+	}
+
+	allowed, err := client.Tools(ctx, []string{"echo"}, xtools.Meta{})
+	if err != nil || len(allowed) != 1 || allowed[0].GetSchema().Name != "echo" {
+		t.Errorf("allowed = %v, %v", allowed, err)
+	}
+}
+
+func TestStdio(t *testing.T) {
+	client, err := xmcp.Connect(context.Background(), &conf.MCPServerConfig{
+		Name:    "stub",
+		Command: os.Args[0],
+		Args:    []string{"-test.run=^$"},
+		Env:     map[string]string{"MCPTEST_STDIO": "1"},
+	})
+	if err != nil {
+		t.Fatalf("Connect 失败: %v", err)
+	}
+	testClient(t, client)
+
+	if err := client.Close(); err != nil {
+		t.Errorf("Close 失败: %v", err)
+	}
+	if _, err := client.CallTool(context.Background(), "echo", nil); err == nil {
+		t.Error("关闭后调用应该失败")
+	}
+}
+
+func TestHTTP(t *testing.T) {
+	server := httptest.NewServer(stubServer())
+	defer server.Close()
+
+	client, err := xmcp.Connect(context.Background(), &conf.MCPServerConfig{
+		Name:      "stub",
+		Transport: "http",
+		URL:       server.URL,
+	})
+	if err != nil {
+		t.Fatalf("Connect 失败: %v", err)
+	}
+	defer client.Close()
+	testClient(t, client)
+
+	// 没有会话 id 时服务端拒绝
+	anonymous := xmcp.NewClient(xmcp.NewHTTP(server.URL, nil))
+	if _, err := anonymous.ListTools(context.Background()); err == nil || !strings.Contains(err.Error(), "404") {
+		t.Errorf("anonymous err = %v", err)
+	}
+}
@@ -0,0 +1,32 @@
+package xmcp
+
+import (
+	"companions/internal/conf"
+	"context"
+	"fmt"
+	"time"
+)
+
+// Connect 按配置连接 MCP 服务并完成初始化
+func Connect(ctx context.Context, serverConf *conf.MCPServerConfig) (*Client, error) {
+	var transport Transport
+	switch serverConf.Transport {
+	case "", "stdio":
+		stdio, err := NewStdio(serverConf.Command, serverConf.Args, serverConf.Env)
+		if err != nil {
+			return nil, err
+		}
+		transport = stdio
+	case "http":
+		transport = NewHTTP(serverConf.URL, serverConf.Headers)
+	default:
+		return nil, fmt.Errorf("未知的 mcp transport: %s", serverConf.Transport)
+	}
+
+	client := NewClient(transport, WithTimeout(time.Duration(serverConf.Timeout)*time.Second))
+	if err := client.Initialize(ctx); err != nil {
+		_ = client.Close()
+		return nil, err
+	}
+	return client, nil
+}
@@ -0,0 +1,166 @@
+package xmcp
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// HTTP streamable HTTP 传输, 每条消息一个 POST 请求
+// 响应为 application/json 或 text/event-stream, 会话 id 通过 Mcp-Session-Id 头传递
+type HTTP struct {
+	url     string
+	headers map[string]string
+	client  *http.Client
+
+	mu        sync.Mutex
+	sessionID string
+}
+
+// NewHTTP headers 附加在每个请求上, 如 Authorization
+func NewHTTP(url string, headers map[string]string) *HTTP {
+	return &HTTP{
+		url:     url,
+		headers: headers,
+		client:  &http.Client{},
+	}
+}
+
+func (t *HTTP) Call(ctx context.Context, req *Message) (*Message, error) {
+	resp, err := t.post(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if mediaType == "text/event-stream" {
+		return readEventStream(resp.Body, req.ID)
+	}
+
+	var msg Message
+	if err := json.NewDecoder(resp.Body).Decode(&msg); err != nil {
+		return nil, fmt.Errorf("解析 mcp 响应失败: %w", err)
+	}
+	return &msg, nil
+}
+
+func (t *HTTP) Notify(ctx context.Context, msg *Message) error {
+	resp, err := t.post(ctx, msg)
+	if err != nil {
+		return err
+	}
+	_, _ = io.Copy(io.Discard, resp.Body)
+	return resp.Body.Close()
+}
+
+// Close 通知服务端结束会话, 服务端不支持时忽略
+func (t *HTTP) Close() error {
+	sessionID := t.session()
+	if sessionID == "" {
+		return nil
+	}
+	req, err := http.NewRequest(http.MethodDelete, t.url, nil)
+	if err != nil {
+		return err
+	}
+	t.setHeaders(req, sessionID)
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
+
+func (t *HTTP) post(ctx context.Context, msg *Message) (*http.Response, error) {
+	body, err := json.Marshal(msg)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, t.url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json, text/event-stream")
+	t.setHeaders(req, t.session())
+
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("mcp 请求失败: %w", err)
+	}
+	if resp.StatusCode/100 != 2 {
+		defer resp.Body.Close()
+		data, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return nil, fmt.Errorf("mcp 请求失败: status=%d, %s", resp.StatusCode, strings.TrimSpace(string(data)))
+	}
+	if sessionID := resp.Header.Get("Mcp-Session-Id"); sessionID != "" {
+		t.mu.Lock()
+		t.sessionID = sessionID
+		t.mu.Unlock()
+	}
+	return resp, nil
+}
+
+func (t *HTTP) setHeaders(req *http.Request, sessionID string) {
+	for k, v := range t.headers {
+		req.Header.Set(k, v)
+	}
+	if sessionID != "" {
+		req.Header.Set("Mcp-Session-Id", sessionID)
+	}
+}
+
+func (t *HTTP) session() string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.sessionID
+}
+
+// readEventStream 读取 SSE 事件直到 id 相同的响应, 其间的通知和请求忽略
+func readEventStream(r io.Reader, id json.RawMessage) (*Message, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), maxLineSize)
+
+	var data []string
+	// match 空行表示事件结束, 解析累积的 data 并判断是否为等待的响应
+	match := func() *Message {
+		if len(data) == 0 {
+			return nil
+		}
+		var msg Message
+		err := json.Unmarshal([]byte(strings.Join(data, "\n")), &msg)
+		data = nil
+		if err != nil || !msg.IsResponse() || string(msg.ID) != string(id) {
+			return nil
+		}
+		return &msg
+	}
+
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line != "" {
+			if value, ok := strings.CutPrefix(line, "data:"); ok {
+				data = append(data, strings.TrimPrefix(value, " "))
+			}
+			continue
+		}
+		if msg := match(); msg != nil {
+			return msg, nil
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if msg := match(); msg != nil {
+		return msg, nil
+	}
+	return nil, fmt.Errorf("mcp 事件流结束但没有收到响应")
+}
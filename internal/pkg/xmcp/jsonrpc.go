@@ -0,0 +1,71 @@
+package xmcp
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// JSON-RPC 2.0 错误码
+const (
+	CodeParseError     = -32700
+	CodeInvalidRequest = -32600
+	CodeMethodNotFound = -32601
+	CodeInvalidParams  = -32602
+	CodeInternalError  = -32603
+)
+
+// Message JSON-RPC 消息, 请求、响应和通知共用
+// 有 Method 和 ID 为请求, 只有 Method 为通知, 没有 Method 为响应
+type Message struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id,omitempty"`
+	Method  string          `json:"method,omitempty"`
+	Params  json.RawMessage `json:"params,omitempty"`
+	Result  json.RawMessage `json:"result,omitempty"`
+	Error   *RPCError       `json:"error,omitempty"`
+}
+
+func (m *Message) IsResponse() bool {
+	return m.Method == "" && len(m.ID) > 0
+}
+
+// RPCError JSON-RPC 错误
+type RPCError struct {
+	Code    int             `json:"code"`
+	Message string          `json:"message"`
+	Data    json.RawMessage `json:"data,omitempty"`
+}
+
+func (e *RPCError) Error() string {
+	return fmt.Sprintf("mcp error %d: %s", e.Code, e.Message)
+}
+
+// newRequest id 为 0 时创建通知
+func newRequest(id int64, method string, params any) (*Message, error) {
+	msg := &Message{JSONRPC: "2.0", Method: method}
+	if id > 0 {
+		msg.ID = json.RawMessage(fmt.Sprint(id))
+	}
+	if params != nil {
+		data, err := json.Marshal(params)
+		if err != nil {
+			return nil, err
+		}
+		msg.Params = data
+	}
+	return msg, nil
+}
+
+// NewResult 创建成功响应
+func NewResult(id json.RawMessage, result any) *Message {
+	data, err := json.Marshal(result)
+	if err != nil {
+		return NewError(id, CodeInternalError, err.Error())
+	}
+	return &Message{JSONRPC: "2.0", ID: id, Result: data}
+}
+
+// NewError 创建错误响应
+func NewError(id json.RawMessage, code int, message string) *Message {
+	return &Message{JSONRPC: "2.0", ID: id, Error: &RPCError{Code: code, Message: message}}
+}
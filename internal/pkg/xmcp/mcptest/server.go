@@ -0,0 +1,214 @@
+// Package mcptest 用于测试的 MCP 服务, 支持 stdio 和 streamable HTTP
+package mcptest
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+
+	"companions/internal/pkg/xmcp"
+
+	"github.com/google/uuid"
+)
+
+// Handler 工具实现, 返回的 error 作为 isError 结果
+type Handler func(args map[string]any) (string, error)
+
+type tool struct {
+	info    xmcp.ToolInfo
+	handler Handler
+}
+
+// Server 内存中的 MCP 服务, tools/list 每页返回 PageSize 个工具
+type Server struct {
+	PageSize int
+
+	mu       sync.Mutex
+	tools    []tool
+	sessions map[string]bool
+	calls    []string
+}
+
+func NewServer() *Server {
+	return &Server{
+		PageSize: 2,
+		sessions: make(map[string]bool),
+	}
+}
+
+// AddTool 注册工具, schema 为参数的 JSON Schema
+func (s *Server) AddTool(name string, description string, schema map[string]any, handler Handler) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.tools = append(s.tools, tool{
+		info:    xmcp.ToolInfo{Name: name, Description: description, InputSchema: schema},
+		handler: handler,
+	})
+}
+
+// Calls 已调用的工具名称
+func (s *Server) Calls() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.calls...)
+}
+
+// Handle 处理一条消息, 通知返回 nil
+func (s *Server) Handle(msg *xmcp.Message) *xmcp.Message {
+	if len(msg.ID) == 0 {
+		return nil
+	}
+
+	switch msg.Method {
+	case "initialize":
+		return xmcp.NewResult(msg.ID, map[string]any{
+			"protocolVersion": xmcp.ProtocolVersion,
+			"capabilities":    map[string]any{"tools": map[string]any{}},
+			"serverInfo":      map[string]any{"name": "mcptest", "version": "0.1.0"},
+		})
+	case "ping":
+		return xmcp.NewResult(msg.ID, struct{}{})
+	case "tools/list":
+		return s.list(msg)
+	case "tools/call":
+		return s.call(msg)
+	}
+	return xmcp.NewError(msg.ID, xmcp.CodeMethodNotFound, "method not found: "+msg.Method)
+}
+
+func (s *Server) list(msg *xmcp.Message) *xmcp.Message {
+	var params struct {
+		Cursor string `json:"cursor"`
+	}
+	_ = json.Unmarshal(msg.Params, &params)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	start := 0
+	for i, t := range s.tools {
+		if t.info.Name == params.Cursor {
+			start = i
+		}
+	}
+	end := min(start+max(s.PageSize, 1), len(s.tools))
+	infos := make([]xmcp.ToolInfo, 0, end-start)
+	for _, t := range s.tools[start:end] {
+		infos = append(infos, t.info)
+	}
+	result := map[string]any{"tools": infos}
+	if end < len(s.tools) {
+		result["nextCursor"] = s.tools[end].info.Name
+	}
+	return xmcp.NewResult(msg.ID, result)
+}
+
+func (s *Server) call(msg *xmcp.Message) *xmcp.Message {
+	var params struct {
+		Name      string         `json:"name"`
+		Arguments map[string]any `json:"arguments"`
+	}
+	if err := json.Unmarshal(msg.Params, &params); err != nil {
+		return xmcp.NewError(msg.ID, xmcp.CodeInvalidParams, err.Error())
+	}
+
+	s.mu.Lock()
+	var handler Handler
+	for _, t := range s.tools {
+		if t.info.Name == params.Name {
+			handler = t.handler
+		}
+	}
+	s.calls = append(s.calls, params.Name)
+	s.mu.Unlock()
+	if handler == nil {
+		return xmcp.NewError(msg.ID, xmcp.CodeInvalidParams, "unknown tool: "+params.Name)
+	}
+
+	text, err := handler(params.Arguments)
+	if err != nil {
+		return xmcp.NewResult(msg.ID, xmcp.CallToolResult{
+			Content: []xmcp.Content{{Type: "text", Text: err.Error()}},
+			IsError: true,
+		})
+	}
+	return xmcp.NewResult(msg.ID, xmcp.CallToolResult{
+		Content: []xmcp.Content{{Type: "text", Text: text}},
+	})
+}
+
+// ServeStdio 从 r 读取换行分隔的消息, 响应写入 w, r 结束时返回
+func (s *Server) ServeStdio(r io.Reader, w io.Writer) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 10<<20)
+	encoder := json.NewEncoder(w)
+	for scanner.Scan() {
+		var msg xmcp.Message
+		if err := json.Unmarshal(scanner.Bytes(), &msg); err != nil {
+			if err := encoder.Encode(xmcp.NewError(json.RawMessage("null"), xmcp.CodeParseError, err.Error())); err != nil {
+				return err
+			}
+			continue
+		}
+		if resp := s.Handle(&msg); resp != nil {
+			if err := encoder.Encode(resp); err != nil {
+				return err
+			}
+		}
+	}
+	return scanner.Err()
+}
+
+// ServeHTTP streamable HTTP, initialize 时分配会话 id, tools/call 以事件流返回
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	sessionID := r.Header.Get("Mcp-Session-Id")
+	if r.Method == http.MethodDelete {
+		s.mu.Lock()
+		delete(s.sessions, sessionID)
+		s.mu.Unlock()
+		return
+	}
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	var msg xmcp.Message
+	if err := json.NewDecoder(r.Body).Decode(&msg); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if msg.Method == "initialize" {
+		sessionID = uuid.New().String()
+		s.mu.Lock()
+		s.sessions[sessionID] = true
+		s.mu.Unlock()
+		w.Header().Set("Mcp-Session-Id", sessionID)
+	} else {
+		s.mu.Lock()
+		ok := s.sessions[sessionID]
+		s.mu.Unlock()
+		if !ok {
+			http.Error(w, "session not found", http.StatusNotFound)
+			return
+		}
+	}
+
+	resp := s.Handle(&msg)
+	if resp == nil {
+		w.WriteHeader(http.StatusAccepted)
+		return
+	}
+	data, _ := json.Marshal(resp)
+	if msg.Method == "tools/call" && strings.Contains(r.Header.Get("Accept"), "text/event-stream") {
+		w.Header().Set("Content-Type", "text/event-stream")
+		// 响应之前先发送一条进度通知, 客户端需要跳过
+		_, _ = io.WriteString(w, "event: message\ndata: {\"jsonrpc\":\"2.0\",\"method\":\"notifications/progress\",\"params\":{\"progress\":1}}\n\n")
+		_, _ = io.WriteString(w, "event: message\ndata: "+string(data)+"\n\n")
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_, _ = w.Write(data)
+}
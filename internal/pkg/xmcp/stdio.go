@@ -0,0 +1,189 @@
+package xmcp
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"sync"
+	"time"
+
+	"github.com/daodao97/xgo/xlog"
+)
+
+// maxLineSize 单条消息的大小上限
+const maxLineSize = 10 << 20
+
+// Stdio 通过子进程的 stdin/stdout 收发换行分隔的 JSON-RPC 消息, stderr 写入日志
+type Stdio struct {
+	cmd    *exec.Cmd
+	writer io.WriteCloser
+
+	writeMu sync.Mutex
+	mu      sync.Mutex
+	pending map[string]chan *Message
+	done    chan struct{}
+	err     error
+}
+
+// NewStdio 启动 MCP 服务进程, env 追加在当前进程的环境变量之后
+func NewStdio(command string, args []string, env map[string]string) (*Stdio, error) {
+	cmd := exec.Command(command, args...)
+	cmd.Env = os.Environ()
+	for k, v := range env {
+		cmd.Env = append(cmd.Env, k+"="+v)
+	}
+
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	stderr, err := cmd.StderrPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("启动 mcp 服务失败: %w", err)
+	}
+
+	go func() {
+		scanner := bufio.NewScanner(stderr)
+		for scanner.Scan() {
+			xlog.Debug("mcp stderr", xlog.String("command", command), xlog.String("line", scanner.Text()))
+		}
+	}()
+
+	t := newStdio(stdout, stdin)
+	t.cmd = cmd
+	return t, nil
+}
+
+func newStdio(r io.Reader, w io.WriteCloser) *Stdio {
+	t := &Stdio{
+		writer:  w,
+		pending: make(map[string]chan *Message),
+		done:    make(chan struct{}),
+	}
+	go t.read(r)
+	return t
+}
+
+func (t *Stdio) read(r io.Reader) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), maxLineSize)
+	for scanner.Scan() {
+		var msg Message
+		if err := json.Unmarshal(scanner.Bytes(), &msg); err != nil {
+			xlog.Warn("mcp 消息解析失败", xlog.String("line", scanner.Text()), xlog.Err(err))
+			continue
+		}
+		switch {
+		case msg.IsResponse():
+			t.mu.Lock()
+			ch, ok := t.pending[string(msg.ID)]
+			delete(t.pending, string(msg.ID))
+			t.mu.Unlock()
+			if ok {
+				ch <- &msg
+			}
+		case len(msg.ID) > 0:
+			// 服务端发起的请求, 只支持 ping
+			if msg.Method == "ping" {
+				_ = t.write(NewResult(msg.ID, struct{}{}))
+			} else {
+				_ = t.write(NewError(msg.ID, CodeMethodNotFound, "method not found: "+msg.Method))
+			}
+		}
+	}
+
+	err := scanner.Err()
+	if err == nil {
+		err = ErrClosed
+	}
+	t.mu.Lock()
+	t.err = err
+	t.pending = nil
+	t.mu.Unlock()
+	close(t.done)
+}
+
+func (t *Stdio) write(msg *Message) error {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	t.writeMu.Lock()
+	defer t.writeMu.Unlock()
+	_, err = t.writer.Write(append(data, '\n'))
+	return err
+}
+
+func (t *Stdio) Call(ctx context.Context, req *Message) (*Message, error) {
+	ch := make(chan *Message, 1)
+	id := string(req.ID)
+	t.mu.Lock()
+	if t.pending == nil {
+		err := t.err
+		t.mu.Unlock()
+		return nil, err
+	}
+	t.pending[id] = ch
+	t.mu.Unlock()
+
+	if err := t.write(req); err != nil {
+		t.forget(id)
+		return nil, err
+	}
+
+	select {
+	case resp := <-ch:
+		return resp, nil
+	case <-t.done:
+		return nil, t.err
+	case <-ctx.Done():
+		t.forget(id)
+		return nil, ctx.Err()
+	}
+}
+
+func (t *Stdio) forget(id string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.pending != nil {
+		delete(t.pending, id)
+	}
+}
+
+func (t *Stdio) Notify(ctx context.Context, msg *Message) error {
+	return t.write(msg)
+}
+
+// Close 关闭 stdin 通知服务退出, 超过 5 秒未退出时结束进程
+func (t *Stdio) Close() error {
+	err := t.writer.Close()
+	if t.cmd == nil {
+		return err
+	}
+
+	exited := make(chan error, 1)
+	go func() {
+		exited <- t.cmd.Wait()
+	}()
+	select {
+	case waitErr := <-exited:
+		if err == nil {
+			err = waitErr
+		}
+	case <-time.After(5 * time.Second):
+		_ = t.cmd.Process.Kill()
+		<-exited
+	}
+	return err
+}
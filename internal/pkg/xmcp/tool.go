@@ -0,0 +1,76 @@
+package xmcp
+
+import (
+	"companions/internal/pkg/xllm"
+	"companions/internal/pkg/xtools"
+	"context"
+	"errors"
+	"slices"
+)
+
+var _ xtools.ToolInterface = (*Tool)(nil)
+
+// Tool 将 MCP 服务的工具适配为 xtools.ToolInterface, 调用转发到服务端
+type Tool struct {
+	client *Client
+	info   ToolInfo
+	meta   xtools.Meta
+}
+
+func (t *Tool) GetSchema() xllm.Tool {
+	return xllm.Tool{
+		Name:        t.info.Name,
+		Description: t.info.Description,
+		InputSchema: inputSchema(t.info.InputSchema),
+	}
+}
+
+func (t *Tool) GetMeta() xtools.Meta {
+	return t.meta
+}
+
+func (t *Tool) Execute(ctx context.Context, args map[string]any) (*xtools.Result, error) {
+	result, err := t.client.CallTool(ctx, t.info.Name, args)
+	if err != nil {
+		return nil, err
+	}
+	if result.IsError {
+		return nil, errors.New(result.Text())
+	}
+	return xtools.TextResult(result.Text()), nil
+}
+
+// Tools 服务端的工具, allow 不为空时只保留其中的工具; meta 未设置超时时使用客户端的请求超时
+func (c *Client) Tools(ctx context.Context, allow []string, meta xtools.Meta) ([]xtools.ToolInterface, error) {
+	infos, err := c.ListTools(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if meta.Timeout <= 0 {
+		meta.Timeout = c.timeout
+	}
+	var tools []xtools.ToolInterface
+	for _, info := range infos {
+		if len(allow) > 0 && !slices.Contains(allow, info.Name) {
+			continue
+		}
+		tools = append(tools, &Tool{client: c, info: info, meta: meta})
+	}
+	return tools, nil
+}
+
+// inputSchema 去掉模型接口不接受的 $schema 等元信息, 没有参数时返回 nil
+func inputSchema(schema map[string]any) map[string]any {
+	if properties, _ := schema["properties"].(map[string]any); len(properties) == 0 {
+		return nil
+	}
+	cleaned := make(map[string]any, len(schema))
+	for k, v := range schema {
+		if k == "$schema" || k == "$id" {
+			continue
+		}
+		cleaned[k] = v
+	}
+	cleaned["type"] = "object"
+	return cleaned
+}
@@ -0,0 +1,17 @@
+package xmcp
+
+import (
+	"context"
+	"errors"
+)
+
+var ErrClosed = errors.New("mcp 连接已关闭")
+
+// Transport MCP 传输层
+type Transport interface {
+	// Call 发送请求并等待 id 相同的响应
+	Call(ctx context.Context, req *Message) (*Message, error)
+	// Notify 发送通知, 不等待响应
+	Notify(ctx context.Context, msg *Message) error
+	Close() error
+}
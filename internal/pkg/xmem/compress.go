@@ -1,7 +1,6 @@
 package xmem
 
 import (
-	"companions/internal/conf"
 	"context"
 
 	"companions/internal/pkg/xllm"
@@ -14,14 +13,19 @@ and important details discussed. This summary will replace the current chat hist
 so it must capture everything essential to understand the context and continue our conversation effectively as if no information was lost.
 `
 
-func Compress(messages []xllm.Message) string {
-	llmConf := conf.Get().GetLLM("default")
-	llm := xllm.NewOpenAI(
-		xllm.WithAPIKey(llmConf.ApiKey),
-		xllm.WithAPIUrl(llmConf.ApiUrl),
-	)
-	response, err := llm.Chat(context.Background(), xllm.Request{
-		Model: llmConf.Model,
+// summarizer 按会话返回记忆压缩使用的模型, 默认为 summarize 任务的模型
+var summarizer = func(conversationID string) xllm.LLM {
+	return xllm.ForTask(xllm.TaskSummarize)
+}
+
+// SetSummarizer 设置记忆压缩使用的模型, 调用方可以按会话所属的用户包装计量
+func SetSummarizer(fn func(conversationID string) xllm.LLM) {
+	summarizer = fn
+}
+
+// Compress 使用 llm 将历史消息压缩为摘要, 失败时返回空字符串
+func Compress(ctx context.Context, llm xllm.LLM, messages []xllm.Message) string {
+	response, err := llm.Chat(ctx, xllm.Request{
 		Messages: append(messages, xllm.Message{
 			Role: "user",
 			Content: xllm.NewMultiContent([]xllm.ContentItem{
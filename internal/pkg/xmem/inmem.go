@@ -0,0 +1,214 @@
+package xmem
+
+import (
+	"companions/internal/pkg/xagent"
+	"companions/internal/pkg/xllm"
+	"sort"
+	"sync"
+	"time"
+)
+
+var _ Memory = (*InMemory)(nil)
+
+// InMemory 进程内存储, 用于测试和单机开发, 重启后数据丢失
+type InMemory struct {
+	mu    sync.RWMutex
+	seq   int64
+	convs map[string]*inMemoryConv
+}
+
+type inMemoryConv struct {
+	conv    Conversation
+	deleted bool
+	records []record
+}
+
+func NewInMemory() *InMemory {
+	return &InMemory{
+		convs: make(map[string]*inMemoryConv),
+	}
+}
+
+func (m *InMemory) find(convId string) (*inMemoryConv, error) {
+	c, ok := m.convs[convId]
+	if !ok || c.deleted {
+		return nil, ErrNotFound
+	}
+	return c, nil
+}
+
+// Create 创建会话, 先写入消息时自动创建的记录只补充会话信息, 保留已有的消息
+func (m *InMemory) Create(convId string, uid string, title string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	c, ok := m.convs[convId]
+	if ok && c.conv.CreatedAt != "" {
+		return ErrExists
+	}
+	if !ok {
+		c = &inMemoryConv{}
+		m.convs[convId] = c
+	}
+	now := time.Now().Format(time.DateTime)
+	c.conv = Conversation{
+		Id:        convId,
+		Uid:       uid,
+		Title:     title,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	return nil
+}
+
+func (m *InMemory) Exists(convId string) (bool, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	c, ok := m.convs[convId]
+	return ok && c.conv.CreatedAt != "", nil
+}
+
+func (m *InMemory) Find(convId string) (*Conversation, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	c, err := m.find(convId)
+	if err != nil {
+		return nil, err
+	}
+	conv := c.conv
+	return &conv, nil
+}
+
+func (m *InMemory) Get(convId string) (*Conversation, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	c, err := m.find(convId)
+	if err != nil {
+		return nil, err
+	}
+	conv := c.conv
+	conv.Messages, err = groupRecords(c.records)
+	if err != nil {
+		return nil, err
+	}
+	return &conv, nil
+}
+
+func (m *InMemory) List(uid string) ([]*Conversation, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	convs := make([]*Conversation, 0)
+	for _, c := range m.convs {
+		if c.deleted || c.conv.Uid != uid {
+			continue
+		}
+		conv := c.conv
+		convs = append(convs, &conv)
+	}
+	sort.SliceStable(convs, func(i, j int) bool {
+		return convs[i].UpdatedAt > convs[j].UpdatedAt
+	})
+	return convs, nil
+}
+
+func (m *InMemory) Rename(convId string, title string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	c, err := m.find(convId)
+	if err != nil {
+		return err
+	}
+	c.conv.Title = title
+	c.conv.UpdatedAt = time.Now().Format(time.DateTime)
+	return nil
+}
+
+func (m *InMemory) Delete(convId string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	c, err := m.find(convId)
+	if err != nil {
+		return err
+	}
+	c.deleted = true
+	return nil
+}
+
+// Insert 写入消息, 会话不存在时自动创建 (与数据库实现一致, 消息不依赖会话记录)
+func (m *InMemory) Insert(convId string, value []xagent.Message) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	c, ok := m.convs[convId]
+	if !ok {
+		c = &inMemoryConv{conv: Conversation{Id: convId}}
+		m.convs[convId] = c
+	}
+	for _, item := range newRecords(value) {
+		m.seq++
+		item.ID = m.seq
+		c.records = append(c.records, item)
+	}
+	c.conv.UpdatedAt = time.Now().Format(time.DateTime)
+	return nil
+}
+
+func (m *InMemory) records(convId string) []record {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	c, ok := m.convs[convId]
+	if !ok {
+		return nil
+	}
+	return append([]record(nil), c.records...)
+}
+
+func (m *InMemory) GetMemory(convId string) ([]xllm.Message, error) {
+	messages, needCompress := memoryFromRecords(m.records(convId))
+	if needCompress {
+		messages = compressMemory(m, convId, messages)
+	}
+	return messages, nil
+}
+
+func (m *InMemory) Messages(convId string, cursor int64, limit int) ([]map[string]any, int64, error) {
+	return pageRecords(m.records(convId), cursor, limit)
+}
+
+func (m *InMemory) Turn(convId string, messageId string) (*Turn, error) {
+	var list []record
+	for _, item := range m.records(convId) {
+		if item.MessageID == messageId {
+			list = append(list, item)
+		}
+	}
+	return turnFromRecords(messageId, list)
+}
+
+func (m *InMemory) DeleteTurn(convId string, messageId string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	c, ok := m.convs[convId]
+	if !ok {
+		return ErrNotFound
+	}
+	kept := c.records[:0]
+	for _, item := range c.records {
+		if item.MessageID != messageId {
+			kept = append(kept, item)
+		}
+	}
+	if len(kept) == len(c.records) {
+		return ErrNotFound
+	}
+	c.records = kept
+	return nil
+}
@@ -0,0 +1,163 @@
+package xmem
+
+import (
+	"companions/internal/pkg/xagent"
+	"errors"
+	"testing"
+)
+
+// testMemory 各存储实现共用的行为测试
+func testMemory(t *testing.T, m Memory) {
+	t.Helper()
+
+	if err := m.Create("c1", "u1", ""); err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	if err := m.Create("c2", "u1", "second"); err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	if err := m.Create("c3", "u2", "other user"); err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+
+	turn1 := []xagent.Message{
+		xagent.NewMessage().Role(xagent.MessageRoleUser).ID("t1").Content("hi").Storage(true).Build(),
+		xagent.NewMessage().Role(xagent.MessageRoleAssistant).ID("t1").Content("hey").Storage(true).Build(),
+		xagent.NewMetaMessage("t1", map[string]any{"romance": map[string]any{"change": 1}}),
+	}
+	turn2 := []xagent.Message{
+		xagent.NewMessage().Role(xagent.MessageRoleUser).ID("t2").Content("how are you").Storage(true).Build(),
+		xagent.NewMessage().Role(xagent.MessageRoleAssistant).ID("t2").Content("good").Storage(true).Build(),
+		xagent.NewMetaMessage("t2", map[string]any{}),
+	}
+	if err := m.Insert("c1", turn1); err != nil {
+		t.Fatalf("Insert() error = %v", err)
+	}
+	if err := m.Insert("c1", turn2); err != nil {
+		t.Fatalf("Insert() error = %v", err)
+	}
+
+	// 记忆不包含元信息
+	history, err := m.GetMemory("c1")
+	if err != nil {
+		t.Fatalf("GetMemory() error = %v", err)
+	}
+	if len(history) != 4 {
+		t.Fatalf("GetMemory() len = %d, want 4", len(history))
+	}
+	if history[0].Role != "user" || history[3].Role != "assistant" {
+		t.Errorf("GetMemory() roles = %s..%s", history[0].Role, history[3].Role)
+	}
+
+	// 按 message_id 分组
+	conv, err := m.Get("c1")
+	if err != nil {
+		t.Fatalf("Get() error = %v", err)
+	}
+	if conv.Uid != "u1" || len(conv.Messages) != 2 {
+		t.Errorf("Get() uid = %s, groups = %d", conv.Uid, len(conv.Messages))
+	}
+
+	// 游标分页: 每页 2 条, 从最新的开始
+	page, next, err := m.Messages("c1", 0, 2)
+	if err != nil {
+		t.Fatalf("Messages() error = %v", err)
+	}
+	if len(page) != 2 || page[0]["content"] != "how are you" || next == 0 {
+		t.Fatalf("Messages() page1 = %v, next = %d", page, next)
+	}
+	// limit 只计可展示的消息, 元信息记录不占用分页
+	page, next, err = m.Messages("c1", next, 2)
+	if err != nil {
+		t.Fatalf("Messages() error = %v", err)
+	}
+	if len(page) != 2 || page[0]["content"] != "hi" || page[1]["content"] != "hey" || next != 0 {
+		t.Fatalf("Messages() page2 = %v, next = %d, want [hi hey]", page, next)
+	}
+	page, next, err = m.Messages("c1", 0, 1)
+	if err != nil {
+		t.Fatalf("Messages() error = %v", err)
+	}
+	if len(page) != 1 || page[0]["content"] != "good" || next == 0 {
+		t.Fatalf("Messages(limit=1) = %v, next = %d, want [good]", page, next)
+	}
+
+	turn, err := m.Turn("c1", "t1")
+	if err != nil {
+		t.Fatalf("Turn() error = %v", err)
+	}
+	if len(turn.Messages) != 2 || turn.Meta["romance"] == nil {
+		t.Errorf("Turn() = %+v", turn)
+	}
+
+	if err := m.DeleteTurn("c1", "t1"); err != nil {
+		t.Fatalf("DeleteTurn() error = %v", err)
+	}
+	if _, err := m.Turn("c1", "t1"); err == nil {
+		t.Error("Turn() after DeleteTurn should fail")
+	}
+	if err := m.DeleteTurn("c1", "t1"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("DeleteTurn() on missing turn error = %v, want ErrNotFound", err)
+	}
+
+	if err := m.Rename("c1", "renamed"); err != nil {
+		t.Fatalf("Rename() error = %v", err)
+	}
+	found, err := m.Find("c1")
+	if err != nil || found.Title != "renamed" {
+		t.Errorf("Find() = %+v, %v", found, err)
+	}
+
+	list, err := m.List("u1")
+	if err != nil {
+		t.Fatalf("List() error = %v", err)
+	}
+	if len(list) != 2 {
+		t.Errorf("List() len = %d, want 2", len(list))
+	}
+
+	if err := m.Delete("c2"); err != nil {
+		t.Fatalf("Delete() error = %v", err)
+	}
+	if _, err := m.Find("c2"); err == nil {
+		t.Error("Find() after Delete should fail")
+	}
+	list, _ = m.List("u1")
+	if len(list) != 1 || list[0].Id != "c1" {
+		t.Errorf("List() after Delete = %+v", list)
+	}
+
+	// 会话 id 不能重复创建, 已删除的会话仍占用 id
+	for _, id := range []string{"c1", "c2"} {
+		if exists, err := m.Exists(id); err != nil || !exists {
+			t.Errorf("Exists(%s) = %v, %v, want true", id, exists, err)
+		}
+		if err := m.Create(id, "u1", ""); !errors.Is(err, ErrExists) {
+			t.Errorf("Create(%s) again error = %v, want ErrExists", id, err)
+		}
+	}
+	if _, err := m.Find("c2"); err == nil {
+		t.Error("Create() should not restore a deleted conversation")
+	}
+
+	// 先写入消息的会话可以创建, 已有的消息保留
+	if exists, err := m.Exists("c4"); err != nil || exists {
+		t.Errorf("Exists(c4) = %v, %v, want false", exists, err)
+	}
+	if err := m.Insert("c4", turn1); err != nil {
+		t.Fatalf("Insert() error = %v", err)
+	}
+	if exists, _ := m.Exists("c4"); exists {
+		t.Error("Exists() should be false before Create")
+	}
+	if err := m.Create("c4", "u1", ""); err != nil {
+		t.Fatalf("Create() after Insert error = %v", err)
+	}
+	if history, _ := m.GetMemory("c4"); len(history) != 2 {
+		t.Errorf("GetMemory(c4) len = %d, want 2", len(history))
+	}
+}
+
+func TestInMemory(t *testing.T) {
+	testMemory(t, NewInMemory())
+}
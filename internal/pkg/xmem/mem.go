@@ -1,11 +1,13 @@
 package xmem
 
 import (
+	"companions/internal/pkg/xagent"
 	"companions/internal/pkg/xllm"
 )
 
 type Conversation struct {
 	Id        string `json:"id"`
+	Uid       string `json:"uid,omitempty"`
 	Title     string `json:"title"`
 	Model     string `json:"model,omitempty"`
 	Messages  []any  `json:"messages"`
@@ -13,13 +15,36 @@ type Conversation struct {
 	UpdatedAt string `json:"updated_at"`
 }
 
+// Turn 一轮对话, 同一轮的消息共享 message_id
+type Turn struct {
+	MessageID string           `json:"message_id"`
+	Messages  []map[string]any `json:"messages"`
+	Meta      map[string]any   `json:"meta,omitempty"` // 音频、动作、浪漫度等元信息
+}
+
 type Memory interface {
 	// 获取历史消息
 	Get(convId string) (*Conversation, error)
 	// 获取记忆
 	GetMemory(convId string) ([]xllm.Message, error)
 	// 设置历史消息
-	Insert(convId string, value []xllm.Message) error
-	// 创建会话
+	Insert(convId string, value []xagent.Message) error
+	// 创建会话, id 已被占用 (包括已删除的会话) 时返回 ErrExists
 	Create(convId string, uid string, title string) error
+	// 会话 id 是否已被占用, 已删除的会话同样返回 true
+	Exists(convId string) (bool, error)
+	// 获取会话信息, 不包含消息
+	Find(convId string) (*Conversation, error)
+	// 获取用户的会话列表
+	List(uid string) ([]*Conversation, error)
+	// 重命名会话
+	Rename(convId string, title string) error
+	// 删除会话 (软删除)
+	Delete(convId string) error
+	// 按游标分页获取消息
+	Messages(convId string, cursor int64, limit int) ([]map[string]any, int64, error)
+	// 获取一轮对话
+	Turn(convId string, messageId string) (*Turn, error)
+	// 永久删除一轮对话, 不同于会话的软删除, 删除后不再进入记忆; 没有匹配的消息时返回 ErrNotFound
+	DeleteTurn(convId string, messageId string) error
 }
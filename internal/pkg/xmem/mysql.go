@@ -5,12 +5,15 @@ import (
 	"companions/internal/pkg/xagent"
 	"companions/internal/pkg/xllm"
 	"encoding/json"
+	"errors"
+	"strings"
 	"time"
 
 	"github.com/daodao97/xgo/xdb"
-	"github.com/tidwall/gjson"
 )
 
+var _ Memory = (*MysqlMemory)(nil)
+
 type MysqlMemory struct {
 	conv xdb.Model
 	msg  xdb.Model
@@ -24,70 +27,166 @@ func NewMysqlMemory(convModel, msgModel xdb.Model) *MysqlMemory {
 }
 
 func (m *MysqlMemory) Get(key string) (*Conversation, error) {
-	conv, err := m.conv.First(xdb.WhereEq("conversation_id", key))
+	data, err := m.Find(key)
 	if err != nil {
 		return nil, err
 	}
 
-	data := &Conversation{
-		Id:        conv.GetString("conversation_id"),
-		Title:     conv.GetString("title"),
-		Model:     conv.GetString("model"),
-		CreatedAt: conv.GetTime("created_at").Format(time.DateTime),
-		UpdatedAt: conv.GetTime("updated_at").Format(time.DateTime),
+	list, err := m.msg.Selects(xdb.WhereEq("conversation_id", key), xdb.OrderByAsc("id"))
+	if err != nil {
+		return nil, err
 	}
 
-	var messages []any
-	list, err := m.msg.Selects(xdb.WhereEq("conversation_id", key), xdb.OrderByAsc("id"))
+	data.Messages, err = groupRecords(toRecords(list))
 	if err != nil {
 		return nil, err
 	}
 
-	// 按 message_id 分组，同时保持顺序
-	messageGroups := make(map[string][]map[string]any)
-	messageOrder := make([]string, 0) // 记录 message_id 的出现顺序
-	seenMessageIds := make(map[string]bool)
+	return data, nil
+}
 
-	for _, item := range list {
-		if item.GetString("message_id") == "summary" {
-			continue
+// Messages 按游标倒序分页获取消息
+// cursor 为上一页返回的 next_cursor (即本页最小的消息 id), 0 表示从最新消息开始
+// 返回的消息按时间正序排列, nextCursor 为 0 表示没有更多消息
+// 每轮对话还存有元信息和用量等隐藏记录, 按批读取直到凑满 limit 条可展示的消息
+func (m *MysqlMemory) Messages(convId string, cursor int64, limit int) ([]map[string]any, int64, error) {
+	batch := limit*3 + 1
+	var desc []record
+	for visible := 0; visible <= limit; {
+		opts := []xdb.Option{
+			xdb.WhereEq("conversation_id", convId),
+			xdb.OrderByDesc("id"),
+			xdb.Limit(batch),
 		}
-
-		var msg map[string]any
-		err := json.Unmarshal([]byte(item.GetString("content")), &msg)
+		if cursor > 0 {
+			opts = append(opts, xdb.WhereLt("id", cursor))
+		}
+		list, err := m.msg.Selects(opts...)
 		if err != nil {
-			return nil, err
+			return nil, 0, err
+		}
+		for _, item := range toRecords(list) {
+			desc = append(desc, item)
+			if item.visible() {
+				visible++
+			}
 		}
-		if msg["role"] == "usage" {
-			continue
+		if len(list) < batch {
+			break
 		}
-		msg["message_id"] = item.GetString("message_id")
-		delete(msg, "memory")
-		delete(msg, "storage")
-		delete(msg, "hidden")
+		cursor = desc[len(desc)-1].ID
+	}
+
+	page, nextCursor := pageVisible(desc, limit)
+	messages, err := visibleMessages(page)
+	if err != nil {
+		return nil, 0, err
+	}
+	return messages, nextCursor, nil
+}
 
-		messageId := item.GetString("message_id")
+// Turn 获取一轮对话, 包含用户消息、回复以及音频/动作等元信息
+func (m *MysqlMemory) Turn(convId string, messageId string) (*Turn, error) {
+	list, err := m.msg.Selects(
+		xdb.WhereEq("conversation_id", convId),
+		xdb.WhereEq("message_id", messageId),
+		xdb.OrderByAsc("id"),
+	)
+	if err != nil {
+		return nil, err
+	}
+	return turnFromRecords(messageId, toRecords(list))
+}
 
-		// 记录第一次出现的 message_id 顺序
-		if !seenMessageIds[messageId] {
-			messageOrder = append(messageOrder, messageId)
-			seenMessageIds[messageId] = true
-		}
+// DeleteTurn 永久删除一轮对话的全部消息, 没有匹配的消息时返回 ErrNotFound
+func (m *MysqlMemory) DeleteTurn(convId string, messageId string) error {
+	list, err := m.msg.Selects(
+		xdb.WhereEq("conversation_id", convId),
+		xdb.WhereEq("message_id", messageId),
+		xdb.Limit(1),
+	)
+	if err != nil {
+		return err
+	}
+	if len(list) == 0 {
+		return ErrNotFound
+	}
+	_, err = m.msg.Delete(
+		xdb.WhereEq("conversation_id", convId),
+		xdb.WhereEq("message_id", messageId),
+	)
+	return err
+}
 
-		messageGroups[messageId] = append(messageGroups[messageId], msg)
+func (m *MysqlMemory) Find(convId string) (*Conversation, error) {
+	conv, err := m.conv.First(
+		xdb.WhereEq("conversation_id", convId),
+		xdb.WhereEq("is_deleted", 0),
+	)
+	if err != nil {
+		return nil, err
 	}
+	return toConversation(conv), nil
+}
 
-	// 按原顺序将分组后的消息添加到结果中
-	for _, messageId := range messageOrder {
-		group := messageGroups[messageId]
-		messages = append(messages, group)
+func (m *MysqlMemory) List(uid string) ([]*Conversation, error) {
+	list, err := m.conv.Selects(
+		xdb.WhereEq("uid", uid),
+		xdb.WhereEq("is_deleted", 0),
+		xdb.OrderByDesc("updated_at"),
+	)
+	if err != nil {
+		return nil, err
 	}
 
-	data.Messages = messages
+	convs := make([]*Conversation, 0, len(list))
+	for _, item := range list {
+		convs = append(convs, toConversation(item))
+	}
+	return convs, nil
+}
 
-	return data, nil
+func (m *MysqlMemory) Rename(convId string, title string) error {
+	_, err := m.conv.Update(xdb.Record{
+		"title":      title,
+		"updated_at": time.Now(),
+	}, xdb.WhereEq("conversation_id", convId))
+	return err
 }
 
+// Delete 软删除会话, 消息保留以便审计
+func (m *MysqlMemory) Delete(convId string) error {
+	_, err := m.conv.Update(xdb.Record{
+		"is_deleted": 1,
+		"updated_at": time.Now(),
+	}, xdb.WhereEq("conversation_id", convId))
+	return err
+}
+
+func toConversation(conv xdb.Record) *Conversation {
+	return &Conversation{
+		Id:        conv.GetString("conversation_id"),
+		Uid:       conv.GetString("uid"),
+		Title:     conv.GetString("title"),
+		Model:     conv.GetString("model"),
+		CreatedAt: conv.GetTime("created_at").Format(time.DateTime),
+		UpdatedAt: conv.GetTime("updated_at").Format(time.DateTime),
+	}
+}
+
+func toRecords(list []xdb.Record) []record {
+	records := make([]record, 0, len(list))
+	for _, item := range list {
+		records = append(records, record{
+			ID:        item.GetInt64("id"),
+			MessageID: item.GetString("message_id"),
+			Content:   item.GetString("content"),
+		})
+	}
+	return records
+}
+
+// Create 依赖 conversation_id 唯一索引, 重复时返回 ErrExists
 func (m *MysqlMemory) Create(convId string, uid string, title string) error {
 	_, err := m.conv.Insert(xdb.Record{
 		"conversation_id": convId,
@@ -95,25 +194,43 @@ func (m *MysqlMemory) Create(convId string, uid string, title string) error {
 		"title":           title,
 	})
 	if err != nil {
+		// MySQL 返回 Duplicate entry (1062), SQLite 返回 UNIQUE constraint failed
+		if msg := err.Error(); strings.Contains(msg, "Duplicate entry") || strings.Contains(msg, "UNIQUE constraint failed") {
+			return ErrExists
+		}
 		return err
 	}
 	return nil
 }
 
+// Exists 不过滤 is_deleted, 软删除的会话仍占用 id
+func (m *MysqlMemory) Exists(convId string) (bool, error) {
+	_, err := m.conv.First(xdb.WhereEq("conversation_id", convId))
+	if errors.Is(err, xdb.ErrNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
 func (m *MysqlMemory) Insert(key string, value []xagent.Message) error {
 	var records []xdb.Record
-	processor := xagent.NewMessageProcessor()
-
-	for _, item := range value {
+	for _, item := range newRecords(value) {
 		records = append(records, xdb.Record{
 			"conversation_id": key,
-			"message_id":      item.GetMessageID(),
-			"content":         processor.ToJSON(item),
+			"message_id":      item.MessageID,
+			"content":         item.Content,
 		})
 	}
 
 	if len(records) > 0 {
-		_, err := m.msg.InsertBatch(records)
+		if _, err := m.msg.InsertBatch(records); err != nil {
+			return err
+		}
+		// 刷新会话活跃时间, 会话列表按 updated_at 排序
+		_, err := m.conv.Update(xdb.Record{"updated_at": time.Now()}, xdb.WhereEq("conversation_id", key))
 		return err
 	}
 
@@ -123,79 +240,38 @@ func (m *MysqlMemory) Insert(key string, value []xagent.Message) error {
 // 获取记忆
 // 检查历史消息是否超出 模型最大token数
 // 如果超出，则压缩历史消息
-// 压缩历史消息时，使用 compressPrompt 提示词
 func (m *MysqlMemory) GetMemory(convId string) ([]xllm.Message, error) {
-	var messages []xllm.Message
 	list, err := m.msg.Selects(xdb.WhereEq("conversation_id", convId), xdb.OrderByAsc("created_at"))
 	if err != nil {
 		return nil, err
 	}
 
-	// TODO: RAG 过滤
-
-	var lastUsageMessage string
-	for _, item := range list {
-		role := gjson.Get(item.GetString("content"), "role").String()
-		step := gjson.Get(item.GetString("content"), "step").String()
-		if role == "usage" && step == "llm_call" {
-			lastUsageMessage = item.GetString("content")
-			continue
-		}
-
-		isSummary := gjson.Get(item.GetString("content"), "summary").Bool()
-		if isSummary {
-			llmMsg := ToLLmMessage(item.GetString("content"))
-			if llmMsg != nil {
-				messages = []xllm.Message{*llmMsg}
-			}
-			lastUsageMessage = ""
-			continue
-		}
-
-		llmMsg := ToLLmMessage(item.GetString("content"))
-		if llmMsg != nil {
-			messages = append(messages, *llmMsg)
-		}
-
-	}
-
-	// 如果最后一条消息是 summary 消息，则不进行压缩
-	if lastUsageMessage == "" {
-		return messages, nil
-	}
-
-	totalTokens := gjson.Get(lastUsageMessage, "usage.total_tokens").Int()
-	limit := GetModelMaxTokens(gjson.Get(lastUsageMessage, "model").String())
-
-	if totalTokens >= int64(float64(limit)*0.8) {
-		compressMessages := Compress(messages)
-
-		// 创建压缩后的 LLM 消息
-		messages = []xllm.Message{
-			{
-				Role:    xllm.RoleAssistant,
-				Content: xllm.NewTextContent(compressMessages),
-			},
-		}
-
-		// 使用新的转换函数创建 agent 消息
-		agentMessages := xagent.ToAgentMessages(messages)
-		m.Insert(convId, agentMessages)
+	messages, needCompress := memoryFromRecords(toRecords(list))
+	if needCompress {
+		messages = compressMemory(m, convId, messages)
 	}
 
 	return messages, nil
 }
 
+// GetModelMaxTokens 返回模型的上下文窗口大小, 按路由名称查找, 找不到时再按模型名称匹配, 未配置时默认 100000
 func GetModelMaxTokens(model string) int {
-	models := conf.Get().LLM
-	for _, item := range models {
-		if item.Model == model {
-			if item.MaxTokens > 0 {
-				return item.MaxTokens
+	c := conf.Get()
+	if c == nil {
+		return 100000
+	}
+	llm := c.GetLLM(model)
+	if llm == nil {
+		for _, item := range c.LLM {
+			if item.Model == model {
+				llm = item
+				break
 			}
-			return 100000
 		}
 	}
+	if llm != nil && llm.ContextSize() > 0 {
+		return llm.ContextSize()
+	}
 	return 100000
 }
 
@@ -0,0 +1,245 @@
+package xmem
+
+import (
+	"companions/internal/pkg/xagent"
+	"companions/internal/pkg/xllm"
+	"context"
+	"encoding/json"
+	"errors"
+
+	"github.com/tidwall/gjson"
+)
+
+var (
+	// ErrNotFound 会话或消息不存在
+	ErrNotFound = errors.New("not found")
+	// ErrExists 会话 id 已被占用, 包括已删除的会话
+	ErrExists = errors.New("conversation exists")
+)
+
+// record 一条存储的消息, 各存储实现共用的结构
+type record struct {
+	ID        int64  `json:"id"`
+	MessageID string `json:"message_id"`
+	Content   string `json:"content"`
+}
+
+func (r record) role() string {
+	return gjson.Get(r.Content, "role").String()
+}
+
+// visible 是否为展示给用户的消息, 摘要、用量和元信息只在服务端使用
+func (r record) visible() bool {
+	if r.MessageID == "summary" {
+		return false
+	}
+	role := r.role()
+	return role != "usage" && role != string(xagent.MessageRoleMeta)
+}
+
+// decodeRecord 解析消息记录, 去掉仅服务端使用的字段
+func decodeRecord(r record) (map[string]any, error) {
+	var msg map[string]any
+	if err := json.Unmarshal([]byte(r.Content), &msg); err != nil {
+		return nil, err
+	}
+	msg["id"] = r.ID
+	msg["message_id"] = r.MessageID
+	delete(msg, "memory")
+	delete(msg, "storage")
+	delete(msg, "hidden")
+	delete(msg, "metadata")
+	return msg, nil
+}
+
+// newRecords 将 agent 消息转换为存储记录, id 由存储实现分配
+func newRecords(value []xagent.Message) []record {
+	processor := xagent.NewMessageProcessor()
+	records := make([]record, 0, len(value))
+	for _, item := range value {
+		records = append(records, record{
+			MessageID: item.GetMessageID(),
+			Content:   processor.ToJSON(item),
+		})
+	}
+	return records
+}
+
+// groupRecords 按 message_id 分组，同时保持顺序
+func groupRecords(list []record) ([]any, error) {
+	messageGroups := make(map[string][]map[string]any)
+	messageOrder := make([]string, 0) // 记录 message_id 的出现顺序
+
+	for _, item := range list {
+		if item.MessageID == "summary" {
+			continue
+		}
+
+		msg, err := decodeRecord(item)
+		if err != nil {
+			return nil, err
+		}
+		if msg["role"] == "usage" {
+			continue
+		}
+
+		// 记录第一次出现的 message_id 顺序
+		if _, ok := messageGroups[item.MessageID]; !ok {
+			messageOrder = append(messageOrder, item.MessageID)
+		}
+		messageGroups[item.MessageID] = append(messageGroups[item.MessageID], msg)
+	}
+
+	// 按原顺序将分组后的消息添加到结果中
+	var messages []any
+	for _, messageId := range messageOrder {
+		messages = append(messages, messageGroups[messageId])
+	}
+	return messages, nil
+}
+
+// visibleMessages 将按 id 倒序的记录转换为正序的可展示消息
+func visibleMessages(desc []record) ([]map[string]any, error) {
+	messages := make([]map[string]any, 0, len(desc))
+	for i := len(desc) - 1; i >= 0; i-- {
+		item := desc[i]
+		if !item.visible() {
+			continue
+		}
+		msg, err := decodeRecord(item)
+		if err != nil {
+			return nil, err
+		}
+		messages = append(messages, msg)
+	}
+	return messages, nil
+}
+
+// pageRecords 对按 id 正序排列的记录做游标分页, 语义同 Memory.Messages
+func pageRecords(asc []record, cursor int64, limit int) ([]map[string]any, int64, error) {
+	var desc []record
+	for i := len(asc) - 1; i >= 0; i-- {
+		if cursor > 0 && asc[i].ID >= cursor {
+			continue
+		}
+		desc = append(desc, asc[i])
+	}
+
+	page, nextCursor := pageVisible(desc, limit)
+	messages, err := visibleMessages(page)
+	return messages, nextCursor, err
+}
+
+// pageVisible 从按 id 倒序的记录中取 limit 条可展示的消息, limit 不计隐藏的记录
+// 之后还有可展示的消息时 nextCursor 为本页最小的 id, 否则为 0
+func pageVisible(desc []record, limit int) ([]record, int64) {
+	page := make([]record, 0, limit)
+	for _, item := range desc {
+		if !item.visible() {
+			continue
+		}
+		if len(page) == limit {
+			return page, page[len(page)-1].ID
+		}
+		page = append(page, item)
+	}
+	return page, 0
+}
+
+// turnFromRecords 组装一轮对话
+func turnFromRecords(messageId string, list []record) (*Turn, error) {
+	if len(list) == 0 {
+		return nil, ErrNotFound
+	}
+
+	turn := &Turn{MessageID: messageId, Messages: []map[string]any{}}
+	for _, item := range list {
+		msg, err := decodeRecord(item)
+		if err != nil {
+			return nil, err
+		}
+		switch msg["role"] {
+		case "usage":
+			continue
+		case string(xagent.MessageRoleMeta):
+			if extra, ok := msg["extra"].(map[string]any); ok {
+				turn.Meta = extra
+			}
+		default:
+			turn.Messages = append(turn.Messages, msg)
+		}
+	}
+	return turn, nil
+}
+
+// memoryFromRecords 从按时间正序的记录构建记忆
+// 检查历史消息是否超出 模型最大token数, 超出时 needCompress 为 true
+// 用量取自每轮元信息中聊天模型的 usage, 模型为路由名称; 同时兼容旧版本的 usage 记录
+func memoryFromRecords(list []record) (messages []xllm.Message, needCompress bool) {
+	// TODO: RAG 过滤
+
+	var totalTokens int64
+	var model string
+	for _, item := range list {
+		role := item.role()
+		step := gjson.Get(item.Content, "step").String()
+		if role == "usage" && step == "llm_call" {
+			totalTokens = gjson.Get(item.Content, "usage.total_tokens").Int()
+			model = gjson.Get(item.Content, "model").String()
+			continue
+		}
+
+		// 元信息只用于展示, 不进入记忆
+		if role == string(xagent.MessageRoleMeta) {
+			if usage := gjson.Get(item.Content, "extra.usage.total_tokens"); usage.Exists() {
+				totalTokens = usage.Int()
+				model = gjson.Get(item.Content, "extra.models.chat").String()
+			}
+			continue
+		}
+
+		isSummary := gjson.Get(item.Content, "summary").Bool()
+		if isSummary {
+			llmMsg := ToLLmMessage(item.Content)
+			if llmMsg != nil {
+				messages = []xllm.Message{*llmMsg}
+			}
+			totalTokens = 0
+			continue
+		}
+
+		llmMsg := ToLLmMessage(item.Content)
+		if llmMsg != nil {
+			messages = append(messages, *llmMsg)
+		}
+	}
+
+	// 如果最后一条消息是 summary 消息，则不进行压缩
+	if totalTokens == 0 {
+		return messages, false
+	}
+
+	limit := GetModelMaxTokens(model)
+
+	return messages, totalTokens >= int64(float64(limit)*0.8)
+}
+
+// compressMemory 压缩历史消息并写回存储
+// 压缩历史消息时，使用 compressPrompt 提示词
+func compressMemory(m Memory, convId string, messages []xllm.Message) []xllm.Message {
+	compressMessages := Compress(context.Background(), summarizer(convId), messages)
+
+	// 创建压缩后的 LLM 消息
+	messages = []xllm.Message{
+		{
+			Role:    xllm.RoleAssistant,
+			Content: xllm.NewTextContent(compressMessages),
+		},
+	}
+
+	// 使用新的转换函数创建 agent 消息
+	agentMessages := xagent.ToAgentMessages(messages)
+	m.Insert(convId, agentMessages)
+
+	return messages
+}
@@ -0,0 +1,53 @@
+package xmem
+
+import (
+	"companions/internal/pkg/xagent"
+	"encoding/json"
+	"testing"
+)
+
+func toRecord(t *testing.T, id int64, msg xagent.Message) record {
+	t.Helper()
+	content, err := json.Marshal(msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return record{ID: id, MessageID: msg.GetMessageID(), Content: string(content)}
+}
+
+// TestMemoryFromRecordsUsage 按每轮元信息中记录的用量判断是否压缩, 未配置模型时窗口为 100000
+func TestMemoryFromRecordsUsage(t *testing.T) {
+	turn := func(id int64, total int) []record {
+		meta := map[string]any{"models": map[string]string{"chat": "chat"}}
+		if total > 0 {
+			meta["usage"] = map[string]int{"total_tokens": total}
+		}
+		return []record{
+			toRecord(t, id, xagent.NewMessage().Role(xagent.MessageRoleUser).ID("t").Content("hi").Build()),
+			toRecord(t, id+1, xagent.NewMessage().Role(xagent.MessageRoleAssistant).ID("t").Content("hey").Build()),
+			toRecord(t, id+2, xagent.NewMetaMessage("t", meta)),
+		}
+	}
+	summary := record{ID: 100, Content: `{"role":"assistant","content":"摘要","summary":true}`}
+
+	tests := []struct {
+		name    string
+		records []record
+		want    bool
+	}{
+		{"no usage", turn(1, 0), false},
+		{"below limit", turn(1, 1000), false},
+		{"above limit", turn(1, 90000), true},
+		{"latest turn counts", append(turn(1, 90000), turn(4, 1000)...), false},
+		{"summary resets", append(turn(1, 90000), summary), false},
+	}
+	for _, tt := range tests {
+		messages, needCompress := memoryFromRecords(tt.records)
+		if needCompress != tt.want {
+			t.Errorf("%s: needCompress = %v, want %v", tt.name, needCompress, tt.want)
+		}
+		if len(messages) == 0 {
+			t.Errorf("%s: messages is empty", tt.name)
+		}
+	}
+}
@@ -0,0 +1,300 @@
+package xmem
+
+import (
+	"companions/internal/pkg/xagent"
+	"companions/internal/pkg/xllm"
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+var _ Memory = (*RedisMemory)(nil)
+
+// RedisMemory 基于 Redis 协议的存储, 适合保存热会话历史
+// 会话信息存储在 hash, 消息存储在 list, 用户会话列表存储在 zset (按活跃时间排序)
+// ttl > 0 时每次写入刷新过期时间, 长期不活跃的会话自动淘汰
+type RedisMemory struct {
+	client *redis.Client
+	prefix string
+	ttl    time.Duration
+}
+
+type RedisMemoryOption func(*RedisMemory)
+
+func WithRedisPrefix(prefix string) RedisMemoryOption {
+	return func(m *RedisMemory) {
+		if prefix != "" {
+			m.prefix = prefix
+		}
+	}
+}
+
+func WithRedisTTL(ttl time.Duration) RedisMemoryOption {
+	return func(m *RedisMemory) {
+		m.ttl = ttl
+	}
+}
+
+func NewRedisMemory(client *redis.Client, opts ...RedisMemoryOption) *RedisMemory {
+	m := &RedisMemory{
+		client: client,
+		prefix: "companion:",
+	}
+	for _, opt := range opts {
+		opt(m)
+	}
+	return m
+}
+
+func (m *RedisMemory) convKey(convId string) string { return m.prefix + "conv:" + convId }
+func (m *RedisMemory) msgsKey(convId string) string { return m.prefix + "msgs:" + convId }
+func (m *RedisMemory) userKey(uid string) string    { return m.prefix + "user:" + uid }
+func (m *RedisMemory) seqKey() string               { return m.prefix + "msg_seq" }
+
+// touch 刷新会话活跃时间和过期时间
+func (m *RedisMemory) touch(ctx context.Context, pipe redis.Pipeliner, convId string, uid string) {
+	now := time.Now()
+	pipe.HSet(ctx, m.convKey(convId), "updated_at", now.Format(time.DateTime))
+	if uid != "" {
+		pipe.ZAdd(ctx, m.userKey(uid), &redis.Z{Score: float64(now.UnixNano()), Member: convId})
+	}
+	if m.ttl > 0 {
+		pipe.Expire(ctx, m.convKey(convId), m.ttl)
+		pipe.Expire(ctx, m.msgsKey(convId), m.ttl)
+	}
+}
+
+// Create 以 created_at 字段占用会话 id, 已删除的会话同样占用, 不会被重新创建
+func (m *RedisMemory) Create(convId string, uid string, title string) error {
+	ctx := context.Background()
+	now := time.Now().Format(time.DateTime)
+	created, err := m.client.HSetNX(ctx, m.convKey(convId), "created_at", now).Result()
+	if err != nil {
+		return err
+	}
+	if !created {
+		return ErrExists
+	}
+	_, err = m.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.HSet(ctx, m.convKey(convId),
+			"uid", uid,
+			"title", title,
+			"deleted", "0",
+		)
+		m.touch(ctx, pipe, convId, uid)
+		return nil
+	})
+	return err
+}
+
+func (m *RedisMemory) Exists(convId string) (bool, error) {
+	createdAt, err := m.client.HGet(context.Background(), m.convKey(convId), "created_at").Result()
+	if err == redis.Nil {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return createdAt != "", nil
+}
+
+func (m *RedisMemory) Find(convId string) (*Conversation, error) {
+	fields, err := m.client.HGetAll(context.Background(), m.convKey(convId)).Result()
+	if err != nil {
+		return nil, err
+	}
+	if len(fields) == 0 || fields["deleted"] == "1" || fields["created_at"] == "" {
+		return nil, ErrNotFound
+	}
+	return &Conversation{
+		Id:        convId,
+		Uid:       fields["uid"],
+		Title:     fields["title"],
+		CreatedAt: fields["created_at"],
+		UpdatedAt: fields["updated_at"],
+	}, nil
+}
+
+func (m *RedisMemory) Get(convId string) (*Conversation, error) {
+	conv, err := m.Find(convId)
+	if err != nil {
+		return nil, err
+	}
+	list, err := m.records(convId)
+	if err != nil {
+		return nil, err
+	}
+	conv.Messages, err = groupRecords(list)
+	if err != nil {
+		return nil, err
+	}
+	return conv, nil
+}
+
+func (m *RedisMemory) List(uid string) ([]*Conversation, error) {
+	ctx := context.Background()
+	ids, err := m.client.ZRevRange(ctx, m.userKey(uid), 0, -1).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	convs := make([]*Conversation, 0, len(ids))
+	for _, id := range ids {
+		conv, err := m.Find(id)
+		if err == ErrNotFound {
+			// 已删除或已过期的会话从列表中移除
+			m.client.ZRem(ctx, m.userKey(uid), id)
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		convs = append(convs, conv)
+	}
+	return convs, nil
+}
+
+func (m *RedisMemory) Rename(convId string, title string) error {
+	conv, err := m.Find(convId)
+	if err != nil {
+		return err
+	}
+	ctx := context.Background()
+	_, err = m.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.HSet(ctx, m.convKey(convId), "title", title)
+		m.touch(ctx, pipe, convId, conv.Uid)
+		return nil
+	})
+	return err
+}
+
+func (m *RedisMemory) Delete(convId string) error {
+	conv, err := m.Find(convId)
+	if err != nil {
+		return err
+	}
+	ctx := context.Background()
+	_, err = m.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.HSet(ctx, m.convKey(convId), "deleted", "1")
+		pipe.ZRem(ctx, m.userKey(conv.Uid), convId)
+		return nil
+	})
+	return err
+}
+
+func (m *RedisMemory) Insert(convId string, value []xagent.Message) error {
+	records := newRecords(value)
+	if len(records) == 0 {
+		return nil
+	}
+
+	ctx := context.Background()
+	lastId, err := m.client.IncrBy(ctx, m.seqKey(), int64(len(records))).Result()
+	if err != nil {
+		return err
+	}
+
+	values := make([]any, 0, len(records))
+	for i, item := range records {
+		item.ID = lastId - int64(len(records)-1-i)
+		data, err := json.Marshal(item)
+		if err != nil {
+			return err
+		}
+		values = append(values, data)
+	}
+
+	uid, _ := m.client.HGet(ctx, m.convKey(convId), "uid").Result()
+	_, err = m.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.RPush(ctx, m.msgsKey(convId), values...)
+		m.touch(ctx, pipe, convId, uid)
+		return nil
+	})
+	return err
+}
+
+func (m *RedisMemory) records(convId string) ([]record, error) {
+	list, err := m.client.LRange(context.Background(), m.msgsKey(convId), 0, -1).Result()
+	if err != nil {
+		return nil, err
+	}
+	records := make([]record, 0, len(list))
+	for _, item := range list {
+		var r record
+		if err := json.Unmarshal([]byte(item), &r); err != nil {
+			return nil, err
+		}
+		records = append(records, r)
+	}
+	return records, nil
+}
+
+func (m *RedisMemory) GetMemory(convId string) ([]xllm.Message, error) {
+	list, err := m.records(convId)
+	if err != nil {
+		return nil, err
+	}
+	messages, needCompress := memoryFromRecords(list)
+	if needCompress {
+		messages = compressMemory(m, convId, messages)
+	}
+	return messages, nil
+}
+
+func (m *RedisMemory) Messages(convId string, cursor int64, limit int) ([]map[string]any, int64, error) {
+	list, err := m.records(convId)
+	if err != nil {
+		return nil, 0, err
+	}
+	return pageRecords(list, cursor, limit)
+}
+
+func (m *RedisMemory) Turn(convId string, messageId string) (*Turn, error) {
+	all, err := m.records(convId)
+	if err != nil {
+		return nil, err
+	}
+	var list []record
+	for _, item := range all {
+		if item.MessageID == messageId {
+			list = append(list, item)
+		}
+	}
+	return turnFromRecords(messageId, list)
+}
+
+// DeleteTurn 永久删除一轮对话, 没有匹配的消息时返回 ErrNotFound
+func (m *RedisMemory) DeleteTurn(convId string, messageId string) error {
+	ctx := context.Background()
+	// 乐观锁: 期间列表被修改时返回 redis.TxFailedErr
+	return m.client.Watch(ctx, func(tx *redis.Tx) error {
+		list, err := tx.LRange(ctx, m.msgsKey(convId), 0, -1).Result()
+		if err != nil {
+			return err
+		}
+		var kept []any
+		for _, item := range list {
+			var r record
+			if err := json.Unmarshal([]byte(item), &r); err == nil && r.MessageID == messageId {
+				continue
+			}
+			kept = append(kept, item)
+		}
+		if len(kept) == len(list) {
+			return ErrNotFound
+		}
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.Del(ctx, m.msgsKey(convId))
+			if len(kept) > 0 {
+				pipe.RPush(ctx, m.msgsKey(convId), kept...)
+			}
+			if m.ttl > 0 {
+				pipe.Expire(ctx, m.msgsKey(convId), m.ttl)
+			}
+			return nil
+		})
+		return err
+	}, m.msgsKey(convId))
+}
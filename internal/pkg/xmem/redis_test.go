@@ -0,0 +1,48 @@
+package xmem
+
+import (
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+)
+
+func newTestRedisMemory(t *testing.T, opts ...RedisMemoryOption) (*RedisMemory, *miniredis.Miniredis) {
+	mr, err := miniredis.Run()
+	if err != nil {
+		t.Fatalf("miniredis.Run() error = %v", err)
+	}
+	t.Cleanup(mr.Close)
+
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { client.Close() })
+
+	return NewRedisMemory(client, opts...), mr
+}
+
+func TestRedisMemory(t *testing.T) {
+	m, _ := newTestRedisMemory(t)
+	testMemory(t, m)
+}
+
+func TestRedisMemory_TTL(t *testing.T) {
+	m, mr := newTestRedisMemory(t, WithRedisTTL(time.Minute))
+
+	if err := m.Create("c1", "u1", "hot"); err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	if _, err := m.Find("c1"); err != nil {
+		t.Fatalf("Find() error = %v", err)
+	}
+
+	mr.FastForward(2 * time.Minute)
+
+	if _, err := m.Find("c1"); err != ErrNotFound {
+		t.Errorf("Find() after ttl error = %v, want ErrNotFound", err)
+	}
+	list, err := m.List("u1")
+	if err != nil || len(list) != 0 {
+		t.Errorf("List() after ttl = %v, %v", list, err)
+	}
+}
@@ -0,0 +1,33 @@
+package xmem
+
+import (
+	"context"
+	"strings"
+
+	"companions/internal/pkg/xllm"
+)
+
+var titlePrompt = `
+Generate a short title for the conversation above.
+The title should be no more than 8 words (or 15 characters for Chinese), in the same language the user speaks,
+without quotes or trailing punctuation. Reply with the title only.
+`
+
+// GenTitle 使用 llm 根据对话内容生成会话标题, 超时由 ctx 控制
+func GenTitle(ctx context.Context, llm xllm.LLM, messages []xllm.Message) (string, error) {
+	response, err := llm.Chat(ctx, xllm.Request{
+		Messages: append(messages, xllm.Message{
+			Role:    xllm.RoleUser,
+			Content: xllm.NewTextContent(titlePrompt),
+		}),
+	})
+	if err != nil {
+		return "", err
+	}
+	title := strings.TrimSpace(response.Content)
+	title = strings.Trim(title, "\"'“”《》")
+	if runes := []rune(title); len(runes) > 50 {
+		title = string(runes[:50])
+	}
+	return title, nil
+}
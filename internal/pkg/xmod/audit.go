@@ -0,0 +1,84 @@
+package xmod
+
+import (
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/daodao97/xgo/xdb"
+)
+
+// Audit 审核记录
+type Audit struct {
+	UID            string    `json:"uid"`
+	ConversationID string    `json:"conversation_id"`
+	MessageID      string    `json:"message_id"`
+	Character      string    `json:"character"`
+	Stage          string    `json:"stage"`
+	Provider       string    `json:"provider"`
+	Categories     []string  `json:"categories"`
+	Action         Action    `json:"action"`
+	Text           string    `json:"text"`
+	CreatedAt      time.Time `json:"created_at"`
+}
+
+// AuditStore 审核记录存储
+type AuditStore interface {
+	Insert(audit Audit) error
+}
+
+var _ AuditStore = (*DBAuditStore)(nil)
+
+// DBAuditStore 基于 xdb 的审核记录存储, 对应 companion_moderation 表
+type DBAuditStore struct {
+	model xdb.Model
+}
+
+func NewDBAuditStore(model xdb.Model) *DBAuditStore {
+	return &DBAuditStore{model: model}
+}
+
+func (s *DBAuditStore) Insert(audit Audit) error {
+	categories, err := json.Marshal(audit.Categories)
+	if err != nil {
+		return err
+	}
+	_, err = s.model.Insert(xdb.Record{
+		"uid":             audit.UID,
+		"conversation_id": audit.ConversationID,
+		"message_id":      audit.MessageID,
+		"character_name":  audit.Character,
+		"stage":           audit.Stage,
+		"provider":        audit.Provider,
+		"categories":      string(categories),
+		"action":          string(audit.Action),
+		"text":            audit.Text,
+		"created_at":      audit.CreatedAt,
+	})
+	return err
+}
+
+var _ AuditStore = (*InMemoryAuditStore)(nil)
+
+// InMemoryAuditStore 进程内审核记录, 用于测试
+type InMemoryAuditStore struct {
+	mu     sync.RWMutex
+	audits []Audit
+}
+
+func NewInMemoryAuditStore() *InMemoryAuditStore {
+	return &InMemoryAuditStore{}
+}
+
+func (s *InMemoryAuditStore) Insert(audit Audit) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.audits = append(s.audits, audit)
+	return nil
+}
+
+func (s *InMemoryAuditStore) Audits() []Audit {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return append([]Audit(nil), s.audits...)
+}
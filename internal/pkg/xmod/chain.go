@@ -0,0 +1,62 @@
+package xmod
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strings"
+
+	"github.com/daodao97/xgo/xlog"
+)
+
+var _ Classifier = (*Chain)(nil)
+
+// Chain 依次调用多个分类器并合并结果, 单个分类器失败时跳过, 全部失败才返回错误
+type Chain struct {
+	classifiers []Classifier
+}
+
+func NewChain(classifiers ...Classifier) *Chain {
+	return &Chain{classifiers: classifiers}
+}
+
+func (c *Chain) Classify(ctx context.Context, text string) (*Result, error) {
+	merged := &Result{}
+	var (
+		providers []string
+		errs      []error
+	)
+	for _, classifier := range c.classifiers {
+		result, err := classifier.Classify(ctx, text)
+		if err != nil {
+			xlog.WarnC(ctx, "内容分类器调用失败", xlog.Err(err))
+			errs = append(errs, err)
+			continue
+		}
+		if !result.Flagged() {
+			continue
+		}
+
+		providers = append(providers, result.Provider)
+		for _, category := range result.Categories {
+			if !slices.Contains(merged.Categories, category) {
+				merged.Categories = append(merged.Categories, category)
+			}
+		}
+		for category, score := range result.Scores {
+			if merged.Scores == nil {
+				merged.Scores = map[string]float64{}
+			}
+			merged.Scores[category] = max(merged.Scores[category], score)
+		}
+		if merged.Rewritten == "" {
+			merged.Rewritten = result.Rewritten
+		}
+	}
+
+	if len(errs) > 0 && len(errs) == len(c.classifiers) {
+		return nil, errors.Join(errs...)
+	}
+	merged.Provider = strings.Join(providers, ",")
+	return merged, nil
+}
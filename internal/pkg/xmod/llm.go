@@ -0,0 +1,50 @@
+package xmod
+
+import (
+	"companions/internal/pkg/xllm"
+	"context"
+	"slices"
+	"strings"
+)
+
+var _ Classifier = (*LLMClassifier)(nil)
+
+// LLMClassifier 使用对话模型判断内容类别, 适合没有专用审核接口的部署
+type LLMClassifier struct {
+	llm xllm.LLM
+}
+
+func NewLLMClassifier(llm xllm.LLM) *LLMClassifier {
+	return &LLMClassifier{llm: llm}
+}
+
+// verdict LLM 分类器的结构化输出
+type verdict struct {
+	Categories []string `json:"categories" description:"violated categories, empty if the content is safe"`
+}
+
+func (l *LLMClassifier) Classify(ctx context.Context, text string) (*Result, error) {
+	v, _, err := xllm.Structured[verdict](ctx, l.llm, xllm.Request{
+		Messages: []xllm.Message{
+			{Role: xllm.RoleSystem, Content: xllm.NewTextContent(classifierPrompt())},
+			{Role: xllm.RoleUser, Content: xllm.NewTextContent(text)},
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	result := &Result{Provider: "llm"}
+	for _, category := range v.Categories {
+		if slices.Contains(Categories, category) && !slices.Contains(result.Categories, category) {
+			result.Categories = append(result.Categories, category)
+		}
+	}
+	return result, nil
+}
+
+func classifierPrompt() string {
+	return "You are a content moderation classifier for a companion chat app. " +
+		"Classify the user's text into zero or more of these categories: " + strings.Join(Categories, ", ") + ". " +
+		"Only flag content that clearly violates a category. Respond with JSON."
+}
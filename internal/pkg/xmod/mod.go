@@ -0,0 +1,219 @@
+package xmod
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/daodao97/xgo/xlog"
+)
+
+// 审核类别, 与 OpenAI moderation 的类别对齐, 规则和 LLM 分类器也使用这些名称
+const (
+	CategorySexual       = "sexual"
+	CategorySexualMinors = "sexual/minors"
+	CategoryHarassment   = "harassment"
+	CategoryHate         = "hate"
+	CategoryViolence     = "violence"
+	CategorySelfHarm     = "self-harm"
+	CategoryIllicit      = "illicit"
+)
+
+// Categories 全部审核类别
+var Categories = []string{
+	CategorySexual,
+	CategorySexualMinors,
+	CategoryHarassment,
+	CategoryHate,
+	CategoryViolence,
+	CategorySelfHarm,
+	CategoryIllicit,
+}
+
+// 审核阶段
+const (
+	StageInput  = "input"  // 用户消息
+	StageOutput = "output" // 模型回复
+)
+
+// Action 命中类别后的处理方式, 按严重程度排序
+type Action string
+
+const (
+	ActionAllow   Action = "allow"
+	ActionWarn    Action = "warn"    // 放行并提示客户端
+	ActionRewrite Action = "rewrite" // 屏蔽命中的内容后放行
+	ActionBlock   Action = "block"   // 拦截
+)
+
+func (a Action) severity() int {
+	switch a {
+	case ActionWarn:
+		return 1
+	case ActionRewrite:
+		return 2
+	case ActionBlock:
+		return 3
+	}
+	return 0
+}
+
+// Result 分类结果
+type Result struct {
+	Categories []string           `json:"categories"`          // 命中的类别
+	Scores     map[string]float64 `json:"scores,omitempty"`    // 各类别的分数, 只有 openai 返回
+	Rewritten  string             `json:"rewritten,omitempty"` // 屏蔽命中片段后的文本, 只有规则分类器返回
+	Provider   string             `json:"provider"`
+}
+
+func (r *Result) Flagged() bool {
+	return r != nil && len(r.Categories) > 0
+}
+
+// Classifier 内容分类器
+type Classifier interface {
+	Classify(ctx context.Context, text string) (*Result, error)
+}
+
+// Subject 年龄分级, 成人类别只在用户通过年龄验证且角色允许成人内容时放行
+type Subject struct {
+	AdultUser      bool
+	AdultCharacter bool
+}
+
+// Policy 各类别的处理方式
+type Policy struct {
+	Actions     map[string]Action // 类别 -> 处理方式
+	Default     Action            // 未配置的类别, 默认 block
+	Mature      []string          // 成人类别, 满足年龄分级时不处理
+	RewriteText string            // 无法局部屏蔽时替换整段内容使用的文本
+}
+
+// Decide 返回命中类别中最严重的处理方式
+func (p Policy) Decide(result *Result, subject Subject) Action {
+	action := ActionAllow
+	if !result.Flagged() {
+		return action
+	}
+	for _, category := range result.Categories {
+		if slices.Contains(p.Mature, category) && subject.AdultUser && subject.AdultCharacter {
+			continue
+		}
+		categoryAction, ok := p.Actions[category]
+		if !ok {
+			categoryAction = p.Default
+		}
+		if categoryAction == "" {
+			categoryAction = ActionBlock
+		}
+		if categoryAction.severity() > action.severity() {
+			action = categoryAction
+		}
+	}
+	return action
+}
+
+// Decision 审核结论, Text 为处理后的文本
+type Decision struct {
+	Action     Action   `json:"action"`
+	Categories []string `json:"categories"`
+	Text       string   `json:"-"`
+}
+
+// Target 审核记录中的归属信息
+type Target struct {
+	UID            string
+	ConversationID string
+	MessageID      string
+	Character      string
+	Stage          string
+}
+
+type ModeratorOption func(*Moderator)
+
+// WithAuditStore 命中类别时写入审核记录
+func WithAuditStore(store AuditStore) ModeratorOption {
+	return func(m *Moderator) {
+		m.store = store
+	}
+}
+
+// Moderator 按策略审核用户消息和模型回复
+type Moderator struct {
+	classifier Classifier
+	policy     Policy
+	store      AuditStore
+}
+
+func NewModerator(classifier Classifier, policy Policy, opts ...ModeratorOption) *Moderator {
+	if policy.RewriteText == "" {
+		policy.RewriteText = "[内容已屏蔽]"
+	}
+	m := &Moderator{
+		classifier: classifier,
+		policy:     policy,
+	}
+	for _, opt := range opts {
+		opt(m)
+	}
+	return m
+}
+
+// Check 分类并按策略处理文本, 分类失败时放行, 避免审核服务故障导致无法对话
+func (m *Moderator) Check(ctx context.Context, text string, subject Subject, target Target) *Decision {
+	decision := &Decision{Action: ActionAllow, Text: text}
+	if m == nil || strings.TrimSpace(text) == "" {
+		return decision
+	}
+
+	result, err := m.classifier.Classify(ctx, text)
+	if err != nil {
+		xlog.ErrorC(ctx, "内容审核失败", xlog.String("stage", target.Stage), xlog.Err(err))
+		return decision
+	}
+	if !result.Flagged() {
+		return decision
+	}
+
+	decision.Action = m.policy.Decide(result, subject)
+	decision.Categories = result.Categories
+	switch decision.Action {
+	case ActionRewrite:
+		decision.Text = result.Rewritten
+		if decision.Text == "" || decision.Text == text {
+			decision.Text = m.policy.RewriteText
+		}
+	case ActionBlock:
+		decision.Text = ""
+	}
+
+	xlog.WarnC(ctx, "内容审核命中",
+		xlog.String("stage", target.Stage),
+		xlog.String("uid", target.UID),
+		xlog.Any("categories", result.Categories),
+		xlog.String("action", string(decision.Action)),
+	)
+	m.audit(ctx, text, result, decision, target)
+	return decision
+}
+
+func (m *Moderator) audit(ctx context.Context, text string, result *Result, decision *Decision, target Target) {
+	if m.store == nil {
+		return
+	}
+	if err := m.store.Insert(Audit{
+		UID:            target.UID,
+		ConversationID: target.ConversationID,
+		MessageID:      target.MessageID,
+		Character:      target.Character,
+		Stage:          target.Stage,
+		Provider:       result.Provider,
+		Categories:     result.Categories,
+		Action:         decision.Action,
+		Text:           text,
+		CreatedAt:      time.Now(),
+	}); err != nil {
+		xlog.ErrorC(ctx, "写入审核记录失败", xlog.Err(err))
+	}
+}
@@ -0,0 +1,153 @@
+package xmod
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+)
+
+type stubClassifier struct {
+	result *Result
+	err    error
+}
+
+func (s stubClassifier) Classify(ctx context.Context, text string) (*Result, error) {
+	return s.result, s.err
+}
+
+func TestRules(t *testing.T) {
+	rules, err := NewRules([]Rule{
+		{Category: CategoryIllicit, Patterns: []string{"代开发票", `(?i)buy\s+drugs`}},
+		{Category: CategoryHarassment, Patterns: []string{"笨蛋"}},
+	})
+	if err != nil {
+		t.Fatalf("NewRules 失败: %v", err)
+	}
+
+	result, _ := rules.Classify(context.Background(), "你这个笨蛋, 要不要 BUY drugs")
+	if !slices.Equal(result.Categories, []string{CategoryIllicit, CategoryHarassment}) {
+		t.Errorf("Categories = %v", result.Categories)
+	}
+	if result.Rewritten != "你这个**, 要不要 *********" {
+		t.Errorf("Rewritten = %q", result.Rewritten)
+	}
+
+	result, _ = rules.Classify(context.Background(), "今天天气不错")
+	if result.Flagged() || result.Rewritten != "" {
+		t.Errorf("result = %+v", result)
+	}
+
+	if _, err := NewRules([]Rule{{Category: CategoryHate, Patterns: []string{"("}}}); err == nil {
+		t.Error("非法表达式应返回错误")
+	}
+}
+
+func TestPolicyDecide(t *testing.T) {
+	policy := Policy{
+		Actions: map[string]Action{
+			CategoryHarassment: ActionRewrite,
+			CategoryViolence:   ActionWarn,
+			CategorySexual:     ActionBlock,
+		},
+		Mature: []string{CategorySexual},
+	}
+	adult := Subject{AdultUser: true, AdultCharacter: true}
+
+	tests := []struct {
+		categories []string
+		subject    Subject
+		want       Action
+	}{
+		{nil, Subject{}, ActionAllow},
+		{[]string{CategoryViolence}, Subject{}, ActionWarn},
+		{[]string{CategoryViolence, CategoryHarassment}, Subject{}, ActionRewrite},
+		{[]string{CategoryHate}, Subject{}, ActionBlock}, // 未配置的类别默认拦截
+		{[]string{CategorySexual}, Subject{}, ActionBlock},
+		{[]string{CategorySexual}, Subject{AdultUser: true}, ActionBlock},
+		{[]string{CategorySexual}, adult, ActionAllow},
+		{[]string{CategorySexual, CategoryViolence}, adult, ActionWarn},
+		{[]string{CategorySexualMinors}, adult, ActionBlock},
+	}
+	for _, tt := range tests {
+		got := policy.Decide(&Result{Categories: tt.categories}, tt.subject)
+		if got != tt.want {
+			t.Errorf("Decide(%v, %+v) = %s, want %s", tt.categories, tt.subject, got, tt.want)
+		}
+	}
+
+	policy.Default = ActionWarn
+	if got := policy.Decide(&Result{Categories: []string{CategoryHate}}, Subject{}); got != ActionWarn {
+		t.Errorf("Default = %s", got)
+	}
+}
+
+func TestChain(t *testing.T) {
+	ctx := context.Background()
+	failed := stubClassifier{err: errors.New("timeout")}
+
+	chain := NewChain(
+		failed,
+		stubClassifier{result: &Result{Provider: "rules", Categories: []string{CategoryHate}, Rewritten: "**"}},
+		stubClassifier{result: &Result{Provider: "openai", Categories: []string{CategoryHate, CategoryViolence}, Scores: map[string]float64{CategoryHate: 0.9}}},
+		stubClassifier{result: &Result{Provider: "llm"}},
+	)
+	result, err := chain.Classify(ctx, "text")
+	if err != nil {
+		t.Fatalf("Classify 失败: %v", err)
+	}
+	if !slices.Equal(result.Categories, []string{CategoryHate, CategoryViolence}) || result.Provider != "rules,openai" ||
+		result.Rewritten != "**" || result.Scores[CategoryHate] != 0.9 {
+		t.Errorf("result = %+v", result)
+	}
+
+	if _, err := NewChain(failed, failed).Classify(ctx, "text"); err == nil {
+		t.Error("全部分类器失败时应返回错误")
+	}
+}
+
+func TestModeratorCheck(t *testing.T) {
+	ctx := context.Background()
+	rules, _ := NewRules([]Rule{
+		{Category: CategoryHarassment, Patterns: []string{"笨蛋"}},
+		{Category: CategoryHate, Patterns: []string{"仇恨"}},
+	})
+	store := NewInMemoryAuditStore()
+	moderator := NewModerator(rules, Policy{
+		Actions: map[string]Action{CategoryHarassment: ActionRewrite},
+	}, WithAuditStore(store))
+	target := Target{UID: "1", ConversationID: "c1", Stage: StageInput}
+
+	decision := moderator.Check(ctx, "你好", Subject{}, target)
+	if decision.Action != ActionAllow || decision.Text != "你好" {
+		t.Errorf("allow decision = %+v", decision)
+	}
+
+	decision = moderator.Check(ctx, "你是笨蛋", Subject{}, target)
+	if decision.Action != ActionRewrite || decision.Text != "你是**" {
+		t.Errorf("rewrite decision = %+v", decision)
+	}
+
+	decision = moderator.Check(ctx, "仇恨言论", Subject{}, target)
+	if decision.Action != ActionBlock || decision.Text != "" || !slices.Equal(decision.Categories, []string{CategoryHate}) {
+		t.Errorf("block decision = %+v", decision)
+	}
+
+	audits := store.Audits()
+	if len(audits) != 2 {
+		t.Fatalf("audits = %d, want 2", len(audits))
+	}
+	if audits[1].UID != "1" || audits[1].Action != ActionBlock || audits[1].Text != "仇恨言论" || audits[1].Provider != "rules" {
+		t.Errorf("audit = %+v", audits[1])
+	}
+
+	// 未启用审核和审核服务故障时放行
+	var disabled *Moderator
+	if decision := disabled.Check(ctx, "仇恨言论", Subject{}, target); decision.Action != ActionAllow {
+		t.Errorf("nil moderator decision = %+v", decision)
+	}
+	failing := NewModerator(stubClassifier{err: errors.New("timeout")}, Policy{})
+	if decision := failing.Check(ctx, "仇恨言论", Subject{}, target); decision.Action != ActionAllow || decision.Text != "仇恨言论" {
+		t.Errorf("failing decision = %+v", decision)
+	}
+}
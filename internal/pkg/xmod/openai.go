@@ -0,0 +1,104 @@
+package xmod
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/daodao97/xgo/xrequest"
+)
+
+var _ Classifier = (*OpenAI)(nil)
+
+// OpenAI 调用 OpenAI moderation 接口
+type OpenAI struct {
+	APIKey string
+	APIUrl string
+	Model  string
+}
+
+type OpenAIOption func(*OpenAI)
+
+func WithAPIKey(apiKey string) OpenAIOption {
+	return func(o *OpenAI) {
+		o.APIKey = apiKey
+	}
+}
+
+func WithAPIUrl(apiUrl string) OpenAIOption {
+	return func(o *OpenAI) {
+		o.APIUrl = apiUrl
+	}
+}
+
+func WithModel(model string) OpenAIOption {
+	return func(o *OpenAI) {
+		o.Model = model
+	}
+}
+
+func NewOpenAI(opts ...OpenAIOption) *OpenAI {
+	openai := &OpenAI{
+		APIUrl: "https://api.openai.com/v1",
+		Model:  "omni-moderation-latest",
+	}
+	for _, opt := range opts {
+		opt(openai)
+	}
+	return openai
+}
+
+func (o *OpenAI) Classify(ctx context.Context, text string) (*Result, error) {
+	if o.APIKey == "" {
+		return nil, errors.New("API key is required")
+	}
+
+	response, err := xrequest.New().
+		SetDebug(false).
+		SetHeader("Authorization", "Bearer "+o.APIKey).
+		SetBody(map[string]any{
+			"model": o.Model,
+			"input": text,
+		}).
+		Post(strings.TrimSuffix(o.APIUrl, "/") + "/moderations")
+	if err != nil {
+		return nil, fmt.Errorf("request failed: %v", err)
+	}
+	if err := response.Error(); err != nil {
+		return nil, fmt.Errorf("request error: %v", err)
+	}
+
+	body := response.Json()
+	if errMsg := body.Get("error.message"); errMsg.Exists() {
+		return nil, fmt.Errorf("OpenAI API error: %s", errMsg.String())
+	}
+
+	result := &Result{Provider: "openai", Scores: map[string]float64{}}
+	moderation := body.Get("results.0")
+	for name, flagged := range moderation.Get("categories").Map() {
+		category := normalizeCategory(name)
+		score := moderation.Get("category_scores").Get(escapeKey(name)).Float()
+		result.Scores[category] = max(result.Scores[category], score)
+		if flagged.Bool() && !slices.Contains(result.Categories, category) {
+			result.Categories = append(result.Categories, category)
+		}
+	}
+	slices.Sort(result.Categories)
+	return result, nil
+}
+
+// normalizeCategory 子类别归并到主类别, 如 self-harm/intent -> self-harm; sexual/minors 单独处理
+func normalizeCategory(name string) string {
+	if name == CategorySexualMinors {
+		return name
+	}
+	category, _, _ := strings.Cut(name, "/")
+	return category
+}
+
+// escapeKey gjson 路径中的 / 和 - 不需要转义, 但 . 需要
+func escapeKey(key string) string {
+	return strings.ReplaceAll(key, ".", `\.`)
+}
@@ -0,0 +1,65 @@
+package xmod
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+	"unicode/utf8"
+)
+
+var _ Classifier = (*Rules)(nil)
+
+// Rule 本地规则, Patterns 为正则表达式, 普通关键词直接填写即可
+type Rule struct {
+	Category string
+	Patterns []string
+}
+
+// Rules 关键词/正则分类器, 命中的片段在 Rewritten 中替换为 *
+type Rules struct {
+	rules []compiledRule
+}
+
+type compiledRule struct {
+	category string
+	patterns []*regexp.Regexp
+}
+
+func NewRules(rules []Rule) (*Rules, error) {
+	r := &Rules{}
+	for _, rule := range rules {
+		compiled := compiledRule{category: rule.Category}
+		for _, pattern := range rule.Patterns {
+			re, err := regexp.Compile(pattern)
+			if err != nil {
+				return nil, fmt.Errorf("审核规则 %s 的表达式 %q 不合法: %w", rule.Category, pattern, err)
+			}
+			compiled.patterns = append(compiled.patterns, re)
+		}
+		r.rules = append(r.rules, compiled)
+	}
+	return r, nil
+}
+
+func (r *Rules) Classify(ctx context.Context, text string) (*Result, error) {
+	result := &Result{Provider: "rules", Rewritten: text}
+	for _, rule := range r.rules {
+		for _, re := range rule.patterns {
+			if !re.MatchString(text) {
+				continue
+			}
+			if !slices.Contains(result.Categories, rule.category) {
+				result.Categories = append(result.Categories, rule.category)
+			}
+			result.Rewritten = re.ReplaceAllStringFunc(result.Rewritten, func(match string) string {
+				return strings.Repeat("*", utf8.RuneCountInString(match))
+			})
+		}
+	}
+	if !result.Flagged() {
+		result.Rewritten = ""
+	}
+	return result, nil
+}
@@ -0,0 +1,103 @@
+package xmod
+
+import (
+	"context"
+	"strings"
+	"unicode/utf8"
+)
+
+// sentenceEnds 流式审核的断句标点, 每句结束时审核一次
+const sentenceEnds = "。！？!?.\n"
+
+// Stream 审核流式输出的文本: 按句累计, 每句结束时审核截至该句的全部内容, 通过后才放行
+// Moderator 为空时增量原样放行
+type Stream struct {
+	m       *Moderator
+	ctx     context.Context
+	subject Subject
+	target  Target
+
+	text    string // 累计的文本, 局部屏蔽后为屏蔽后的文本
+	sent    int    // 已放行的字节数
+	action  Action // 已命中的最严重的处理方式
+	stopped bool   // 拦截或整段替换后不再放行
+}
+
+// Stream 创建流式审核, 每段回复使用一个
+func (m *Moderator) Stream(ctx context.Context, subject Subject, target Target) *Stream {
+	return &Stream{m: m, ctx: ctx, subject: subject, target: target, action: ActionAllow}
+}
+
+// Write 追加一段增量, 返回可以发送的文本
+// decision 不为空时需要通知客户端: warn 只在首次命中时返回;
+// block 和整段替换的 rewrite 表示之前放行的文本作废, 返回的文本为替换后的完整内容, 之后不再放行
+func (s *Stream) Write(delta string) (string, *Decision) {
+	if s.stopped || delta == "" {
+		return "", nil
+	}
+	s.text += delta
+	if s.m == nil {
+		s.sent = len(s.text)
+		return delta, nil
+	}
+	i := strings.LastIndexAny(s.text[s.sent:], sentenceEnds)
+	if i < 0 {
+		return "", nil
+	}
+	_, size := utf8.DecodeRuneInString(s.text[s.sent+i:])
+	return s.check(s.sent + i + size)
+}
+
+// Close 输出结束, 审核并放行剩余的文本
+func (s *Stream) Close() (string, *Decision) {
+	if s.stopped || s.sent == len(s.text) {
+		return "", nil
+	}
+	return s.check(len(s.text))
+}
+
+// Text 放行的全部文本, 拦截时为空
+func (s *Stream) Text() string {
+	return s.text[:s.sent]
+}
+
+// Action 本段回复命中的最严重的处理方式
+func (s *Stream) Action() Action {
+	return s.action
+}
+
+// check 审核 text[:end], 通过时放行 sent 到 end 之间的文本
+func (s *Stream) check(end int) (string, *Decision) {
+	decision := s.m.Check(s.ctx, s.text[:end], s.subject, s.target)
+	first := decision.Action != ActionAllow && decision.Action.severity() > s.action.severity()
+	if first {
+		s.action = decision.Action
+	}
+
+	switch decision.Action {
+	case ActionBlock:
+		s.text, s.sent, s.stopped = "", 0, true
+		return "", decision
+	case ActionRewrite:
+		// 局部屏蔽且已放行的部分不变时继续输出, 之后在屏蔽后的文本上审核, 同一片段不会重复命中
+		if decision.Text != s.m.policy.RewriteText && strings.HasPrefix(decision.Text, s.text[:s.sent]) {
+			s.text = decision.Text + s.text[end:]
+			end = len(decision.Text)
+			break
+		}
+		// 整段替换, 之前没有放行过文本时与整段审核一致, 不需要通知客户端
+		replaced := s.sent > 0
+		s.text, s.sent, s.stopped = decision.Text, len(decision.Text), true
+		if !replaced {
+			return decision.Text, nil
+		}
+		return decision.Text, decision
+	}
+
+	chunk := s.text[s.sent:end]
+	s.sent = end
+	if decision.Action == ActionWarn && first {
+		return chunk, decision
+	}
+	return chunk, nil
+}
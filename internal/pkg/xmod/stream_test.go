@@ -0,0 +1,101 @@
+package xmod
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+// feed 逐段写入并收集放行的文本和通知客户端的处理方式
+func feed(s *Stream, deltas ...string) (string, []Action) {
+	var out strings.Builder
+	var actions []Action
+	collect := func(text string, decision *Decision) {
+		if decision != nil {
+			actions = append(actions, decision.Action)
+			if decision.Action != ActionWarn {
+				out.Reset()
+			}
+		}
+		out.WriteString(text)
+	}
+	for _, delta := range deltas {
+		collect(s.Write(delta))
+	}
+	collect(s.Close())
+	return out.String(), actions
+}
+
+func TestStream(t *testing.T) {
+	ctx := context.Background()
+	rules, _ := NewRules([]Rule{
+		{Category: CategoryHarassment, Patterns: []string{"笨蛋"}},
+		{Category: CategoryHate, Patterns: []string{"仇恨"}},
+		{Category: CategorySexual, Patterns: []string{"亲亲"}},
+	})
+	moderator := NewModerator(rules, Policy{
+		Actions: map[string]Action{
+			CategoryHarassment: ActionRewrite,
+			CategorySexual:     ActionWarn,
+		},
+	})
+	target := Target{Stage: StageOutput}
+
+	// 未启用审核时增量原样放行
+	var disabled *Moderator
+	s := disabled.Stream(ctx, Subject{}, target)
+	if text, _ := s.Write("你好"); text != "你好" {
+		t.Errorf("disabled Write() = %q", text)
+	}
+
+	// 句子结束前不放行
+	s = moderator.Stream(ctx, Subject{}, target)
+	if text, _ := s.Write("你好"); text != "" {
+		t.Errorf("Write() before sentence end = %q", text)
+	}
+	if text, _ := s.Write("呀。今天"); text != "你好呀。" {
+		t.Errorf("Write() = %q, want 你好呀。", text)
+	}
+
+	tests := []struct {
+		name    string
+		deltas  []string
+		want    string
+		actions []Action
+	}{
+		{"allow", []string{"你好呀。", "今天", "天气不错"}, "你好呀。今天天气不错", nil},
+		{"partial rewrite", []string{"你好。", "你是笨", "蛋。再见"}, "你好。你是**。再见", nil},
+		{"warn once", []string{"亲亲。", "再亲亲。"}, "亲亲。再亲亲。", []Action{ActionWarn}},
+		{"block after sent", []string{"你好。", "仇恨言论。"}, "", []Action{ActionBlock}},
+	}
+	for _, tt := range tests {
+		s := moderator.Stream(ctx, Subject{}, target)
+		text, actions := feed(s, tt.deltas...)
+		if text != tt.want || s.Text() != tt.want || len(actions) != len(tt.actions) {
+			t.Errorf("%s: text = %q, Text() = %q, actions = %v", tt.name, text, s.Text(), actions)
+			continue
+		}
+		for i := range actions {
+			if actions[i] != tt.actions[i] {
+				t.Errorf("%s: actions = %v, want %v", tt.name, actions, tt.actions)
+			}
+		}
+	}
+
+	// 整段替换: 已放行过文本时通知客户端, 之后不再放行
+	replace := NewModerator(stubClassifier{result: &Result{Categories: []string{CategoryViolence}}}, Policy{Default: ActionRewrite})
+	s = replace.Stream(ctx, Subject{}, target)
+	if text, decision := s.Write("打架。"); text != "[内容已屏蔽]" || decision != nil {
+		t.Errorf("first sentence replaced = %q, %v", text, decision)
+	}
+	if text, _ := s.Write("继续。"); text != "" || s.Text() != "[内容已屏蔽]" || s.Action() != ActionRewrite {
+		t.Errorf("after replace = %q, Text() = %q", text, s.Text())
+	}
+
+	s = moderator.Stream(ctx, Subject{}, target)
+	s.Write("你好。")
+	s.m = replace
+	if text, decision := s.Write("打架。"); text != "[内容已屏蔽]" || decision == nil || decision.Action != ActionRewrite {
+		t.Errorf("replace after sent = %q, %v", text, decision)
+	}
+}
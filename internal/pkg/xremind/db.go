@@ -0,0 +1,157 @@
+package xremind
+
+import (
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/daodao97/xgo/xdb"
+)
+
+var _ Store = (*DBStore)(nil)
+
+// DBStore 基于 xdb 的提醒存储, 对应 companion_reminder 表
+type DBStore struct {
+	model xdb.Model
+}
+
+func NewDBStore(model xdb.Model) *DBStore {
+	return &DBStore{model: model}
+}
+
+func (s *DBStore) Create(r *Reminder) error {
+	id, err := s.model.Insert(xdb.Record{
+		"uid":             r.UID,
+		"character_name":  r.Character,
+		"conversation_id": r.ConversationID,
+		"kind":            r.Kind,
+		"name":            r.Name,
+		"content":         r.Content,
+		"timezone":        r.Timezone,
+		"status":          r.Status,
+		"due_at":          r.DueAt.In(time.Local),
+		"expire_at":       nullTime(r.ExpireAt),
+		"created_at":      r.CreatedAt,
+	})
+	if err != nil {
+		return err
+	}
+	r.ID = strconv.FormatInt(id, 10)
+	return nil
+}
+
+func (s *DBStore) Get(id string) (*Reminder, error) {
+	record, err := s.model.First(xdb.WhereEq("id", id))
+	if errors.Is(err, xdb.ErrNotFound) {
+		return nil, ErrReminderNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	r := toReminder(record)
+	return &r, nil
+}
+
+func (s *DBStore) List(filter Filter) ([]Reminder, error) {
+	opts := []xdb.Option{xdb.OrderByAsc("due_at"), xdb.OrderByAsc("id")}
+	if filter.UID != "" {
+		opts = append(opts, xdb.WhereEq("uid", filter.UID))
+	}
+	if filter.Kind != "" {
+		opts = append(opts, xdb.WhereEq("kind", filter.Kind))
+	}
+	if filter.Name != "" {
+		opts = append(opts, xdb.WhereEq("name", filter.Name))
+	}
+	if len(filter.Status) > 0 {
+		opts = append(opts, xdb.WhereIn("status", toAny(filter.Status)))
+	}
+	if !filter.DueBefore.IsZero() {
+		opts = append(opts, xdb.WhereLe("due_at", filter.DueBefore.In(time.Local)))
+	}
+	if filter.Limit > 0 {
+		opts = append(opts, xdb.Limit(filter.Limit))
+	}
+
+	list, err := s.model.Selects(opts...)
+	if err != nil {
+		return nil, err
+	}
+	reminders := make([]Reminder, 0, len(list))
+	for _, item := range list {
+		reminders = append(reminders, toReminder(item))
+	}
+	return reminders, nil
+}
+
+func (s *DBStore) Update(r *Reminder) error {
+	_, err := s.model.Update(xdb.Record{
+		"character_name":  r.Character,
+		"conversation_id": r.ConversationID,
+		"content":         r.Content,
+		"timezone":        r.Timezone,
+		"due_at":          r.DueAt.In(time.Local),
+		"expire_at":       nullTime(r.ExpireAt),
+		"updated_at":      time.Now(),
+	}, xdb.WhereEq("id", r.ID))
+	return err
+}
+
+// SetStatus 以状态作为更新条件, 多个实例同时处理同一条提醒时只有一个能更新成功
+func (s *DBStore) SetStatus(id string, status string, from ...string) (bool, error) {
+	record := xdb.Record{
+		"status":     status,
+		"updated_at": time.Now(),
+	}
+	if status == StatusDelivered {
+		record["delivered_at"] = time.Now()
+	}
+	opts := []xdb.Option{xdb.WhereEq("id", id)}
+	if len(from) > 0 {
+		opts = append(opts, xdb.WhereIn("status", toAny(from)))
+	}
+	return s.model.Update(record, opts...)
+}
+
+func toReminder(record xdb.Record) Reminder {
+	r := Reminder{
+		ID:             record.GetString("id"),
+		UID:            record.GetString("uid"),
+		Character:      record.GetString("character_name"),
+		ConversationID: record.GetString("conversation_id"),
+		Kind:           record.GetString("kind"),
+		Name:           record.GetString("name"),
+		Content:        record.GetString("content"),
+		Timezone:       record.GetString("timezone"),
+		Status:         record.GetString("status"),
+	}
+	if t := record.GetTime("due_at"); t != nil {
+		r.DueAt = *t
+	}
+	if t := record.GetTime("expire_at"); t != nil {
+		r.ExpireAt = *t
+	}
+	if t := record.GetTime("created_at"); t != nil {
+		r.CreatedAt = *t
+	}
+	if t := record.GetTime("delivered_at"); t != nil {
+		r.DeliveredAt = *t
+	}
+	return r
+}
+
+// nullTime 零值时间写入 NULL; 与其他表一致按服务器时区保存, sqlite 以字符串比较时间
+func nullTime(t time.Time) any {
+	if t.IsZero() {
+		return nil
+	}
+	return t.In(time.Local)
+}
+
+func toAny(list []string) []any {
+	values := make([]any, len(list))
+	for i, v := range list {
+		values[i] = v
+	}
+	return values
+}
@@ -0,0 +1,94 @@
+package xremind
+
+import (
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+)
+
+var _ Store = (*InMemory)(nil)
+
+// InMemory 进程内提醒存储, 用于测试和单机开发, 重启后数据丢失
+type InMemory struct {
+	mu        sync.RWMutex
+	nextID    int
+	reminders map[string]Reminder
+}
+
+func NewInMemory() *InMemory {
+	return &InMemory{reminders: make(map[string]Reminder)}
+}
+
+func (m *InMemory) Create(r *Reminder) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.nextID++
+	r.ID = strconv.Itoa(m.nextID)
+	m.reminders[r.ID] = *r
+	return nil
+}
+
+func (m *InMemory) Get(id string) (*Reminder, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	r, ok := m.reminders[id]
+	if !ok {
+		return nil, ErrReminderNotFound
+	}
+	return &r, nil
+}
+
+func (m *InMemory) List(filter Filter) ([]Reminder, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var list []Reminder
+	for _, r := range m.reminders {
+		if filter.match(r) {
+			list = append(list, r)
+		}
+	}
+	slices.SortFunc(list, func(a, b Reminder) int {
+		return a.DueAt.Compare(b.DueAt)
+	})
+	if filter.Limit > 0 && len(list) > filter.Limit {
+		list = list[:filter.Limit]
+	}
+	return list, nil
+}
+
+func (m *InMemory) Update(r *Reminder) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	existing, ok := m.reminders[r.ID]
+	if !ok {
+		return ErrReminderNotFound
+	}
+	existing.Character = r.Character
+	existing.ConversationID = r.ConversationID
+	existing.Content = r.Content
+	existing.Timezone = r.Timezone
+	existing.DueAt = r.DueAt
+	existing.ExpireAt = r.ExpireAt
+	m.reminders[r.ID] = existing
+	return nil
+}
+
+func (m *InMemory) SetStatus(id string, status string, from ...string) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	r, ok := m.reminders[id]
+	if !ok {
+		return false, ErrReminderNotFound
+	}
+	if len(from) > 0 && !slices.Contains(from, r.Status) {
+		return false, nil
+	}
+	r.Status = status
+	if status == StatusDelivered {
+		r.DeliveredAt = time.Now()
+	}
+	m.reminders[id] = r
+	return true, nil
+}
@@ -0,0 +1,178 @@
+// Package xremind 提醒和主动消息: 持久化待发送的消息, 到期后由 Scheduler 投递
+package xremind
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+)
+
+// 提醒类型
+const (
+	KindReminder = "reminder" // 用户让角色设置的提醒
+	KindCheckin  = "checkin"  // 角色主动问候
+)
+
+// 提醒状态
+// pending -> sending -> delivered; 用户不在线时 sending -> queued, 下次连接时 queued -> sending
+const (
+	StatusPending   = "pending"   // 未到期
+	StatusSending   = "sending"   // 正在投递, 避免多个实例或连接重复发送
+	StatusQueued    = "queued"    // 已到期, 用户不在线
+	StatusDelivered = "delivered" // 已发送
+	StatusCanceled  = "canceled"  // 已取消
+	StatusExpired   = "expired"   // 用户长时间不在线, 不再发送
+)
+
+var (
+	ErrReminderNotFound = errors.New("提醒不存在")
+	ErrTooManyReminders = errors.New("未触发的提醒太多")
+	ErrPastDue          = errors.New("提醒时间已过")
+)
+
+// Reminder 待发送的提醒或问候, Timezone 为创建时用户所在的时区, 用于展示和安排下一次问候
+type Reminder struct {
+	ID             string    `json:"id"`
+	UID            string    `json:"uid"`
+	Character      string    `json:"character"`
+	ConversationID string    `json:"conversation_id"`
+	Kind           string    `json:"kind"`
+	Name           string    `json:"name,omitempty"` // 问候的配置名称, 同一用户同一名称只保留一条未触发的问候
+	Content        string    `json:"content"`
+	Timezone       string    `json:"timezone"`
+	Status         string    `json:"status"`
+	DueAt          time.Time `json:"due_at"`
+	ExpireAt       time.Time `json:"expire_at,omitzero"` // 零值表示不过期
+	CreatedAt      time.Time `json:"created_at"`
+	DeliveredAt    time.Time `json:"delivered_at,omitzero"`
+}
+
+// LocalDueAt 用户时区的到期时间
+func (r *Reminder) LocalDueAt() time.Time {
+	return r.DueAt.In(LoadLocation(r.Timezone, time.Local))
+}
+
+// Filter 查询条件, 零值字段不参与过滤
+type Filter struct {
+	UID       string
+	Kind      string
+	Name      string
+	Status    []string
+	DueBefore time.Time // DueAt <= DueBefore
+	Limit     int
+}
+
+func (f Filter) match(r Reminder) bool {
+	if f.UID != "" && r.UID != f.UID {
+		return false
+	}
+	if f.Kind != "" && r.Kind != f.Kind {
+		return false
+	}
+	if f.Name != "" && r.Name != f.Name {
+		return false
+	}
+	if len(f.Status) > 0 && !slices.Contains(f.Status, r.Status) {
+		return false
+	}
+	if !f.DueBefore.IsZero() && r.DueAt.After(f.DueBefore) {
+		return false
+	}
+	return true
+}
+
+// Store 提醒存储, List 按到期时间升序返回
+type Store interface {
+	// Create 创建提醒并回填 ID
+	Create(r *Reminder) error
+	Get(id string) (*Reminder, error)
+	List(filter Filter) ([]Reminder, error)
+	// Update 修改未触发提醒的角色、内容和时间
+	Update(r *Reminder) error
+	// SetStatus 仅当前状态为 from 之一时更新, 返回是否更新成功
+	SetStatus(id string, status string, from ...string) (bool, error)
+}
+
+// Add 创建提醒, 检查到期时间和用户未触发的提醒数量; maxPending 为 0 时不限制
+func Add(store Store, r *Reminder, maxPending int, now time.Time) error {
+	if !r.DueAt.After(now) {
+		return ErrPastDue
+	}
+	if maxPending > 0 {
+		pending, err := store.List(Filter{UID: r.UID, Kind: KindReminder, Status: []string{StatusPending}})
+		if err != nil {
+			return err
+		}
+		if len(pending) >= maxPending {
+			return ErrTooManyReminders
+		}
+	}
+	r.Kind = KindReminder
+	r.Status = StatusPending
+	r.CreatedAt = now
+	return store.Create(r)
+}
+
+// Cancel 取消用户未触发的提醒
+func Cancel(store Store, uid string, id string) error {
+	r, err := store.Get(id)
+	if err != nil {
+		return err
+	}
+	if r.UID != uid {
+		return ErrReminderNotFound
+	}
+	ok, err := store.SetStatus(id, StatusCanceled, StatusPending, StatusQueued)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return fmt.Errorf("提醒已%s, 不能取消", statusText(r.Status))
+	}
+	return nil
+}
+
+// LoadLocation 加载 IANA 时区, 名称为空或不合法时返回 fallback
+func LoadLocation(name string, fallback *time.Location) *time.Location {
+	if name == "" {
+		return fallback
+	}
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return fallback
+	}
+	return loc
+}
+
+// ParseLocalTime 按用户时区解析 "2006-01-02 15:04" 格式的时间
+func ParseLocalTime(value string, loc *time.Location) (time.Time, error) {
+	for _, layout := range []string{"2006-01-02 15:04", "2006-01-02 15:04:05", "2006-01-02T15:04", "2006-01-02T15:04:05"} {
+		if t, err := time.ParseInLocation(layout, value, loc); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("时间格式不正确, 应为 2006-01-02 15:04: %s", value)
+}
+
+// NextDay 用户时区下第二天的 clock (HH:MM) 时刻
+func NextDay(now time.Time, loc *time.Location, clock string) (time.Time, error) {
+	t, err := time.Parse("15:04", clock)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("时间格式不正确, 应为 HH:MM: %s", clock)
+	}
+	local := now.In(loc)
+	return time.Date(local.Year(), local.Month(), local.Day()+1, t.Hour(), t.Minute(), 0, 0, loc), nil
+}
+
+func statusText(status string) string {
+	switch status {
+	case StatusDelivered, StatusSending:
+		return "发送"
+	case StatusCanceled:
+		return "取消"
+	case StatusExpired:
+		return "过期"
+	}
+	return status
+}
@@ -0,0 +1,181 @@
+package xremind
+
+import (
+	"companions/internal/conf"
+	"context"
+	"slices"
+	"time"
+
+	"github.com/daodao97/xgo/xlog"
+)
+
+// batchSize 每次检查最多处理的到期提醒数
+const batchSize = 100
+
+// defaultCheckinExpire 问候在用户不在线时保留的时间
+const defaultCheckinExpire = 6 * time.Hour
+
+// Deliverer 把提醒发送给用户, 用户不在线时返回 false
+type Deliverer func(ctx context.Context, r *Reminder) bool
+
+type Option func(*Scheduler)
+
+// WithInterval 检查到期提醒的间隔, 默认 30 秒
+func WithInterval(interval time.Duration) Option {
+	return func(s *Scheduler) {
+		if interval > 0 {
+			s.interval = interval
+		}
+	}
+}
+
+// WithCheckins 主动问候的配置
+func WithCheckins(checkins []conf.CheckinConfig) Option {
+	return func(s *Scheduler) {
+		s.checkins = checkins
+	}
+}
+
+// WithClock 替换当前时间, 用于测试
+func WithClock(now func() time.Time) Option {
+	return func(s *Scheduler) {
+		s.now = now
+	}
+}
+
+// Scheduler 定时投递到期的提醒, 用户不在线时转为 queued, 下次连接时由 Flush 发送
+type Scheduler struct {
+	store    Store
+	deliver  Deliverer
+	interval time.Duration
+	checkins []conf.CheckinConfig
+	now      func() time.Time
+}
+
+func NewScheduler(store Store, deliver Deliverer, opts ...Option) *Scheduler {
+	s := &Scheduler{
+		store:    store,
+		deliver:  deliver,
+		interval: 30 * time.Second,
+		now:      time.Now,
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+func (s *Scheduler) Store() Store {
+	return s.store
+}
+
+// Run 按间隔检查到期的提醒, ctx 结束时返回
+func (s *Scheduler) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.Tick(ctx)
+		}
+	}
+}
+
+// Tick 投递所有到期的提醒, 返回发送成功的数量
+func (s *Scheduler) Tick(ctx context.Context) int {
+	due, err := s.store.List(Filter{Status: []string{StatusPending}, DueBefore: s.now(), Limit: batchSize})
+	if err != nil {
+		xlog.ErrorC(ctx, "查询到期提醒失败", xlog.Err(err))
+		return 0
+	}
+	return s.send(ctx, due, StatusPending)
+}
+
+// Flush 用户连接后发送积压的提醒, 返回发送成功的数量
+func (s *Scheduler) Flush(ctx context.Context, uid string) int {
+	queued, err := s.store.List(Filter{UID: uid, Status: []string{StatusQueued}, Limit: batchSize})
+	if err != nil {
+		xlog.ErrorC(ctx, "查询积压提醒失败", xlog.String("uid", uid), xlog.Err(err))
+		return 0
+	}
+	return s.send(ctx, queued, StatusQueued)
+}
+
+func (s *Scheduler) send(ctx context.Context, reminders []Reminder, from string) int {
+	sent := 0
+	for i := range reminders {
+		r := &reminders[i]
+		// 先改为 sending, 其他实例或连接已经在处理时跳过
+		ok, err := s.store.SetStatus(r.ID, StatusSending, from)
+		if err != nil {
+			xlog.ErrorC(ctx, "更新提醒状态失败", xlog.String("id", r.ID), xlog.Err(err))
+			continue
+		}
+		if !ok {
+			continue
+		}
+
+		status := StatusQueued
+		switch {
+		case !r.ExpireAt.IsZero() && s.now().After(r.ExpireAt):
+			status = StatusExpired
+		case s.deliver(ctx, r):
+			status = StatusDelivered
+			sent++
+		}
+		if _, err := s.store.SetStatus(r.ID, status, StatusSending); err != nil {
+			xlog.ErrorC(ctx, "更新提醒状态失败", xlog.String("id", r.ID), xlog.Err(err))
+		}
+		xlog.InfoC(ctx, "处理提醒", xlog.String("id", r.ID), xlog.String("uid", r.UID),
+			xlog.String("kind", r.Kind), xlog.String("status", status))
+	}
+	return sent
+}
+
+// Touch 用户有对话时调用, 按用户时区把问候安排在第二天; 同名问候尚未触发时改期, 不重复创建
+func (s *Scheduler) Touch(uid string, character string, conversationID string, loc *time.Location) error {
+	now := s.now()
+	for _, checkin := range s.checkins {
+		if len(checkin.Characters) > 0 && !slices.Contains(checkin.Characters, character) {
+			continue
+		}
+		dueAt, err := NextDay(now, loc, checkin.Time)
+		if err != nil {
+			return err
+		}
+		expire := time.Duration(checkin.Expire) * time.Second
+		if expire <= 0 {
+			expire = defaultCheckinExpire
+		}
+
+		r := &Reminder{
+			UID:            uid,
+			Character:      character,
+			ConversationID: conversationID,
+			Kind:           KindCheckin,
+			Name:           checkin.Name,
+			Content:        checkin.Message,
+			Timezone:       loc.String(),
+			Status:         StatusPending,
+			DueAt:          dueAt,
+			ExpireAt:       dueAt.Add(expire),
+			CreatedAt:      now,
+		}
+		existing, err := s.store.List(Filter{UID: uid, Kind: KindCheckin, Name: checkin.Name, Status: []string{StatusPending}, Limit: 1})
+		if err != nil {
+			return err
+		}
+		if len(existing) > 0 {
+			r.ID = existing[0].ID
+			err = s.store.Update(r)
+		} else {
+			err = s.store.Create(r)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
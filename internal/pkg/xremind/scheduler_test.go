@@ -0,0 +1,150 @@
+package xremind
+
+import (
+	"companions/internal/conf"
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestAddAndCancel(t *testing.T) {
+	store := NewInMemory()
+	now := time.Date(2025, 7, 31, 15, 0, 0, 0, time.UTC)
+
+	past := &Reminder{UID: "u1", Content: "开会", DueAt: now.Add(-time.Minute)}
+	if err := Add(store, past, 2, now); !errors.Is(err, ErrPastDue) {
+		t.Errorf("past err = %v", err)
+	}
+
+	for i := 0; i < 2; i++ {
+		if err := Add(store, &Reminder{UID: "u1", Content: "开会", DueAt: now.Add(time.Hour)}, 2, now); err != nil {
+			t.Fatalf("Add 失败: %v", err)
+		}
+	}
+	if err := Add(store, &Reminder{UID: "u1", Content: "开会", DueAt: now.Add(time.Hour)}, 2, now); !errors.Is(err, ErrTooManyReminders) {
+		t.Errorf("limit err = %v", err)
+	}
+
+	if err := Cancel(store, "u2", "1"); !errors.Is(err, ErrReminderNotFound) {
+		t.Errorf("其他用户不能取消, err = %v", err)
+	}
+	if err := Cancel(store, "u1", "1"); err != nil {
+		t.Errorf("Cancel 失败: %v", err)
+	}
+	if err := Cancel(store, "u1", "1"); err == nil {
+		t.Error("重复取消应该失败")
+	}
+	if err := Add(store, &Reminder{UID: "u1", Content: "吃药", DueAt: now.Add(time.Hour)}, 2, now); err != nil {
+		t.Errorf("取消后可以继续添加, err = %v", err)
+	}
+}
+
+func TestScheduler(t *testing.T) {
+	store := NewInMemory()
+	now := time.Date(2025, 7, 31, 9, 0, 0, 0, time.UTC)
+	online := map[string]bool{"u1": true}
+	var delivered []string
+	scheduler := NewScheduler(store, func(ctx context.Context, r *Reminder) bool {
+		if !online[r.UID] {
+			return false
+		}
+		delivered = append(delivered, r.UID+":"+r.Content)
+		return true
+	}, WithClock(func() time.Time { return now }))
+
+	_ = Add(store, &Reminder{UID: "u1", Content: "开会", DueAt: now.Add(time.Minute)}, 0, now)
+	_ = Add(store, &Reminder{UID: "u2", Content: "吃药", DueAt: now.Add(time.Minute)}, 0, now)
+	_ = Add(store, &Reminder{UID: "u1", Content: "睡觉", DueAt: now.Add(time.Hour)}, 0, now)
+
+	if sent := scheduler.Tick(context.Background()); sent != 0 {
+		t.Errorf("未到期时 sent = %d", sent)
+	}
+
+	now = now.Add(2 * time.Minute)
+	if sent := scheduler.Tick(context.Background()); sent != 1 || len(delivered) != 1 || delivered[0] != "u1:开会" {
+		t.Errorf("sent = %d, delivered = %v", sent, delivered)
+	}
+	queued, _ := store.List(Filter{Status: []string{StatusQueued}})
+	if len(queued) != 1 || queued[0].UID != "u2" {
+		t.Fatalf("queued = %+v", queued)
+	}
+	// 已处理的提醒不会再次投递
+	if sent := scheduler.Tick(context.Background()); sent != 0 {
+		t.Errorf("重复投递 sent = %d", sent)
+	}
+
+	online["u2"] = true
+	if sent := scheduler.Flush(context.Background(), "u2"); sent != 1 || delivered[1] != "u2:吃药" {
+		t.Errorf("Flush sent = %d, delivered = %v", sent, delivered)
+	}
+	r, _ := store.Get(queued[0].ID)
+	if r.Status != StatusDelivered || r.DeliveredAt.IsZero() {
+		t.Errorf("reminder = %+v", r)
+	}
+}
+
+func TestScheduler_Touch(t *testing.T) {
+	store := NewInMemory()
+	shanghai, _ := time.LoadLocation("Asia/Shanghai")
+	// 上海时间 7 月 31 日 23:30
+	now := time.Date(2025, 7, 31, 15, 30, 0, 0, time.UTC)
+	var delivered []*Reminder
+	online := false
+	scheduler := NewScheduler(store, func(ctx context.Context, r *Reminder) bool {
+		if online {
+			delivered = append(delivered, r)
+		}
+		return online
+	},
+		WithClock(func() time.Time { return now }),
+		WithCheckins([]conf.CheckinConfig{
+			{Name: "morning", Time: "08:00", Message: "早安", Expire: 3600},
+			{Name: "ani_only", Time: "12:00", Message: "午安", Characters: []string{"ani"}},
+		}),
+	)
+
+	if err := scheduler.Touch("u1", "rudi", "c1", shanghai); err != nil {
+		t.Fatalf("Touch 失败: %v", err)
+	}
+	now = now.Add(10 * time.Minute)
+	if err := scheduler.Touch("u1", "rudi", "c2", shanghai); err != nil {
+		t.Fatalf("Touch 失败: %v", err)
+	}
+
+	checkins, _ := store.List(Filter{UID: "u1", Kind: KindCheckin})
+	if len(checkins) != 1 {
+		t.Fatalf("同名问候只保留一条, checkins = %+v", checkins)
+	}
+	checkin := checkins[0]
+	// 用户时区的第二天 (8 月 1 日) 早上 8 点
+	if want := time.Date(2025, 8, 1, 8, 0, 0, 0, shanghai); !checkin.DueAt.Equal(want) || checkin.ConversationID != "c2" || checkin.Timezone != "Asia/Shanghai" {
+		t.Errorf("checkin = %+v", checkin)
+	}
+
+	// 到期时不在线, 超过有效期后连接不再发送
+	now = time.Date(2025, 8, 1, 8, 0, 0, 0, shanghai)
+	scheduler.Tick(context.Background())
+	online = true
+	now = now.Add(2 * time.Hour)
+	if sent := scheduler.Flush(context.Background(), "u1"); sent != 0 || len(delivered) != 0 {
+		t.Errorf("过期的问候不应发送, delivered = %v", delivered)
+	}
+	if r, _ := store.Get(checkin.ID); r.Status != StatusExpired {
+		t.Errorf("status = %s", r.Status)
+	}
+}
+
+func TestParseLocalTime(t *testing.T) {
+	shanghai, _ := time.LoadLocation("Asia/Shanghai")
+	got, err := ParseLocalTime("2025-08-01 09:00", shanghai)
+	if err != nil || !got.Equal(time.Date(2025, 8, 1, 1, 0, 0, 0, time.UTC)) {
+		t.Errorf("got = %v, %v", got, err)
+	}
+	if _, err := ParseLocalTime("明天 9 点", shanghai); err == nil {
+		t.Error("不支持的格式应该报错")
+	}
+	if LoadLocation("Mars/Base", time.UTC) != time.UTC {
+		t.Error("不合法的时区应该使用 fallback")
+	}
+}
@@ -0,0 +1,161 @@
+package xstorage
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var _ Storage = (*Local)(nil)
+
+type LocalOption func(*Local)
+
+// WithSecret 签名密钥, 未设置时 SignedURL 返回普通地址
+func WithSecret(secret string) LocalOption {
+	return func(l *Local) {
+		l.secret = secret
+	}
+}
+
+// WithPrivate 私有存储, ServeHTTP 只响应签名有效的请求
+func WithPrivate(private bool) LocalOption {
+	return func(l *Local) {
+		l.private = private
+	}
+}
+
+// Local 本地文件存储, 通过 baseURL 对外访问 (由 ServeHTTP 提供文件)
+type Local struct {
+	dir     string
+	baseURL string
+	secret  string
+	private bool
+}
+
+func NewLocal(dir string, baseURL string, opts ...LocalOption) *Local {
+	l := &Local{
+		dir:     dir,
+		baseURL: strings.TrimSuffix(baseURL, "/"),
+	}
+	for _, opt := range opts {
+		opt(l)
+	}
+	return l
+}
+
+func (l *Local) Put(ctx context.Context, key string, data []byte, contentType string) (string, error) {
+	key, err := cleanKey(key)
+	if err != nil {
+		return "", err
+	}
+	file := filepath.Join(l.dir, filepath.FromSlash(key))
+	if err := os.MkdirAll(filepath.Dir(file), 0o755); err != nil {
+		return "", fmt.Errorf("创建存储目录失败: %w", err)
+	}
+	if err := os.WriteFile(file, data, 0o644); err != nil {
+		return "", fmt.Errorf("写入文件失败: %w", err)
+	}
+	return l.url(key), nil
+}
+
+func (l *Local) Get(ctx context.Context, key string) ([]byte, error) {
+	file, err := l.path(key)
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(file)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, ErrNotFound
+	}
+	return data, err
+}
+
+// SignedURL 地址附带 expires 和 signature 参数, 由 ServeHTTP 校验
+func (l *Local) SignedURL(ctx context.Context, key string, ttl time.Duration) (string, error) {
+	key, err := cleanKey(key)
+	if err != nil {
+		return "", err
+	}
+	if l.secret == "" {
+		return l.url(key), nil
+	}
+	if ttl <= 0 {
+		ttl = DefaultSignTTL
+	}
+	expires := strconv.FormatInt(time.Now().Add(ttl).Unix(), 10)
+	query := url.Values{"expires": {expires}, "signature": {l.sign(key, expires)}}
+	return l.url(key) + "?" + query.Encode(), nil
+}
+
+// ServeHTTP 提供存储目录下的文件, 请求路径为去掉 baseURL 前缀后的 key
+func (l *Local) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	key := strings.TrimPrefix(r.URL.Path, "/")
+	file, err := l.path(key)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	if l.private && !l.verify(key, r.URL.Query().Get("expires"), r.URL.Query().Get("signature")) {
+		http.Error(w, "签名无效或已过期", http.StatusForbidden)
+		return
+	}
+
+	f, err := os.Open(file)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	defer f.Close()
+	// 不列出目录
+	info, err := f.Stat()
+	if err != nil || info.IsDir() {
+		http.NotFound(w, r)
+		return
+	}
+	if contentType := mime.TypeByExtension(path.Ext(key)); contentType != "" {
+		w.Header().Set("Content-Type", contentType)
+	}
+	http.ServeContent(w, r, key, info.ModTime(), f)
+}
+
+func (l *Local) verify(key string, expires string, signature string) bool {
+	if l.secret == "" {
+		return false
+	}
+	unix, err := strconv.ParseInt(expires, 10, 64)
+	if err != nil || time.Now().Unix() > unix {
+		return false
+	}
+	return hmac.Equal([]byte(signature), []byte(l.sign(key, expires)))
+}
+
+func (l *Local) sign(key string, expires string) string {
+	mac := hmac.New(sha256.New, []byte(l.secret))
+	mac.Write([]byte(key + "\n" + expires))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func (l *Local) path(key string) (string, error) {
+	key, err := cleanKey(key)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(l.dir, filepath.FromSlash(key)), nil
+}
+
+func (l *Local) url(key string) string {
+	return l.baseURL + "/" + key
+}
@@ -0,0 +1,95 @@
+package xstorage
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLocalPut(t *testing.T) {
+	dir := t.TempDir()
+	store := NewLocal(dir, "/uploads/")
+
+	url, err := store.Put(context.Background(), "images/a/b.png", []byte("png"), "image/png")
+	if err != nil {
+		t.Fatalf("Put 失败: %v", err)
+	}
+	if url != "/uploads/images/a/b.png" {
+		t.Errorf("url = %s", url)
+	}
+	data, err := os.ReadFile(filepath.Join(dir, "images", "a", "b.png"))
+	if err != nil || string(data) != "png" {
+		t.Errorf("文件内容 = %q, %v", data, err)
+	}
+
+	for _, key := range []string{"", "/etc/passwd", "../secret", "images/../../secret", `images\a.png`} {
+		if _, err := store.Put(context.Background(), key, []byte("x"), ""); !errors.Is(err, ErrInvalidKey) {
+			t.Errorf("Put(%q) err = %v", key, err)
+		}
+	}
+}
+
+func TestNewKey(t *testing.T) {
+	key := NewKey("images", "jpg")
+	if !strings.HasPrefix(key, "images/") || !strings.HasSuffix(key, ".jpg") || strings.Count(key, "/") != 4 {
+		t.Errorf("key = %s", key)
+	}
+	if _, err := cleanKey(key); err != nil {
+		t.Errorf("cleanKey(%s) err = %v", key, err)
+	}
+}
+
+func TestLocalSignedURL(t *testing.T) {
+	dir := t.TempDir()
+	store := NewLocal(dir, "/uploads", WithSecret("secret"), WithPrivate(true))
+	if _, err := store.Put(context.Background(), "a/b.txt", []byte("hello"), "text/plain"); err != nil {
+		t.Fatalf("Put 失败: %v", err)
+	}
+	if data, err := store.Get(context.Background(), "a/b.txt"); err != nil || string(data) != "hello" {
+		t.Errorf("Get = %q, %v", data, err)
+	}
+	if _, err := store.Get(context.Background(), "a/missing.txt"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get missing err = %v", err)
+	}
+
+	signed, err := store.SignedURL(context.Background(), "a/b.txt", time.Minute)
+	if err != nil || !strings.HasPrefix(signed, "/uploads/a/b.txt?expires=") {
+		t.Fatalf("SignedURL = %s, %v", signed, err)
+	}
+
+	handler := http.StripPrefix("/uploads", store)
+	serve := func(target string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, target, nil))
+		return w
+	}
+	if w := serve(signed); w.Code != http.StatusOK || w.Body.String() != "hello" {
+		t.Errorf("signed status = %d, body = %q", w.Code, w.Body.String())
+	}
+	if w := serve("/uploads/a/b.txt"); w.Code != http.StatusForbidden {
+		t.Errorf("unsigned status = %d", w.Code)
+	}
+	dirURL, _ := store.SignedURL(context.Background(), "a", time.Minute)
+	if w := serve(dirURL); w.Code != http.StatusNotFound {
+		t.Errorf("dir status = %d", w.Code)
+	}
+	if w := serve(strings.Replace(signed, "a/b.txt", "a/c.txt", 1)); w.Code != http.StatusForbidden {
+		t.Errorf("other key status = %d", w.Code)
+	}
+	expires := strconv.FormatInt(time.Now().Add(-time.Minute).Unix(), 10)
+	if w := serve("/uploads/a/b.txt?expires=" + expires + "&signature=" + store.sign("a/b.txt", expires)); w.Code != http.StatusForbidden {
+		t.Errorf("expired status = %d", w.Code)
+	}
+
+	public := NewLocal(dir, "/uploads")
+	if url, _ := public.SignedURL(context.Background(), "a/b.txt", time.Minute); url != "/uploads/a/b.txt" {
+		t.Errorf("未设置密钥时 SignedURL = %s", url)
+	}
+}
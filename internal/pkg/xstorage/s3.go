@@ -0,0 +1,283 @@
+package xstorage
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var _ Storage = (*S3)(nil)
+
+// emptyPayloadHash 空请求体的 sha256
+const emptyPayloadHash = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+
+// S3Config S3 兼容存储 (AWS S3、MinIO、Cloudflare R2 等)
+type S3Config struct {
+	Endpoint  string // 如 https://s3.amazonaws.com、http://127.0.0.1:9000
+	Region    string // 默认 us-east-1
+	Bucket    string
+	AccessKey string
+	SecretKey string
+	PathStyle bool   // 使用 endpoint/bucket/key 形式的地址, MinIO 需要开启
+	PublicURL string // 公开访问地址前缀 (如 CDN), 为空时使用 bucket 地址
+}
+
+// S3 使用 AWS Signature V4 签名的 S3 兼容存储
+type S3 struct {
+	conf   S3Config
+	client *http.Client
+	now    func() time.Time
+}
+
+func NewS3(conf S3Config) *S3 {
+	if conf.Region == "" {
+		conf.Region = "us-east-1"
+	}
+	conf.Endpoint = strings.TrimSuffix(conf.Endpoint, "/")
+	conf.PublicURL = strings.TrimSuffix(conf.PublicURL, "/")
+	return &S3{
+		conf:   conf,
+		client: &http.Client{Timeout: 30 * time.Second},
+		now:    time.Now,
+	}
+}
+
+func (s *S3) Put(ctx context.Context, key string, data []byte, contentType string) (string, error) {
+	key, err := cleanKey(key)
+	if err != nil {
+		return "", err
+	}
+	host, uri, err := s.object(key)
+	if err != nil {
+		return "", err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, s.scheme()+"://"+host+uri, bytes.NewReader(data))
+	if err != nil {
+		return "", err
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	s.signRequest(req, host, uri, sha256Hex(data))
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("上传文件失败: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return "", responseError("上传文件失败", resp)
+	}
+
+	if s.conf.PublicURL != "" {
+		return s.conf.PublicURL + "/" + uriEncode(key, false), nil
+	}
+	return s.scheme() + "://" + host + uri, nil
+}
+
+func (s *S3) Get(ctx context.Context, key string) ([]byte, error) {
+	key, err := cleanKey(key)
+	if err != nil {
+		return nil, err
+	}
+	host, uri, err := s.object(key)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.scheme()+"://"+host+uri, nil)
+	if err != nil {
+		return nil, err
+	}
+	s.signRequest(req, host, uri, emptyPayloadHash)
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("读取文件失败: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, ErrNotFound
+	}
+	if resp.StatusCode/100 != 2 {
+		return nil, responseError("读取文件失败", resp)
+	}
+	return io.ReadAll(resp.Body)
+}
+
+// SignedURL 预签名的 GET 地址, 最长 7 天
+func (s *S3) SignedURL(ctx context.Context, key string, ttl time.Duration) (string, error) {
+	key, err := cleanKey(key)
+	if err != nil {
+		return "", err
+	}
+	host, uri, err := s.object(key)
+	if err != nil {
+		return "", err
+	}
+	if ttl <= 0 {
+		ttl = DefaultSignTTL
+	}
+	ttl = min(ttl, 7*24*time.Hour)
+
+	amzDate, scope := s.scope()
+	query := url.Values{
+		"X-Amz-Algorithm":     {"AWS4-HMAC-SHA256"},
+		"X-Amz-Credential":    {s.conf.AccessKey + "/" + scope},
+		"X-Amz-Date":          {amzDate},
+		"X-Amz-Expires":       {strconv.Itoa(int(ttl.Seconds()))},
+		"X-Amz-SignedHeaders": {"host"},
+	}
+	canonicalQuery := canonicalQueryString(query)
+	canonicalRequest := strings.Join([]string{
+		http.MethodGet,
+		uri,
+		canonicalQuery,
+		"host:" + host + "\n",
+		"host",
+		"UNSIGNED-PAYLOAD",
+	}, "\n")
+	signature := s.signature(amzDate, scope, canonicalRequest)
+	return s.scheme() + "://" + host + uri + "?" + canonicalQuery + "&X-Amz-Signature=" + signature, nil
+}
+
+// signRequest 在请求头中签名
+func (s *S3) signRequest(req *http.Request, host string, uri string, payloadHash string) {
+	amzDate, scope := s.scope()
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	headers := map[string]string{
+		"host":                 host,
+		"x-amz-content-sha256": payloadHash,
+		"x-amz-date":           amzDate,
+	}
+	if contentType := req.Header.Get("Content-Type"); contentType != "" {
+		headers["content-type"] = contentType
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + strings.TrimSpace(headers[name]) + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		uri,
+		canonicalQueryString(req.URL.Query()),
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s.conf.AccessKey, scope, signedHeaders, s.signature(amzDate, scope, canonicalRequest)))
+}
+
+func (s *S3) scope() (amzDate string, scope string) {
+	now := s.now().UTC()
+	amzDate = now.Format("20060102T150405Z")
+	return amzDate, now.Format("20060102") + "/" + s.conf.Region + "/s3/aws4_request"
+}
+
+func (s *S3) signature(amzDate string, scope string, canonicalRequest string) string {
+	stringToSign := strings.Join([]string{
+		"AWS4-HMAC-SHA256",
+		amzDate,
+		scope,
+		sha256Hex([]byte(canonicalRequest)),
+	}, "\n")
+
+	key := []byte("AWS4" + s.conf.SecretKey)
+	for _, part := range strings.Split(scope, "/") {
+		key = hmacSHA256(key, part)
+	}
+	return hex.EncodeToString(hmacSHA256(key, stringToSign))
+}
+
+// object 对象的 host 和编码后的路径
+func (s *S3) object(key string) (host string, uri string, err error) {
+	endpoint, err := url.Parse(s.conf.Endpoint)
+	if err != nil || endpoint.Host == "" {
+		return "", "", fmt.Errorf("S3 endpoint 不合法: %s", s.conf.Endpoint)
+	}
+	if s.conf.PathStyle {
+		return endpoint.Host, "/" + uriEncode(s.conf.Bucket, true) + "/" + uriEncode(key, false), nil
+	}
+	return s.conf.Bucket + "." + endpoint.Host, "/" + uriEncode(key, false), nil
+}
+
+func (s *S3) scheme() string {
+	if strings.HasPrefix(s.conf.Endpoint, "http://") {
+		return "http"
+	}
+	return "https"
+}
+
+// canonicalQueryString 按 key 排序并编码的查询参数
+func canonicalQueryString(query url.Values) string {
+	keys := make([]string, 0, len(query))
+	for key := range query {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var parts []string
+	for _, key := range keys {
+		values := append([]string(nil), query[key]...)
+		sort.Strings(values)
+		for _, value := range values {
+			parts = append(parts, uriEncode(key, true)+"="+uriEncode(value, true))
+		}
+	}
+	return strings.Join(parts, "&")
+}
+
+// uriEncode AWS 要求的 URI 编码, 只保留 A-Z a-z 0-9 - _ . ~ 不编码
+func uriEncode(s string, encodeSlash bool) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9', c == '-', c == '_', c == '.', c == '~':
+			b.WriteByte(c)
+		case c == '/' && !encodeSlash:
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+func responseError(message string, resp *http.Response) error {
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+	return fmt.Errorf("%s: status=%d, %s", message, resp.StatusCode, strings.TrimSpace(string(body)))
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
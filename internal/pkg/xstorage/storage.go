@@ -0,0 +1,68 @@
+package xstorage
+
+import (
+	"context"
+	"errors"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+var (
+	ErrInvalidKey = errors.New("文件路径不合法")
+	ErrNotFound   = errors.New("文件不存在")
+)
+
+// DefaultSignTTL 签名地址默认有效期
+const DefaultSignTTL = time.Hour
+
+// Storage 文件存储, key 为 / 分隔的相对路径
+type Storage interface {
+	// Put 保存文件并返回访问地址, 私有存储的地址需要签名后才能访问
+	Put(ctx context.Context, key string, data []byte, contentType string) (string, error)
+	// Get 读取文件, 不存在时返回 ErrNotFound
+	Get(ctx context.Context, key string) ([]byte, error)
+	// SignedURL 生成有效期为 ttl 的访问地址
+	SignedURL(ctx context.Context, key string, ttl time.Duration) (string, error)
+}
+
+// NewKey 生成按日期分目录的文件路径, 如 images/2025/01/02/<uuid>.jpg
+func NewKey(prefix string, ext string) string {
+	if ext != "" && !strings.HasPrefix(ext, ".") {
+		ext = "." + ext
+	}
+	return path.Join(prefix, time.Now().Format("2006/01/02"), uuid.New().String()+ext)
+}
+
+// cleanKey 规范化 key, 拒绝绝对路径和 .. 跳出存储目录
+func cleanKey(key string) (string, error) {
+	if key == "" || strings.HasPrefix(key, "/") || strings.Contains(key, "\\") {
+		return "", ErrInvalidKey
+	}
+	cleaned := path.Clean(key)
+	if cleaned == "." || cleaned == ".." || strings.HasPrefix(cleaned, "../") {
+		return "", ErrInvalidKey
+	}
+	return cleaned, nil
+}
+
+// ExtByContentType 常见 mime 类型对应的扩展名
+func ExtByContentType(contentType string) string {
+	switch contentType {
+	case "image/jpeg":
+		return ".jpg"
+	case "image/png":
+		return ".png"
+	case "image/webp":
+		return ".webp"
+	case "image/gif":
+		return ".gif"
+	case "audio/mpeg":
+		return ".mp3"
+	case "audio/wav":
+		return ".wav"
+	}
+	return ""
+}
@@ -2,26 +2,25 @@ package xstt
 
 import (
 	"bytes"
+	"companions/internal/pkg/xstorage"
 	"context"
 	"encoding/base64"
 	"errors"
 	"fmt"
 	"io"
 	"mime/multipart"
-	"os"
-	"path/filepath"
-	"time"
 
 	"github.com/daodao97/xgo/xlog"
 	"github.com/daodao97/xgo/xrequest"
+	"github.com/tidwall/gjson"
 )
 
 type OpenAI struct {
 	APIKey  string
 	APIUrl  string
 	Model   string
-	Timeout int    // 超时时间（秒）
-	SaveDir string // 保存音频文件的目录
+	Timeout int              // 超时时间（秒）
+	Storage xstorage.Storage // 保存音频文件, 为空时不保存
 }
 
 type OpenAIOption func(*OpenAI)
@@ -50,12 +49,18 @@ func WithTimeout(timeout int) OpenAIOption {
 	}
 }
 
-func WithSaveDir(saveDir string) OpenAIOption {
+// WithStorage 识别前将音频保存到文件存储
+func WithStorage(storage xstorage.Storage) OpenAIOption {
 	return func(o *OpenAI) {
-		o.SaveDir = saveDir
+		o.Storage = storage
 	}
 }
 
+// WithSaveDir 将音频保存到本地目录
+func WithSaveDir(saveDir string) OpenAIOption {
+	return WithStorage(xstorage.NewLocal(saveDir, ""))
+}
+
 func NewOpenAI(opts ...OpenAIOption) STT {
 	openai := &OpenAI{
 		APIUrl:  "https://api.gptsapi.net/v1",
@@ -83,31 +88,20 @@ func (o *OpenAI) SpeechToText(ctx context.Context, req SpeechToTextReq) (*Speech
 		return nil, fmt.Errorf("failed to decode audio data: %v", err)
 	}
 
-	// 如果指定了保存目录，则保存音频文件
+	// 如果指定了文件存储，则保存音频文件, 保存失败不影响识别
 	var savedFilePath string
-	if o.SaveDir != "" {
-		// 确保保存目录存在
-		if err := os.MkdirAll(o.SaveDir, 0755); err != nil {
-			xlog.ErrorC(ctx, "创建保存目录失败: %v", err)
-			return nil, fmt.Errorf("failed to create save directory: %v", err)
-		}
-
-		// 生成文件名（使用时间戳避免冲突）
-		timestamp := time.Now().Format("20060102_150405_000")
+	if o.Storage != nil {
 		extension := req.Format
 		if extension == "" {
 			extension = "mp3" // 默认格式
 		}
-		fileName := fmt.Sprintf("audio_%s.%s", timestamp, extension)
-		savedFilePath = filepath.Join(o.SaveDir, fileName)
-
-		// 保存文件
-		if err := os.WriteFile(savedFilePath, audioData, 0644); err != nil {
+		savedFilePath, err = o.Storage.Put(ctx, xstorage.NewKey("audio/stt", extension), audioData, "audio/"+extension)
+		if err != nil {
 			xlog.ErrorC(ctx, "保存音频文件失败: %v", err)
-			return nil, fmt.Errorf("failed to save audio file: %v", err)
+			savedFilePath = ""
+		} else {
+			xlog.InfoC(ctx, "音频文件已保存到: %s", savedFilePath)
 		}
-
-		xlog.InfoC(ctx, "音频文件已保存到: %s", savedFilePath)
 	}
 
 	// 发送请求
@@ -160,10 +154,23 @@ func (o *OpenAI) SpeechToText(ctx context.Context, req SpeechToTextReq) (*Speech
 	xlog.DebugC(ctx, "STT转换结果: %s", text)
 
 	return &SpeechToTextResp{
-		Text: text,
+		Text:     text,
+		Duration: transcriptionDuration(response),
+		AudioURL: savedFilePath,
 	}, nil
 }
 
+// transcriptionDuration 音频时长, verbose_json 返回 duration, whisper-1 的 json 返回 usage.seconds
+func transcriptionDuration(response gjson.Result) float64 {
+	if duration := response.Get("duration"); duration.Exists() {
+		return duration.Float()
+	}
+	if response.Get("usage.type").String() == "duration" {
+		return response.Get("usage.seconds").Float()
+	}
+	return 0
+}
+
 // SpeechToTextWithReader 使用io.Reader进行语音转文字
 func (o *OpenAI) SpeechToTextWithReader(ctx context.Context, reader io.Reader, filename string) (*SpeechToTextResp, error) {
 	if o.APIKey == "" {
@@ -297,6 +304,7 @@ func (o *OpenAI) SpeechToTextWithOptions(ctx context.Context, req SpeechToTextRe
 	xlog.DebugC(ctx, "STT转换结果: %s", text)
 
 	return &SpeechToTextResp{
-		Text: text,
+		Text:     text,
+		Duration: transcriptionDuration(response),
 	}, nil
 }
@@ -15,17 +15,20 @@ type SpeechToTextReq struct {
 }
 
 type SpeechToTextResp struct {
-	Text string `json:"text"`
+	Text     string  `json:"text"`
+	Duration float64 `json:"duration,omitempty"`  // 音频时长 (秒), 用于用量统计, provider 未返回时为 0
+	AudioURL string  `json:"audio_url,omitempty"` // 音频保存后的地址, 未保存时为空
 }
 
-func New(sttConf *conf.STTConfig) STT {
+// New 按配置创建语音识别, opts 为 openai 的额外选项 (如 WithStorage)
+func New(sttConf *conf.STTConfig, opts ...OpenAIOption) STT {
 	switch sttConf.Provider {
 	case "openai":
-		return NewOpenAI(
+		return NewOpenAI(append([]OpenAIOption{
 			WithAPIKey(sttConf.ApiKey),
 			WithAPIUrl(sttConf.ApiUrl),
 			WithModel(sttConf.Model),
-		)
+		}, opts...)...)
 	}
 	return nil
 }
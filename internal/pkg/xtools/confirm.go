@@ -0,0 +1,19 @@
+package xtools
+
+import "context"
+
+// Confirmer 执行 Meta.Confirm 的工具前向用户请求确认, 返回是否同意
+type Confirmer func(ctx context.Context, tool string, args map[string]any) bool
+
+type confirmerKey struct{}
+
+// WithConfirmer 注入确认方式, 由发起对话的一方 (如 WebSocket 会话) 提供
+func WithConfirmer(ctx context.Context, confirmer Confirmer) context.Context {
+	return context.WithValue(ctx, confirmerKey{}, confirmer)
+}
+
+// confirm 没有注入确认方式时拒绝执行
+func confirm(ctx context.Context, tool string, args map[string]any) bool {
+	confirmer, ok := ctx.Value(confirmerKey{}).(Confirmer)
+	return ok && confirmer != nil && confirmer(ctx, tool, args)
+}
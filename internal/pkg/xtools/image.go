@@ -0,0 +1,191 @@
+package xtools
+
+import (
+	"companions/internal/pkg/tools/img4o"
+	"companions/internal/pkg/xllm"
+	"companions/internal/pkg/xstorage"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/daodao97/xgo/xlog"
+)
+
+// maxGeneratedImageSize 下载生成结果的大小上限
+const maxGeneratedImageSize = 20 << 20
+
+var imageSizes = []string{"1:1", "3:2", "2:3"}
+
+type ImageToolOption func(*ImageTool)
+
+// WithImageStorage 生成结果转存到文件存储, 图片服务返回的地址有有效期
+func WithImageStorage(storage xstorage.Storage) ImageToolOption {
+	return func(t *ImageTool) {
+		t.storage = storage
+	}
+}
+
+// WithReferenceImage 自拍时的参考图, 一般为角色头像, 需要图片服务可以访问
+func WithReferenceImage(url string) ImageToolOption {
+	return func(t *ImageTool) {
+		t.reference = url
+	}
+}
+
+// WithImageCharacters 允许使用图片生成的角色, 默认全部角色
+func WithImageCharacters(characters ...string) ImageToolOption {
+	return func(t *ImageTool) {
+		t.Meta.Characters = characters
+	}
+}
+
+// WithImageSize 默认画幅 1:1 | 3:2 | 2:3
+func WithImageSize(size string) ImageToolOption {
+	return func(t *ImageTool) {
+		if size != "" {
+			t.size = size
+		}
+	}
+}
+
+// ImageTool 图片生成工具, 角色可以发自拍或画出用户想看的内容
+type ImageTool struct {
+	Schema    xllm.Tool
+	Meta      Meta
+	client    *img4o.Client
+	storage   xstorage.Storage
+	reference string
+	size      string
+}
+
+func NewImageTool(client *img4o.Client, opts ...ImageToolOption) ToolInterface {
+	t := &ImageTool{
+		Schema: xllm.Tool{
+			Name:        "generate_image",
+			Description: "生成一张图片发送给用户, 用于发自拍或画出用户想看的内容",
+			Parameters: []xllm.Parameter{
+				{
+					Name:        "prompt",
+					Description: "图片内容的详细描述",
+					Type:        xllm.ParameterTypeString,
+					Required:    true,
+				},
+				{
+					Name:        "selfie",
+					Description: "是否为角色本人的自拍, 自拍时参考角色形象",
+					Type:        xllm.ParameterTypeBoolean,
+				},
+				{
+					Name:        "size",
+					Description: "画幅比例",
+					Type:        xllm.ParameterTypeString,
+					Enum:        imageSizes,
+				},
+			},
+		},
+		// 超时包含轮询和转存结果的时间, 图片作为附件发送, 模型不需要复述链接
+		Meta: Meta{
+			Timeout: client.Timeout() + 30*time.Second,
+			Silent:  true,
+		},
+		client: client,
+		size:   "1:1",
+	}
+	for _, opt := range opts {
+		opt(t)
+	}
+	return t
+}
+
+func (t *ImageTool) GetSchema() xllm.Tool {
+	return t.Schema
+}
+
+func (t *ImageTool) GetMeta() Meta {
+	return t.Meta
+}
+
+func (t *ImageTool) Execute(ctx context.Context, args map[string]any) (*Result, error) {
+	prompt, _ := args["prompt"].(string)
+	if prompt == "" {
+		return nil, errors.New("缺少图片描述 prompt")
+	}
+	selfie, _ := args["selfie"].(bool)
+	size := t.size
+	if s, ok := args["size"].(string); ok && validSize(s) {
+		size = s
+	}
+
+	req := img4o.Generate4oImageRequest{Prompt: prompt, Size: size}
+	if selfie && t.reference != "" {
+		req.FilesURL = []string{t.reference}
+	}
+	urls, err := t.client.Generate(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	attachment := Attachment{Type: "image", URL: urls[0], Name: prompt}
+	if t.storage != nil {
+		if key, url, contentType, err := t.save(ctx, urls[0]); err != nil {
+			// 转存失败时使用原始地址, 不影响本次发送
+			xlog.WarnC(ctx, "保存生成的图片失败", xlog.String("url", urls[0]), xlog.Err(err))
+		} else {
+			attachment.Key, attachment.URL, attachment.MimeType = key, url, contentType
+		}
+	}
+
+	text := "图片已发送给用户"
+	if selfie {
+		text = "自拍已发送给用户"
+	}
+	return &Result{Text: text, Attachments: []Attachment{attachment}}, nil
+}
+
+// save 下载生成结果并保存到文件存储
+func (t *ImageTool) save(ctx context.Context, url string) (key string, stored string, contentType string, err error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return "", "", "", err
+	}
+	client := &http.Client{Timeout: 30 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", "", "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", "", "", fmt.Errorf("下载图片失败: status=%d", resp.StatusCode)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxGeneratedImageSize+1))
+	if err != nil {
+		return "", "", "", err
+	}
+	if len(data) > maxGeneratedImageSize {
+		return "", "", "", errors.New("图片过大")
+	}
+
+	contentType = http.DetectContentType(data)
+	ext := xstorage.ExtByContentType(contentType)
+	if ext == "" {
+		return "", "", "", fmt.Errorf("不支持的图片格式: %s", contentType)
+	}
+	key = xstorage.NewKey("images/generated", ext)
+	stored, err = t.storage.Put(ctx, key, data, contentType)
+	if err != nil {
+		return "", "", "", err
+	}
+	return key, stored, contentType, nil
+}
+
+func validSize(size string) bool {
+	for _, s := range imageSizes {
+		if s == size {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,74 @@
+package xtools
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"image"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"companions/internal/pkg/tools/img4o"
+	"companions/internal/pkg/xstorage"
+)
+
+func TestImageTool(t *testing.T) {
+	var buf bytes.Buffer
+	_ = png.Encode(&buf, image.NewRGBA(image.Rect(0, 0, 1, 1)))
+
+	var submitted img4o.Generate4oImageRequest
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/gpt4o-image/generate":
+			_ = json.NewDecoder(r.Body).Decode(&submitted)
+			_ = json.NewEncoder(w).Encode(img4o.Response[img4o.Generate4oImageResponse]{Code: 200, Data: img4o.Generate4oImageResponse{TaskID: "task-1"}})
+		case "/gpt4o-image/record-info":
+			_ = json.NewEncoder(w).Encode(img4o.Response[img4o.GetImageDetailResponse]{Code: 200, Data: img4o.GetImageDetailResponse{
+				SuccessFlag: img4o.FlagSuccess,
+				Response:    img4o.DetailResponse{ResultUrls: []string{server.URL + "/result.png"}},
+			}})
+		case "/result.png":
+			_, _ = w.Write(buf.Bytes())
+		}
+	}))
+	defer server.Close()
+
+	client := img4o.NewClient(img4o.WithBaseURL(server.URL), img4o.WithPolling(10*time.Millisecond, time.Second))
+	tool := NewImageTool(client,
+		WithImageStorage(xstorage.NewLocal(t.TempDir(), "/uploads")),
+		WithReferenceImage("https://example.com/ani.png"),
+	)
+
+	ctx := context.Background()
+	result, err := tool.Execute(ctx, map[string]any{"prompt": "海边的自拍", "selfie": true, "size": "2:3"})
+	if err != nil {
+		t.Fatalf("Execute 失败: %v", err)
+	}
+
+	if submitted.Prompt != "海边的自拍" || submitted.Size != "2:3" || len(submitted.FilesURL) != 1 {
+		t.Errorf("submitted = %+v", submitted)
+	}
+	if len(result.Attachments) != 1 {
+		t.Fatalf("attachments = %v", result.Attachments)
+	}
+	attachment := result.Attachments[0]
+	if attachment.Type != "image" || attachment.MimeType != "image/png" || attachment.Name != "海边的自拍" ||
+		!strings.HasPrefix(attachment.Key, "images/generated/") || !strings.HasSuffix(attachment.Key, ".png") {
+		t.Errorf("attachment = %+v", attachment)
+	}
+	if result.Text == "" || strings.Contains(result.Text, attachment.URL) {
+		t.Errorf("result = %s", result.Text)
+	}
+	if meta := tool.GetMeta(); !meta.Silent || meta.Timeout <= time.Second {
+		t.Errorf("meta = %+v", meta)
+	}
+
+	if _, err := tool.Execute(ctx, map[string]any{}); err == nil {
+		t.Error("缺少 prompt 时应该报错")
+	}
+}
@@ -0,0 +1,127 @@
+package xtools
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"companions/internal/pkg/xllm"
+)
+
+func echoTool(name string, meta Meta) *Tool {
+	return &Tool{
+		Schema: xllm.Tool{
+			Name: name,
+			Parameters: []xllm.Parameter{
+				{Name: "text", Type: xllm.ParameterTypeString, Required: true},
+			},
+		},
+		Meta: meta,
+		Handler: func(ctx context.Context, args map[string]any) (*Result, error) {
+			return TextResult(args["text"].(string)), nil
+		},
+	}
+}
+
+func TestTools_Register(t *testing.T) {
+	tools := NewTools(echoTool("a", Meta{}), echoTool("b", Meta{}), echoTool("a", Meta{}))
+	if tools.Len() != 2 {
+		t.Fatalf("Len = %d", tools.Len())
+	}
+	if schemas := tools.GetTools(); schemas[0].Name != "a" || schemas[1].Name != "b" {
+		t.Errorf("GetTools = %+v", schemas)
+	}
+
+	err := tools.Register(echoTool("c", Meta{}), echoTool("b", Meta{}))
+	if !errors.Is(err, ErrDuplicateTool) || !strings.Contains(err.Error(), "b") {
+		t.Errorf("Register err = %v", err)
+	}
+	if _, ok := tools.Get("c"); !ok {
+		t.Error("重复之外的工具应该注册成功")
+	}
+}
+
+func TestTools_CallTool(t *testing.T) {
+	ctx := context.Background()
+	tools := NewTools(echoTool("echo", Meta{}))
+
+	result, err := tools.CallTool(ctx, "echo", map[string]any{"text": "hi"})
+	if err != nil || result.Text != "hi" {
+		t.Errorf("CallTool = %+v, %v", result, err)
+	}
+	if _, err := tools.CallTool(ctx, "missing", nil); !errors.Is(err, ErrToolNotFound) {
+		t.Errorf("missing err = %v", err)
+	}
+	if _, err := tools.CallTool(ctx, "echo", map[string]any{"text": 1}); !errors.Is(err, ErrInvalidArguments) {
+		t.Errorf("invalid err = %v", err)
+	}
+	if _, err := tools.CallTool(ctx, "echo", nil); !errors.Is(err, ErrInvalidArguments) {
+		t.Errorf("required err = %v", err)
+	}
+}
+
+func TestTools_CallToolTimeout(t *testing.T) {
+	block := make(chan struct{})
+	defer close(block)
+	tools := NewTools(
+		&Tool{
+			Schema: xllm.Tool{Name: "slow"},
+			Meta:   Meta{Timeout: 20 * time.Millisecond},
+			Handler: func(ctx context.Context, args map[string]any) (*Result, error) {
+				// 不响应 ctx 的工具也要按时返回
+				<-block
+				return TextResult("done"), nil
+			},
+		},
+		&Tool{
+			Schema: xllm.Tool{Name: "panic"},
+			Handler: func(ctx context.Context, args map[string]any) (*Result, error) {
+				panic("boom")
+			},
+		},
+	)
+
+	start := time.Now()
+	if _, err := tools.CallTool(context.Background(), "slow", nil); err == nil || !strings.Contains(err.Error(), "超时") {
+		t.Errorf("slow err = %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("elapsed = %s", elapsed)
+	}
+	if _, err := tools.CallTool(context.Background(), "panic", nil); err == nil || !strings.Contains(err.Error(), "boom") {
+		t.Errorf("panic err = %v", err)
+	}
+}
+
+func TestTools_CallToolConfirm(t *testing.T) {
+	tools := NewTools(echoTool("echo", Meta{Confirm: true}))
+	args := map[string]any{"text": "hi"}
+
+	if _, err := tools.CallTool(context.Background(), "echo", args); !errors.Is(err, ErrNotConfirmed) {
+		t.Errorf("没有确认方式时应该拒绝, err = %v", err)
+	}
+
+	var asked string
+	ctx := WithConfirmer(context.Background(), func(ctx context.Context, tool string, args map[string]any) bool {
+		asked = tool
+		return args["text"] == "hi"
+	})
+	if result, err := tools.CallTool(ctx, "echo", args); err != nil || result.Text != "hi" || asked != "echo" {
+		t.Errorf("CallTool = %+v, %v, asked %q", result, err, asked)
+	}
+	if _, err := tools.CallTool(ctx, "echo", map[string]any{"text": "no"}); !errors.Is(err, ErrNotConfirmed) {
+		t.Errorf("拒绝后 err = %v", err)
+	}
+}
+
+func TestMeta_Allowed(t *testing.T) {
+	if !(Meta{}).Allowed("ani") {
+		t.Error("未限制角色时应该允许")
+	}
+	meta := Meta{Characters: []string{"ani"}}
+	if !meta.Allowed("ani") || meta.Allowed("rudi") {
+		t.Errorf("Allowed 结果不正确")
+	}
+}
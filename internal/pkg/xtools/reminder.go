@@ -0,0 +1,87 @@
+package xtools
+
+import (
+	"companions/internal/pkg/xllm"
+	"companions/internal/pkg/xremind"
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ReminderTool 角色为用户设置提醒, 到期后由 xremind.Scheduler 推送
+type ReminderTool struct {
+	Schema     xllm.Tool
+	Meta       Meta
+	store      xremind.Store
+	template   xremind.Reminder
+	maxPending int
+	now        func() time.Time
+}
+
+// NewReminderTool template 提供提醒的用户、角色、会话和时区; maxPending 为每个用户未触发的提醒数上限
+func NewReminderTool(store xremind.Store, template xremind.Reminder, maxPending int) ToolInterface {
+	return newReminderTool(store, template, maxPending, time.Now)
+}
+
+func newReminderTool(store xremind.Store, template xremind.Reminder, maxPending int, now func() time.Time) *ReminderTool {
+	// 模型需要知道用户的当前时间才能换算 "明天早上 9 点"
+	current := now().In(xremind.LoadLocation(template.Timezone, time.Local))
+	return &ReminderTool{
+		Schema: xllm.Tool{
+			Name:        "set_reminder",
+			Description: fmt.Sprintf("为用户设置提醒, 到时间后你会主动提醒用户。用户当前时间 %s %s", current.Format("2006-01-02 15:04"), weekdays[current.Weekday()]),
+			Parameters: []xllm.Parameter{
+				{
+					Name:        "time",
+					Description: "提醒时间, 用户当地时间, 格式 2006-01-02 15:04",
+					Type:        xllm.ParameterTypeString,
+					Required:    true,
+				},
+				{
+					Name:        "content",
+					Description: "提醒内容, 如 开会、吃药",
+					Type:        xllm.ParameterTypeString,
+					Required:    true,
+				},
+			},
+		},
+		Meta:       Meta{Timeout: 5 * time.Second},
+		store:      store,
+		template:   template,
+		maxPending: maxPending,
+		now:        now,
+	}
+}
+
+var weekdays = []string{"星期日", "星期一", "星期二", "星期三", "星期四", "星期五", "星期六"}
+
+func (t *ReminderTool) GetSchema() xllm.Tool {
+	return t.Schema
+}
+
+func (t *ReminderTool) GetMeta() Meta {
+	return t.Meta
+}
+
+func (t *ReminderTool) Execute(ctx context.Context, args map[string]any) (*Result, error) {
+	value, _ := args["time"].(string)
+	content, _ := args["content"].(string)
+	if content == "" {
+		return nil, errors.New("缺少提醒内容 content")
+	}
+
+	loc := xremind.LoadLocation(t.template.Timezone, time.Local)
+	dueAt, err := xremind.ParseLocalTime(value, loc)
+	if err != nil {
+		return nil, err
+	}
+
+	r := t.template
+	r.Content = content
+	r.DueAt = dueAt
+	if err := xremind.Add(t.store, &r, t.maxPending, t.now()); err != nil {
+		return nil, err
+	}
+	return TextResult(fmt.Sprintf("已设置提醒: %s %s", dueAt.Format("2006-01-02 15:04"), content)), nil
+}
@@ -0,0 +1,39 @@
+package xtools
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"companions/internal/pkg/xremind"
+)
+
+func TestReminderTool(t *testing.T) {
+	store := xremind.NewInMemory()
+	// 纽约时间 2025-07-31 (星期四) 08:00
+	now := time.Date(2025, 7, 31, 12, 0, 0, 0, time.UTC)
+	tool := newReminderTool(store, xremind.Reminder{UID: "u1", Character: "ani", Timezone: "America/New_York"}, 10, func() time.Time { return now })
+
+	if desc := tool.GetSchema().Description; !strings.Contains(desc, "2025-07-31 08:00 星期四") {
+		t.Errorf("description = %s", desc)
+	}
+
+	tools := NewTools(tool)
+	result, err := tools.CallTool(context.Background(), "set_reminder", map[string]any{"time": "2025-08-01 09:00", "content": "开会"})
+	if err != nil || !strings.Contains(result.Text, "开会") {
+		t.Fatalf("CallTool = %+v, %v", result, err)
+	}
+
+	list, _ := store.List(xremind.Filter{UID: "u1"})
+	if len(list) != 1 {
+		t.Fatalf("list = %+v", list)
+	}
+	if r := list[0]; !r.DueAt.Equal(time.Date(2025, 8, 1, 13, 0, 0, 0, time.UTC)) || r.Character != "ani" || r.Status != xremind.StatusPending {
+		t.Errorf("reminder = %+v", r)
+	}
+
+	if _, err := tools.CallTool(context.Background(), "set_reminder", map[string]any{"time": "2025-07-30 09:00", "content": "开会"}); err == nil {
+		t.Error("过去的时间应该报错")
+	}
+}
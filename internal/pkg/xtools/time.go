@@ -19,8 +19,12 @@ func NewTimeTool() ToolInterface {
 	}
 }
 
-func (t *TimeTool) Execute(ctx context.Context, args map[string]any) (string, error) {
-	return time.Now().Format("2006-01-02 15:04:05"), nil
+func (t *TimeTool) Execute(ctx context.Context, args map[string]any) (*Result, error) {
+	return TextResult(time.Now().Format("2006-01-02 15:04:05")), nil
+}
+
+func (t *TimeTool) GetMeta() Meta {
+	return Meta{}
 }
 
 func (t *TimeTool) GetSchema() xllm.Tool {
@@ -2,48 +2,201 @@ package xtools
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"slices"
+	"strings"
+	"time"
 
 	"companions/internal/pkg/xllm"
 )
 
+// DefaultTimeout 未设置 Meta.Timeout 时单次执行的超时时间
+const DefaultTimeout = 30 * time.Second
+
+var (
+	ErrToolNotFound     = errors.New("工具不存在")
+	ErrDuplicateTool    = errors.New("工具名称重复")
+	ErrInvalidArguments = errors.New("工具参数不合法")
+	ErrNotConfirmed     = errors.New("用户未确认执行")
+)
+
 type ToolInterface interface {
 	GetSchema() xllm.Tool
-	Execute(ctx context.Context, args map[string]any) (string, error)
+	GetMeta() Meta
+	Execute(ctx context.Context, args map[string]any) (*Result, error)
+}
+
+// Meta 工具的执行约束
+type Meta struct {
+	Timeout    time.Duration // 单次执行超时, 0 使用 DefaultTimeout
+	Characters []string      // 允许使用的角色, 为空表示全部角色
+	Silent     bool          // 结果已通过附件或事件展示给用户, 模型回复时不需要复述
+	Confirm    bool          // 执行前需要用户确认
+}
+
+// Allowed 角色是否可以使用该工具
+func (m Meta) Allowed(character string) bool {
+	return len(m.Characters) == 0 || slices.Contains(m.Characters, character)
+}
+
+// Attachment 随回复发送给用户的文件
+type Attachment struct {
+	Type     string `json:"type"` // image | audio | file
+	URL      string `json:"url"`
+	Key      string `json:"key,omitempty"` // 文件存储中的路径, 为空时 URL 为外部地址
+	MimeType string `json:"mime_type,omitempty"`
+	Name     string `json:"name,omitempty"`
 }
 
+// Event 推送给客户端的事件, 如播放音乐、切换场景
+type Event struct {
+	Type string `json:"type"`
+	Data any    `json:"data,omitempty"`
+}
+
+// Result 工具的执行结果, Text 返回给模型, 附件和事件发送给客户端
+type Result struct {
+	Text        string
+	Attachments []Attachment
+	Events      []Event
+}
+
+// TextResult 只有文本的结果
+func TextResult(text string) *Result {
+	return &Result{Text: text}
+}
+
+// Tool 以函数实现的工具
 type Tool struct {
 	Schema  xllm.Tool
-	Execute func(ctx context.Context, args map[string]any) (string, error)
+	Meta    Meta
+	Handler func(ctx context.Context, args map[string]any) (*Result, error)
 }
 
+func (t *Tool) GetSchema() xllm.Tool {
+	return t.Schema
+}
+
+func (t *Tool) GetMeta() Meta {
+	return t.Meta
+}
+
+func (t *Tool) Execute(ctx context.Context, args map[string]any) (*Result, error) {
+	return t.Handler(ctx, args)
+}
+
+// Tools 按名称索引的工具集合, 保留注册顺序
 type Tools struct {
-	tools []ToolInterface
+	tools map[string]ToolInterface
+	names []string
 }
 
+// NewTools 创建工具集合, 名称重复的工具只保留第一个
 func NewTools(tools ...ToolInterface) *Tools {
-	return &Tools{
-		tools: tools,
+	x := &Tools{tools: make(map[string]ToolInterface)}
+	x.AddTool(tools...)
+	return x
+}
+
+// Register 注册工具, 名称重复时返回 ErrDuplicateTool, 已注册的工具不受影响
+func (x *Tools) Register(tools ...ToolInterface) error {
+	var errs []error
+	for _, tool := range tools {
+		name := tool.GetSchema().Name
+		if name == "" {
+			errs = append(errs, errors.New("工具名称为空"))
+			continue
+		}
+		if _, ok := x.tools[name]; ok {
+			errs = append(errs, fmt.Errorf("%w: %s", ErrDuplicateTool, name))
+			continue
+		}
+		x.tools[name] = tool
+		x.names = append(x.names, name)
 	}
+	return errors.Join(errs...)
+}
+
+// AddTool 注册工具, 忽略名称重复的工具
+func (x *Tools) AddTool(tool ...ToolInterface) {
+	_ = x.Register(tool...)
+}
+
+func (x *Tools) Get(name string) (ToolInterface, bool) {
+	tool, ok := x.tools[name]
+	return tool, ok
+}
+
+func (x *Tools) Len() int {
+	return len(x.names)
 }
 
+// GetTools 按注册顺序返回工具定义
 func (x *Tools) GetTools() []xllm.Tool {
-	tools := make([]xllm.Tool, len(x.tools))
-	for i, tool := range x.tools {
-		tools[i] = tool.GetSchema()
+	tools := make([]xllm.Tool, len(x.names))
+	for i, name := range x.names {
+		tools[i] = x.tools[name].GetSchema()
 	}
 	return tools
 }
 
-func (x *Tools) AddTool(tool ...ToolInterface) {
-	x.tools = append(x.tools, tool...)
-}
+// CallTool 校验参数后在超时时间内执行工具
+func (x *Tools) CallTool(ctx context.Context, name string, args map[string]any) (*Result, error) {
+	tool, ok := x.tools[name]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrToolNotFound, name)
+	}
+	if args == nil {
+		args = map[string]any{}
+	}
+	if schema := tool.GetSchema().Schema(); schema != nil {
+		if errs := xllm.Validate(schema, args); len(errs) > 0 {
+			return nil, fmt.Errorf("%w: %s", ErrInvalidArguments, strings.Join(errs, "; "))
+		}
+	}
 
-func (x *Tools) CallTool(ctx context.Context, name string, args map[string]any) (string, error) {
-	for _, tool := range x.tools {
-		if tool.GetSchema().Name == name {
-			return tool.Execute(ctx, args)
+	meta := tool.GetMeta()
+	if meta.Confirm && !confirm(ctx, name, args) {
+		return nil, fmt.Errorf("%w: %s", ErrNotConfirmed, name)
+	}
+
+	timeout := meta.Timeout
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	// 在单独的 goroutine 中执行, 工具不响应 ctx 时也能按时返回
+	type outcome struct {
+		result *Result
+		err    error
+	}
+	done := make(chan outcome, 1)
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				done <- outcome{err: fmt.Errorf("工具 %s 执行异常: %v", name, r)}
+			}
+		}()
+		result, err := tool.Execute(ctx, args)
+		done <- outcome{result: result, err: err}
+	}()
+
+	select {
+	case o := <-done:
+		if o.err != nil {
+			return nil, o.err
+		}
+		if o.result == nil {
+			o.result = &Result{}
+		}
+		return o.result, nil
+	case <-ctx.Done():
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			return nil, fmt.Errorf("工具 %s 执行超时 (%s)", name, timeout)
 		}
+		return nil, ctx.Err()
 	}
-	return "", fmt.Errorf("tool not found")
 }
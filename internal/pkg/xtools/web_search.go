@@ -4,21 +4,25 @@ import (
 	"companions/internal/pkg/tools/websearch"
 	"companions/internal/pkg/xllm"
 	"context"
-	"encoding/json"
-	"os"
+	"errors"
+	"time"
 )
 
-var TavilySearchAPIKey = os.Getenv("TAVILY_API_KEY")
+// maxSpokenSources 返回给模型的搜索结果条数, 语音回复只需要少量要点
+const maxSpokenSources = 3
 
 type WebSearchReq struct {
 	Query string `json:"query"`
 }
 
 type WebSearchTool struct {
-	Schema xllm.Tool
+	Schema   xllm.Tool
+	Meta     Meta
+	searcher websearch.SearchTool
 }
 
-func NewWebSearchTool() ToolInterface {
+// NewWebSearchTool 使用 searcher 搜索, 由 websearch.New 按配置创建; characters 为允许使用的角色
+func NewWebSearchTool(searcher websearch.SearchTool, characters ...string) ToolInterface {
 	return &WebSearchTool{
 		Schema: xllm.Tool{
 			Name:        "web_search",
@@ -32,20 +36,31 @@ func NewWebSearchTool() ToolInterface {
 				},
 			},
 		},
+		Meta: Meta{
+			Timeout:    15 * time.Second,
+			Characters: characters,
+		},
+		searcher: searcher,
 	}
 }
 
-func (t *WebSearchTool) Execute(ctx context.Context, args map[string]any) (string, error) {
-	searchTool := websearch.NewTavilySearchTool(TavilySearchAPIKey)
-	searchResp, err := searchTool.Search(ctx, args["query"].(string))
-	if err != nil {
-		return "", err
+func (t *WebSearchTool) Execute(ctx context.Context, args map[string]any) (*Result, error) {
+	query, _ := args["query"].(string)
+	if query == "" {
+		return nil, errors.New("缺少搜索关键词 query")
 	}
 
-	jsonData, _ := json.Marshal(searchResp)
-	return string(jsonData), nil
+	searchResp, err := t.searcher.Search(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	return TextResult(websearch.Condense(searchResp, maxSpokenSources)), nil
 }
 
 func (t *WebSearchTool) GetSchema() xllm.Tool {
 	return t.Schema
 }
+
+func (t *WebSearchTool) GetMeta() Meta {
+	return t.Meta
+}
@@ -0,0 +1,94 @@
+package xtts
+
+import (
+	"bytes"
+	"companions/internal/conf"
+	"companions/internal/pkg/xstorage"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"strings"
+
+	"github.com/daodao97/xgo/xlog"
+)
+
+var _ TTS = (*Cached)(nil)
+
+// Cached 将合成结果缓存到文件存储, 相同文本和音色参数直接返回缓存, 不再调用 provider
+type Cached struct {
+	tts     TTS
+	storage xstorage.Storage
+	conf    *conf.TTSConfig
+}
+
+// NewCached tts 或 storage 为空时返回原 tts
+func NewCached(tts TTS, storage xstorage.Storage, ttsConf *conf.TTSConfig) TTS {
+	if tts == nil || storage == nil {
+		return tts
+	}
+	return &Cached{tts: tts, storage: storage, conf: ttsConf}
+}
+
+func (c *Cached) TextToSpeech(req AudioReq) (AudioStream, error) {
+	ctx := context.Background()
+	format := c.format(req)
+	key := c.key(req, format)
+
+	if data, err := c.storage.Get(ctx, key); err == nil {
+		xlog.DebugC(ctx, "TTS命中缓存", xlog.String("key", key))
+		stream := make(AudioStream, 1)
+		stream <- AudioChunk{Data: base64.StdEncoding.EncodeToString(data), Format: format}
+		close(stream)
+		return stream, nil
+	}
+
+	upstream, err := c.tts.TextToSpeech(req)
+	if err != nil {
+		return nil, err
+	}
+
+	stream := make(AudioStream, cap(upstream))
+	go func() {
+		defer close(stream)
+
+		var audio bytes.Buffer
+		complete := true
+		for chunk := range upstream {
+			data, err := base64.StdEncoding.DecodeString(chunk.Data)
+			if err != nil {
+				complete = false
+			}
+			audio.Write(data)
+			stream <- chunk
+		}
+		if !complete || audio.Len() == 0 {
+			return
+		}
+		if _, err := c.storage.Put(ctx, key, audio.Bytes(), "audio/"+format); err != nil {
+			xlog.ErrorC(ctx, "保存TTS缓存失败", xlog.String("key", key), xlog.Err(err))
+		}
+	}()
+	return stream, nil
+}
+
+func (c *Cached) format(req AudioReq) string {
+	if req.Format != "" {
+		return req.Format
+	}
+	if c.conf != nil && c.conf.Format != "" {
+		return c.conf.Format
+	}
+	return "mp3"
+}
+
+// key 由 provider、模型、音色参数和文本计算, 任一参数变化都不会命中旧缓存
+func (c *Cached) key(req AudioReq, format string) string {
+	parts := []string{req.Text, req.Model, req.Voice, req.Speed, req.Vol, req.Pitch, format}
+	if c.conf != nil {
+		parts = append(parts, c.conf.Provider, c.conf.Model, c.conf.Voice, c.conf.Speed, c.conf.Volume, c.conf.Pitch)
+	}
+	sum := sha256.Sum256([]byte(strings.Join(parts, "\x00")))
+	hash := hex.EncodeToString(sum[:])
+	return "tts/" + hash[:2] + "/" + hash + "." + format
+}
@@ -0,0 +1,61 @@
+package xtts
+
+import (
+	"companions/internal/conf"
+	"companions/internal/pkg/xstorage"
+	"encoding/base64"
+	"testing"
+)
+
+// countingTTS 记录实际调用 provider 的次数
+type countingTTS struct {
+	TTS
+	calls int
+}
+
+func (c *countingTTS) TextToSpeech(req AudioReq) (AudioStream, error) {
+	c.calls++
+	return c.TTS.TextToSpeech(req)
+}
+
+func readAudio(t *testing.T, tts TTS, text string) string {
+	t.Helper()
+	stream, err := tts.TextToSpeech(AudioReq{Text: text})
+	if err != nil {
+		t.Fatalf("TextToSpeech 失败: %v", err)
+	}
+	var audio []byte
+	for chunk := range stream {
+		data, _ := base64.StdEncoding.DecodeString(chunk.Data)
+		audio = append(audio, data...)
+	}
+	return string(audio)
+}
+
+func TestCached(t *testing.T) {
+	ttsConf := &conf.TTSConfig{Provider: "fake", Voice: "ani"}
+	upstream := &countingTTS{TTS: NewFake(ttsConf)}
+	storage := xstorage.NewLocal(t.TempDir(), "/uploads")
+	tts := NewCached(upstream, storage, ttsConf)
+
+	if audio := readAudio(t, tts, "你好"); audio != "你好" || upstream.calls != 1 {
+		t.Fatalf("audio = %q, calls = %d", audio, upstream.calls)
+	}
+	if audio := readAudio(t, tts, "你好"); audio != "你好" || upstream.calls != 1 {
+		t.Errorf("缓存未命中: audio = %q, calls = %d", audio, upstream.calls)
+	}
+	if audio := readAudio(t, tts, "再见"); audio != "再见" || upstream.calls != 2 {
+		t.Errorf("audio = %q, calls = %d", audio, upstream.calls)
+	}
+
+	// 音色变化后不命中旧缓存
+	other := NewCached(upstream, storage, &conf.TTSConfig{Provider: "fake", Voice: "other"})
+	readAudio(t, other, "你好")
+	if upstream.calls != 3 {
+		t.Errorf("calls = %d, want 3", upstream.calls)
+	}
+
+	if NewCached(upstream, nil, ttsConf) != TTS(upstream) {
+		t.Error("未配置存储时应返回原 TTS")
+	}
+}
@@ -0,0 +1,34 @@
+package xtts
+
+import (
+	"companions/internal/conf"
+	"encoding/base64"
+)
+
+// Fake 不访问网络的 TTS, 将文本原样编码为音频数据返回, 用于 CI 和离线开发
+type Fake struct {
+	Format string
+}
+
+func NewFake(ttsConf *conf.TTSConfig) *Fake {
+	format := ttsConf.Format
+	if format == "" {
+		format = "mp3"
+	}
+	return &Fake{Format: format}
+}
+
+func (f *Fake) TextToSpeech(req AudioReq) (AudioStream, error) {
+	format := req.Format
+	if format == "" {
+		format = f.Format
+	}
+
+	stream := make(AudioStream, 1)
+	stream <- AudioChunk{
+		Data:   base64.StdEncoding.EncodeToString([]byte(req.Text)),
+		Format: format,
+	}
+	close(stream)
+	return stream, nil
+}
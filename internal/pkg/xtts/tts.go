@@ -27,6 +27,8 @@ func New(ttsConf *conf.TTSConfig) TTS {
 	switch ttsConf.Provider {
 	case "minimax":
 		return NewMinimax(ttsConf)
+	case "fake":
+		return NewFake(ttsConf)
 	}
 	return nil
 }
@@ -0,0 +1,54 @@
+package xusage
+
+import (
+	"companions/internal/pkg/xllm"
+	"context"
+)
+
+type meterKey struct{}
+
+// WithContext 将本轮对话的计量器放入 ctx, 供 ContextLLM 按用户记录用量
+func WithContext(ctx context.Context, m *Meter) context.Context {
+	return context.WithValue(ctx, meterKey{}, m)
+}
+
+// FromContext ctx 中的计量器, 没有时返回 nil
+func FromContext(ctx context.Context) *Meter {
+	m, _ := ctx.Value(meterKey{}).(*Meter)
+	return m
+}
+
+// ContextLLM 包装创建时还不知道用户的模型 (如内容审核), 每次调用记到 ctx 中的计量器, ctx 中没有时记到 fallback
+func ContextLLM(task string, llm xllm.LLM, fallback *Meter) xllm.LLM {
+	return &contextLLM{LLM: llm, task: task, fallback: fallback}
+}
+
+type contextLLM struct {
+	xllm.LLM
+	task     string
+	fallback *Meter
+}
+
+func (l *contextLLM) metered(ctx context.Context) xllm.LLM {
+	m := FromContext(ctx)
+	if m == nil {
+		m = l.fallback
+	}
+	return m.LLM(l.task, l.LLM)
+}
+
+func (l *contextLLM) Chat(ctx context.Context, req xllm.Request) (*xllm.Response, error) {
+	return l.metered(ctx).Chat(ctx, req)
+}
+
+func (l *contextLLM) ChatRaw(ctx context.Context, body []byte) (*xllm.Response, error) {
+	return l.metered(ctx).ChatRaw(ctx, body)
+}
+
+func (l *contextLLM) ChatStream(ctx context.Context, req xllm.Request) (chan *xllm.Response, error) {
+	return l.metered(ctx).ChatStream(ctx, req)
+}
+
+func (l *contextLLM) ChatStreamRaw(ctx context.Context, body []byte) (chan *xllm.Response, error) {
+	return l.metered(ctx).ChatStreamRaw(ctx, body)
+}
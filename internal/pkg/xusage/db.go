@@ -0,0 +1,90 @@
+package xusage
+
+import (
+	"time"
+
+	"github.com/daodao97/xgo/xdb"
+)
+
+var _ Store = (*DBStore)(nil)
+
+// DBStore 基于 xdb 的用量存储, 对应 companion_usage 表
+type DBStore struct {
+	model xdb.Model
+}
+
+func NewDBStore(model xdb.Model) *DBStore {
+	return &DBStore{model: model}
+}
+
+func (s *DBStore) Insert(records ...Record) error {
+	if len(records) == 0 {
+		return nil
+	}
+	rows := make([]xdb.Record, 0, len(records))
+	for _, r := range records {
+		rows = append(rows, xdb.Record{
+			"uid":               r.UID,
+			"conversation_id":   r.ConversationID,
+			"message_id":        r.MessageID,
+			"kind":              r.Kind,
+			"task":              r.Task,
+			"provider":          r.Provider,
+			"model":             r.Model,
+			"prompt_tokens":     r.PromptTokens,
+			"completion_tokens": r.CompletionTokens,
+			"audio_seconds":     r.AudioSeconds,
+			"characters":        r.Characters,
+			"cost":              r.Cost,
+			"created_at":        r.CreatedAt,
+		})
+	}
+	_, err := s.model.InsertBatch(rows)
+	return err
+}
+
+// Records 聚合在应用层完成, 查询条件需要带上 uid 或时间范围避免全表扫描
+func (s *DBStore) Records(filter Filter) ([]Record, error) {
+	opts := []xdb.Option{xdb.OrderByAsc("id")}
+	if filter.UID != "" {
+		opts = append(opts, xdb.WhereEq("uid", filter.UID))
+	}
+	if filter.ConversationID != "" {
+		opts = append(opts, xdb.WhereEq("conversation_id", filter.ConversationID))
+	}
+	if !filter.From.IsZero() {
+		opts = append(opts, xdb.WhereGe("created_at", filter.From))
+	}
+	if !filter.To.IsZero() {
+		opts = append(opts, xdb.WhereLt("created_at", filter.To))
+	}
+
+	list, err := s.model.Selects(opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	records := make([]Record, 0, len(list))
+	for _, item := range list {
+		var createdAt time.Time
+		if t := item.GetTime("created_at"); t != nil {
+			createdAt = *t
+		}
+		records = append(records, Record{
+			UID:              item.GetString("uid"),
+			ConversationID:   item.GetString("conversation_id"),
+			MessageID:        item.GetString("message_id"),
+			Kind:             item.GetString("kind"),
+			Task:             item.GetString("task"),
+			Provider:         item.GetString("provider"),
+			Model:            item.GetString("model"),
+			PromptTokens:     item.GetInt("prompt_tokens"),
+			CompletionTokens: item.GetInt("completion_tokens"),
+			AudioSeconds:     item.GetFloat64("audio_seconds"),
+			Characters:       item.GetInt("characters"),
+			Cost:             item.GetFloat64("cost"),
+			CreatedAt:        createdAt,
+		})
+	}
+	return records, nil
+}
@@ -0,0 +1,35 @@
+package xusage
+
+import "sync"
+
+var _ Store = (*InMemory)(nil)
+
+// InMemory 进程内用量存储, 用于测试和单机开发, 重启后数据丢失
+type InMemory struct {
+	mu      sync.RWMutex
+	records []Record
+}
+
+func NewInMemory() *InMemory {
+	return &InMemory{}
+}
+
+func (m *InMemory) Insert(records ...Record) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.records = append(m.records, records...)
+	return nil
+}
+
+func (m *InMemory) Records(filter Filter) ([]Record, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var records []Record
+	for _, r := range m.records {
+		if filter.match(r) {
+			records = append(records, r)
+		}
+	}
+	return records, nil
+}
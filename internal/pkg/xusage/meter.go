@@ -0,0 +1,246 @@
+package xusage
+
+import (
+	"companions/internal/conf"
+	"companions/internal/pkg/xllm"
+	"companions/internal/pkg/xstt"
+	"companions/internal/pkg/xtts"
+	"context"
+	"sync"
+	"time"
+
+	"github.com/daodao97/xgo/xlog"
+)
+
+type MeterOption func(*Meter)
+
+// WithPrices 模型单价, key 为模型名称
+func WithPrices(prices map[string]conf.PriceConfig) MeterOption {
+	return func(m *Meter) {
+		m.prices = prices
+	}
+}
+
+// WithConversation 用量归属的会话
+func WithConversation(conversationID string) MeterOption {
+	return func(m *Meter) {
+		m.conversationID = conversationID
+	}
+}
+
+// Meter 记录一个用户的 LLM/STT/TTS 用量, 通过包装对应的客户端在每次调用后写入 Store
+// 记录失败只打印日志, 不影响调用本身
+type Meter struct {
+	store  Store
+	prices map[string]conf.PriceConfig
+	uid    string
+
+	mu             sync.RWMutex
+	conversationID string
+	messageID      string
+}
+
+func NewMeter(store Store, uid string, opts ...MeterOption) *Meter {
+	meter := &Meter{
+		store: store,
+		uid:   uid,
+	}
+	for _, opt := range opts {
+		opt(meter)
+	}
+	return meter
+}
+
+// Bind 设置后续用量归属的会话和消息, 会话在工作流开始后才能确定
+func (m *Meter) Bind(conversationID string, messageID string) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.conversationID = conversationID
+	m.messageID = messageID
+}
+
+// Record 补全归属和费用后写入存储
+func (m *Meter) Record(r Record) {
+	if m == nil || m.store == nil {
+		return
+	}
+
+	m.mu.RLock()
+	r.UID = m.uid
+	r.ConversationID = m.conversationID
+	r.MessageID = m.messageID
+	m.mu.RUnlock()
+
+	if r.CreatedAt.IsZero() {
+		r.CreatedAt = time.Now()
+	}
+	r.Cost = Cost(m.prices, r)
+
+	if err := m.store.Insert(r); err != nil {
+		xlog.Error("记录用量失败", xlog.String("kind", r.Kind), xlog.String("model", r.Model), xlog.Err(err))
+	}
+}
+
+// LLM 包装模型, task 为 xllm.Task* 路由任务
+func (m *Meter) LLM(task string, llm xllm.LLM) xllm.LLM {
+	if m == nil || m.store == nil || llm == nil {
+		return llm
+	}
+	return &meteredLLM{LLM: llm, meter: m, task: task}
+}
+
+// TTS 包装语音合成, 按合成的字符数计量
+func (m *Meter) TTS(tts xtts.TTS, provider string, model string) xtts.TTS {
+	if m == nil || m.store == nil || tts == nil {
+		return tts
+	}
+	return &meteredTTS{TTS: tts, meter: m, provider: provider, model: model}
+}
+
+// STT 包装语音识别, 按音频时长计量
+func (m *Meter) STT(stt xstt.STT, provider string, model string) xstt.STT {
+	if m == nil || m.store == nil || stt == nil {
+		return stt
+	}
+	return &meteredSTT{STT: stt, meter: m, provider: provider, model: model}
+}
+
+type meteredLLM struct {
+	xllm.LLM
+	meter *Meter
+	task  string
+}
+
+func (l *meteredLLM) Chat(ctx context.Context, req xllm.Request) (*xllm.Response, error) {
+	response, err := l.LLM.Chat(ctx, req)
+	if err == nil {
+		l.record(response.Model, response.Usage)
+	}
+	return response, err
+}
+
+func (l *meteredLLM) ChatRaw(ctx context.Context, body []byte) (*xllm.Response, error) {
+	response, err := l.LLM.ChatRaw(ctx, body)
+	if err == nil {
+		l.record(response.Model, response.Usage)
+	}
+	return response, err
+}
+
+func (l *meteredLLM) ChatStream(ctx context.Context, req xllm.Request) (chan *xllm.Response, error) {
+	stream, err := l.LLM.ChatStream(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	return l.stream(stream), nil
+}
+
+func (l *meteredLLM) ChatStreamRaw(ctx context.Context, body []byte) (chan *xllm.Response, error) {
+	stream, err := l.LLM.ChatStreamRaw(ctx, body)
+	if err != nil {
+		return nil, err
+	}
+	return l.stream(stream), nil
+}
+
+// stream 转发分片, 流结束后记录最后一个带 usage 的分片
+func (l *meteredLLM) stream(stream chan *xllm.Response) chan *xllm.Response {
+	ch := make(chan *xllm.Response)
+	go func() {
+		defer close(ch)
+		var (
+			model string
+			usage *xllm.Usage
+		)
+		for response := range stream {
+			if response.Model != "" {
+				model = response.Model
+			}
+			if response.Usage != nil {
+				usage = response.Usage
+			}
+			ch <- response
+		}
+		l.record(model, usage)
+	}()
+	return ch
+}
+
+// record name 为 xllm.Router 返回的模型配置名称, 从配置中取 provider 和实际模型
+func (l *meteredLLM) record(name string, usage *xllm.Usage) {
+	if usage == nil {
+		return
+	}
+	r := Record{
+		Kind:             KindLLM,
+		Task:             l.task,
+		Model:            name,
+		PromptTokens:     usage.PromptTokens,
+		CompletionTokens: usage.CompletionTokens,
+	}
+	if c := conf.Get(); c != nil && name != "" {
+		if llmConf := c.GetLLM(name); llmConf != nil {
+			r.Provider = llmConf.Provider
+			r.Model = llmConf.Model
+		}
+	}
+	l.meter.Record(r)
+}
+
+type meteredTTS struct {
+	xtts.TTS
+	meter    *Meter
+	provider string
+	model    string
+}
+
+func (t *meteredTTS) TextToSpeech(req xtts.AudioReq) (xtts.AudioStream, error) {
+	stream, err := t.TTS.TextToSpeech(req)
+	if err != nil {
+		return nil, err
+	}
+
+	model := t.model
+	if req.Model != "" {
+		model = req.Model
+	}
+
+	ch := make(xtts.AudioStream)
+	go func() {
+		defer close(ch)
+		for chunk := range stream {
+			ch <- chunk
+		}
+		t.meter.Record(Record{
+			Kind:       KindTTS,
+			Provider:   t.provider,
+			Model:      model,
+			Characters: len([]rune(req.Text)),
+		})
+	}()
+	return ch, nil
+}
+
+type meteredSTT struct {
+	xstt.STT
+	meter    *Meter
+	provider string
+	model    string
+}
+
+func (s *meteredSTT) SpeechToText(ctx context.Context, req xstt.SpeechToTextReq) (*xstt.SpeechToTextResp, error) {
+	response, err := s.STT.SpeechToText(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	s.meter.Record(Record{
+		Kind:         KindSTT,
+		Provider:     s.provider,
+		Model:        s.model,
+		AudioSeconds: response.Duration,
+	})
+	return response, nil
+}
@@ -0,0 +1,92 @@
+package xusage
+
+import (
+	"companions/internal/conf"
+	"companions/internal/pkg/xllm"
+	"companions/internal/pkg/xstt"
+	"companions/internal/pkg/xtts"
+	"context"
+	"testing"
+)
+
+type stubSTT struct{}
+
+func (stubSTT) SpeechToText(ctx context.Context, req xstt.SpeechToTextReq) (*xstt.SpeechToTextResp, error) {
+	return &xstt.SpeechToTextResp{Text: "你好", Duration: 12}, nil
+}
+
+func TestMeter(t *testing.T) {
+	store := NewInMemory()
+	meter := NewMeter(store, "1", WithPrices(map[string]conf.PriceConfig{
+		"speech-02-hd": {Character: 1e6},
+	}))
+	meter.Bind("c1", "m1")
+
+	llm := meter.LLM(xllm.TaskChat, xllm.NewFake())
+	req := xllm.Request{Messages: []xllm.Message{{Role: xllm.RoleUser, Content: xllm.NewTextContent("hi")}}}
+	if _, err := llm.Chat(context.Background(), req); err != nil {
+		t.Fatalf("Chat 失败: %v", err)
+	}
+
+	stream, err := llm.ChatStream(context.Background(), req)
+	if err != nil {
+		t.Fatalf("ChatStream 失败: %v", err)
+	}
+	for range stream {
+	}
+
+	audio, err := meter.TTS(xtts.NewFake(&conf.TTSConfig{}), "minimax", "speech-02-hd").TextToSpeech(xtts.AudioReq{Text: "你好呀"})
+	if err != nil {
+		t.Fatalf("TextToSpeech 失败: %v", err)
+	}
+	for range audio {
+	}
+
+	if _, err := meter.STT(stubSTT{}, "openai", "whisper-1").SpeechToText(context.Background(), xstt.SpeechToTextReq{}); err != nil {
+		t.Fatalf("SpeechToText 失败: %v", err)
+	}
+
+	records, _ := store.Records(Filter{UID: "1", ConversationID: "c1"})
+	if len(records) != 4 {
+		t.Fatalf("records = %+v", records)
+	}
+	for _, r := range records[:2] {
+		if r.Kind != KindLLM || r.Task != xllm.TaskChat || r.MessageID != "m1" || r.PromptTokens != 2 || r.CompletionTokens == 0 {
+			t.Errorf("llm record = %+v", r)
+		}
+	}
+	if r := records[2]; r.Kind != KindTTS || r.Characters != 3 || r.Cost != 3 || r.Provider != "minimax" {
+		t.Errorf("tts record = %+v", r)
+	}
+	if r := records[3]; r.Kind != KindSTT || r.AudioSeconds != 12 || r.Model != "whisper-1" {
+		t.Errorf("stt record = %+v", r)
+	}
+}
+
+func TestMeter_NoStore(t *testing.T) {
+	llm := xllm.NewFake()
+	if got := NewMeter(nil, "1").LLM(xllm.TaskChat, llm); got != llm {
+		t.Errorf("没有存储时应返回原模型")
+	}
+	var meter *Meter
+	meter.Bind("c1", "m1")
+}
+
+func TestContextLLM(t *testing.T) {
+	store := NewInMemory()
+	llm := ContextLLM(xllm.TaskModeration, xllm.NewFake(), NewMeter(store, ""))
+	req := xllm.Request{Messages: []xllm.Message{{Role: xllm.RoleUser, Content: xllm.NewTextContent("hi")}}}
+
+	// ctx 中有计量器时记到该用户, 否则记到 fallback
+	if _, err := llm.Chat(WithContext(context.Background(), NewMeter(store, "1")), req); err != nil {
+		t.Fatalf("Chat 失败: %v", err)
+	}
+	if _, err := llm.Chat(context.Background(), req); err != nil {
+		t.Fatalf("Chat 失败: %v", err)
+	}
+
+	records, _ := store.Records(Filter{})
+	if len(records) != 2 || records[0].UID != "1" || records[1].UID != "" || records[0].Task != xllm.TaskModeration {
+		t.Errorf("records = %+v", records)
+	}
+}
@@ -0,0 +1,188 @@
+package xusage
+
+import (
+	"companions/internal/conf"
+	"errors"
+	"sort"
+	"time"
+)
+
+// 用量类型
+const (
+	KindLLM = "llm"
+	KindSTT = "stt"
+	KindTTS = "tts"
+)
+
+// 聚合维度
+const (
+	GroupByDay          = "day"
+	GroupByConversation = "conversation"
+	GroupByModel        = "model"
+	GroupByKind         = "kind"
+)
+
+// ErrQuotaExceeded 用户当日用量超过配额
+var ErrQuotaExceeded = errors.New("今日用量已达上限")
+
+// Record 一次 LLM/STT/TTS 调用的用量
+type Record struct {
+	UID              string    `json:"uid"`
+	ConversationID   string    `json:"conversation_id"`
+	MessageID        string    `json:"message_id"`
+	Kind             string    `json:"kind"`
+	Task             string    `json:"task"`
+	Provider         string    `json:"provider"`
+	Model            string    `json:"model"`
+	PromptTokens     int       `json:"prompt_tokens"`
+	CompletionTokens int       `json:"completion_tokens"`
+	AudioSeconds     float64   `json:"audio_seconds"`
+	Characters       int       `json:"characters"`
+	Cost             float64   `json:"cost"`
+	CreatedAt        time.Time `json:"created_at"`
+}
+
+// Summary 聚合后的用量, Key 为分组值 (日期、会话 id 或模型名称)
+type Summary struct {
+	Key              string  `json:"key"`
+	Requests         int     `json:"requests"`
+	PromptTokens     int     `json:"prompt_tokens"`
+	CompletionTokens int     `json:"completion_tokens"`
+	TotalTokens      int     `json:"total_tokens"`
+	AudioSeconds     float64 `json:"audio_seconds"`
+	Characters       int     `json:"characters"`
+	Cost             float64 `json:"cost"`
+}
+
+func (s *Summary) add(r Record) {
+	s.Requests++
+	s.PromptTokens += r.PromptTokens
+	s.CompletionTokens += r.CompletionTokens
+	s.TotalTokens += r.PromptTokens + r.CompletionTokens
+	s.AudioSeconds += r.AudioSeconds
+	s.Characters += r.Characters
+	s.Cost += r.Cost
+}
+
+// Filter 查询条件, 零值字段不参与过滤, 时间范围为 [From, To)
+type Filter struct {
+	UID            string
+	ConversationID string
+	From           time.Time
+	To             time.Time
+}
+
+func (f Filter) match(r Record) bool {
+	if f.UID != "" && r.UID != f.UID {
+		return false
+	}
+	if f.ConversationID != "" && r.ConversationID != f.ConversationID {
+		return false
+	}
+	if !f.From.IsZero() && r.CreatedAt.Before(f.From) {
+		return false
+	}
+	if !f.To.IsZero() && !r.CreatedAt.Before(f.To) {
+		return false
+	}
+	return true
+}
+
+// Store 用量存储
+type Store interface {
+	Insert(records ...Record) error
+	Records(filter Filter) ([]Record, error)
+}
+
+// Aggregate 按维度聚合用量, groupBy 为空时返回一条总计
+func Aggregate(records []Record, groupBy string) []Summary {
+	summaries := make(map[string]*Summary)
+	for _, r := range records {
+		key := groupKey(r, groupBy)
+		summary, ok := summaries[key]
+		if !ok {
+			summary = &Summary{Key: key}
+			summaries[key] = summary
+		}
+		summary.add(r)
+	}
+
+	result := make([]Summary, 0, len(summaries))
+	for _, summary := range summaries {
+		result = append(result, *summary)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Key < result[j].Key
+	})
+	return result
+}
+
+func groupKey(r Record, groupBy string) string {
+	switch groupBy {
+	case GroupByDay:
+		return r.CreatedAt.Format(time.DateOnly)
+	case GroupByConversation:
+		return r.ConversationID
+	case GroupByModel:
+		return r.Model
+	case GroupByKind:
+		return r.Kind
+	}
+	return ""
+}
+
+// Total 汇总符合条件的用量
+func Total(store Store, filter Filter) (Summary, error) {
+	records, err := store.Records(filter)
+	if err != nil {
+		return Summary{}, err
+	}
+	var total Summary
+	for _, r := range records {
+		total.add(r)
+	}
+	return total, nil
+}
+
+// Cost 按单价计算费用, 未配置单价的模型费用为 0
+func Cost(prices map[string]conf.PriceConfig, r Record) float64 {
+	price, ok := prices[r.Model]
+	if !ok {
+		return 0
+	}
+	return float64(r.PromptTokens)*price.Input/1e6 +
+		float64(r.CompletionTokens)*price.Output/1e6 +
+		r.AudioSeconds*price.AudioMinute/60 +
+		float64(r.Characters)*price.Character/1e6
+}
+
+// CheckQuota 检查用户当日 (本地时间) 用量是否超过配额, 匿名用户和未配置配额时不检查
+func CheckQuota(store Store, uid string, quota conf.QuotaConfig) error {
+	if store == nil || uid == "" || (quota.DailyTokens <= 0 && quota.DailyAudioSeconds <= 0 && quota.DailyCost <= 0) {
+		return nil
+	}
+
+	now := time.Now()
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	total, err := Total(store, Filter{UID: uid, From: today})
+	if err != nil {
+		return err
+	}
+
+	if quota.DailyTokens > 0 && total.TotalTokens >= quota.DailyTokens {
+		return ErrQuotaExceeded
+	}
+	if quota.DailyAudioSeconds > 0 && total.AudioSeconds >= quota.DailyAudioSeconds {
+		return ErrQuotaExceeded
+	}
+	if quota.DailyCost > 0 && total.Cost >= quota.DailyCost {
+		return ErrQuotaExceeded
+	}
+	return nil
+}
+
+// UntilReset 距离配额重置 (次日零点) 的时间, 超出配额时用作 Retry-After
+func UntilReset(now time.Time) time.Duration {
+	tomorrow := time.Date(now.Year(), now.Month(), now.Day()+1, 0, 0, 0, 0, now.Location())
+	return tomorrow.Sub(now)
+}
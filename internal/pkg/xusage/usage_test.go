@@ -0,0 +1,90 @@
+package xusage
+
+import (
+	"companions/internal/conf"
+	"errors"
+	"math"
+	"testing"
+	"time"
+)
+
+func TestAggregate(t *testing.T) {
+	day1 := time.Date(2025, 7, 1, 10, 0, 0, 0, time.Local)
+	day2 := day1.AddDate(0, 0, 1)
+	records := []Record{
+		{ConversationID: "c1", Model: "gpt-4o-mini", PromptTokens: 100, CompletionTokens: 20, Cost: 0.1, CreatedAt: day1},
+		{ConversationID: "c1", Model: "speech-02-hd", Characters: 30, Cost: 0.2, CreatedAt: day1},
+		{ConversationID: "c2", Model: "gpt-4o-mini", PromptTokens: 50, CompletionTokens: 10, CreatedAt: day2},
+	}
+
+	byDay := Aggregate(records, GroupByDay)
+	if len(byDay) != 2 || byDay[0].Key != "2025-07-01" || byDay[0].Requests != 2 || byDay[0].TotalTokens != 120 || byDay[0].Characters != 30 {
+		t.Errorf("byDay = %+v", byDay)
+	}
+
+	byModel := Aggregate(records, GroupByModel)
+	if len(byModel) != 2 || byModel[0].Key != "gpt-4o-mini" || byModel[0].TotalTokens != 180 {
+		t.Errorf("byModel = %+v", byModel)
+	}
+
+	total := Aggregate(records, "")
+	if len(total) != 1 || total[0].Requests != 3 || math.Abs(total[0].Cost-0.3) > 1e-9 {
+		t.Errorf("total = %+v", total)
+	}
+}
+
+func TestCost(t *testing.T) {
+	prices := map[string]conf.PriceConfig{
+		"gpt-4o-mini":  {Input: 0.15, Output: 0.6},
+		"whisper-1":    {AudioMinute: 0.006},
+		"speech-02-hd": {Character: 50},
+	}
+	tests := []struct {
+		record Record
+		want   float64
+	}{
+		{Record{Model: "gpt-4o-mini", PromptTokens: 1000000, CompletionTokens: 500000}, 0.45},
+		{Record{Model: "whisper-1", AudioSeconds: 30}, 0.003},
+		{Record{Model: "speech-02-hd", Characters: 1000}, 0.05},
+		{Record{Model: "unknown", PromptTokens: 1000}, 0},
+	}
+	for _, tt := range tests {
+		if got := Cost(prices, tt.record); math.Abs(got-tt.want) > 1e-9 {
+			t.Errorf("Cost(%+v) = %v, want %v", tt.record, got, tt.want)
+		}
+	}
+}
+
+func TestCheckQuota(t *testing.T) {
+	store := NewInMemory()
+	store.Insert(
+		Record{UID: "1", PromptTokens: 80, CompletionTokens: 20, Cost: 0.5, CreatedAt: time.Now()},
+		// 昨天的用量不计入
+		Record{UID: "1", PromptTokens: 1000, CreatedAt: time.Now().AddDate(0, 0, -1)},
+		Record{UID: "2", PromptTokens: 1000, CreatedAt: time.Now()},
+	)
+
+	if err := CheckQuota(store, "1", conf.QuotaConfig{DailyTokens: 101}); err != nil {
+		t.Errorf("under quota: %v", err)
+	}
+	if err := CheckQuota(store, "1", conf.QuotaConfig{DailyTokens: 100}); !errors.Is(err, ErrQuotaExceeded) {
+		t.Errorf("tokens quota: %v", err)
+	}
+	if err := CheckQuota(store, "1", conf.QuotaConfig{DailyCost: 0.5}); !errors.Is(err, ErrQuotaExceeded) {
+		t.Errorf("cost quota: %v", err)
+	}
+	store.Insert(Record{UID: "3", AudioSeconds: 60, CreatedAt: time.Now()})
+	if err := CheckQuota(store, "3", conf.QuotaConfig{DailyAudioSeconds: 60}); !errors.Is(err, ErrQuotaExceeded) {
+		t.Errorf("audio quota: %v", err)
+	}
+	if err := CheckQuota(store, "", conf.QuotaConfig{DailyTokens: 1}); err != nil {
+		t.Errorf("anonymous: %v", err)
+	}
+}
+
+func TestUntilReset(t *testing.T) {
+	now := time.Date(2025, 7, 31, 23, 59, 0, 0, time.Local)
+	if got := UntilReset(now); got != time.Minute {
+		t.Errorf("UntilReset() = %v, want 1m", got)
+	}
+}
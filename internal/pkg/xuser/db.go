@@ -0,0 +1,106 @@
+package xuser
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/daodao97/xgo/xdb"
+)
+
+var _ Store = (*DBStore)(nil)
+
+// DBStore 基于 xdb 的用户存储, 对应 companion_user 表
+type DBStore struct {
+	model xdb.Model
+}
+
+func NewDBStore(model xdb.Model) *DBStore {
+	return &DBStore{model: model}
+}
+
+func (s *DBStore) Create(user *User) error {
+	id, err := s.model.Insert(xdb.Record{
+		"email":         nullString(user.Email),
+		"password_hash": user.PasswordHash,
+		"nickname":      user.Nickname,
+		"is_guest":      user.IsGuest,
+		"is_adult":      user.Adult,
+		"status":        user.Status,
+		"token_version": user.TokenVersion,
+		"created_at":    user.CreatedAt,
+	})
+	if err != nil {
+		return emailError(err)
+	}
+	user.ID = strconv.FormatInt(id, 10)
+	return nil
+}
+
+func (s *DBStore) Get(id string) (*User, error) {
+	return s.first(xdb.WhereEq("id", id))
+}
+
+func (s *DBStore) FindByEmail(email string) (*User, error) {
+	return s.first(xdb.WhereEq("email", email))
+}
+
+func (s *DBStore) Update(user *User) error {
+	_, err := s.model.Update(xdb.Record{
+		"email":         nullString(user.Email),
+		"password_hash": user.PasswordHash,
+		"nickname":      user.Nickname,
+		"is_guest":      user.IsGuest,
+		"is_adult":      user.Adult,
+		"status":        user.Status,
+		"token_version": user.TokenVersion,
+		"updated_at":    time.Now(),
+	}, xdb.WhereEq("id", user.ID))
+	return emailError(err)
+}
+
+func (s *DBStore) first(opts ...xdb.Option) (*User, error) {
+	record, err := s.model.First(opts...)
+	if errors.Is(err, xdb.ErrNotFound) {
+		return nil, ErrUserNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	user := &User{
+		ID:           record.GetString("id"),
+		Email:        record.GetString("email"),
+		PasswordHash: record.GetString("password_hash"),
+		Nickname:     record.GetString("nickname"),
+		IsGuest:      record.GetBool("is_guest"),
+		Adult:        record.GetBool("is_adult"),
+		Status:       record.GetInt("status"),
+		TokenVersion: record.GetInt("token_version"),
+	}
+	if t := record.GetTime("created_at"); t != nil {
+		user.CreatedAt = *t
+	}
+	return user, nil
+}
+
+// emailError 注册时先查邮箱再写入, 并发注册同一邮箱时由 email 唯一索引拦截, 转换为 ErrEmailTaken
+// 表中只有 email 一个唯一索引, MySQL 返回 Duplicate entry (1062), SQLite 返回 UNIQUE constraint failed
+func emailError(err error) error {
+	if err == nil {
+		return nil
+	}
+	if msg := err.Error(); strings.Contains(msg, "Duplicate entry") || strings.Contains(msg, "UNIQUE constraint failed") {
+		return ErrEmailTaken
+	}
+	return err
+}
+
+// nullString 游客没有邮箱, 写入 NULL 避免与 email 唯一索引冲突
+func nullString(s string) any {
+	if s == "" {
+		return nil
+	}
+	return s
+}
@@ -0,0 +1,72 @@
+package xuser
+
+import (
+	"strconv"
+	"sync"
+)
+
+var _ Store = (*InMemory)(nil)
+
+// InMemory 进程内用户存储, 用于测试和单机开发, 重启后数据丢失
+type InMemory struct {
+	mu     sync.RWMutex
+	nextID int
+	users  map[string]User
+}
+
+func NewInMemory() *InMemory {
+	return &InMemory{users: make(map[string]User)}
+}
+
+func (m *InMemory) Create(user *User) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if user.Email != "" && m.findByEmail(user.Email) != nil {
+		return ErrEmailTaken
+	}
+	m.nextID++
+	user.ID = strconv.Itoa(m.nextID)
+	m.users[user.ID] = *user
+	return nil
+}
+
+func (m *InMemory) Get(id string) (*User, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	user, ok := m.users[id]
+	if !ok {
+		return nil, ErrUserNotFound
+	}
+	return &user, nil
+}
+
+func (m *InMemory) FindByEmail(email string) (*User, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if user := m.findByEmail(email); user != nil {
+		return user, nil
+	}
+	return nil, ErrUserNotFound
+}
+
+func (m *InMemory) Update(user *User) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.users[user.ID]; !ok {
+		return ErrUserNotFound
+	}
+	if other := m.findByEmail(user.Email); user.Email != "" && other != nil && other.ID != user.ID {
+		return ErrEmailTaken
+	}
+	m.users[user.ID] = *user
+	return nil
+}
+
+func (m *InMemory) findByEmail(email string) *User {
+	for _, user := range m.users {
+		if user.Email == email {
+			return &user
+		}
+	}
+	return nil
+}
@@ -0,0 +1,192 @@
+package xuser
+
+import (
+	"errors"
+	"net/mail"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// 账号状态
+const (
+	StatusDisabled = 0
+	StatusActive   = 1
+)
+
+// minPasswordLength 密码最小长度
+const minPasswordLength = 8
+
+var (
+	ErrUserNotFound       = errors.New("用户不存在")
+	ErrEmailTaken         = errors.New("邮箱已被注册")
+	ErrInvalidEmail       = errors.New("邮箱格式不正确")
+	ErrWeakPassword       = errors.New("密码至少 8 位")
+	ErrInvalidCredentials = errors.New("邮箱或密码错误")
+	ErrUserDisabled       = errors.New("账号已被禁用")
+	ErrNotGuest           = errors.New("只有游客账号可以升级")
+)
+
+// User 终端用户, ID 即会话、记忆和用量中的 uid
+// 游客账号没有邮箱和密码, 升级后保留原 ID, 历史数据不需要迁移
+type User struct {
+	ID           string    `json:"id"`
+	Email        string    `json:"email,omitempty"`
+	PasswordHash string    `json:"-"`
+	Nickname     string    `json:"nickname"`
+	IsGuest      bool      `json:"is_guest"`
+	Adult        bool      `json:"adult"` // 已通过年龄验证, 由管理后台设置
+	Status       int       `json:"status"`
+	TokenVersion int       `json:"-"` // 退出登录时递增, 使已签发的 refresh token 失效
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+// Store 用户存储
+type Store interface {
+	// Create 创建用户并回填 ID
+	Create(user *User) error
+	Get(id string) (*User, error)
+	FindByEmail(email string) (*User, error)
+	Update(user *User) error
+}
+
+// Register 使用邮箱和密码注册
+func Register(store Store, email string, password string, nickname string) (*User, error) {
+	email, err := credentials(store, email, password)
+	if err != nil {
+		return nil, err
+	}
+	hash, err := hashPassword(password)
+	if err != nil {
+		return nil, err
+	}
+
+	user := &User{
+		Email:        email,
+		PasswordHash: hash,
+		Nickname:     nickname,
+		Status:       StatusActive,
+		CreatedAt:    time.Now(),
+	}
+	if user.Nickname == "" {
+		user.Nickname = strings.Split(email, "@")[0]
+	}
+	if err := store.Create(user); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// CreateGuest 创建游客账号
+func CreateGuest(store Store) (*User, error) {
+	user := &User{
+		Nickname:  "游客",
+		IsGuest:   true,
+		Status:    StatusActive,
+		CreatedAt: time.Now(),
+	}
+	if err := store.Create(user); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// Upgrade 为游客账号绑定邮箱和密码
+func Upgrade(store Store, id string, email string, password string) (*User, error) {
+	user, err := Get(store, id)
+	if err != nil {
+		return nil, err
+	}
+	if !user.IsGuest {
+		return nil, ErrNotGuest
+	}
+	if email, err = credentials(store, email, password); err != nil {
+		return nil, err
+	}
+	if user.PasswordHash, err = hashPassword(password); err != nil {
+		return nil, err
+	}
+
+	user.Email = email
+	user.IsGuest = false
+	if user.Nickname == "" || user.Nickname == "游客" {
+		user.Nickname = strings.Split(email, "@")[0]
+	}
+	if err := store.Update(user); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// Login 校验邮箱和密码, 邮箱不存在和密码错误返回相同的错误
+func Login(store Store, email string, password string) (*User, error) {
+	user, err := store.FindByEmail(normalizeEmail(email))
+	if errors.Is(err, ErrUserNotFound) {
+		return nil, ErrInvalidCredentials
+	}
+	if err != nil {
+		return nil, err
+	}
+	if bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(password)) != nil {
+		return nil, ErrInvalidCredentials
+	}
+	if user.Status != StatusActive {
+		return nil, ErrUserDisabled
+	}
+	return user, nil
+}
+
+// Get 获取正常状态的用户
+func Get(store Store, id string) (*User, error) {
+	user, err := store.Get(id)
+	if err != nil {
+		return nil, err
+	}
+	if user.Status != StatusActive {
+		return nil, ErrUserDisabled
+	}
+	return user, nil
+}
+
+// Logout 递增 token 版本, 用户所有设备上的 refresh token 失效
+func Logout(store Store, id string) error {
+	user, err := store.Get(id)
+	if err != nil {
+		return err
+	}
+	user.TokenVersion++
+	return store.Update(user)
+}
+
+// credentials 校验邮箱格式、密码强度以及邮箱是否已注册, 返回规范化后的邮箱
+func credentials(store Store, email string, password string) (string, error) {
+	email = normalizeEmail(email)
+	if address, err := mail.ParseAddress(email); err != nil || address.Address != email {
+		return "", ErrInvalidEmail
+	}
+	if len(password) < minPasswordLength {
+		return "", ErrWeakPassword
+	}
+
+	_, err := store.FindByEmail(email)
+	if err == nil {
+		return "", ErrEmailTaken
+	}
+	if !errors.Is(err, ErrUserNotFound) {
+		return "", err
+	}
+	return email, nil
+}
+
+func normalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+func hashPassword(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", err
+	}
+	return string(hash), nil
+}
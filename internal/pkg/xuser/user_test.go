@@ -0,0 +1,145 @@
+package xuser
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+)
+
+func TestRegisterAndLogin(t *testing.T) {
+	store := NewInMemory()
+
+	user, err := Register(store, " Alice@Example.com ", "password123", "")
+	if err != nil {
+		t.Fatalf("Register 失败: %v", err)
+	}
+	if user.ID == "" || user.Email != "alice@example.com" || user.Nickname != "alice" || user.PasswordHash == "password123" {
+		t.Errorf("user = %+v", user)
+	}
+
+	tests := []struct {
+		email    string
+		password string
+		err      error
+	}{
+		{"alice@example.com", "password123", ErrEmailTaken},
+		{"not-an-email", "password123", ErrInvalidEmail},
+		{"bob@example.com", "short", ErrWeakPassword},
+	}
+	for _, tt := range tests {
+		if _, err := Register(store, tt.email, tt.password, ""); !errors.Is(err, tt.err) {
+			t.Errorf("Register(%s) err = %v, want %v", tt.email, err, tt.err)
+		}
+	}
+
+	if logged, err := Login(store, "ALICE@example.com", "password123"); err != nil || logged.ID != user.ID {
+		t.Errorf("Login = %+v, %v", logged, err)
+	}
+	if _, err := Login(store, "alice@example.com", "wrong-password"); !errors.Is(err, ErrInvalidCredentials) {
+		t.Errorf("wrong password err = %v", err)
+	}
+	if _, err := Login(store, "nobody@example.com", "password123"); !errors.Is(err, ErrInvalidCredentials) {
+		t.Errorf("unknown email err = %v", err)
+	}
+
+	user.Status = StatusDisabled
+	if err := store.Update(user); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Login(store, "alice@example.com", "password123"); !errors.Is(err, ErrUserDisabled) {
+		t.Errorf("disabled user err = %v", err)
+	}
+}
+
+func TestGuestUpgrade(t *testing.T) {
+	store := NewInMemory()
+
+	guest, err := CreateGuest(store)
+	if err != nil || !guest.IsGuest {
+		t.Fatalf("CreateGuest = %+v, %v", guest, err)
+	}
+	// 多个游客账号都没有邮箱
+	if _, err := CreateGuest(store); err != nil {
+		t.Fatalf("CreateGuest 失败: %v", err)
+	}
+
+	user, err := Upgrade(store, guest.ID, "guest@example.com", "password123")
+	if err != nil {
+		t.Fatalf("Upgrade 失败: %v", err)
+	}
+	if user.ID != guest.ID || user.IsGuest || user.Nickname != "guest" {
+		t.Errorf("user = %+v", user)
+	}
+	if _, err := Upgrade(store, guest.ID, "other@example.com", "password123"); !errors.Is(err, ErrNotGuest) {
+		t.Errorf("upgrade again err = %v", err)
+	}
+	if logged, err := Login(store, "guest@example.com", "password123"); err != nil || logged.ID != guest.ID {
+		t.Errorf("Login = %+v, %v", logged, err)
+	}
+}
+
+func TestLogout(t *testing.T) {
+	store := NewInMemory()
+	user, err := CreateGuest(store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := Logout(store, user.ID); err != nil {
+		t.Fatal(err)
+	}
+	if user, _ = store.Get(user.ID); user.TokenVersion != 1 {
+		t.Errorf("token version = %d", user.TokenVersion)
+	}
+	if err := Logout(store, "404"); !errors.Is(err, ErrUserNotFound) {
+		t.Errorf("err = %v", err)
+	}
+}
+
+// TestRegisterConcurrent 并发注册同一邮箱时只有一个成功, 其余返回 ErrEmailTaken
+func TestRegisterConcurrent(t *testing.T) {
+	store := NewInMemory()
+	errs := make([]error, 5)
+	var wg sync.WaitGroup
+	for i := range errs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, errs[i] = Register(store, "race@example.com", "password123", "")
+		}()
+	}
+	wg.Wait()
+
+	created := 0
+	for _, err := range errs {
+		switch {
+		case err == nil:
+			created++
+		case !errors.Is(err, ErrEmailTaken):
+			t.Errorf("err = %v, want ErrEmailTaken", err)
+		}
+	}
+	if created != 1 {
+		t.Errorf("created = %d, want 1", created)
+	}
+}
+
+func TestEmailError(t *testing.T) {
+	tests := []struct {
+		err  error
+		want error
+	}{
+		{nil, nil},
+		{fmt.Errorf("Error 1062 (23000): Duplicate entry 'a@example.com' for key 'idx_email'"), ErrEmailTaken},
+		{fmt.Errorf("UNIQUE constraint failed: companion_user.email"), ErrEmailTaken},
+	}
+	for _, tt := range tests {
+		if err := emailError(tt.err); !errors.Is(err, tt.want) {
+			t.Errorf("emailError(%v) = %v, want %v", tt.err, err, tt.want)
+		}
+	}
+	other := errors.New("connection refused")
+	if err := emailError(other); err != other {
+		t.Errorf("emailError(other) = %v", err)
+	}
+}
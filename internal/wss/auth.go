@@ -0,0 +1,210 @@
+package wss
+
+import (
+	"companions/internal/auth"
+	"companions/internal/conf"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/daodao97/xgo/xlog"
+	"github.com/gorilla/websocket"
+)
+
+// bearerProtocol 浏览器无法设置 Authorization 头时通过子协议传递 token:
+// new WebSocket(url, ["bearer", token])
+const bearerProtocol = "bearer"
+
+// expiryNotice token 过期前提前推送 auth_expiring 的时间
+const expiryNotice = time.Minute
+
+// credentials 握手时解析出的身份, UID 为空表示匿名连接
+type credentials struct {
+	UID       string
+	ExpiresAt time.Time // 零值表示不过期
+}
+
+// authenticate 依次从 ?ticket=、Authorization 头和 Sec-WebSocket-Protocol 中取凭证校验
+// 未携带凭证时, 配置允许匿名连接则返回匿名身份
+func authenticate(r *http.Request) (*credentials, error) {
+	if ticket := r.URL.Query().Get("ticket"); ticket != "" {
+		payload, err := auth.ParseTicket(ticket)
+		if err != nil {
+			return nil, err
+		}
+		if err := auth.CheckUser(payload.GetString("uid")); err != nil {
+			return nil, err
+		}
+		// 票据只用于握手, 连接的有效期跟随签发票据的登录 token
+		return &credentials{UID: payload.GetString("uid"), ExpiresAt: auth.TicketTokenExpiresAt(payload)}, nil
+	}
+
+	token := requestToken(r)
+	if token == "" {
+		if conf.Get().WebSocket.AllowAnonymous {
+			return &credentials{}, nil
+		}
+		return nil, auth.ErrTokenInvalid
+	}
+	payload, err := auth.ParseToken(token)
+	if err != nil {
+		return nil, err
+	}
+	if err := auth.CheckUser(payload.GetString("uid")); err != nil {
+		return nil, err
+	}
+	return &credentials{UID: payload.GetString("uid"), ExpiresAt: auth.ExpiresAt(payload)}, nil
+}
+
+// requestToken 取 Authorization 头或 bearer 子协议后的 token
+func requestToken(r *http.Request) string {
+	if token := auth.BearerToken(r); token != "" {
+		return token
+	}
+	protocols := websocket.Subprotocols(r)
+	for i, protocol := range protocols {
+		if protocol == bearerProtocol && i+1 < len(protocols) {
+			return protocols[i+1]
+		}
+	}
+	return ""
+}
+
+func checkOrigin(r *http.Request) bool {
+	return originAllowed(r.Header.Get("Origin"), r.Host, conf.Get().WebSocket.AllowedOrigins)
+}
+
+// originAllowed 不带 Origin 的非浏览器客户端和同源请求直接放行, 其余按配置匹配
+// 配置项可以是 *、完整 origin (https://example.com)、host (example.com:8080) 或子域名通配 (*.example.com)
+func originAllowed(origin string, host string, allowed []string) bool {
+	if origin == "" {
+		return true
+	}
+	u, err := url.Parse(origin)
+	if err != nil || u.Host == "" {
+		return false
+	}
+	if strings.EqualFold(u.Host, host) {
+		return true
+	}
+
+	for _, pattern := range allowed {
+		pattern = strings.ToLower(strings.TrimSpace(pattern))
+		if pattern == "*" {
+			return true
+		}
+		if scheme, rest, ok := strings.Cut(pattern, "://"); ok {
+			if scheme != strings.ToLower(u.Scheme) {
+				continue
+			}
+			pattern = rest
+		}
+		if suffix, ok := strings.CutPrefix(pattern, "*."); ok {
+			if strings.HasSuffix(strings.ToLower(u.Hostname()), "."+suffix) {
+				return true
+			}
+			continue
+		}
+		if pattern == strings.ToLower(u.Host) {
+			return true
+		}
+	}
+	return false
+}
+
+// setExpiry 设置 token 过期时间, 过期前推送 auth_expiring, 过期后推送 auth_expired 并关闭连接
+// 客户端可以在过期前发送 {"type": "auth", "token": "..."} 续期
+func (s *Session) setExpiry(expiresAt time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.expiryTimer != nil {
+		s.expiryTimer.Stop()
+		s.expiryTimer = nil
+	}
+	s.expiresAt = expiresAt
+	if expiresAt.IsZero() {
+		return
+	}
+
+	if notice := time.Until(expiresAt) - expiryNotice; notice > 0 {
+		s.expiryTimer = time.AfterFunc(notice, func() { s.onExpiring(expiresAt) })
+		return
+	}
+	s.expiryTimer = time.AfterFunc(time.Until(expiresAt), func() { s.onExpired(expiresAt) })
+}
+
+func (s *Session) stopExpiry() {
+	s.setExpiry(time.Time{})
+}
+
+func (s *Session) onExpiring(expiresAt time.Time) {
+	s.mu.Lock()
+	if !s.expiresAt.Equal(expiresAt) {
+		// 已续期
+		s.mu.Unlock()
+		return
+	}
+	s.expiryTimer = time.AfterFunc(time.Until(expiresAt), func() { s.onExpired(expiresAt) })
+	s.mu.Unlock()
+
+	if err := s.Send(AuthEvent{Type: "auth_expiring", ExpiresAt: expiresAt.Unix()}); err != nil {
+		xlog.ErrorC(context.Background(), "发送 token 即将过期消息失败", xlog.Err(err))
+	}
+}
+
+func (s *Session) onExpired(expiresAt time.Time) {
+	s.mu.RLock()
+	renewed := !s.expiresAt.Equal(expiresAt)
+	s.mu.RUnlock()
+	if renewed {
+		return
+	}
+
+	xlog.WarnC(context.Background(), "token 已过期, 关闭连接", xlog.String("uid", s.UID))
+	if err := s.Send(AuthEvent{Type: "auth_expired"}); err != nil {
+		xlog.ErrorC(context.Background(), "发送 token 过期消息失败", xlog.Err(err))
+	}
+	s.Close(websocket.ClosePolicyViolation, "token expired")
+	// 不等待客户端回应关闭帧, 直接断开让读循环退出
+	s.conn.Close()
+}
+
+// handleAuth 刷新连接的 token, 新 token 必须属于同一用户
+func handleAuth(s *Session, data []byte) {
+	ctx := context.Background()
+
+	var req AuthRequest
+	if err := json.Unmarshal(data, &req); err != nil {
+		xlog.ErrorC(ctx, "auth 消息解析错误", xlog.Err(err))
+		sendError(s, req.RequestID, ErrCodeBadRequest, "auth 消息格式不正确")
+		return
+	}
+
+	payload, err := auth.ParseToken(req.Token)
+	if err != nil {
+		sendError(s, req.RequestID, ErrCodeUnauthorized, err.Error())
+		return
+	}
+	if s.UID == "" || payload.GetString("uid") != s.UID {
+		sendError(s, req.RequestID, ErrCodeUnauthorized, "token 与当前连接的用户不一致")
+		return
+	}
+	if err := auth.CheckUser(s.UID); err != nil {
+		sendError(s, req.RequestID, ErrCodeUnauthorized, err.Error())
+		return
+	}
+
+	expiresAt := auth.ExpiresAt(payload)
+	s.setExpiry(expiresAt)
+
+	response := AuthEvent{Type: "auth", RequestID: req.RequestID}
+	if !expiresAt.IsZero() {
+		response.ExpiresAt = expiresAt.Unix()
+	}
+	if err := s.Send(response); err != nil {
+		xlog.ErrorC(ctx, "发送 auth 响应失败", xlog.Err(err))
+	}
+}
@@ -0,0 +1,51 @@
+package wss
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestOriginAllowed(t *testing.T) {
+	allowed := []string{"https://app.example.com", "*.example.org", "localhost:3000"}
+	tests := []struct {
+		origin string
+		want   bool
+	}{
+		{"", true},
+		{"http://companion.local:4001", true}, // 同源
+		{"https://app.example.com", true},
+		{"http://app.example.com", false},
+		{"https://chat.example.org", true},
+		{"https://example.org", false},
+		{"http://localhost:3000", true},
+		{"http://localhost:3001", false},
+		{"https://evil.com", false},
+		{"null", false},
+	}
+	for _, tt := range tests {
+		if got := originAllowed(tt.origin, "companion.local:4001", allowed); got != tt.want {
+			t.Errorf("originAllowed(%q) = %v, want %v", tt.origin, got, tt.want)
+		}
+	}
+
+	if !originAllowed("https://evil.com", "companion.local", []string{"*"}) {
+		t.Errorf("* should allow all origins")
+	}
+}
+
+func TestRequestToken(t *testing.T) {
+	r := httptest.NewRequest("GET", "/ws", nil)
+	if token := requestToken(r); token != "" {
+		t.Errorf("token = %q", token)
+	}
+
+	r.Header.Set("Sec-WebSocket-Protocol", "bearer, abc.def.ghi")
+	if token := requestToken(r); token != "abc.def.ghi" {
+		t.Errorf("protocol token = %q", token)
+	}
+
+	r.Header.Set("Authorization", "Bearer header.token")
+	if token := requestToken(r); token != "header.token" {
+		t.Errorf("header token = %q", token)
+	}
+}
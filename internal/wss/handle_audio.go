@@ -2,38 +2,44 @@ package wss
 
 import (
 	"companions/internal/conf"
+	"companions/internal/dao"
 	"companions/internal/pkg/xstt"
+	"companions/internal/pkg/xusage"
 	"context"
 	"encoding/json"
 	"log"
+	"time"
 
 	"github.com/daodao97/xgo/xlog"
-	"github.com/gin-gonic/gin"
-	"github.com/gorilla/websocket"
 )
 
-func handleAudioMessage(conn *websocket.Conn, c *gin.Context, data []byte) {
+func handleAudioMessage(s *Session, data []byte) {
 	var audioMsg AudioMessage
 	if err := json.Unmarshal(data, &audioMsg); err != nil {
 		log.Printf("音频消息解析错误: %v", err)
+		sendError(s, audioMsg.RequestID, ErrCodeBadRequest, "音频消息格式不正确")
 		return
 	}
 
 	log.Printf("收到音频消息: 格式=%s, 大小=%d字节", audioMsg.Format, audioMsg.Size)
 
+	if !checkQuota(s, audioMsg.RequestID) {
+		return
+	}
+
 	sttConf := conf.Get().GetSTT("default")
 
 	if sttConf == nil {
-		if err := conn.WriteJSON(map[string]any{
-			"type":    "error",
-			"message": "语音识别配置不存在",
-		}); err != nil {
-			xlog.ErrorC(context.Background(), "发送文本响应失败", xlog.Err(err))
-		}
+		sendError(s, audioMsg.RequestID, ErrCodeSTTFailed, "语音识别配置不存在")
 		return
 	}
 
-	stt := xstt.New(sttConf)
+	meter := dao.NewMeter(s.UID, xusage.WithConversation(s.ConversationID()))
+	var sttOpts []xstt.OpenAIOption
+	if sttConf.SaveAudio && dao.Storage != nil {
+		sttOpts = append(sttOpts, xstt.WithStorage(dao.Storage))
+	}
+	stt := meter.STT(xstt.New(sttConf, sttOpts...), sttConf.Provider, sttConf.Model)
 
 	res, err := stt.SpeechToText(context.Background(), xstt.SpeechToTextReq{
 		Audio:  audioMsg.Data,
@@ -41,20 +47,11 @@ func handleAudioMessage(conn *websocket.Conn, c *gin.Context, data []byte) {
 	})
 	if err != nil {
 		xlog.ErrorC(context.Background(), "语音识别失败: %v", err)
+		sendError(s, audioMsg.RequestID, ErrCodeSTTFailed, "语音识别失败")
 		return
 	}
 	xlog.InfoC(context.Background(), "语音识别结果: %v", res)
 
-	toText := map[string]any{
-		"type": "text",
-		"data": res.Text,
-	}
-
-	jsonData, err := json.Marshal(toText)
-	if err != nil {
-		xlog.ErrorC(context.Background(), "JSON编码失败: %v", err)
-		return
-	}
-
-	handleTextMessage(conn, c, jsonData)
+	// 与文本消息相同, 摄像头开启时附带最近采样的画面
+	chat(s, audioMsg.RequestID, res.Text, s.takeFrames(time.Now()))
 }
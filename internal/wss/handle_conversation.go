@@ -0,0 +1,154 @@
+package wss
+
+import (
+	"companions/internal/dao"
+	"companions/internal/pkg/xmem"
+	"context"
+	"encoding/json"
+	"errors"
+
+	"github.com/daodao97/xgo/xlog"
+	"github.com/google/uuid"
+)
+
+var errNotOwner = errors.New("会话不属于当前用户")
+
+func handleConversationMessage(s *Session, data []byte) {
+	ctx := context.Background()
+
+	var req ConversationRequest
+	if err := json.Unmarshal(data, &req); err != nil {
+		xlog.ErrorC(ctx, "会话消息解析错误", xlog.Err(err))
+		sendError(s, req.RequestID, ErrCodeBadRequest, "会话消息格式不正确")
+		return
+	}
+
+	if s.UID == "" {
+		sendError(s, req.RequestID, ErrCodeUnauthorized, "未登录用户不支持会话管理")
+		return
+	}
+
+	mem := dao.Memory
+
+	switch req.Type {
+	case "conversation_new":
+		conv, err := newConversation(s, mem, req.Title)
+		if err != nil {
+			xlog.ErrorC(ctx, "创建会话失败", xlog.Err(err))
+			sendError(s, req.RequestID, ErrCodeInternal, "创建会话失败")
+			return
+		}
+		sendConversation(s, req.RequestID, conv)
+	case "conversation_switch":
+		conv, err := findConversation(s, mem, req.ConversationID)
+		if err != nil {
+			sendError(s, req.RequestID, ErrCodeNotFound, "会话不存在")
+			return
+		}
+		s.SetConversationID(conv.Id)
+		sendConversation(s, req.RequestID, conv)
+	case "conversation_list":
+		list, err := mem.List(s.UID)
+		if err != nil {
+			xlog.ErrorC(ctx, "获取会话列表失败", xlog.Err(err))
+			sendError(s, req.RequestID, ErrCodeInternal, "获取会话列表失败")
+			return
+		}
+		if err := s.Send(ConversationListEvent{Type: "conversation_list", RequestID: req.RequestID, Data: list}); err != nil {
+			xlog.ErrorC(ctx, "发送会话列表失败", xlog.Err(err))
+		}
+	case "conversation_rename":
+		conv, err := findConversation(s, mem, req.ConversationID)
+		if err != nil {
+			sendError(s, req.RequestID, ErrCodeNotFound, "会话不存在")
+			return
+		}
+		if err := mem.Rename(conv.Id, req.Title); err != nil {
+			xlog.ErrorC(ctx, "重命名会话失败", xlog.Err(err))
+			sendError(s, req.RequestID, ErrCodeInternal, "重命名会话失败")
+			return
+		}
+		conv.Title = req.Title
+		sendConversation(s, req.RequestID, conv)
+	case "conversation_delete":
+		conv, err := findConversation(s, mem, req.ConversationID)
+		if err != nil {
+			sendError(s, req.RequestID, ErrCodeNotFound, "会话不存在")
+			return
+		}
+		if err := mem.Delete(conv.Id); err != nil {
+			xlog.ErrorC(ctx, "删除会话失败", xlog.Err(err))
+			sendError(s, req.RequestID, ErrCodeInternal, "删除会话失败")
+			return
+		}
+		if s.ConversationID() == conv.Id {
+			s.SetConversationID("")
+		}
+		if err := s.Send(ConversationDeletedEvent{
+			Type:      "conversation_deleted",
+			RequestID: req.RequestID,
+			Data:      ConversationDeletedData{ConversationID: conv.Id},
+		}); err != nil {
+			xlog.ErrorC(ctx, "发送会话删除响应失败", xlog.Err(err))
+		}
+	}
+}
+
+// newConversation 为当前用户创建会话并设为当前会话
+func newConversation(s *Session, mem xmem.Memory, title string) (*xmem.Conversation, error) {
+	conv := &xmem.Conversation{
+		Id:    uuid.New().String(),
+		Uid:   s.UID,
+		Title: title,
+	}
+	if err := mem.Create(conv.Id, conv.Uid, conv.Title); err != nil {
+		return nil, err
+	}
+	s.SetConversationID(conv.Id)
+	return conv, nil
+}
+
+// findConversation 获取会话并校验归属
+func findConversation(s *Session, mem xmem.Memory, conversationId string) (*xmem.Conversation, error) {
+	conv, err := mem.Find(conversationId)
+	if err != nil {
+		return nil, err
+	}
+	if conv.Uid != s.UID {
+		return nil, errNotOwner
+	}
+	return conv, nil
+}
+
+// checkConversation 校验连接时通过 ?conversation_id= 指定的会话属于当前用户, 否则忽略
+func checkConversation(s *Session) {
+	conversationId := s.ConversationID()
+	if conversationId == "" {
+		return
+	}
+	if s.UID != "" {
+		if _, err := findConversation(s, dao.Memory, conversationId); err == nil {
+			return
+		}
+	}
+	xlog.WarnC(context.Background(), "忽略无权访问的会话", xlog.String("uid", s.UID), xlog.String("conversation_id", conversationId))
+	s.SetConversationID("")
+	sendError(s, "", ErrCodeNotFound, "会话不存在")
+}
+
+func sendConversation(s *Session, requestID string, conv *xmem.Conversation) {
+	if err := s.Send(ConversationEvent{
+		Type:      "conversation",
+		RequestID: requestID,
+		Data:      ConversationData{ConversationID: conv.Id, Title: conv.Title},
+	}); err != nil {
+		xlog.ErrorC(context.Background(), "发送会话响应失败", xlog.Err(err))
+	}
+}
+
+// sendError code 见 ErrCode*, requestID 为触发错误的客户端请求, 没有时为空
+func sendError(s *Session, requestID string, code string, message string) {
+	if err := s.Send(ErrorEvent{Type: "error", RequestID: requestID, Code: code, Message: message}); err != nil {
+		xlog.ErrorC(context.Background(), "发送错误响应失败", xlog.Err(err))
+	}
+}
@@ -0,0 +1,61 @@
+package wss
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/daodao97/xgo/xlog"
+	"github.com/gorilla/websocket"
+)
+
+func handleHello(s *Session, data []byte) {
+	var req HelloRequest
+	if err := json.Unmarshal(data, &req); err != nil {
+		sendError(s, req.RequestID, ErrCodeBadRequest, "hello 消息格式不正确")
+		return
+	}
+	negotiate(s, req.ProtocolVersion, req.RequestID)
+}
+
+// negotiate 取客户端和服务端都支持的最高版本并回复 hello; 客户端版本过低时发送错误并关闭连接
+func negotiate(s *Session, version int, requestID string) bool {
+	if version < MinProtocolVersion {
+		xlog.WarnC(context.Background(), "不支持的协议版本", xlog.Int("version", version))
+		sendError(s, requestID, ErrCodeUnsupportedVersion, "不支持的协议版本, 请升级客户端")
+		s.Close(websocket.CloseProtocolError, "unsupported protocol version")
+		// 不等待客户端回应关闭帧, 直接断开让读循环退出
+		s.conn.Close()
+		return false
+	}
+
+	version = min(version, ProtocolVersion)
+	s.mu.Lock()
+	s.protocol = version
+	s.mu.Unlock()
+
+	event := HelloEvent{
+		Type:               "hello",
+		RequestID:          requestID,
+		ProtocolVersion:    version,
+		MinProtocolVersion: MinProtocolVersion,
+		MaxProtocolVersion: ProtocolVersion,
+	}
+	if box := s.outbox(); box != nil {
+		event.ResumeToken = box.token
+		event.ResumeTTL = int(resumeTTL().Seconds())
+	}
+	if err := s.Send(event); err != nil {
+		xlog.ErrorC(context.Background(), "发送 hello 响应失败", xlog.Err(err))
+	}
+	return true
+}
+
+// ack 协议版本 2 起, 带 request_id 的对话请求通过限流后立即确认
+func (s *Session) ack(requestID string) {
+	if requestID == "" || s.Protocol() < 2 {
+		return
+	}
+	if err := s.Send(AckEvent{Type: "ack", RequestID: requestID}); err != nil {
+		xlog.ErrorC(context.Background(), "发送 ack 失败", xlog.Err(err))
+	}
+}
@@ -0,0 +1,156 @@
+package wss
+
+import (
+	"companions/internal/character"
+	"companions/internal/conf"
+	"companions/internal/dao"
+	"companions/internal/pkg/xstorage"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/daodao97/xgo/xlog"
+)
+
+// frameMaxAge 超过该时间的画面不再附带到对话中
+const frameMaxAge = 30 * time.Second
+
+// allowedImageTypes 按文件内容识别的图片类型
+var allowedImageTypes = []string{"image/jpeg", "image/png", "image/webp", "image/gif"}
+
+var (
+	errImageEmpty    = errors.New("图片内容为空")
+	errImageInvalid  = errors.New("图片不是合法的 base64 数据")
+	errImageTooLarge = errors.New("图片超过大小限制")
+	errImageFormat   = errors.New("不支持的图片格式, 仅支持 jpeg、png、webp、gif")
+)
+
+func handleImageMessage(s *Session, data []byte) {
+	var imageMsg ImageMessage
+	if err := json.Unmarshal(data, &imageMsg); err != nil {
+		xlog.ErrorC(context.Background(), "图片消息解析错误", xlog.Err(err))
+		sendError(s, imageMsg.RequestID, ErrCodeBadRequest, "图片消息格式不正确")
+		return
+	}
+
+	image, err := decodeImage(imageMsg.Data, conf.Get().Vision.MaxImageSize)
+	if err != nil {
+		sendError(s, imageMsg.RequestID, ErrCodeInvalidImage, err.Error())
+		return
+	}
+	xlog.InfoC(context.Background(), "收到图片消息", xlog.String("mime_type", image.MimeType), xlog.Int("size", len(image.Data)))
+
+	chat(s, imageMsg.RequestID, imageMsg.Text, append(s.takeFrames(time.Now()), image))
+}
+
+func handleVideoFrame(s *Session, data []byte) {
+	visionConf := conf.Get().Vision
+	interval := time.Duration(visionConf.FrameInterval) * time.Millisecond
+	now := time.Now()
+	if !s.frameDue(now, interval) {
+		return
+	}
+
+	var frameMsg ImageMessage
+	if err := json.Unmarshal(data, &frameMsg); err != nil {
+		xlog.ErrorC(context.Background(), "视频帧解析错误", xlog.Err(err))
+		return
+	}
+	image, err := decodeImage(frameMsg.Data, visionConf.MaxImageSize)
+	if err != nil {
+		sendError(s, frameMsg.RequestID, ErrCodeInvalidImage, err.Error())
+		return
+	}
+	s.addFrame(image, now, interval, visionConf.MaxFrames)
+}
+
+// decodeImage 解码并校验图片, 类型以文件内容为准
+func decodeImage(data string, maxSize int) (*character.Image, error) {
+	if after, ok := strings.CutPrefix(data, "data:"); ok {
+		_, payload, found := strings.Cut(after, ",")
+		if !found {
+			return nil, errImageInvalid
+		}
+		data = payload
+	}
+	if data == "" {
+		return nil, errImageEmpty
+	}
+	if maxSize > 0 && base64.StdEncoding.DecodedLen(len(data)) > maxSize+2 {
+		return nil, errImageTooLarge
+	}
+
+	raw, err := base64.StdEncoding.DecodeString(data)
+	if err != nil {
+		return nil, errImageInvalid
+	}
+	if maxSize > 0 && len(raw) > maxSize {
+		return nil, errImageTooLarge
+	}
+	mimeType := http.DetectContentType(raw)
+	if !slices.Contains(allowedImageTypes, mimeType) {
+		return nil, errImageFormat
+	}
+	return &character.Image{MimeType: mimeType, Data: raw}, nil
+}
+
+// saveImages 保存登录用户发送的图片, 地址随消息写入记忆; 匿名用户不保存
+func saveImages(ctx context.Context, s *Session, images []*character.Image) {
+	if dao.Storage == nil || s.UID == "" {
+		return
+	}
+	for _, image := range images {
+		if image.URL != "" {
+			continue
+		}
+		url, err := dao.Storage.Put(ctx, xstorage.NewKey("images", xstorage.ExtByContentType(image.MimeType)), image.Data, image.MimeType)
+		if err != nil {
+			xlog.ErrorC(ctx, "保存图片失败", xlog.Err(err))
+			continue
+		}
+		image.URL = url
+	}
+}
+
+// frameDue 距离上一次采样是否已超过间隔, 未到间隔的帧直接丢弃, 不做解码
+func (s *Session) frameDue(now time.Time, interval time.Duration) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.lastFrameAt.IsZero() || now.Sub(s.lastFrameAt) >= interval
+}
+
+// addFrame 缓存采样的画面, 只保留最近 maxFrames 帧
+func (s *Session) addFrame(image *character.Image, now time.Time, interval time.Duration, maxFrames int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.lastFrameAt.IsZero() && now.Sub(s.lastFrameAt) < interval {
+		return
+	}
+	if maxFrames <= 0 {
+		maxFrames = 1
+	}
+	s.lastFrameAt = now
+	s.frames = append(s.frames, frame{image: image, at: now})
+	if len(s.frames) > maxFrames {
+		s.frames = slices.Clone(s.frames[len(s.frames)-maxFrames:])
+	}
+}
+
+// takeFrames 取出未过期的画面并清空缓存, 同一画面只随一条消息发送
+func (s *Session) takeFrames(now time.Time) []*character.Image {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var images []*character.Image
+	for _, f := range s.frames {
+		if now.Sub(f.at) <= frameMaxAge {
+			images = append(images, f.image)
+		}
+	}
+	s.frames = nil
+	return images
+}
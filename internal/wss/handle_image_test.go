@@ -0,0 +1,79 @@
+package wss
+
+import (
+	"companions/internal/character"
+	"encoding/base64"
+	"errors"
+	"testing"
+	"time"
+)
+
+// pngHeader 足以被识别为 png 的文件头
+var pngHeader = []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR")
+
+func TestDecodeImage(t *testing.T) {
+	encoded := base64.StdEncoding.EncodeToString(pngHeader)
+
+	for _, data := range []string{encoded, "data:image/png;base64," + encoded, "data:image/jpeg;base64," + encoded} {
+		image, err := decodeImage(data, 1024)
+		if err != nil {
+			t.Fatalf("decodeImage(%.20s) 失败: %v", data, err)
+		}
+		if image.MimeType != "image/png" || len(image.Data) != len(pngHeader) {
+			t.Errorf("image = %s, %d", image.MimeType, len(image.Data))
+		}
+	}
+
+	tests := []struct {
+		data    string
+		maxSize int
+		err     error
+	}{
+		{"", 1024, errImageEmpty},
+		{"data:image/png;base64,", 1024, errImageEmpty},
+		{"not base64!", 1024, errImageInvalid},
+		{encoded, 8, errImageTooLarge},
+		{base64.StdEncoding.EncodeToString([]byte("hello world")), 1024, errImageFormat},
+	}
+	for _, tt := range tests {
+		if _, err := decodeImage(tt.data, tt.maxSize); !errors.Is(err, tt.err) {
+			t.Errorf("decodeImage(%q, %d) err = %v, want %v", tt.data, tt.maxSize, err, tt.err)
+		}
+	}
+}
+
+func TestFrameSampling(t *testing.T) {
+	s := &Session{}
+	now := time.Now()
+	interval := 2 * time.Second
+	frames := []*character.Image{{URL: "1"}, {URL: "2"}, {URL: "3"}, {URL: "4"}}
+
+	for i, image := range frames {
+		at := now.Add(time.Duration(i) * time.Second)
+		if s.frameDue(at, interval) {
+			s.addFrame(image, at, interval, 2)
+		}
+	}
+	// 间隔 2 秒采样得到第 1、3 帧
+	got := s.takeFrames(now.Add(3 * time.Second))
+	if len(got) != 2 || got[0].URL != "1" || got[1].URL != "3" {
+		t.Fatalf("frames = %+v", got)
+	}
+	if again := s.takeFrames(now.Add(3 * time.Second)); len(again) != 0 {
+		t.Errorf("画面应只取出一次, got %d", len(again))
+	}
+
+	// 超过 maxFrames 时保留最近的帧, 过期的帧丢弃
+	for i := 0; i < 3; i++ {
+		at := now.Add(time.Duration(10+i*2) * time.Second)
+		s.addFrame(&character.Image{URL: string(rune('a' + i))}, at, interval, 2)
+	}
+	got = s.takeFrames(now.Add(14 * time.Second))
+	if len(got) != 2 || got[0].URL != "b" || got[1].URL != "c" {
+		t.Errorf("frames = %+v", got)
+	}
+	s.addFrame(&character.Image{URL: "old"}, now.Add(20*time.Second), interval, 2)
+	if got := s.takeFrames(now.Add(20*time.Second + frameMaxAge + time.Second)); len(got) != 0 {
+		t.Errorf("过期画面应丢弃, got %+v", got)
+	}
+}
@@ -2,65 +2,115 @@ package wss
 
 import (
 	"companions/internal/character"
-	"companions/internal/conf"
+	"companions/internal/companion"
+	"companions/internal/dao"
 	"companions/internal/pkg/xagent"
-	"companions/internal/pkg/xllm"
-	"companions/internal/pkg/xtts"
+	"companions/internal/pkg/xmod"
+	"companions/internal/pkg/xtools"
 	"context"
 	"encoding/json"
+	"time"
 
 	"github.com/daodao97/xgo/xlog"
-	"github.com/gin-gonic/gin"
-	"github.com/gorilla/websocket"
+	"github.com/google/uuid"
 )
 
-type AudioMessageResp struct {
-	Type      string `json:"type"`
-	Format    string `json:"format"`
-	Data      string `json:"data"`
-	MessageId string `json:"message_id"`
-}
-
-func handleTextMessage(conn *websocket.Conn, c *gin.Context, data []byte) {
+func handleTextMessage(s *Session, data []byte) {
 	var textMsg TextMessage
 	if err := json.Unmarshal(data, &textMsg); err != nil {
 		xlog.ErrorC(context.Background(), "文本消息解析错误", xlog.Err(err))
+		sendError(s, textMsg.RequestID, ErrCodeBadRequest, "文本消息格式不正确")
 		return
 	}
 
 	xlog.InfoC(context.Background(), "收到文本消息", xlog.Any("data", textMsg.Data))
 
-	uid := c.Query("uid")
-
-	llmConf := conf.Get().GetLLM("default")
-	llm := xllm.New(llmConf)
-	ttsConf := conf.Get().GetTTS("default")
-	tts := xtts.New(ttsConf)
+	// 摄像头开启时附带最近采样的画面
+	chat(s, textMsg.RequestID, textMsg.Data, s.takeFrames(time.Now()))
+}
 
+// chat 以用户消息和图片启动一轮对话, 回复通过 WebSocket 推送, 回复事件带上 requestID
+// 协议版本 2 以 turn_start 和 turn_end 包围一轮回复
+func chat(s *Session, requestID string, text string, images []*character.Image) {
 	// 使用新的工作流处理消息
 	ctx := context.Background()
-	agent := character.NewAgent(llm, tts, character.Ani)
-	messageStream, err := agent.Execute(ctx, xagent.NewInput(map[string]any{
-		"user_message": textMsg.Data,
-		"user_id":      uid,
-	}))
-	if err != nil {
-		xlog.ErrorC(ctx, "启动工作流失败", xlog.Err(err))
-		if err := conn.WriteJSON(map[string]any{
-			"type":    "error",
-			"message": "工作流启动失败",
+	// 需要确认的工具通过 tool_confirm 询问客户端
+	ctx = xtools.WithConfirmer(ctx, s.confirmTool)
+
+	if !checkQuota(s, requestID) {
+		return
+	}
+
+	// 登录用户未选择会话时先创建, 保证同一连接的连续消息落在同一会话
+	if s.UID != "" && s.ConversationID() == "" {
+		conv, err := newConversation(s, dao.Memory, "")
+		if err != nil {
+			xlog.ErrorC(ctx, "创建会话失败", xlog.Err(err))
+			sendError(s, requestID, ErrCodeInternal, "创建会话失败")
+			return
+		}
+		sendConversation(s, requestID, conv)
+	}
+	touchScheduler(ctx, s)
+
+	opts := companion.Options{
+		UID:            s.UID,
+		Character:      s.Character,
+		ConversationID: s.ConversationID(),
+		Location:       s.Location(),
+		MessageID:      uuid.New().String(),
+		// 标题在本轮回复结束后生成, 单独推送
+		OnTitle: func(conversationID string, title string) {
+			if err := s.Send(ConversationEvent{
+				Type:      "conversation",
+				RequestID: requestID,
+				Data:      ConversationData{ConversationID: conversationID, Title: title},
+			}); err != nil {
+				xlog.WarnC(ctx, "发送会话标题失败", xlog.Err(err))
+			}
+		},
+	}
+	turn := s.Protocol() >= 2
+	if turn {
+		if err := s.Send(TurnStartEvent{
+			Type:      "turn_start",
+			RequestID: requestID,
+			Data:      TurnData{MessageID: opts.MessageID, ConversationID: opts.ConversationID},
 		}); err != nil {
-			xlog.ErrorC(ctx, "发送错误响应失败", xlog.Err(err))
+			xlog.ErrorC(ctx, "发送 turn_start 失败", xlog.Err(err))
 		}
+	}
+	endTurn := func(status string) {
+		if turn {
+			if err := s.Send(TurnEndEvent{
+				Type:      "turn_end",
+				RequestID: requestID,
+				Data:      TurnEndData{MessageID: opts.MessageID, Status: status},
+			}); err != nil {
+				xlog.ErrorC(ctx, "发送 turn_end 失败", xlog.Err(err))
+			}
+		}
+	}
+
+	agent := companion.NewAgent(opts)
+	saveImages(ctx, s, images)
+	messageStream, err := agent.Execute(ctx, companion.Input(opts, text, images))
+	if err != nil {
+		xlog.ErrorC(ctx, "启动工作流失败", xlog.Err(err))
+		sendError(s, requestID, ErrCodeTurnFailed, "工作流启动失败")
+		endTurn(TurnFailed)
 		return
 	}
 
 	// 处理消息流并发送到WebSocket
 	go func() {
+		status := TurnCompleted
 		defer func() {
 			if r := recover(); r != nil {
 				xlog.ErrorC(ctx, "处理消息流时发生panic", xlog.Any("panic", r))
+				status = TurnFailed
 			}
+			endTurn(status)
 		}()
 
 		m := xagent.NewMessageProcessor()
@@ -69,57 +119,19 @@ func handleTextMessage(conn *websocket.Conn, c *gin.Context, data []byte) {
 				continue
 			}
 
-			switch v := msg.(type) {
-			case *character.AudioMessage:
-				response := AudioMessageResp{
-					Type:      "audio",
-					Format:    v.AudioChunk.Format,
-					Data:      v.AudioChunk.Data,
-					MessageId: v.MessageID,
-				}
-				if err := sendMessage(conn, response); err != nil {
-					xlog.ErrorC(ctx, "发送音频响应失败", xlog.Err(err))
-					return
-				}
-			case *xagent.BaseMessage:
-				response := map[string]any{
-					"type": "text",
-					"data": v.GetContent(),
-				}
-				if err := sendMessage(conn, response); err != nil {
-					xlog.ErrorC(ctx, "发送文本响应失败", xlog.Err(err))
-					return
-				}
-			case *character.RomanceMessage:
-				response := map[string]any{
-					"type": "romance",
-					"data": v.Romance,
-				}
-				if err := sendMessage(conn, response); err != nil {
-					xlog.ErrorC(ctx, "发送浪漫响应失败", xlog.Err(err))
-					return
-				}
-			case *character.ActionMessage:
-				response := map[string]any{
-					"type": "action",
-					"data": map[string]any{
-						"action": v.Action,
-						"args":   v.Args,
-					},
-				}
-				if err := sendMessage(conn, response); err != nil {
-					xlog.ErrorC(ctx, "发送动作响应失败", xlog.Err(err))
-					return
-				}
-			case *character.ErrorMessage:
-				response := map[string]any{
-					"type":    "error",
-					"message": v.Error,
-				}
-				if err := sendMessage(conn, response); err != nil {
-					xlog.ErrorC(ctx, "发送错误响应失败", xlog.Err(err))
-					return
-				}
+			event, ok := companion.ToEvent(msg)
+			if !ok {
+				continue
+			}
+			switch event.Type {
+			case companion.EventConversation:
+				s.SetConversationID(event.Data["conversation_id"].(string))
+			case companion.EventError:
+				status = TurnFailed
+			}
+			// 连接断开后事件仍进入 outbox, 继续读取直到结束, 客户端重连后可以续接
+			if err := s.Send(protocolEvent(event, requestID)); err != nil {
+				xlog.WarnC(ctx, "发送响应失败", xlog.Err(err))
 			}
 		}
 
@@ -127,6 +139,51 @@ func handleTextMessage(conn *websocket.Conn, c *gin.Context, data []byte) {
 	}()
 }
 
-func sendMessage(conn *websocket.Conn, message any) error {
-	return conn.WriteJSON(message)
+// protocolEvent 把 companion.ToEvent 的事件转换为协议中带 request_id 的事件, 与 HTTP 接口共用消息到事件的转换
+func protocolEvent(event companion.Event, requestID string) any {
+	str := func(key string) string {
+		v, _ := event.Data[key].(string)
+		return v
+	}
+	switch event.Type {
+	case companion.EventText:
+		return TextEvent{Type: "text", RequestID: requestID, Data: str("delta"), MessageID: str("message_id")}
+	case companion.EventAudio:
+		return AudioEvent{Type: "audio", RequestID: requestID, Format: str("format"), Data: str("data"), MessageID: str("message_id")}
+	case companion.EventRomance:
+		romance, _ := event.Data["romance"].(int)
+		return RomanceEvent{Type: "romance", RequestID: requestID, Data: romance}
+	case companion.EventAction:
+		return ActionEvent{Type: "action", RequestID: requestID, Data: ActionData{Action: str("action"), Args: str("args")}}
+	case companion.EventConversation:
+		return ConversationEvent{
+			Type:      "conversation",
+			RequestID: requestID,
+			Data:      ConversationData{ConversationID: str("conversation_id"), Title: str("title")},
+		}
+	case companion.EventModeration:
+		action, _ := event.Data["action"].(xmod.Action)
+		categories, _ := event.Data["categories"].([]string)
+		return ModerationEvent{
+			Type:      "moderation",
+			RequestID: requestID,
+			Data:      ModerationData{Stage: str("stage"), Action: action, Categories: categories},
+		}
+	case companion.EventAttachment:
+		// WebSocket 以附件类型作为 type
+		return AttachmentEvent{
+			Type:      str("type"),
+			RequestID: requestID,
+			Data:      AttachmentData{URL: str("url"), Name: str("name"), MimeType: str("mime_type"), MessageID: str("message_id")},
+		}
+	case companion.EventToolEvent:
+		return ToolEvent{
+			Type:      "tool_event",
+			RequestID: requestID,
+			Data:      ToolEventData{Type: str("type"), Data: event.Data["data"], MessageID: str("message_id")},
+		}
+	case companion.EventError:
+		return ErrorEvent{Type: "error", RequestID: requestID, Code: ErrCodeTurnFailed, Message: str("message")}
+	}
+	return event
 }
@@ -1,21 +1,23 @@
 package wss
 
 import (
+	"encoding/json"
 	"log"
 	"time"
-
-	"github.com/gorilla/websocket"
 )
 
-func handlePing(conn *websocket.Conn) {
+func handlePing(s *Session, data []byte) {
 	log.Printf("收到ping，发送pong")
 
+	var ping PingMessage
+	_ = json.Unmarshal(data, &ping)
 	pong := PongMessage{
 		Type:      "pong",
+		RequestID: ping.RequestID,
 		Timestamp: time.Now().UnixMilli(),
 	}
 
-	if err := conn.WriteJSON(pong); err != nil {
+	if err := s.Send(pong); err != nil {
 		log.Printf("发送pong失败: %v", err)
 	}
 }
@@ -0,0 +1,73 @@
+package wss
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/daodao97/xgo/xlog"
+	"github.com/google/uuid"
+)
+
+// confirmTimeout 等待用户确认工具调用的时间, 超时视为拒绝
+const confirmTimeout = 60 * time.Second
+
+// confirmTool 向客户端发送 tool_confirm 请求并等待答复, 实现 xtools.Confirmer
+func (s *Session) confirmTool(ctx context.Context, tool string, args map[string]any) bool {
+	id := uuid.New().String()
+	reply := make(chan bool, 1)
+	s.mu.Lock()
+	if s.confirms == nil {
+		s.confirms = make(map[string]chan bool)
+	}
+	s.confirms[id] = reply
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		delete(s.confirms, id)
+		s.mu.Unlock()
+	}()
+
+	if err := s.Send(ToolConfirmEvent{
+		Type: "tool_confirm",
+		Data: ToolConfirmData{ID: id, Tool: tool, Args: args},
+	}); err != nil {
+		xlog.ErrorC(ctx, "发送工具确认请求失败", xlog.Err(err))
+		return false
+	}
+
+	timer := time.NewTimer(confirmTimeout)
+	defer timer.Stop()
+	select {
+	case approved := <-reply:
+		xlog.InfoC(ctx, "用户答复工具确认", xlog.String("tool", tool), xlog.Any("approved", approved))
+		return approved
+	case <-timer.C:
+		xlog.WarnC(ctx, "等待工具确认超时", xlog.String("tool", tool))
+		return false
+	case <-ctx.Done():
+		return false
+	}
+}
+
+func handleToolConfirm(s *Session, data []byte) {
+	var confirmMsg ToolConfirmMessage
+	if err := json.Unmarshal(data, &confirmMsg); err != nil {
+		xlog.ErrorC(context.Background(), "工具确认消息解析错误", xlog.Err(err))
+		sendError(s, confirmMsg.RequestID, ErrCodeBadRequest, "tool_confirm 消息格式不正确")
+		return
+	}
+
+	s.mu.RLock()
+	reply, ok := s.confirms[confirmMsg.ID]
+	s.mu.RUnlock()
+	if !ok {
+		// 已超时或 id 不存在
+		xlog.WarnC(context.Background(), "未知的工具确认", xlog.String("id", confirmMsg.ID))
+		return
+	}
+	select {
+	case reply <- confirmMsg.Approved:
+	default:
+	}
+}
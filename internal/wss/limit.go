@@ -0,0 +1,114 @@
+package wss
+
+import (
+	"companions/internal/conf"
+	"companions/internal/dao"
+	"companions/internal/pkg/xlimit"
+	"companions/internal/pkg/xusage"
+	"context"
+	"errors"
+	"math"
+	"time"
+
+	"github.com/daodao97/xgo/xlog"
+	"github.com/gorilla/websocket"
+)
+
+// rate_limited 事件的原因
+const (
+	limitReasonMessages    = "messages"
+	limitReasonConnections = "connections"
+	limitReasonQuota       = "quota"
+)
+
+func sendRateLimited(s *Session, requestID string, reason string, message string, retryAfter time.Duration) {
+	if err := s.Send(RateLimitedMessage{
+		Type:       "rate_limited",
+		RequestID:  requestID,
+		Reason:     reason,
+		Message:    message,
+		RetryAfter: int(math.Ceil(retryAfter.Seconds())),
+	}); err != nil {
+		xlog.ErrorC(context.Background(), "发送限流消息失败", xlog.Err(err))
+	}
+}
+
+// acquireConnection 占用用户和 IP 的连接名额, 返回释放函数
+// 超过上限时发送 rate_limited 事件并关闭连接
+func acquireConnection(ctx context.Context, s *Session) (func(), bool) {
+	limitConf := conf.Get().RateLimit
+	if dao.Limiter == nil {
+		return func() {}, true
+	}
+
+	var keys []string
+	release := func() {
+		for _, key := range keys {
+			if err := dao.Limiter.Release(ctx, key); err != nil {
+				xlog.ErrorC(ctx, "释放连接名额失败", xlog.String("key", key), xlog.Err(err))
+			}
+		}
+	}
+
+	limits := map[string]int{"conn:ip:" + s.IP: limitConf.ConnectionsPerIP}
+	if s.UID != "" {
+		limits["conn:uid:"+s.UID] = limitConf.ConnectionsPerUser
+	}
+
+	for key, max := range limits {
+		if max <= 0 {
+			continue
+		}
+		ok, err := dao.Limiter.Acquire(ctx, key, max)
+		if err != nil {
+			// 限流存储故障时放行
+			xlog.ErrorC(ctx, "连接限流检查失败", xlog.String("key", key), xlog.Err(err))
+			continue
+		}
+		if !ok {
+			release()
+			xlog.WarnC(ctx, "连接数超过限制", xlog.String("key", key), xlog.Int("max", max))
+			sendRateLimited(s, "", limitReasonConnections, "连接数超过限制", 0)
+			s.Close(websocket.CloseTryAgainLater, "rate_limited")
+			return nil, false
+		}
+		keys = append(keys, key)
+	}
+	return release, true
+}
+
+// allowMessage 按用户 (匿名用户按 IP) 限制消息频率
+func allowMessage(s *Session, requestID string) bool {
+	limitConf := conf.Get().RateLimit
+	if dao.Limiter == nil || limitConf.MessagesPerMinute <= 0 {
+		return true
+	}
+
+	ctx := context.Background()
+	result, err := dao.Limiter.Allow(ctx, "msg:"+s.limitKey(), xlimit.PerMinute(limitConf.MessagesPerMinute, limitConf.Burst))
+	if err != nil {
+		xlog.ErrorC(ctx, "消息限流检查失败", xlog.Err(err))
+		return true
+	}
+	if !result.Allowed {
+		xlog.WarnC(ctx, "消息频率超过限制", xlog.String("key", s.limitKey()))
+		sendRateLimited(s, requestID, limitReasonMessages, "发送消息过于频繁", result.RetryAfter)
+		return false
+	}
+	return true
+}
+
+// checkQuota 检查用户当日的 token、音频和费用预算
+func checkQuota(s *Session, requestID string) bool {
+	ctx := context.Background()
+	err := xusage.CheckQuota(dao.Usage, s.UID, conf.Get().Usage.Quota)
+	if errors.Is(err, xusage.ErrQuotaExceeded) {
+		xlog.WarnC(ctx, "用户用量超限", xlog.String("uid", s.UID))
+		sendRateLimited(s, requestID, limitReasonQuota, err.Error(), xusage.UntilReset(time.Now()))
+		return false
+	}
+	if err != nil {
+		xlog.ErrorC(ctx, "用量配额检查失败", xlog.Err(err))
+	}
+	return true
+}
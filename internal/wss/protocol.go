@@ -0,0 +1,416 @@
+package wss
+
+import (
+	"companions/internal/pkg/xllm"
+	"companions/internal/pkg/xmem"
+	"companions/internal/pkg/xmod"
+	"maps"
+)
+
+// 协议版本
+// 1: 最初的协议, 不握手; 2: hello 握手, 增加 ack、turn_start、turn_end
+// request_id、错误码和下行事件的 seq 对所有版本生效, 旧客户端忽略新增的字段即可
+// 断线续接需要 hello 下发的 resume_token, 见 resume.go
+const (
+	ProtocolVersion    = 2
+	MinProtocolVersion = 1
+)
+
+// 错误码, 随 error 事件的 code 字段下发
+const (
+	ErrCodeBadRequest         = "bad_request"         // 消息不是合法的 JSON 或字段不正确
+	ErrCodeUnknownType        = "unknown_type"        // 未知的消息类型
+	ErrCodeUnsupportedVersion = "unsupported_version" // 客户端的协议版本过低, 随后关闭连接
+	ErrCodeUnauthorized       = "unauthorized"        // 未登录或 token 不合法
+	ErrCodeNotFound           = "not_found"           // 会话不存在或不属于当前用户
+	ErrCodeInvalidImage       = "invalid_image"       // 图片为空、过大或格式不支持
+	ErrCodeSTTFailed          = "stt_failed"          // 语音识别不可用或失败
+	ErrCodeTurnFailed         = "turn_failed"         // 对话工作流启动或执行失败
+	ErrCodeInternal           = "internal"            // 服务端内部错误
+)
+
+var errorCodes = []string{
+	ErrCodeBadRequest, ErrCodeUnknownType, ErrCodeUnsupportedVersion, ErrCodeUnauthorized,
+	ErrCodeNotFound, ErrCodeInvalidImage, ErrCodeSTTFailed, ErrCodeTurnFailed, ErrCodeInternal,
+}
+
+// turn_end 的状态
+const (
+	TurnCompleted = "completed"
+	TurnFailed    = "failed"
+)
+
+// Message 客户端消息的公共字段, 先按 type 分发再解析为具体的消息
+// request_id 由客户端生成, 服务端对该消息的所有响应原样带回
+type Message struct {
+	Type      string `json:"type"`
+	RequestID string `json:"request_id,omitempty"`
+}
+
+// ---------- 客户端消息 ----------
+
+// HelloRequest 协商协议版本, 也可以在连接时通过 ?protocol_version= 指定
+type HelloRequest struct {
+	Type            string `json:"type"`
+	RequestID       string `json:"request_id,omitempty"`
+	ProtocolVersion int    `json:"protocol_version"`
+}
+
+type PingMessage struct {
+	Type      string `json:"type"`
+	RequestID string `json:"request_id,omitempty"`
+	Timestamp int64  `json:"timestamp,omitempty"`
+}
+
+// AuthRequest 连接期间刷新 token, 避免长连接在 token 过期后被关闭
+type AuthRequest struct {
+	Type      string `json:"type"`
+	RequestID string `json:"request_id,omitempty"`
+	Token     string `json:"token"`
+}
+
+type TextMessage struct {
+	Type      string `json:"type"`
+	RequestID string `json:"request_id,omitempty"`
+	Data      string `json:"data"`
+}
+
+type AudioMessage struct {
+	Type      string `json:"type"`
+	RequestID string `json:"request_id,omitempty"`
+	Format    string `json:"format"`
+	Size      int    `json:"size,omitempty"`
+	Data      string `json:"data"`
+}
+
+// ImageMessage 图片 (image) 或摄像头画面 (video_frame), data 为 base64 或 data URL
+// image 立即发起一轮对话; video_frame 按间隔采样后缓存, 随下一条文本或语音消息发送
+type ImageMessage struct {
+	Type      string `json:"type"`
+	RequestID string `json:"request_id,omitempty"`
+	Data      string `json:"data"`
+	Text      string `json:"text,omitempty"` // 随图片发送的文字, 仅 image 使用
+}
+
+// ToolConfirmMessage 客户端对 tool_confirm 请求的答复, id 为请求中的 id
+type ToolConfirmMessage struct {
+	Type      string `json:"type"`
+	RequestID string `json:"request_id,omitempty"`
+	ID        string `json:"id"`
+	Approved  bool   `json:"approved"`
+}
+
+// ConversationRequest 会话管理消息
+// conversation_new: 新建会话并切换
+// conversation_switch: 切换到已有会话
+// conversation_list: 获取会话列表
+// conversation_rename: 重命名会话
+// conversation_delete: 删除会话
+type ConversationRequest struct {
+	Type           string `json:"type"`
+	RequestID      string `json:"request_id,omitempty"`
+	ConversationID string `json:"conversation_id,omitempty"`
+	Title          string `json:"title,omitempty"`
+}
+
+// ResumeRequest 重连后续接断开前的连接, last_seq 为收到的最后一个事件的 seq
+// 缓冲已过期时服务端从 conversation_id (为空时使用连接当前的会话) 加载最后一轮对话
+type ResumeRequest struct {
+	Type           string `json:"type"`
+	RequestID      string `json:"request_id,omitempty"`
+	ResumeToken    string `json:"resume_token"`
+	LastSeq        int64  `json:"last_seq" minimum:"0"`
+	ConversationID string `json:"conversation_id,omitempty"`
+}
+
+// ---------- 服务端事件 ----------
+
+// HelloEvent 握手结果, protocol_version 为双方都支持的版本
+type HelloEvent struct {
+	Type               string `json:"type"`
+	RequestID          string `json:"request_id,omitempty"`
+	ProtocolVersion    int    `json:"protocol_version"`
+	MinProtocolVersion int    `json:"min_protocol_version"`
+	MaxProtocolVersion int    `json:"max_protocol_version"`
+	ResumeToken        string `json:"resume_token,omitempty"` // 断线重连后通过 resume 续接
+	ResumeTTL          int    `json:"resume_ttl,omitempty"`   // 断线后可以续接的时间 (秒)
+}
+
+type PongMessage struct {
+	Type      string `json:"type"`
+	RequestID string `json:"request_id,omitempty"`
+	Timestamp int64  `json:"timestamp"`
+}
+
+// AckEvent 协议版本 2: 对话请求通过校验和限流, 开始处理
+type AckEvent struct {
+	Type      string `json:"type"`
+	RequestID string `json:"request_id"`
+}
+
+// ErrorEvent 错误, code 见 ErrCode*, message 为给用户看的说明
+type ErrorEvent struct {
+	Type      string `json:"type"`
+	RequestID string `json:"request_id,omitempty"`
+	Code      string `json:"code"`
+	Message   string `json:"message"`
+}
+
+// AuthEvent auth (续期成功)、auth_expiring (即将过期)、auth_expired (已过期, 随后关闭连接)
+type AuthEvent struct {
+	Type      string `json:"type"`
+	RequestID string `json:"request_id,omitempty"`
+	ExpiresAt int64  `json:"expires_at,omitempty"`
+}
+
+// RateLimitedMessage 被限流时发送给客户端的事件, retry_after 单位为秒, 0 表示无法通过等待恢复
+type RateLimitedMessage struct {
+	Type       string `json:"type"`
+	RequestID  string `json:"request_id,omitempty"`
+	Reason     string `json:"reason" enum:"messages,connections,quota"`
+	Message    string `json:"message"`
+	RetryAfter int    `json:"retry_after"`
+}
+
+// TurnStartEvent 协议版本 2: 一轮回复开始, 之后的回复事件共用 message_id
+type TurnStartEvent struct {
+	Type      string   `json:"type"`
+	RequestID string   `json:"request_id,omitempty"`
+	Data      TurnData `json:"data"`
+}
+
+type TurnData struct {
+	MessageID      string `json:"message_id"`
+	ConversationID string `json:"conversation_id,omitempty"`
+}
+
+// TurnEndEvent 协议版本 2: 一轮回复结束, 之后不会再有该轮的事件
+type TurnEndEvent struct {
+	Type      string      `json:"type"`
+	RequestID string      `json:"request_id,omitempty"`
+	Data      TurnEndData `json:"data"`
+}
+
+type TurnEndData struct {
+	MessageID string `json:"message_id"`
+	Status    string `json:"status" enum:"completed,failed"`
+}
+
+// TextEvent 回复的一段增量, 客户端按 message_id 拼接
+type TextEvent struct {
+	Type      string `json:"type"`
+	RequestID string `json:"request_id,omitempty"`
+	Data      string `json:"data"`
+	MessageID string `json:"message_id,omitempty"`
+}
+
+type AudioEvent struct {
+	Type      string `json:"type"`
+	RequestID string `json:"request_id,omitempty"`
+	Format    string `json:"format"`
+	Data      string `json:"data"`
+	MessageID string `json:"message_id"`
+}
+
+type RomanceEvent struct {
+	Type      string `json:"type"`
+	RequestID string `json:"request_id,omitempty"`
+	Data      int    `json:"data"`
+}
+
+type ActionEvent struct {
+	Type      string     `json:"type"`
+	RequestID string     `json:"request_id,omitempty"`
+	Data      ActionData `json:"data"`
+}
+
+type ActionData struct {
+	Action string `json:"action"`
+	Args   string `json:"args"`
+}
+
+// ConversationEvent 会话创建、切换、重命名或生成标题后推送
+type ConversationEvent struct {
+	Type      string           `json:"type"`
+	RequestID string           `json:"request_id,omitempty"`
+	Data      ConversationData `json:"data"`
+}
+
+type ConversationData struct {
+	ConversationID string `json:"conversation_id"`
+	Title          string `json:"title"`
+}
+
+type ConversationListEvent struct {
+	Type      string               `json:"type"`
+	RequestID string               `json:"request_id,omitempty"`
+	Data      []*xmem.Conversation `json:"data"`
+}
+
+type ConversationDeletedEvent struct {
+	Type      string                  `json:"type"`
+	RequestID string                  `json:"request_id,omitempty"`
+	Data      ConversationDeletedData `json:"data"`
+}
+
+type ConversationDeletedData struct {
+	ConversationID string `json:"conversation_id"`
+}
+
+type ModerationEvent struct {
+	Type      string         `json:"type"`
+	RequestID string         `json:"request_id,omitempty"`
+	Data      ModerationData `json:"data"`
+}
+
+type ModerationData struct {
+	Stage      string      `json:"stage"`
+	Action     xmod.Action `json:"action"`
+	Categories []string    `json:"categories"`
+}
+
+// AttachmentEvent 工具产生的附件, type 为附件类型, 如 image
+type AttachmentEvent struct {
+	Type      string         `json:"type"`
+	RequestID string         `json:"request_id,omitempty"`
+	Data      AttachmentData `json:"data"`
+}
+
+type AttachmentData struct {
+	URL       string `json:"url"`
+	Name      string `json:"name"`
+	MimeType  string `json:"mime_type"`
+	MessageID string `json:"message_id"`
+}
+
+type ToolEvent struct {
+	Type      string        `json:"type"`
+	RequestID string        `json:"request_id,omitempty"`
+	Data      ToolEventData `json:"data"`
+}
+
+type ToolEventData struct {
+	Type      string `json:"type"`
+	Data      any    `json:"data"`
+	MessageID string `json:"message_id"`
+}
+
+// ToolConfirmEvent 需要用户确认的工具调用, 客户端以 tool_confirm 答复
+type ToolConfirmEvent struct {
+	Type string          `json:"type"`
+	Data ToolConfirmData `json:"data"`
+}
+
+type ToolConfirmData struct {
+	ID   string         `json:"id"`
+	Tool string         `json:"tool"`
+	Args map[string]any `json:"args"`
+}
+
+// ResumedEvent resume 的结果, resumed 为 false 时缓冲已过期或不完整, 没有补发事件, 由 last_turn 补齐
+// 之后的事件从 last_seq 继续编号
+type ResumedEvent struct {
+	Type      string      `json:"type"`
+	RequestID string      `json:"request_id,omitempty"`
+	Data      ResumedData `json:"data"`
+}
+
+type ResumedData struct {
+	Resumed     bool       `json:"resumed"`
+	Replayed    int        `json:"replayed"`
+	ResumeToken string     `json:"resume_token"`
+	LastSeq     int64      `json:"last_seq"`
+	LastTurn    *xmem.Turn `json:"last_turn,omitempty"`
+}
+
+type ReminderEvent struct {
+	Type string       `json:"type"`
+	Data ReminderData `json:"data"`
+}
+
+type ReminderData struct {
+	ID             string `json:"id"`
+	Kind           string `json:"kind" enum:"reminder,checkin"`
+	Character      string `json:"character"`
+	ConversationID string `json:"conversation_id"`
+	Content        string `json:"content"`
+	DueAt          string `json:"due_at"` // RFC3339, 用户当地时间
+}
+
+// ---------- JSON Schema ----------
+
+// clientSchemas 客户端消息, 按 type 索引
+func clientSchemas() map[string]any {
+	schemas := map[string]any{
+		"hello":        eventSchema[HelloRequest]("hello"),
+		"ping":         eventSchema[PingMessage]("ping"),
+		"auth":         eventSchema[AuthRequest]("auth"),
+		"text":         eventSchema[TextMessage]("text"),
+		"audio":        eventSchema[AudioMessage]("audio"),
+		"image":        eventSchema[ImageMessage]("image"),
+		"video_frame":  eventSchema[ImageMessage]("video_frame"),
+		"tool_confirm": eventSchema[ToolConfirmMessage]("tool_confirm"),
+		"resume":       eventSchema[ResumeRequest]("resume"),
+	}
+	for _, t := range []string{"conversation_new", "conversation_switch", "conversation_list", "conversation_rename", "conversation_delete"} {
+		schemas[t] = eventSchema[ConversationRequest](t)
+	}
+	return schemas
+}
+
+// serverSchemas 服务端事件, 按 type 索引
+func serverSchemas() map[string]any {
+	schemas := map[string]any{
+		"hello":                eventSchema[HelloEvent]("hello"),
+		"pong":                 eventSchema[PongMessage]("pong"),
+		"ack":                  eventSchema[AckEvent]("ack"),
+		"error":                eventSchema[ErrorEvent]("error"),
+		"rate_limited":         eventSchema[RateLimitedMessage]("rate_limited"),
+		"turn_start":           eventSchema[TurnStartEvent]("turn_start"),
+		"turn_end":             eventSchema[TurnEndEvent]("turn_end"),
+		"text":                 eventSchema[TextEvent]("text"),
+		"audio":                eventSchema[AudioEvent]("audio"),
+		"romance":              eventSchema[RomanceEvent]("romance"),
+		"action":               eventSchema[ActionEvent]("action"),
+		"conversation":         eventSchema[ConversationEvent]("conversation"),
+		"conversation_list":    eventSchema[ConversationListEvent]("conversation_list"),
+		"conversation_deleted": eventSchema[ConversationDeletedEvent]("conversation_deleted"),
+		"moderation":           eventSchema[ModerationEvent]("moderation"),
+		"image":                eventSchema[AttachmentEvent]("image"),
+		"tool_event":           eventSchema[ToolEvent]("tool_event"),
+		"tool_confirm":         eventSchema[ToolConfirmEvent]("tool_confirm"),
+		"reminder":             eventSchema[ReminderEvent]("reminder"),
+		"resumed":              eventSchema[ResumedEvent]("resumed"),
+	}
+	for _, t := range []string{"auth", "auth_expiring", "auth_expired"} {
+		schemas[t] = eventSchema[AuthEvent](t)
+	}
+	// 经过 outbox 的事件带有 seq
+	for t, schema := range schemas {
+		if !transientEvents[t] {
+			schema.(map[string]any)["properties"].(map[string]any)["seq"] = map[string]any{"type": "integer"}
+		}
+	}
+	return schemas
+}
+
+// eventSchema 结构体的 JSONSchema, type 字段限定为 t
+func eventSchema[T any](t string) map[string]any {
+	schema := xllm.SchemaFor[T]()
+	properties := maps.Clone(schema["properties"].(map[string]any))
+	properties["type"] = map[string]any{"type": "string", "enum": []string{t}}
+	schema["properties"] = properties
+	return schema
+}
+
+// ProtocolSchema WebSocket 协议的 JSONSchema 文档, 前端和测试使用 assets/static/ws-protocol.json 中生成的副本
+func ProtocolSchema() map[string]any {
+	return map[string]any{
+		"title":                "companions websocket protocol",
+		"protocol_version":     ProtocolVersion,
+		"min_protocol_version": MinProtocolVersion,
+		"error_codes":          errorCodes,
+		"client":               clientSchemas(),
+		"server":               serverSchemas(),
+	}
+}
@@ -0,0 +1,148 @@
+package wss
+
+import (
+	"bytes"
+	"companions/internal/character"
+	"companions/internal/companion"
+	"companions/internal/pkg/xagent"
+	"companions/internal/pkg/xllm"
+	"companions/internal/pkg/xmod"
+	"companions/internal/pkg/xtools"
+	"companions/internal/pkg/xtts"
+	"encoding/json"
+	"os"
+	"testing"
+)
+
+const protocolSchemaFile = "../../assets/static/ws-protocol.json"
+
+// TestProtocolSchema 前端使用的 ws-protocol.json 需要与代码一致, UPDATE_PROTOCOL_SCHEMA=1 时重新生成
+func TestProtocolSchema(t *testing.T) {
+	want, err := json.MarshalIndent(ProtocolSchema(), "", "  ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want = append(want, '\n')
+
+	if os.Getenv("UPDATE_PROTOCOL_SCHEMA") == "1" {
+		if err := os.WriteFile(protocolSchemaFile, want, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+	got, err := os.ReadFile(protocolSchemaFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("%s 已过期, 使用 UPDATE_PROTOCOL_SCHEMA=1 go test ./internal/wss 重新生成", protocolSchemaFile)
+	}
+}
+
+func TestProtocolEvents(t *testing.T) {
+	server := serverSchemas()
+	events := []any{
+		HelloEvent{Type: "hello", ProtocolVersion: 2, MinProtocolVersion: 1, MaxProtocolVersion: 2},
+		AckEvent{Type: "ack", RequestID: "r1"},
+		ErrorEvent{Type: "error", RequestID: "r1", Code: ErrCodeTurnFailed, Message: "出错了"},
+		RateLimitedMessage{Type: "rate_limited", Reason: "quota", Message: "今日额度已用完", RetryAfter: 60},
+		TurnStartEvent{Type: "turn_start", RequestID: "r1", Data: TurnData{MessageID: "m1", ConversationID: "c1"}},
+		TurnEndEvent{Type: "turn_end", RequestID: "r1", Data: TurnEndData{MessageID: "m1", Status: TurnCompleted}},
+		TextEvent{Type: "text", RequestID: "r1", Data: "你好", MessageID: "m1"},
+		ModerationEvent{Type: "moderation", Data: ModerationData{Stage: "output", Action: xmod.ActionBlock, Categories: []string{"violence"}}},
+		ReminderEvent{Type: "reminder", Data: ReminderData{ID: "1", Kind: "checkin", DueAt: "2025-01-01T09:00:00+08:00"}},
+		AuthEvent{Type: "auth_expiring", ExpiresAt: 1700000000},
+	}
+	for _, event := range events {
+		value := roundTrip(t, event)
+		typ := value.(map[string]any)["type"].(string)
+		schema, ok := server[typ].(map[string]any)
+		if !ok {
+			t.Errorf("缺少 %s 的 schema", typ)
+			continue
+		}
+		if errs := xllm.Validate(schema, value); len(errs) > 0 {
+			t.Errorf("%s: %v", typ, errs)
+		}
+	}
+
+	// 不符合约定的事件需要被 schema 拒绝
+	invalid := roundTrip(t, TurnEndEvent{Type: "turn_end", Data: TurnEndData{MessageID: "m1", Status: "unknown"}})
+	if errs := xllm.Validate(server["turn_end"].(map[string]any), invalid); len(errs) == 0 {
+		t.Error("turn_end status 不在枚举内时应该校验失败")
+	}
+}
+
+// TestProtocolEventFromMessages 工作流消息经 companion.ToEvent 转换后的 WebSocket 事件需要符合 schema
+func TestProtocolEventFromMessages(t *testing.T) {
+	server := serverSchemas()
+	action := &xllm.ToolCall{}
+	action.Function.Name, action.Function.Arguments = "wave", "{}"
+	messages := []xagent.Message{
+		&xagent.BaseMessage{Content: "你好", MessageID: "m1"},
+		character.NewAudioMessage("m1", xtts.AudioChunk{Data: "AAAA", Format: "mp3"}),
+		character.NewRomanceMessage(60),
+		character.NewActionMessage(action),
+		character.NewConversationMessage("c1", "初次见面"),
+		character.NewModerationMessage("m1", xmod.StageOutput, &xmod.Decision{Action: xmod.ActionWarn, Categories: []string{"violence"}}),
+		character.NewAttachmentMessage("m1", xtools.Attachment{Type: "image", URL: "https://a.png", Name: "a.png", MimeType: "image/png"}),
+		character.NewToolEventMessage("m1", xtools.Event{Type: "play_music", Data: map[string]any{"url": "https://a.mp3"}}),
+		character.NewErrorMessage("出错了"),
+	}
+	for _, msg := range messages {
+		event, ok := companion.ToEvent(msg)
+		if !ok {
+			t.Fatalf("%T 没有对应的事件", msg)
+		}
+		value := roundTrip(t, protocolEvent(event, "r1")).(map[string]any)
+		typ := value["type"].(string)
+		schema, ok := server[typ].(map[string]any)
+		if !ok {
+			t.Errorf("缺少 %s 的 schema", typ)
+			continue
+		}
+		if errs := xllm.Validate(schema, value); len(errs) > 0 {
+			t.Errorf("%s: %v", typ, errs)
+		}
+		if value["request_id"] != "r1" {
+			t.Errorf("%s 缺少 request_id", typ)
+		}
+	}
+}
+
+func TestProtocolClientMessages(t *testing.T) {
+	client := clientSchemas()
+	messages := []any{
+		HelloRequest{Type: "hello", ProtocolVersion: 2},
+		TextMessage{Type: "text", RequestID: "r1", Data: "你好"},
+		AudioMessage{Type: "audio", RequestID: "r2", Format: "webm", Data: "AAAA"},
+		ToolConfirmMessage{Type: "tool_confirm", ID: "t1", Approved: true},
+	}
+	for _, msg := range messages {
+		value := roundTrip(t, msg)
+		typ := value.(map[string]any)["type"].(string)
+		if errs := xllm.Validate(client[typ].(map[string]any), value); len(errs) > 0 {
+			t.Errorf("%s: %v", typ, errs)
+		}
+	}
+
+	// 客户端消息的 type 不能匹配其他类型的 schema
+	text := roundTrip(t, TextMessage{Type: "text", Data: "你好"})
+	if errs := xllm.Validate(client["image"].(map[string]any), text); len(errs) == 0 {
+		t.Error("text 消息不应通过 image 的校验")
+	}
+}
+
+// roundTrip 按线上格式编码后解码为通用的 JSON 值
+func roundTrip(t *testing.T, v any) any {
+	t.Helper()
+	data, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var value any
+	if err := json.Unmarshal(data, &value); err != nil {
+		t.Fatal(err)
+	}
+	return value
+}
@@ -0,0 +1,274 @@
+package wss
+
+import (
+	"companions/internal/conf"
+	"companions/internal/dao"
+	"companions/internal/pkg/xmem"
+	"context"
+	"encoding/json"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/daodao97/xgo/xlog"
+	"github.com/google/uuid"
+	"github.com/gorilla/websocket"
+	"github.com/tidwall/sjson"
+)
+
+// 断线续接: 下行事件带上递增的 seq 并缓冲在连接的 outbox 中, 连接断开后 outbox 保留 websocket.resume_ttl,
+// 客户端重连后发送 resume, 带上 hello 下发的 resume_token 和收到的最后一个 seq, 服务端补发之后的事件并由新连接接管 outbox
+
+const (
+	defaultResumeTTL    = 2 * time.Minute
+	defaultResumeBuffer = 256
+)
+
+// transientEvents 只对当前连接有意义的事件, 不编号也不缓冲
+var transientEvents = map[string]bool{
+	"hello":         true,
+	"pong":          true,
+	"resumed":       true,
+	"auth":          true,
+	"auth_expiring": true,
+	"auth_expired":  true,
+}
+
+func resumeTTL() time.Duration {
+	if ttl := conf.Get().WebSocket.ResumeTTL; ttl > 0 {
+		return time.Duration(ttl) * time.Second
+	}
+	return defaultResumeTTL
+}
+
+func resumeBuffer() int {
+	if size := conf.Get().WebSocket.ResumeBuffer; size > 0 {
+		return size
+	}
+	return defaultResumeBuffer
+}
+
+type bufferedEvent struct {
+	seq  int64
+	data []byte
+}
+
+// outbox 连接的下行事件缓冲, 容量有限, 超出时丢弃最早的事件
+type outbox struct {
+	mu      sync.Mutex
+	token   string
+	uid     string
+	seq     int64
+	events  []bufferedEvent
+	limit   int
+	session *Session // 最近一个使用 outbox 的连接
+	online  bool     // session 的连接是否可写, 断开后事件只缓冲
+	expiry  *time.Timer
+}
+
+// outboxes 可以续接的 outbox, 按 resume_token 索引
+var outboxes = struct {
+	mu    sync.Mutex
+	token map[string]*outbox
+}{token: make(map[string]*outbox)}
+
+func newOutbox(uid string, limit int) *outbox {
+	return &outbox{token: uuid.New().String(), uid: uid, limit: limit}
+}
+
+// openOutbox 为新连接创建 outbox 并登记
+func openOutbox(s *Session) *outbox {
+	o := newOutbox(s.UID, resumeBuffer())
+	o.session, o.online = s, true
+	outboxes.mu.Lock()
+	outboxes.token[o.token] = o
+	outboxes.mu.Unlock()
+	return o
+}
+
+// findOutbox 按 token 查找, 不存在、已过期或属于其他用户时返回 nil
+func findOutbox(token string, uid string) *outbox {
+	outboxes.mu.Lock()
+	defer outboxes.mu.Unlock()
+	o := outboxes.token[token]
+	if o == nil || o.uid != uid {
+		return nil
+	}
+	return o
+}
+
+func dropOutbox(o *outbox) {
+	outboxes.mu.Lock()
+	defer outboxes.mu.Unlock()
+	delete(outboxes.token, o.token)
+}
+
+// send 编号、缓冲后写入当前连接; 连接已断开时只缓冲, 等待续接
+func (o *outbox) send(data []byte) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	data = o.push(data)
+	if !o.online {
+		return nil
+	}
+	return o.session.write(data)
+}
+
+// push 分配 seq 并加入缓冲
+func (o *outbox) push(data []byte) []byte {
+	o.seq++
+	if stamped, err := sjson.SetBytes(data, "seq", o.seq); err == nil {
+		data = stamped
+	}
+	o.events = append(o.events, bufferedEvent{seq: o.seq, data: data})
+	if len(o.events) > o.limit {
+		o.events = slices.Delete(o.events, 0, len(o.events)-o.limit)
+	}
+	return data
+}
+
+// since seq 之后的事件; 其中一部分已被丢弃或 seq 不合法时 ok 为 false
+func (o *outbox) since(seq int64) (events []bufferedEvent, ok bool) {
+	if seq < 0 || seq > o.seq {
+		return nil, false
+	}
+	if len(o.events) > 0 && seq+1 < o.events[0].seq {
+		return nil, false
+	}
+	i := slices.IndexFunc(o.events, func(e bufferedEvent) bool { return e.seq > seq })
+	if i < 0 {
+		return nil, true
+	}
+	return o.events[i:], true
+}
+
+// detach 连接断开, outbox 保留 resume_ttl 后删除; 已被其他连接接管时不处理
+func (o *outbox) detach(s *Session) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.session != s || !o.online {
+		return
+	}
+	o.online = false
+	o.expiry = time.AfterFunc(resumeTTL(), o.expire)
+}
+
+func (o *outbox) expire() {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if !o.online {
+		dropOutbox(o)
+	}
+}
+
+// resume 由 s 接管 outbox, 补发 last_seq 之后的事件; 缓冲不完整时不补发, 附带最后一轮对话由客户端从记忆中补齐
+// 旧连接尚未发现断线时将其关闭; 检查缓冲和补发在同一次加锁内完成, 期间的新事件不会遗漏
+func (o *outbox) resume(s *Session, req ResumeRequest, event ResumedEvent) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.expiry != nil {
+		o.expiry.Stop()
+		o.expiry = nil
+	}
+
+	prev, prevOnline := o.session, o.online
+	o.session, o.online = s, true
+	if prev != nil && prev != s {
+		// 沿用旧连接的会话
+		if conv := prev.ConversationID(); conv != "" && s.ConversationID() == "" {
+			s.SetConversationID(conv)
+		}
+		if prevOnline {
+			prev.Close(websocket.CloseNormalClosure, "resumed by another connection")
+			prev.conn.Close()
+		}
+	}
+
+	events, ok := o.since(req.LastSeq)
+	if !ok {
+		event.Data.LastTurn = lastTurn(s, req.ConversationID)
+	}
+	for _, e := range events {
+		if err := s.write(e.data); err != nil {
+			return err
+		}
+	}
+	event.Data.Resumed = ok
+	event.Data.Replayed = len(events)
+	return o.sendResumed(s, event)
+}
+
+// sendResumed 在持有 o.mu 时发送 resumed, 保证 last_seq 之后的事件都在它之后到达
+func (o *outbox) sendResumed(s *Session, event ResumedEvent) error {
+	event.Data.ResumeToken = o.token
+	event.Data.LastSeq = o.seq
+	data, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	return s.write(data)
+}
+
+func handleResume(s *Session, data []byte) {
+	var req ResumeRequest
+	if err := json.Unmarshal(data, &req); err != nil {
+		sendError(s, req.RequestID, ErrCodeBadRequest, "resume 消息格式不正确")
+		return
+	}
+
+	event := ResumedEvent{Type: "resumed", RequestID: req.RequestID}
+	current := s.outbox()
+	if o := findOutbox(req.ResumeToken, s.UID); o != nil && o != current {
+		if current != nil {
+			dropOutbox(current)
+		}
+		s.setOutbox(o)
+		if err := o.resume(s, req, event); err != nil {
+			xlog.ErrorC(context.Background(), "补发事件失败", xlog.Err(err))
+		}
+		return
+	}
+
+	// outbox 已过期: 从记忆中加载最后一轮对话, 之后的事件从新的 outbox 开始编号
+	xlog.InfoC(context.Background(), "续接的会话已过期", xlog.String("uid", s.UID))
+	event.Data.LastTurn = lastTurn(s, req.ConversationID)
+	if current == nil {
+		return
+	}
+	current.mu.Lock()
+	defer current.mu.Unlock()
+	if err := current.sendResumed(s, event); err != nil {
+		xlog.ErrorC(context.Background(), "发送 resumed 失败", xlog.Err(err))
+	}
+}
+
+// lastTurn 会话的最后一轮对话, conversationID 为空时使用连接当前的会话
+// 会话需要属于当前用户, 连接还没有会话时切换到该会话
+func lastTurn(s *Session, conversationID string) *xmem.Turn {
+	if conversationID == "" {
+		conversationID = s.ConversationID()
+	}
+	if s.UID == "" || conversationID == "" || dao.Memory == nil {
+		return nil
+	}
+	conv, err := dao.Memory.Find(conversationID)
+	if err != nil || conv.Uid != s.UID {
+		return nil
+	}
+	if s.ConversationID() == "" {
+		s.SetConversationID(conversationID)
+	}
+
+	// 每轮最后写入的是元信息记录, Messages 的 limit 只计可展示的消息, 取到的是最后一轮的回复
+	messages, _, err := dao.Memory.Messages(conversationID, 0, 1)
+	if err != nil || len(messages) == 0 {
+		return nil
+	}
+	messageID, _ := messages[0]["message_id"].(string)
+	turn, err := dao.Memory.Turn(conversationID, messageID)
+	if err != nil {
+		xlog.WarnC(context.Background(), "读取最后一轮对话失败", xlog.String("conversation_id", conversationID), xlog.Err(err))
+		return nil
+	}
+	return turn
+}
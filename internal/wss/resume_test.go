@@ -0,0 +1,224 @@
+package wss
+
+import (
+	"companions/internal/dao"
+	"companions/internal/pkg/xagent"
+	"companions/internal/pkg/xmem"
+	"companions/internal/pkg/xremind"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestOutboxBuffer(t *testing.T) {
+	o := newOutbox("u1", 3)
+	for i := 0; i < 5; i++ {
+		data, _ := json.Marshal(TextEvent{Type: "text", Data: "你好"})
+		data = o.push(data)
+		var event map[string]any
+		if err := json.Unmarshal(data, &event); err != nil || event["seq"] != float64(i+1) {
+			t.Fatalf("event = %s, err = %v", data, err)
+		}
+	}
+	// 容量为 3, 只保留 seq 3~5
+	if len(o.events) != 3 || o.events[0].seq != 3 {
+		t.Fatalf("events = %+v", o.events)
+	}
+
+	tests := []struct {
+		seq      int64
+		replayed int
+		ok       bool
+	}{
+		{5, 0, true},
+		{2, 3, true},
+		{4, 1, true},
+		{1, 0, false}, // seq 2 已被丢弃
+		{6, 0, false},
+		{-1, 0, false},
+	}
+	for _, tt := range tests {
+		events, ok := o.since(tt.seq)
+		if len(events) != tt.replayed || ok != tt.ok {
+			t.Errorf("since(%d) = %d, %v, want %d, %v", tt.seq, len(events), ok, tt.replayed, tt.ok)
+		}
+	}
+
+	// 还没有事件时从 0 续接
+	if events, ok := newOutbox("u1", 3).since(0); len(events) != 0 || !ok {
+		t.Errorf("empty since(0) = %d, %v", len(events), ok)
+	}
+}
+
+func TestFindOutbox(t *testing.T) {
+	o := newOutbox("u1", 3)
+	outboxes.mu.Lock()
+	outboxes.token[o.token] = o
+	outboxes.mu.Unlock()
+
+	if findOutbox(o.token, "u2") != nil {
+		t.Error("其他用户不能续接")
+	}
+	if findOutbox(o.token, "u1") != o {
+		t.Error("应该找到 outbox")
+	}
+
+	// 断开后过期删除
+	o.expire()
+	if findOutbox(o.token, "u1") != nil {
+		t.Error("过期的 outbox 应该被删除")
+	}
+}
+
+func TestProtocolSeq(t *testing.T) {
+	server := serverSchemas()
+	for _, typ := range []string{"text", "turn_end", "reminder"} {
+		if _, ok := server[typ].(map[string]any)["properties"].(map[string]any)["seq"]; !ok {
+			t.Errorf("%s 缺少 seq", typ)
+		}
+	}
+	for typ := range transientEvents {
+		if _, ok := server[typ].(map[string]any)["properties"].(map[string]any)["seq"]; ok {
+			t.Errorf("%s 不应带 seq", typ)
+		}
+	}
+}
+
+// useMemory 测试期间使用带两轮对话的内存记忆, 结束后恢复
+func useMemory(t *testing.T) {
+	t.Helper()
+	prev := dao.Memory
+	t.Cleanup(func() { dao.Memory = prev })
+
+	dao.Memory = xmem.NewInMemory()
+	if err := dao.Memory.Create("c1", "u1", ""); err != nil {
+		t.Fatal(err)
+	}
+	for _, id := range []string{"t1", "t2"} {
+		if err := dao.Memory.Insert("c1", []xagent.Message{
+			xagent.NewMessage().Role(xagent.MessageRoleUser).ID(id).Content("hi").Storage(true).Build(),
+			xagent.NewMessage().Role(xagent.MessageRoleAssistant).ID(id).Content("hey").Storage(true).Build(),
+			xagent.NewMetaMessage(id, map[string]any{"romance": map[string]any{"change": 1}}),
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// wsPair 返回一对相连的 websocket 连接, server 端用于 Session
+func wsPair(t *testing.T) (server, client *websocket.Conn) {
+	t.Helper()
+	conns := make(chan *websocket.Conn, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := (&websocket.Upgrader{}).Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		conns <- conn
+	}))
+	t.Cleanup(srv.Close)
+
+	client, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server = <-conns
+	t.Cleanup(func() {
+		client.Close()
+		server.Close()
+	})
+	return server, client
+}
+
+func readEvent(t *testing.T, conn *websocket.Conn) map[string]any {
+	t.Helper()
+	_ = conn.SetReadDeadline(time.Now().Add(time.Second))
+	var event map[string]any
+	if err := conn.ReadJSON(&event); err != nil {
+		t.Fatal(err)
+	}
+	return event
+}
+
+func TestResume(t *testing.T) {
+	useMemory(t)
+
+	// 旧连接已断开, 缓冲容量为 2, seq 1 已被丢弃
+	o := newOutbox("u1", 2)
+	old := &Session{UID: "u1", conversationID: "c1"}
+	o.session = old
+	for i := 0; i < 3; i++ {
+		data, _ := json.Marshal(TextEvent{Type: "text", Data: "你好"})
+		o.push(data)
+	}
+
+	server, client := wsPair(t)
+	s := &Session{UID: "u1", conn: server}
+
+	// 缓冲不完整时不补发, 附带最后一轮对话, 并沿用旧连接的会话
+	if err := o.resume(s, ResumeRequest{LastSeq: 0}, ResumedEvent{Type: "resumed"}); err != nil {
+		t.Fatal(err)
+	}
+	event := readEvent(t, client)
+	data := event["data"].(map[string]any)
+	if event["type"] != "resumed" || data["resumed"] != false || data["replayed"] != float64(0) || data["last_turn"] == nil {
+		t.Fatalf("resumed = %v", event)
+	}
+	if s.ConversationID() != "c1" || o.session != s || !o.online {
+		t.Errorf("conversation = %s, session = %p, online = %v", s.ConversationID(), o.session, o.online)
+	}
+
+	// 缓冲完整时补发之后的事件, 不附带最后一轮对话
+	if err := o.resume(s, ResumeRequest{LastSeq: 2}, ResumedEvent{Type: "resumed"}); err != nil {
+		t.Fatal(err)
+	}
+	if event := readEvent(t, client); event["seq"] != float64(3) {
+		t.Fatalf("replayed = %v", event)
+	}
+	event = readEvent(t, client)
+	data = event["data"].(map[string]any)
+	if data["resumed"] != true || data["replayed"] != float64(1) || data["last_turn"] != nil || data["last_seq"] != float64(3) {
+		t.Fatalf("resumed = %v", event)
+	}
+}
+
+// TestDeliverReminderSharedOutbox 续接后旧连接注销前新旧连接共用 outbox, 提醒只缓冲一次
+func TestDeliverReminderSharedOutbox(t *testing.T) {
+	o := newOutbox("u3", 8)
+	old := &Session{UID: "u3", box: o}
+	s := &Session{UID: "u3", box: o}
+	o.session = s
+	defer register(old)()
+	defer register(s)()
+
+	if !deliverReminder(context.Background(), &xremind.Reminder{ID: "r1", UID: "u3", Content: "喝水"}) {
+		t.Fatal("deliverReminder() = false")
+	}
+	if len(o.events) != 1 {
+		t.Errorf("events = %d, want 1", len(o.events))
+	}
+}
+
+func TestLastTurn(t *testing.T) {
+	useMemory(t)
+
+	s := &Session{UID: "u1"}
+	turn := lastTurn(s, "c1")
+	if turn == nil || turn.MessageID != "t2" || len(turn.Messages) != 2 || turn.Meta["romance"] == nil {
+		t.Fatalf("lastTurn() = %+v", turn)
+	}
+	// 连接还没有会话时切换到该会话
+	if s.ConversationID() != "c1" {
+		t.Errorf("conversation = %s", s.ConversationID())
+	}
+
+	if turn := lastTurn(&Session{UID: "u2"}, "c1"); turn != nil {
+		t.Errorf("其他用户的会话不应返回, got %+v", turn)
+	}
+}
@@ -0,0 +1,114 @@
+package wss
+
+import (
+	"companions/internal/character"
+	"companions/internal/conf"
+	"companions/internal/dao"
+	"companions/internal/pkg/xremind"
+	"context"
+	"sync"
+	"time"
+
+	"github.com/daodao97/xgo/xlog"
+)
+
+// scheduler 提醒调度, conf.Scheduler 未开启时为 nil
+var scheduler *xremind.Scheduler
+
+// StartScheduler 启动提醒调度, 需要在 dao.Init 之后调用
+func StartScheduler() {
+	if dao.Reminders == nil {
+		return
+	}
+	schedulerConf := conf.Get().Scheduler
+	scheduler = xremind.NewScheduler(dao.Reminders, deliverReminder,
+		xremind.WithInterval(time.Duration(schedulerConf.Interval)*time.Second),
+		xremind.WithCheckins(schedulerConf.Checkins),
+	)
+	go scheduler.Run(context.Background())
+	xlog.Info("提醒调度已启动", xlog.Int("checkins", len(schedulerConf.Checkins)))
+}
+
+// sessions 在线的登录用户连接, 按 uid 索引, 用于推送提醒
+var sessions = struct {
+	mu  sync.RWMutex
+	uid map[string]map[*Session]struct{}
+}{uid: make(map[string]map[*Session]struct{})}
+
+// register 登记在线连接并发送积压的提醒, 返回的函数在连接断开时调用
+func register(s *Session) func() {
+	if s.UID == "" {
+		return func() {}
+	}
+	sessions.mu.Lock()
+	if sessions.uid[s.UID] == nil {
+		sessions.uid[s.UID] = make(map[*Session]struct{})
+	}
+	sessions.uid[s.UID][s] = struct{}{}
+	sessions.mu.Unlock()
+
+	if scheduler != nil {
+		go scheduler.Flush(context.Background(), s.UID)
+	}
+
+	return func() {
+		sessions.mu.Lock()
+		defer sessions.mu.Unlock()
+		delete(sessions.uid[s.UID], s)
+		if len(sessions.uid[s.UID]) == 0 {
+			delete(sessions.uid, s.UID)
+		}
+	}
+}
+
+func online(uid string) []*Session {
+	sessions.mu.RLock()
+	defer sessions.mu.RUnlock()
+	list := make([]*Session, 0, len(sessions.uid[uid]))
+	for s := range sessions.uid[uid] {
+		list = append(list, s)
+	}
+	return list
+}
+
+// deliverReminder 推送到用户所有在线的连接, 至少一个发送成功即视为送达
+// 续接后新旧连接共用 outbox, 旧连接注销前同一 outbox 只发送一次, 避免重复缓冲
+func deliverReminder(ctx context.Context, r *xremind.Reminder) bool {
+	response := ReminderEvent{
+		Type: "reminder",
+		Data: ReminderData{
+			ID:             r.ID,
+			Kind:           r.Kind,
+			Character:      r.Character,
+			ConversationID: r.ConversationID,
+			Content:        r.Content,
+			DueAt:          r.LocalDueAt().Format(time.RFC3339),
+		},
+	}
+	delivered := false
+	sent := make(map[*outbox]bool)
+	for _, s := range online(r.UID) {
+		if box := s.outbox(); box != nil {
+			if sent[box] {
+				continue
+			}
+			sent[box] = true
+		}
+		if err := s.Send(response); err != nil {
+			xlog.WarnC(ctx, "推送提醒失败", xlog.String("uid", r.UID), xlog.Err(err))
+			continue
+		}
+		delivered = true
+	}
+	return delivered
+}
+
+// touchScheduler 用户发送消息后安排第二天的问候
+func touchScheduler(ctx context.Context, s *Session) {
+	if scheduler == nil || s.UID == "" {
+		return
+	}
+	if err := scheduler.Touch(s.UID, character.Find(s.Character).Name, s.ConversationID(), s.Location()); err != nil {
+		xlog.ErrorC(ctx, "安排问候失败", xlog.Err(err))
+	}
+}
@@ -0,0 +1,135 @@
+package wss
+
+import (
+	"companions/internal/character"
+	"companions/internal/companion"
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+	"github.com/tidwall/gjson"
+)
+
+// Session 一个 WebSocket 连接的会话状态
+type Session struct {
+	conn *websocket.Conn
+	c    *gin.Context
+
+	UID       string
+	IP        string
+	Character string // 连接时通过 ?character= 选择的角色, 为空时使用默认角色
+	Timezone  string // 连接时通过 ?tz= 上报的 IANA 时区, 如 Asia/Shanghai
+
+	writeMu        sync.Mutex // gorilla/websocket 不支持并发写
+	mu             sync.RWMutex
+	conversationID string
+	expiresAt      time.Time // token 过期时间
+	expiryTimer    *time.Timer
+	frames         []frame // 最近采样的摄像头画面
+	lastFrameAt    time.Time
+	confirms       map[string]chan bool // 等待客户端答复的工具确认, 按请求 id 索引
+	protocol       int                  // 协商的协议版本, 未握手的客户端为 1
+	box            *outbox              // 下行事件缓冲, 续接后换成旧连接的 outbox
+}
+
+// frame 采样的摄像头画面
+type frame struct {
+	image *character.Image
+	at    time.Time
+}
+
+// NewSession uid 为握手鉴权得到的用户, 匿名连接为空
+func NewSession(conn *websocket.Conn, c *gin.Context, uid string) *Session {
+	s := &Session{
+		conn:           conn,
+		c:              c,
+		UID:            uid,
+		IP:             c.ClientIP(),
+		Character:      c.Query("character"),
+		Timezone:       c.Query("tz"),
+		conversationID: c.Query("conversation_id"),
+		protocol:       1,
+	}
+	s.box = openOutbox(s)
+	return s
+}
+
+// Send 线程安全地向客户端发送 JSON 消息, 除只对当前连接有意义的事件外都经过 outbox 编号和缓冲
+func (s *Session) Send(message any) error {
+	data, err := json.Marshal(message)
+	if err != nil {
+		return err
+	}
+	box := s.outbox()
+	if box == nil || transientEvents[gjson.GetBytes(data, "type").String()] {
+		return s.write(data)
+	}
+	return box.send(data)
+}
+
+// write 向当前连接写入编码好的消息
+func (s *Session) write(data []byte) error {
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+	return s.conn.WriteMessage(websocket.TextMessage, data)
+}
+
+func (s *Session) outbox() *outbox {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.box
+}
+
+func (s *Session) setOutbox(box *outbox) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.box = box
+}
+
+// detach 连接断开, outbox 保留一段时间等待续接
+func (s *Session) detach() {
+	if box := s.outbox(); box != nil {
+		box.detach(s)
+	}
+}
+
+// Close 发送关闭帧, 读循环随后结束
+func (s *Session) Close(code int, text string) {
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+	_ = s.conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(code, text), time.Now().Add(time.Second))
+}
+
+// limitKey 限流维度, 登录用户按 uid, 匿名用户按 IP
+func (s *Session) limitKey() string {
+	if s.UID != "" {
+		return "uid:" + s.UID
+	}
+	return "ip:" + s.IP
+}
+
+// Location 用户所在时区, 客户端没有上报或不合法时使用 scheduler.timezone, 再退回服务器时区
+func (s *Session) Location() *time.Location {
+	return companion.Location(s.Timezone)
+}
+
+// Protocol 协商的协议版本
+func (s *Session) Protocol() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.protocol
+}
+
+func (s *Session) ConversationID() string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.conversationID
+}
+
+func (s *Session) SetConversationID(conversationId string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.conversationID = conversationId
+}
@@ -1,6 +1,7 @@
 package wss
 
 import (
+	"companions/internal/conf"
 	_ "embed"
 	"encoding/json"
 	"log"
@@ -11,6 +12,7 @@ import (
 	"github.com/daodao97/xgo/xapp"
 	"github.com/gin-gonic/gin"
 	"github.com/gorilla/websocket"
+	"github.com/spf13/cast"
 )
 
 // 连接统计
@@ -20,43 +22,22 @@ var (
 )
 
 var upgrader = websocket.Upgrader{
-	ReadBufferSize:  1024,
-	WriteBufferSize: 1024,
-	CheckOrigin: func(r *http.Request) bool {
-		return true // 允许跨域连接
-	},
+	ReadBufferSize:   1024,
+	WriteBufferSize:  1024,
+	CheckOrigin:      checkOrigin,
+	Subprotocols:     []string{bearerProtocol},
 	HandshakeTimeout: 45 * time.Second,
 }
 
-// 消息类型定义
-type Message struct {
-	Type string `json:"type"`
-	Data any    `json:"data,omitempty"`
-}
-
-type TextMessage struct {
-	Type string `json:"type"`
-	Data string `json:"data"`
-}
-
-type AudioMessage struct {
-	Type   string `json:"type"`
-	Format string `json:"format"`
-	Size   int    `json:"size"`
-	Data   string `json:"data"`
-}
-
-type PingMessage struct {
-	Type string `json:"type"`
-}
-
-type PongMessage struct {
-	Type      string `json:"type"`
-	Timestamp int64  `json:"timestamp"`
-}
-
 func SetupRouter(e *gin.Engine) {
 	e.GET("/ws", func(c *gin.Context) {
+		creds, err := authenticate(c.Request)
+		if err != nil {
+			log.Printf("WebSocket鉴权失败 IP:%s: %v", c.ClientIP(), err)
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+			return
+		}
+
 		// 连接统计
 		connID := atomic.AddInt64(&totalConnections, 1)
 		atomic.AddInt64(&activeConnections, 1)
@@ -81,13 +62,33 @@ func SetupRouter(e *gin.Engine) {
 		log.Printf("新的WebSocket连接建立 [ID:%d] IP:%s UA:%s (当前活跃连接: %d)", connID, clientIP, userAgent, active)
 
 		// 设置连接参数
-		conn.SetReadLimit(512 * 1024) // 512KB
+		conn.SetReadLimit(readLimit())
 		conn.SetReadDeadline(time.Now().Add(60 * time.Second))
 		conn.SetPongHandler(func(string) error {
 			conn.SetReadDeadline(time.Now().Add(60 * time.Second))
 			return nil
 		})
 
+		session := NewSession(conn, c, creds.UID)
+		session.setExpiry(creds.ExpiresAt)
+		defer session.stopExpiry()
+		defer session.detach()
+
+		release, ok := acquireConnection(c.Request.Context(), session)
+		if !ok {
+			return
+		}
+		defer release()
+
+		// 连接时指定协议版本, 省去一次 hello 往返
+		if version := c.Query("protocol_version"); version != "" {
+			if !negotiate(session, cast.ToInt(version), "") {
+				return
+			}
+		}
+		checkConversation(session)
+		defer register(session)()
+
 		// 处理消息循环
 		for {
 			messageType, p, err := conn.ReadMessage()
@@ -119,7 +120,7 @@ func SetupRouter(e *gin.Engine) {
 			conn.SetReadDeadline(time.Now().Add(60 * time.Second))
 
 			if messageType == websocket.TextMessage {
-				handleMessage(conn, c, p)
+				handleMessage(session, p)
 			}
 		}
 	})
@@ -146,23 +147,55 @@ func SetupRouter(e *gin.Engine) {
 	})
 }
 
-func handleMessage(conn *websocket.Conn, c *gin.Context, data []byte) {
+// readLimit 单条消息大小上限, 至少 512KB, 并能容纳 base64 编码后的最大图片
+func readLimit() int64 {
+	limit := int64(conf.Get().Vision.MaxImageSize)*4/3 + 4*1024
+	return max(limit, 512*1024)
+}
+
+func handleMessage(s *Session, data []byte) {
 	var msg Message
 	if err := json.Unmarshal(data, &msg); err != nil {
 		log.Printf("JSON解析错误: %v", err)
+		sendError(s, "", ErrCodeBadRequest, "消息不是合法的 JSON")
 		return
 	}
 
 	log.Printf("收到消息类型: %s", msg.Type)
 
 	switch msg.Type {
+	case "hello":
+		handleHello(s, data)
+	case "resume":
+		handleResume(s, data)
 	case "ping":
-		handlePing(conn)
+		handlePing(s, data)
+	case "auth":
+		handleAuth(s, data)
 	case "text":
-		handleTextMessage(conn, c, data)
+		if allowMessage(s, msg.RequestID) {
+			s.ack(msg.RequestID)
+			handleTextMessage(s, data)
+		}
 	case "audio":
-		handleAudioMessage(conn, c, data)
+		if allowMessage(s, msg.RequestID) {
+			s.ack(msg.RequestID)
+			handleAudioMessage(s, data)
+		}
+	case "image":
+		if allowMessage(s, msg.RequestID) {
+			s.ack(msg.RequestID)
+			handleImageMessage(s, data)
+		}
+	case "video_frame":
+		// 画面只缓存不发起对话, 不计入消息频率
+		handleVideoFrame(s, data)
+	case "tool_confirm":
+		handleToolConfirm(s, data)
+	case "conversation_new", "conversation_switch", "conversation_list", "conversation_rename", "conversation_delete":
+		handleConversationMessage(s, data)
 	default:
 		log.Printf("未知消息类型: %s", msg.Type)
+		sendError(s, msg.RequestID, ErrCodeUnknownType, "未知消息类型: "+msg.Type)
 	}
 }
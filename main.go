@@ -4,12 +4,14 @@ import (
 	"fmt"
 	"log/slog"
 	"net/http"
+	"strings"
 
 	"github.com/daodao97/xgo/utils"
 	"github.com/daodao97/xgo/xapp"
 	"github.com/daodao97/xgo/xdb"
 	"github.com/daodao97/xgo/xlog"
 	"github.com/daodao97/xgo/xrequest"
+	"github.com/gin-gonic/gin"
 
 	"companions/internal/admin"
 	"companions/internal/api"
@@ -31,6 +33,9 @@ func main() {
 	app := xapp.NewApp().
 		AddStartup(
 			conf.InitConf,
+			func() error {
+				return conf.Get().Validate()
+			},
 			func() error {
 				return xdb.Inits(conf.Get().Database)
 			},
@@ -38,6 +43,7 @@ func main() {
 		AfterStarted(func() {
 			xlog.Debug("version", xlog.String("version", Version))
 			dao.Init()
+			wss.StartScheduler()
 		}).
 		AddServer(xapp.NewHttp(xapp.Args.Bind, h))
 
@@ -49,6 +55,9 @@ func main() {
 func h() http.Handler {
 	e := xapp.NewGin()
 	e.Static("/static", "assets/static")
+	if baseURL := strings.TrimSuffix(conf.Get().Storage.BaseURL, "/"); strings.HasPrefix(baseURL, "/") {
+		e.GET(baseURL+"/*key", gin.WrapH(http.StripPrefix(baseURL, http.HandlerFunc(dao.ServeFiles))))
+	}
 	e.LoadHTMLGlob("assets/*.html")
 
 	wss.SetupRouter(e)